@@ -0,0 +1,182 @@
+// Package agecrypt provides a vault.Backend that encrypts values with age
+// (https://age-encryption.org) before handing them to another backend, so
+// that secrets can be decrypted with an existing age identity and
+// inspected or recovered outside the app, for example with
+//
+//	base64 -d < ~/.local/share/vault-secrets/<entry> | age -d -i key.txt
+//
+// for the Linux file storage, which base64-encodes stored values.
+//
+// Values are stored ASCII-armored, so they are text and pass through every
+// backend, including the ones backed by command-line tools. It is a
+// separate package so that the core package does not depend on age.
+package agecrypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+
+	"ella.to/vault"
+)
+
+// Option configures NewBackend.
+type Option func(*config)
+
+type config struct {
+	recipients []string
+	identities []string
+}
+
+// WithAgeRecipient encrypts values to recipient, an age public key such as
+// "age1...". It can be given several times to encrypt to several
+// recipients, any of which can decrypt the values.
+func WithAgeRecipient(recipient string) Option {
+	return func(c *config) {
+		c.recipients = append(c.recipients, recipient)
+	}
+}
+
+// WithAgeIdentity decrypts values with identity, an age secret key such as
+// "AGE-SECRET-KEY-1...", or the content of an age identity file. Without
+// one, Get fails; values are still encrypted to the identity's recipient if
+// no WithAgeRecipient is given.
+func WithAgeIdentity(identity string) Option {
+	return func(c *config) {
+		c.identities = append(c.identities, identity)
+	}
+}
+
+// backend encrypts values for inner.
+type backend struct {
+	inner      vault.Backend
+	recipients []age.Recipient
+	identities []age.Identity
+}
+
+// NewBackend returns a Backend that stores values in inner encrypted to the
+// recipients given with WithAgeRecipient and decrypts them with the
+// identities given with WithAgeIdentity. At least one recipient is needed,
+// unless every identity is an X25519 one, whose recipient is used then.
+//
+// Values inner already holds that are not age-encrypted are returned as
+// stored, so an existing store can be adopted in place; they are encrypted
+// the next time they are set.
+func NewBackend(inner vault.Backend, opts ...Option) (vault.Backend, error) {
+	if inner == nil {
+		return nil, errors.New("agecrypt: nil backend")
+	}
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	b := &backend{inner: inner}
+	for _, r := range cfg.recipients {
+		recipients, err := age.ParseRecipients(strings.NewReader(r))
+		if err != nil {
+			return nil, fmt.Errorf("agecrypt: invalid recipient: %w", err)
+		}
+		b.recipients = append(b.recipients, recipients...)
+	}
+	for _, id := range cfg.identities {
+		identities, err := age.ParseIdentities(strings.NewReader(id))
+		if err != nil {
+			// The error may quote the secret key
+			return nil, errors.New("agecrypt: invalid identity")
+		}
+		b.identities = append(b.identities, identities...)
+	}
+
+	if len(b.recipients) == 0 {
+		for _, id := range b.identities {
+			x, ok := id.(*age.X25519Identity)
+			if !ok {
+				return nil, errors.New("agecrypt: no recipient, use WithAgeRecipient")
+			}
+			b.recipients = append(b.recipients, x.Recipient())
+		}
+	}
+	if len(b.recipients) == 0 {
+		return nil, errors.New("agecrypt: no recipient, use WithAgeRecipient")
+	}
+	return b, nil
+}
+
+func (b *backend) Set(ctx context.Context, service, key string, value []byte) error {
+	if len(value) == 0 {
+		return vault.ErrInvalidValue
+	}
+	encrypted, err := b.encrypt(value)
+	if err != nil {
+		return err
+	}
+	return b.inner.Set(ctx, service, key, encrypted)
+}
+
+func (b *backend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	stored, err := b.inner.Get(ctx, service, key)
+	if err != nil {
+		return nil, err
+	}
+	return b.decrypt(stored)
+}
+
+func (b *backend) Del(ctx context.Context, service, key string) error {
+	return b.inner.Del(ctx, service, key)
+}
+
+func (b *backend) List(ctx context.Context, service string) ([]string, error) {
+	return b.inner.List(ctx, service)
+}
+
+// encrypt returns value encrypted to the recipients, ASCII-armored.
+func (b *backend) encrypt(value []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, b.recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("agecrypt: failed to encrypt value: %w", err)
+	}
+	if _, err := w.Write(value); err != nil {
+		return nil, fmt.Errorf("agecrypt: failed to encrypt value: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("agecrypt: failed to encrypt value: %w", err)
+	}
+	if err := aw.Close(); err != nil {
+		return nil, fmt.Errorf("agecrypt: failed to encrypt value: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decrypt returns the value encrypted in stored, or stored itself if
+// it is not age-encrypted.
+func (b *backend) decrypt(stored []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(stored), []byte(armor.Header)) {
+		return stored, nil
+	}
+	if len(b.identities) == 0 {
+		return nil, errors.New("agecrypt: value is encrypted but no identity is configured, use WithAgeIdentity")
+	}
+
+	r, err := age.Decrypt(armor.NewReader(bytes.NewReader(stored)), b.identities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return nil, fmt.Errorf("%w: value is not encrypted to any configured identity", vault.ErrForbidden)
+		}
+		return nil, fmt.Errorf("%w: failed to decrypt value: %w", vault.ErrCorrupt, err)
+	}
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decrypt value: %w", vault.ErrCorrupt, err)
+	}
+	return value, nil
+}
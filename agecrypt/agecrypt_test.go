@@ -0,0 +1,171 @@
+package agecrypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+
+	"ella.to/vault"
+)
+
+func newIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity: %v", err)
+	}
+	return id
+}
+
+func TestBackend(t *testing.T) {
+	id := newIdentity(t)
+	inner := vault.NewMemoryBackend()
+	b, err := NewBackend(inner, WithAgeRecipient(id.Recipient().String()), WithAgeIdentity(id.String()))
+	if err != nil {
+		t.Fatalf("NewBackend: %v", err)
+	}
+	ctx := context.Background()
+
+	value := []byte{0, 1, 2, 'x', 0xff}
+	if err := b.Set(ctx, "svc", "key", value); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	got, err := b.Get(ctx, "svc", "key")
+	if err != nil || !bytes.Equal(got, value) {
+		t.Fatalf("Get: got %q, %v, want %q", got, err, value)
+	}
+
+	stored, err := inner.Get(ctx, "svc", "key")
+	if err != nil {
+		t.Fatalf("inner Get: %v", err)
+	}
+	if !bytes.HasPrefix(stored, []byte(armor.Header)) {
+		t.Fatalf("stored value is not armored age: %q", stored)
+	}
+
+	// The stored value can be decrypted with age alone
+	r, err := age.Decrypt(armor.NewReader(bytes.NewReader(stored)), id)
+	if err != nil {
+		t.Fatalf("age.Decrypt: %v", err)
+	}
+	if plain, _ := io.ReadAll(r); !bytes.Equal(plain, value) {
+		t.Fatalf("age.Decrypt: got %q, want %q", plain, value)
+	}
+
+	if keys, err := b.List(ctx, "svc"); err != nil || len(keys) != 1 || keys[0] != "key" {
+		t.Fatalf("List: got %q, %v", keys, err)
+	}
+	if err := b.Del(ctx, "svc", "key"); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+	if _, err := b.Get(ctx, "svc", "key"); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("Get after Del: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestBackendRecipientFromIdentity(t *testing.T) {
+	id := newIdentity(t)
+	b, err := NewBackend(vault.NewMemoryBackend(), WithAgeIdentity(id.String()))
+	if err != nil {
+		t.Fatalf("NewBackend: %v", err)
+	}
+	ctx := context.Background()
+	if err := b.Set(ctx, "svc", "key", []byte("value")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got, err := b.Get(ctx, "svc", "key"); err != nil || string(got) != "value" {
+		t.Fatalf("Get: got %q, %v", got, err)
+	}
+}
+
+func TestBackendWithoutIdentity(t *testing.T) {
+	id := newIdentity(t)
+	b, err := NewBackend(vault.NewMemoryBackend(), WithAgeRecipient(id.Recipient().String()))
+	if err != nil {
+		t.Fatalf("NewBackend: %v", err)
+	}
+	ctx := context.Background()
+	if err := b.Set(ctx, "svc", "key", []byte("value")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := b.Get(ctx, "svc", "key"); err == nil {
+		t.Fatal("Get without an identity: got nil error")
+	}
+}
+
+func TestBackendWrongIdentity(t *testing.T) {
+	inner := vault.NewMemoryBackend()
+	writer, err := NewBackend(inner, WithAgeIdentity(newIdentity(t).String()))
+	if err != nil {
+		t.Fatalf("NewBackend: %v", err)
+	}
+	reader, err := NewBackend(inner, WithAgeIdentity(newIdentity(t).String()))
+	if err != nil {
+		t.Fatalf("NewBackend: %v", err)
+	}
+	ctx := context.Background()
+	if err := writer.Set(ctx, "svc", "key", []byte("value")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := reader.Get(ctx, "svc", "key"); !errors.Is(err, vault.ErrForbidden) {
+		t.Fatalf("Get with another identity: got %v, want ErrForbidden", err)
+	}
+}
+
+func TestBackendReadsPlainValues(t *testing.T) {
+	inner := vault.NewMemoryBackend()
+	ctx := context.Background()
+	if err := inner.Set(ctx, "svc", "key", []byte("legacy")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	b, err := NewBackend(inner, WithAgeIdentity(newIdentity(t).String()))
+	if err != nil {
+		t.Fatalf("NewBackend: %v", err)
+	}
+	if got, err := b.Get(ctx, "svc", "key"); err != nil || string(got) != "legacy" {
+		t.Fatalf("Get: got %q, %v, want legacy", got, err)
+	}
+}
+
+func TestNewBackendInvalid(t *testing.T) {
+	inner := vault.NewMemoryBackend()
+	tests := map[string][]Option{
+		"no recipient":      nil,
+		"invalid recipient": {WithAgeRecipient("age1invalid")},
+		"invalid identity":  {WithAgeIdentity("AGE-SECRET-KEY-1INVALID")},
+	}
+	for name, opts := range tests {
+		if _, err := NewBackend(inner, opts...); err == nil {
+			t.Errorf("%s: got nil error", name)
+		}
+	}
+	if _, err := NewBackend(nil, WithAgeIdentity(newIdentity(t).String())); err == nil {
+		t.Error("nil backend: got nil error")
+	}
+}
+
+func TestBackendCorrupt(t *testing.T) {
+	inner := vault.NewMemoryBackend()
+	b, err := NewBackend(inner, WithAgeIdentity(newIdentity(t).String()))
+	if err != nil {
+		t.Fatalf("NewBackend: %v", err)
+	}
+	ctx := context.Background()
+	if err := b.Set(ctx, "svc", "key", []byte("value")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	stored, _ := inner.Get(ctx, "svc", "key")
+	// Drop the end of the armored ciphertext
+	truncated := append(stored[:len(stored)/2:len(stored)/2], "\n-----END AGE ENCRYPTED FILE-----\n"...)
+	if err := inner.Set(ctx, "svc", "key", truncated); err != nil {
+		t.Fatalf("inner Set: %v", err)
+	}
+	if _, err := b.Get(ctx, "svc", "key"); !errors.Is(err, vault.ErrCorrupt) {
+		t.Errorf("Get of a truncated value: got %v, want ErrCorrupt", err)
+	}
+}
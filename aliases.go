@@ -0,0 +1,132 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// SetAliases stores value under key in each of services, for renaming a
+// service without downtime: during the transition the secret is written
+// under the old and the new name, so readers of either find it. It is all
+// or nothing: the current values are read first, and if a write fails,
+// the aliases already written are restored to them, or deleted if they
+// held nothing, before the error is returned.
+//
+// No backend of this package can write several entries in one
+// transaction, so readers of another alias can see the new value a moment
+// before the others while the writes are in progress, and a process that
+// dies in the middle leaves some aliases written. The writes are
+// serialized with the Vault's other read-modify-writes, and, for the
+// file-based backends on Linux and macOS, with the conditional writes of
+// every process sharing the storage directory, as for CompareAndSwap. If a
+// restore fails too, the returned error reports both failures.
+func SetAliases(services []string, key string, value []byte) error {
+	return std.SetAliasesContext(context.Background(), services, key, value)
+}
+
+// SetAliasesContext is like SetAliases but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage calls
+// complete. Aliases written before ctx is done are restored.
+func SetAliasesContext(ctx context.Context, services []string, key string, value []byte) error {
+	return std.SetAliasesContext(ctx, services, key, value)
+}
+
+// SetAliases stores value under key in each of services, all or nothing,
+// as the package-level SetAliases does.
+func (v *Vault) SetAliases(services []string, key string, value []byte) error {
+	return v.SetAliasesContext(context.Background(), services, key, value)
+}
+
+// SetAliasesContext is like SetAliases but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage calls
+// complete.
+func (v *Vault) SetAliasesContext(ctx context.Context, services []string, key string, value []byte) error {
+	if len(services) == 0 {
+		return &ValidationError{Field: "services", Reason: "is empty", Err: ErrInvalidKey}
+	}
+	for _, service := range services {
+		if err := checkKey(service, key); err != nil {
+			return err
+		}
+	}
+	if err := checkValue(value); err != nil {
+		return err
+	}
+	services = slices.Compact(slices.Sorted(slices.Values(services)))
+
+	v.writeMu.Lock()
+	defer v.writeMu.Unlock()
+	b := v.store()
+	if l, isLocker := b.(locker); isLocker {
+		unlock, err := l.lock(ctx)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	// After the writes, including those of a rollback
+	defer v.cache.invalidate()
+
+	// The stored form of the current values, to restore them exactly
+	type alias struct {
+		service, key string
+		previous     []byte // nil: none
+	}
+	aliases := make([]alias, len(services))
+	for i, service := range services {
+		ms, mk := v.mapKey(service, key)
+		previous, err := b.Get(ctx, ms, mk)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if err := checkSize(ctx, b, value); err != nil {
+			return err
+		}
+		if err := v.checkQuota(ctx, b, ms, mk); err != nil {
+			return err
+		}
+		aliases[i] = alias{ms, mk, previous}
+	}
+
+	// Back up the services written, even if restored
+	written := 0
+	defer func() {
+		for _, a := range aliases[:written] {
+			v.backupChanged(b, a.service)
+		}
+	}()
+	for i, a := range aliases {
+		written = i + 1
+		opCtx, done := v.start(ctx, "set", services[i], key)
+		err := b.Set(opCtx, a.service, a.key, value)
+		if err == nil {
+			err = v.tagOwner(opCtx, b, a.service, a.key, value)
+		}
+		done(err)
+		if err == nil {
+			continue
+		}
+
+		// Restore even if ctx is done
+		restoreCtx := context.WithoutCancel(ctx)
+		var restoreErrs []error
+		for _, written := range slices.Backward(aliases[:i]) {
+			var restoreErr error
+			if written.previous != nil {
+				restoreErr = b.Set(restoreCtx, written.service, written.key, written.previous)
+			} else if restoreErr = b.Del(restoreCtx, written.service, written.key); errors.Is(restoreErr, ErrNotFound) {
+				restoreErr = nil
+			}
+			if restoreErr != nil {
+				restoreErrs = append(restoreErrs, fmt.Errorf("vault: failed to restore service %q: %w", written.service, restoreErr))
+			}
+		}
+		if restoreErrs != nil {
+			return errors.Join(append([]error{err}, restoreErrs...)...)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// failOnBackend fails the Set calls for one service.
+type failOnBackend struct {
+	Backend
+	service string
+	err     error
+}
+
+func (b failOnBackend) Set(ctx context.Context, service, key string, value []byte) error {
+	if service == b.service {
+		return b.err
+	}
+	return b.Backend.Set(ctx, service, key, value)
+}
+
+func TestSetAliases(t *testing.T) {
+	v, _ := newTestVault(t)
+	if err := v.SetAliases([]string{"old-app", "new-app", "old-app"}, "token", []byte("v1")); err != nil {
+		t.Fatalf("SetAliases failed: %v", err)
+	}
+	for _, service := range []string{"old-app", "new-app"} {
+		if got, err := v.Get(service, "token"); err != nil || string(got) != "v1" {
+			t.Errorf("Get(%s) = %q, %v, want v1", service, got, err)
+		}
+	}
+
+	if err := v.SetAliases(nil, "token", []byte("v1")); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("SetAliases without services = %v, want ErrInvalidKey", err)
+	}
+	if err := v.SetAliases([]string{"app", ""}, "token", []byte("v1")); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("SetAliases with an empty service = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestSetAliasesRollback(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryBackend()
+	mem.Set(ctx, "a-app", "token", []byte("old"))
+	failure := errors.New("disk full")
+	v, err := New(WithBackend(failOnBackend{mem, "c-app", failure}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// a-app and b-app are written before c-app fails
+	if err := v.SetAliases([]string{"a-app", "b-app", "c-app"}, "token", []byte("new")); !errors.Is(err, failure) {
+		t.Fatalf("SetAliases = %v, want %v", err, failure)
+	}
+	if got, err := mem.Get(ctx, "a-app", "token"); err != nil || string(got) != "old" {
+		t.Errorf("a-app after rollback = %q, %v, want old", got, err)
+	}
+	if _, err := mem.Get(ctx, "b-app", "token"); err != ErrNotFound {
+		t.Errorf("b-app after rollback = %v, want ErrNotFound", err)
+	}
+}
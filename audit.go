@@ -0,0 +1,130 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// auditKeySize is the size of the random keys audit logs hash key names
+// with.
+const auditKeySize = 32
+
+// auditLog serializes the lines written to an audit writer.
+type auditLog struct {
+	mu  sync.Mutex
+	w   io.Writer
+	key []byte // the HMAC key of key names
+}
+
+// newAuditLog returns an audit log writing to w that hashes key names with
+// key, or with a random key if key is nil.
+func newAuditLog(w io.Writer, key []byte) *auditLog {
+	if key == nil {
+		key = make([]byte, auditKeySize)
+		rand.Read(key)
+	}
+	return &auditLog{w: w, key: bytes.Clone(key)}
+}
+
+var audit atomic.Pointer[auditLog]
+
+// auditRecord is one line of the audit log.
+type auditRecord struct {
+	Time    time.Time `json:"time"`
+	Op      string    `json:"op"`
+	Service string    `json:"service"`
+	KeyHash string    `json:"key_hash,omitempty"`
+	Result  string    `json:"result"`
+}
+
+// SetAuditLog makes every operation reported to the hook also append one
+// JSON line to w, such as a file opened with os.O_APPEND:
+//
+//	{"time":"2025-01-02T15:04:05.999Z","op":"get","service":"myapp","key_hash":"9f86d0...","result":"ok"}
+//
+// The key is recorded as the hex HMAC-SHA256 of its name, keyed with a
+// random key of the log, so that the log does not reveal key names and
+// they cannot be found by hashing guesses. The lines of one log can be
+// correlated by key, but not with those of another log, or of the same
+// writer after another SetAuditLog call; use SetAuditLogKey for hashes
+// that can. Values are never written. result is "ok", "not_found" or
+// "error"; error messages are left out because some carry tool output.
+// Lines are written with a single Write call each, one at a time, so w
+// needs no locking of its own. Write errors are ignored: the audit log
+// never makes an operation fail. Passing nil stops logging.
+func SetAuditLog(w io.Writer) {
+	if w == nil {
+		audit.Store(nil)
+		return
+	}
+	audit.Store(newAuditLog(w, nil))
+}
+
+// SetAuditLogKey is like SetAuditLog but hashes key names with key, so
+// that the logs written with the same key, for example across restarts,
+// can be correlated. key must be at least 16 bytes, and should be random
+// and kept secret: with it, the hashes can be checked against guessed
+// names.
+func SetAuditLogKey(w io.Writer, key []byte) error {
+	if err := checkAuditKey(key); err != nil {
+		return err
+	}
+	if w == nil {
+		audit.Store(nil)
+		return nil
+	}
+	audit.Store(newAuditLog(w, key))
+	return nil
+}
+
+// checkAuditKey validates a key set with SetAuditLogKey or WithAuditKey.
+func checkAuditKey(key []byte) error {
+	if key != nil && len(key) < minIntegrityKeySize {
+		return fmt.Errorf("%w: audit key is shorter than %d bytes", ErrInvalidValue, minIntegrityKeySize)
+	}
+	return nil
+}
+
+func (l *auditLog) record(e Event) {
+	rec := auditRecord{
+		Time:    now().UTC(),
+		Op:      e.Op,
+		Service: e.Service,
+		Result:  auditResult(e.Err),
+	}
+	if e.Key != "" {
+		mac := hmac.New(sha256.New, l.key)
+		mac.Write([]byte(e.Key))
+		rec.KeyHash = hex.EncodeToString(mac.Sum(nil))
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(line)
+}
+
+func auditResult(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	default:
+		return "error"
+	}
+}
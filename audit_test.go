@@ -0,0 +1,156 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	useMemory(t)
+	var buf bytes.Buffer
+	key := []byte("0123456789abcdef")
+	if err := SetAuditLogKey(&buf, key); err != nil {
+		t.Fatalf("SetAuditLogKey failed: %v", err)
+	}
+	t.Cleanup(func() { SetAuditLog(nil) })
+	at := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	setNow(t, at)
+
+	if err := Set(testService, "api-key", []byte("s3cret-value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	_, _ = Get(testService, "missing")
+	if _, err := List(testService); err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	if strings.Contains(buf.String(), "s3cret-value") || strings.Contains(buf.String(), "api-key") {
+		t.Errorf("audit log leaks the value or key name:\n%s", buf.String())
+	}
+
+	want := []auditRecord{
+		{Time: at, Op: "set", Service: testService, KeyHash: hashKey(key, "api-key"), Result: "ok"},
+		{Time: at, Op: "get", Service: testService, KeyHash: hashKey(key, "missing"), Result: "not_found"},
+		{Time: at, Op: "list", Service: testService, Result: "ok"},
+	}
+	var got []auditRecord
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		got = append(got, rec)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("audit log has %d lines, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Op != want[i].Op || got[i].Service != want[i].Service ||
+			got[i].KeyHash != want[i].KeyHash || got[i].Result != want[i].Result {
+			t.Errorf("line %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func hashKey(auditKey []byte, key string) string {
+	mac := hmac.New(sha256.New, auditKey)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// TestAuditLogKeys checks that key names are hashed with a key of their
+// log, random unless set.
+func TestAuditLogKeys(t *testing.T) {
+	hashes := func(opts ...Option) []string {
+		t.Helper()
+		var buf bytes.Buffer
+		v, err := New(append([]Option{WithBackend(NewMemoryBackend()), WithAuditLog(&buf)}, opts...)...)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		_, _ = v.Get(testService, "api-key")
+		_, _ = v.Get(testService, "api-key")
+		var hashes []string
+		for line := range strings.Lines(buf.String()) {
+			var rec auditRecord
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatalf("line %q is not JSON: %v", line, err)
+			}
+			hashes = append(hashes, rec.KeyHash)
+		}
+		if len(hashes) != 2 || hashes[0] != hashes[1] {
+			t.Fatalf("key hashes of one log = %q, want two equal ones", hashes)
+		}
+		return hashes
+	}
+
+	if a, b := hashes(), hashes(); a[0] == b[0] {
+		t.Errorf("two Vaults hash a key name the same, %s, without WithAuditKey", a[0])
+	}
+	unsalted := sha256.Sum256([]byte("api-key"))
+	if got := hashes()[0]; got == hex.EncodeToString(unsalted[:]) {
+		t.Error("key hash is the unkeyed SHA-256 of the name")
+	}
+	key := []byte("0123456789abcdef")
+	if got := hashes(WithAuditKey(key))[0]; got != hashKey(key, "api-key") {
+		t.Errorf("key hash with WithAuditKey = %s, want %s", got, hashKey(key, "api-key"))
+	}
+
+	if _, err := New(WithAuditKey([]byte("short"))); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("New with a short audit key = %v, want ErrInvalidValue", err)
+	}
+	if err := SetAuditLogKey(&bytes.Buffer{}, []byte("short")); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("SetAuditLogKey with a short key = %v, want ErrInvalidValue", err)
+	}
+}
+
+// lineWriter fails the test if a Write is not a whole line or overlaps
+// another one.
+type lineWriter struct {
+	t     *testing.T
+	busy  sync.Mutex
+	lines int
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if !w.busy.TryLock() {
+		w.t.Error("concurrent Write")
+		return len(p), nil
+	}
+	defer w.busy.Unlock()
+	if !bytes.HasSuffix(p, []byte("\n")) || bytes.Count(p, []byte("\n")) != 1 {
+		w.t.Errorf("Write(%q) is not one line", p)
+	}
+	w.lines++
+	return len(p), nil
+}
+
+func TestAuditLogConcurrent(t *testing.T) {
+	useMemory(t)
+	w := &lineWriter{t: t}
+	SetAuditLog(w)
+	t.Cleanup(func() { SetAuditLog(nil) })
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 50 {
+				_ = Set(testService, "key", []byte("value"))
+			}
+		})
+	}
+	wg.Wait()
+	if w.lines != 8*50 {
+		t.Errorf("audit log has %d lines, want %d", w.lines, 8*50)
+	}
+}
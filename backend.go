@@ -0,0 +1,243 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Backend is a secret store. Implementations must be safe for concurrent
+// use. Backends can wrap other backends to add behavior, such as
+// NewRestrictedBackend does.
+type Backend interface {
+	// Set stores value under service and key, overwriting any existing value.
+	Set(ctx context.Context, service, key string, value []byte) error
+
+	// Get returns the value stored under service and key, or ErrNotFound.
+	Get(ctx context.Context, service, key string) ([]byte, error)
+
+	// Del removes the value stored under service and key, or returns
+	// ErrNotFound if there is none.
+	Del(ctx context.Context, service, key string) error
+
+	// List returns the keys stored under service. A service without keys
+	// yields an empty list, not ErrNotFound.
+	List(ctx context.Context, service string) ([]string, error)
+}
+
+// syncer is implemented by backends that can flush writes to stable
+// storage.
+type syncer interface {
+	sync() error
+}
+
+// rawGetter is implemented by backends that can return a value as stored,
+// before decoding.
+type rawGetter interface {
+	getRaw(ctx context.Context, service, key string) ([]byte, error)
+}
+
+// backendBox lets backends of different types share an atomic.Pointer.
+type backendBox struct {
+	Backend
+}
+
+var defaultBackend atomic.Pointer[backendBox]
+
+// SetDefaultBackend makes the package-level functions (Set, Get, Del, List,
+// their Context variants, Resolve and the schema version functions) use b
+// instead of the platform's native storage. Passing nil restores the
+// native storage.
+func SetDefaultBackend(b Backend) {
+	defer invalidateGetCache()
+	if b == nil {
+		defaultBackend.Store(nil)
+		return
+	}
+	defaultBackend.Store(&backendBox{b})
+}
+
+// currentBackend returns the backend the package-level functions use.
+func currentBackend() Backend {
+	if box := defaultBackend.Load(); box != nil {
+		return box.Backend
+	}
+	if b := envDefaultBackend(); b != nil {
+		return b
+	}
+	return nativeBackend{}
+}
+
+// NativeOption configures the native storage returned by NativeBackend.
+// Options that do not apply to the current platform are ignored.
+type NativeOption func(*nativeConfig)
+
+type nativeConfig struct {
+	windowsPersistence WindowsPersistence
+
+	macInternetPassword bool
+	macProtocol         string
+	userPresence        bool
+
+	linuxSessionKeyring  bool
+	secretToolCollection string
+
+	goKeyring bool
+
+	separator    string
+	encodedNames bool
+
+	commands *commandLimiter // nil: defaultCommandLimiter
+}
+
+type nativeConfigKey struct{}
+
+// nativeConfigFrom returns the configuration of the native backend an
+// operation runs under. The platform implementations read it from ctx so
+// that their signatures stay the same for every backend configuration.
+func nativeConfigFrom(ctx context.Context) nativeConfig {
+	cfg, _ := ctx.Value(nativeConfigKey{}).(nativeConfig)
+	return cfg
+}
+
+// NativeBackend returns the platform's native secure storage, the storage
+// the package-level functions use unless SetDefaultBackend is called, as a
+// Backend.
+func NativeBackend(opts ...NativeOption) Backend {
+	var b nativeBackend
+	for _, opt := range opts {
+		opt(&b.cfg)
+	}
+	return b
+}
+
+type nativeBackend struct {
+	cfg nativeConfig
+}
+
+func (b nativeBackend) context(ctx context.Context) context.Context {
+	if b.cfg == (nativeConfig{}) {
+		return ctx
+	}
+	return context.WithValue(ctx, nativeConfigKey{}, b.cfg)
+}
+
+func (b nativeBackend) Set(ctx context.Context, service, key string, value []byte) error {
+	if !validBackendKey(service, key) {
+		return ErrInvalidKey
+	}
+	if len(value) == 0 {
+		return ErrInvalidValue
+	}
+	if b.cfg.userPresence {
+		return errNoUserPresence
+	}
+	ctx = b.context(ctx)
+	if err := set(ctx, service, key, value); err != nil {
+		return err
+	}
+	// Move an item stored under its unencoded name, ignoring failures as
+	// the value is stored
+	_ = removeLegacyName(ctx, service, key)
+	return nil
+}
+
+func (b nativeBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	if !validBackendKey(service, key) {
+		return nil, ErrInvalidKey
+	}
+	return withLegacyName(b.context(ctx), service, key, func(ctx context.Context) ([]byte, error) {
+		return get(ctx, service, key)
+	})
+}
+
+func (b nativeBackend) Del(ctx context.Context, service, key string) error {
+	if !validBackendKey(service, key) {
+		return ErrInvalidKey
+	}
+	return delNamed(b.context(ctx), service, key)
+}
+
+func (b nativeBackend) List(ctx context.Context, service string) ([]string, error) {
+	if service == "" {
+		return nil, ErrInvalidKey
+	}
+	keys, err := listNamed(b.context(ctx), service)
+	if err != nil {
+		return nil, err
+	}
+	return withoutReservedKeys(keys), nil
+}
+
+func (b nativeBackend) getRaw(ctx context.Context, service, key string) ([]byte, error) {
+	return withLegacyName(b.context(ctx), service, key, func(ctx context.Context) ([]byte, error) {
+		return getRaw(ctx, service, key)
+	})
+}
+
+func (b nativeBackend) metadata(ctx context.Context, service, key string) (Metadata, error) {
+	if !validBackendKey(service, key) {
+		return Metadata{}, ErrInvalidKey
+	}
+	return withLegacyName(b.context(ctx), service, key, func(ctx context.Context) (Metadata, error) {
+		return metadata(ctx, service, key)
+	})
+}
+
+// setReader streams to the platform's file storage when it is in use, and
+// otherwise stores the value as Set does.
+func (b nativeBackend) setReader(ctx context.Context, service, key string, r io.Reader) error {
+	if !validBackendKey(service, key) {
+		return ErrInvalidKey
+	}
+	if b.cfg.userPresence {
+		return errNoUserPresence
+	}
+	if files := activeFiles(b.context(ctx)); files != nil {
+		return files.setReader(b.context(ctx), service, key, r)
+	}
+	return setBuffered(ctx, b, service, key, r)
+}
+
+func (b nativeBackend) getReader(ctx context.Context, service, key string) (io.ReadCloser, error) {
+	if !validBackendKey(service, key) {
+		return nil, ErrInvalidKey
+	}
+	if files := activeFiles(b.context(ctx)); files != nil {
+		return files.getReader(b.context(ctx), service, key)
+	}
+	value, err := b.Get(ctx, service, key)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(value)), nil
+}
+
+func (b nativeBackend) verify(ctx context.Context, repair bool) ([]Problem, error) {
+	files := activeFiles(b.context(ctx))
+	if files == nil {
+		return nil, errNoFileStorage
+	}
+	return files.verify(ctx, repair)
+}
+
+func (nativeBackend) sync() error {
+	return syncStorage()
+}
+
+// errNoRaw and errNoMetadata are returned for backends that do not expose
+// stored bytes or metadata.
+var (
+	errNoRaw      = fmt.Errorf("vault: backend does not expose stored bytes: %w", errors.ErrUnsupported)
+	errNoMetadata = fmt.Errorf("vault: backend does not record metadata: %w", errors.ErrUnsupported)
+)
+
+// validBackendKey reports whether service and key can address an entry in
+// a backend. Unlike validKey it accepts the package's reserved keys, which
+// the package-level functions store through the default backend.
+func validBackendKey(service, key string) bool {
+	return service != "" && key != ""
+}
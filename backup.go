@@ -0,0 +1,181 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// WithBackupSink sends an encrypted backup of a service to sink whenever
+// a write through the Vault changes it: Set and its variants, Del,
+// SetIfAbsent, a CompareAndSwap that swaps, Store, Touch, SetAliases and a
+// PurgeExpired that removes secrets. It keeps a continuous
+// disaster-recovery copy of the secrets, for example in a file on another
+// volume or an object store.
+//
+// Each backup holds every secret of the service as stored, and is a vault
+// file as NewEncryptedSingleFileBackend keeps: write it to a file and open
+// that with passphrase to restore it. Nothing is ever passed to sink
+// unencrypted. The key is derived from passphrase, with the default KDF,
+// once for the Vault, and each backup is sealed with a new nonce.
+//
+// Backups run on a goroutine of the Vault, one at a time, so Set and Del
+// only wait to queue the service. Writes made while a backup runs are
+// covered by the next one, and a service changed several times meanwhile
+// is backed up once. Each backup is reported to the hooks and audit log
+// as an Event with Op "backup" and the service as stored, whose Err is
+// the error of reading the service or of sink. Close waits for queued
+// backups.
+func WithBackupSink(sink func([]byte) error, passphrase []byte) Option {
+	return func(v *Vault) {
+		v.backups = &backupSink{sink: sink, passphrase: bytes.Clone(passphrase)}
+	}
+}
+
+// backupSink queues and runs the backups of a Vault.
+type backupSink struct {
+	sink       func([]byte) error
+	passphrase []byte // cleared once the key is derived
+
+	mu      sync.Mutex
+	pending []backupJob // without repeats
+	running bool
+	idle    sync.WaitGroup // held while running
+
+	// The key and header of the backups, made by the first
+	aead   cipher.AEAD
+	header []byte
+}
+
+// backupJob is a service to back up, from the backend it was written to.
+type backupJob struct {
+	b       Backend
+	service string
+}
+
+func checkBackupSink(s *backupSink) error {
+	if s != nil && (s.sink == nil || len(s.passphrase) == 0) {
+		return errors.New("vault: WithBackupSink needs a sink and a passphrase")
+	}
+	return nil
+}
+
+// backupChanged queues a backup of service, stored in b, after a write
+// through the Vault changed it.
+func (v *Vault) backupChanged(b Backend, service string) {
+	s := v.backups
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := backupJob{b, service}
+	for _, queued := range s.pending {
+		if queued == job {
+			return
+		}
+	}
+	s.pending = append(s.pending, job)
+	if !s.running {
+		s.running = true
+		s.idle.Add(1)
+		go v.runBackups()
+	}
+}
+
+// runBackups backs up the queued services until none is left.
+func (v *Vault) runBackups() {
+	s := v.backups
+	defer s.idle.Done()
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+		job := s.pending[0]
+		s.pending = s.pending[1:]
+		s.mu.Unlock()
+
+		ctx, done := v.start(context.Background(), "backup", job.service, "")
+		done(s.backup(ctx, job))
+	}
+}
+
+// waitBackups returns once the queued backups have run, for Close.
+func (v *Vault) waitBackups() {
+	if v.backups != nil {
+		v.backups.idle.Wait()
+	}
+}
+
+// backup seals the secrets of job's service and passes them to the sink.
+// Only runBackups calls it, so it needs no lock for the key.
+func (s *backupSink) backup(ctx context.Context, job backupJob) error {
+	if s.aead == nil {
+		var header memoryHeader
+		aead, err := openKey(&header, s.passphrase, encryptedConfig{})
+		if err != nil {
+			return err
+		}
+		clear(s.passphrase)
+		s.aead, s.header = aead, header.data
+	}
+
+	keys, err := job.b.List(ctx, job.service)
+	if err != nil {
+		return fmt.Errorf("vault: failed to read service for backup: %w", err)
+	}
+	values := make(map[string][]byte, len(keys))
+	entries := singleFileEntries{job.service: values}
+	defer clearEntries(entries)
+	for _, key := range keys {
+		value, err := job.b.Get(ctx, job.service, key)
+		if errors.Is(err, ErrNotFound) {
+			// Deleted since List
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("vault: failed to read service for backup: %w", err)
+		}
+		values[key] = value
+	}
+
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	doc := singleFileDoc{Version: singleFileVersion, Header: s.header, Entries: s.aead.Seal(nil, nil, plain, nil)}
+	clear(plain)
+	data, err := json.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	if err := s.sink(data); err != nil {
+		return fmt.Errorf("vault: backup sink failed: %w", err)
+	}
+	return nil
+}
+
+// memoryHeader is a key header held in memory.
+type memoryHeader struct {
+	data []byte
+}
+
+func (h *memoryHeader) load() ([]byte, error) {
+	if h.data == nil {
+		return nil, fs.ErrNotExist
+	}
+	return h.data, nil
+}
+
+func (h *memoryHeader) create(data []byte) error {
+	h.data = data
+	return nil
+}
@@ -0,0 +1,218 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// backupRecorder is a backup sink that keeps what it is sent.
+type backupRecorder struct {
+	mu      sync.Mutex
+	backups [][]byte
+}
+
+func (r *backupRecorder) sink(data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.backups = append(r.backups, bytes.Clone(data))
+	return nil
+}
+
+// restoreBackup opens data as a vault file.
+func restoreBackup(t *testing.T, data, passphrase []byte) Backend {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "backup.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewEncryptedSingleFileBackend(path, passphrase)
+	if err != nil {
+		t.Fatalf("NewEncryptedSingleFileBackend of a backup failed: %v", err)
+	}
+	return b
+}
+
+func TestBackupSink(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	passphrase := []byte("backup passphrase")
+	var r backupRecorder
+	v, err := New(WithBackend(NewMemoryBackend()), WithBackupSink(r.sink, passphrase))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := v.Set(testService, key, []byte("plaintext-"+key)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if err := v.Del(testService, "b"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if err := v.Set("other", "d", []byte("plaintext-d")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := v.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if len(r.backups) == 0 {
+		t.Fatal("no backup sent")
+	}
+	for _, data := range r.backups {
+		if bytes.Contains(data, []byte("plaintext")) {
+			t.Fatalf("backup holds a secret unencrypted: %s", data)
+		}
+	}
+
+	// The last backup of each service holds its final state, alone
+	backups := map[string]Backend{}
+	for _, data := range r.backups {
+		b := restoreBackup(t, data, passphrase)
+		for _, service := range []string{testService, "other"} {
+			if keys, _ := b.List(ctx, service); len(keys) > 0 {
+				backups[service] = b
+			}
+		}
+	}
+	if keys, err := backups[testService].List(ctx, testService); err != nil || !slices.Equal(slices.Sorted(slices.Values(keys)), []string{"a", "c"}) {
+		t.Errorf("backup of %s lists %q, %v, want [a c]", testService, keys, err)
+	}
+	if value, err := backups[testService].Get(ctx, testService, "c"); err != nil || string(value) != "plaintext-c" {
+		t.Errorf("backup Get = %q, %v, want the value set", value, err)
+	}
+	if keys, _ := backups[testService].List(ctx, "other"); len(keys) != 0 {
+		t.Errorf("backup of %s holds other services: %q", testService, keys)
+	}
+	if _, err := backups["other"].Get(ctx, "other", "d"); err != nil {
+		t.Errorf("backup of other: Get = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "backup.json")
+	if err := os.WriteFile(path, r.backups[0], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEncryptedSingleFileBackend(path, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("opening a backup with another passphrase = %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestBackupSinkError(t *testing.T) {
+	fastKDF(t)
+	errSink := errors.New("sink unreachable")
+	var (
+		mu     sync.Mutex
+		events []Event
+	)
+	v, err := New(
+		WithBackend(NewMemoryBackend()),
+		WithBackupSink(func([]byte) error { return errSink }, []byte("passphrase")),
+		WithHook(func(e Event) {
+			if e.Op == "backup" {
+				mu.Lock()
+				events = append(events, e)
+				mu.Unlock()
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := v.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set = %v, want the write to succeed regardless of the sink", err)
+	}
+	v.Close()
+
+	if len(events) != 1 || events[0].Service != testService || !errors.Is(events[0].Err, errSink) {
+		t.Errorf("backup events = %+v, want one reporting the sink's error", events)
+	}
+
+	if _, err := New(WithBackupSink(nil, []byte("passphrase"))); err == nil {
+		t.Error("New with a nil backup sink succeeded")
+	}
+	if _, err := New(WithBackupSink(func([]byte) error { return nil }, nil)); err == nil {
+		t.Error("New with an empty backup passphrase succeeded")
+	}
+}
+
+// TestBackupSinkWrites checks that every write through the Vault that
+// changes a service is backed up, and only those.
+func TestBackupSinkWrites(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	start := time.Unix(1_700_000_000, 0)
+	setNow(t, start)
+	passphrase := []byte("backup passphrase")
+	var r backupRecorder
+	v, err := New(WithBackend(NewMemoryBackend()), WithBackupSink(r.sink, passphrase))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer v.Close()
+
+	// last returns the value of key in the last backup, once it has run
+	backups := 0
+	last := func(op, key string) string {
+		t.Helper()
+		v.waitBackups()
+		if len(r.backups) != backups+1 {
+			t.Fatalf("%s sent %d backups, want 1", op, len(r.backups)-backups)
+		}
+		backups = len(r.backups)
+		value, err := restoreBackup(t, r.backups[backups-1], passphrase).Get(ctx, testService, key)
+		if errors.Is(err, ErrNotFound) {
+			return ""
+		}
+		if err != nil {
+			t.Fatalf("Get from the backup after %s failed: %v", op, err)
+		}
+		return string(value)
+	}
+
+	if ok, err := v.SetIfAbsent(testService, "key", []byte("first")); !ok || err != nil {
+		t.Fatalf("SetIfAbsent = %v, %v", ok, err)
+	}
+	if got := last("SetIfAbsent", "key"); got != "first" {
+		t.Errorf("backup after SetIfAbsent holds %q, want first", got)
+	}
+	if ok, err := v.CompareAndSwap(testService, "key", []byte("first"), []byte("second")); !ok || err != nil {
+		t.Fatalf("CompareAndSwap = %v, %v", ok, err)
+	}
+	if got := last("CompareAndSwap", "key"); got != "second" {
+		t.Errorf("backup after CompareAndSwap holds %q, want second", got)
+	}
+	if ok, err := v.CompareAndSwap(testService, "key", []byte("first"), []byte("third")); ok || err != nil {
+		t.Fatalf("CompareAndSwap of another value = %v, %v", ok, err)
+	}
+	handle, err := v.Store(testService, []byte("stored"))
+	if err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if got := last("Store", handle); got != "stored" {
+		t.Errorf("backup after Store holds %q, want stored", got)
+	}
+
+	if err := v.SetWithTTL(testService, "token", []byte("token"), time.Minute); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	last("SetWithTTL", "token")
+	if err := v.Touch(testService, "token", time.Minute); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	last("Touch", "token")
+	setNow(t, start.Add(time.Hour))
+	if n, err := v.PurgeExpired(testService); n != 1 || err != nil {
+		t.Fatalf("PurgeExpired = %d, %v, want 1", n, err)
+	}
+	if got := last("PurgeExpired", "token"); got != "" {
+		t.Errorf("backup after PurgeExpired holds %q, want none", got)
+	}
+}
@@ -0,0 +1,133 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// KeyErrors reports the keys a batch operation failed for, mapped to the
+// error for each key. errors.Is and errors.As look through it, so
+// errors.Is(err, ErrNotFound) reports whether any key was missing.
+type KeyErrors map[string]error
+
+func (e KeyErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "vault: %d keys failed", len(e))
+	for i, key := range keys {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "%q: %v", key, e[key])
+	}
+	return b.String()
+}
+
+// Unwrap returns the per-key errors.
+func (e KeyErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// GetMany retrieves several keys of service at once. It returns the values
+// it found even when some keys fail: a missing key is reported as
+// ErrNotFound for that key in a KeyErrors error, alongside any other
+// per-key failures, and does not affect the other keys. The error is nil
+// only if every key was found.
+func GetMany(service string, keys ...string) (map[string][]byte, error) {
+	return GetManyContext(context.Background(), service, keys...)
+}
+
+// GetManyContext is like GetMany but stops fetching and reports ctx.Err()
+// for the remaining keys once ctx is done.
+func GetManyContext(ctx context.Context, service string, keys ...string) (map[string][]byte, error) {
+	return std.GetManyContext(ctx, service, keys...)
+}
+
+// GetMany retrieves several keys of service at once, as the package-level
+// GetMany does.
+func (v *Vault) GetMany(service string, keys ...string) (map[string][]byte, error) {
+	return v.GetManyContext(context.Background(), service, keys...)
+}
+
+// GetManyContext is like GetMany but stops fetching and reports ctx.Err()
+// for the remaining keys once ctx is done.
+func (v *Vault) GetManyContext(ctx context.Context, service string, keys ...string) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+	var errs KeyErrors
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		value, err := v.GetContext(ctx, service, key)
+		if err != nil {
+			if errs == nil {
+				errs = make(KeyErrors)
+			}
+			errs[key] = err
+			continue
+		}
+		values[key] = value
+	}
+
+	if errs != nil {
+		return values, errs
+	}
+	return values, nil
+}
+
+// GetAll returns every secret stored under service, mapped by key, for
+// loading a service's configuration in one call. A service without keys
+// yields an empty map. Keys deleted or expired between listing and reading
+// are left out; other failures are reported per key in a KeyErrors error,
+// as with GetMany, alongside the values that were read. The values are
+// copies owned by the caller, who should zero them once done.
+func GetAll(service string) (map[string][]byte, error) {
+	return std.GetAllContext(context.Background(), service)
+}
+
+// GetAllContext is like GetAll but stops fetching and reports ctx.Err()
+// once ctx is done.
+func GetAllContext(ctx context.Context, service string) (map[string][]byte, error) {
+	return std.GetAllContext(ctx, service)
+}
+
+// GetAll returns every secret stored under service, as the package-level
+// GetAll does.
+func (v *Vault) GetAll(service string) (map[string][]byte, error) {
+	return v.GetAllContext(context.Background(), service)
+}
+
+// GetAllContext is like GetAll but stops fetching and reports ctx.Err()
+// once ctx is done.
+func (v *Vault) GetAllContext(ctx context.Context, service string) (map[string][]byte, error) {
+	keys, err := v.ListContext(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	values, err := v.GetManyContext(v.listedContext(ctx), service, keys...)
+	var errs KeyErrors
+	if errors.As(err, &errs) {
+		maps.DeleteFunc(errs, func(_ string, err error) bool {
+			return errors.Is(err, ErrNotFound)
+		})
+		if len(errs) == 0 {
+			return values, nil
+		}
+	}
+	return values, err
+}
@@ -0,0 +1,89 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetMany(t *testing.T) {
+	useMemory(t)
+	service := "vault-test-batch-service"
+
+	for _, key := range []string{"a", "c"} {
+		if err := Set(service, key, []byte("value-"+key)); err != nil {
+			t.Fatalf("Set %q failed: %v", key, err)
+		}
+	}
+
+	values, err := GetMany(service, "a", "b", "c", "")
+	if len(values) != 2 || string(values["a"]) != "value-a" || string(values["c"]) != "value-c" {
+		t.Errorf("GetMany returned %q, want a and c", values)
+	}
+
+	var keyErrs KeyErrors
+	if !errors.As(err, &keyErrs) {
+		t.Fatalf("GetMany error = %v, want KeyErrors", err)
+	}
+	if len(keyErrs) != 2 {
+		t.Errorf("KeyErrors = %v, want errors for b and the empty key", keyErrs)
+	}
+	if keyErrs["b"] != ErrNotFound {
+		t.Errorf("error for b = %v, want ErrNotFound", keyErrs["b"])
+	}
+	if !errors.Is(keyErrs[""], ErrInvalidKey) {
+		t.Errorf("error for empty key = %v, want ErrInvalidKey", keyErrs[""])
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("errors.Is(err, ErrNotFound) = false, want true")
+	}
+
+	values, err = GetMany(service, "a", "c")
+	if err != nil || len(values) != 2 {
+		t.Errorf("GetMany of present keys = %q, %v, want both and no error", values, err)
+	}
+}
+
+func TestGetManyCanceled(t *testing.T) {
+	useMemory(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	values, err := GetManyContext(ctx, "vault-test-batch-service", "a", "b")
+	if len(values) != 0 {
+		t.Errorf("GetManyContext returned %q, want nothing", values)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetManyContext error = %v, want context.Canceled", err)
+	}
+}
+
+func TestGetAll(t *testing.T) {
+	useMemory(t)
+	service := "vault-test-batch-service"
+	start := time.Now()
+	setNow(t, start)
+
+	if values, err := GetAll(service); err != nil || values == nil || len(values) != 0 {
+		t.Errorf("GetAll of an empty service = %q, %v, want an empty map", values, err)
+	}
+
+	for _, key := range []string{"a", "b"} {
+		if err := Set(service, key, []byte("value-"+key)); err != nil {
+			t.Fatalf("Set %q failed: %v", key, err)
+		}
+	}
+	if err := SetWithTTL(service, "expired", []byte("old"), time.Minute); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	setNow(t, start.Add(time.Hour))
+
+	values, err := GetAll(service)
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if len(values) != 2 || string(values["a"]) != "value-a" || string(values["b"]) != "value-b" {
+		t.Errorf("GetAll = %q, want a and b", values)
+	}
+}
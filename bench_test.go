@@ -0,0 +1,100 @@
+package vault
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// The benchmarks run against the memory and file backends, which need no
+// keychain and so run anywhere. BenchmarkCommand measures what a subprocess
+// backend (security, secret-tool) pays per operation on top of that.
+
+// testBackends returns the backends that work everywhere without a
+// keychain.
+func testBackends(tb testing.TB) map[string]Backend {
+	dir := tb.TempDir()
+	return map[string]Backend{
+		"memory": NewMemoryBackend(),
+		"file":   filesBackend{&fileStore{dir: func() (string, error) { return dir, nil }, codec: defaultCodec}},
+	}
+}
+
+// filesBackend exposes a fileStore as a Backend.
+type filesBackend struct {
+	*fileStore
+}
+
+func (b filesBackend) Set(ctx context.Context, service, key string, value []byte) error {
+	return b.set(ctx, service, key, value)
+}
+
+func (b filesBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	return b.get(ctx, service, key)
+}
+
+func (b filesBackend) Del(ctx context.Context, service, key string) error {
+	return b.del(ctx, service, key)
+}
+
+func (b filesBackend) List(ctx context.Context, service string) ([]string, error) {
+	return b.list(ctx, service)
+}
+
+func BenchmarkSet(b *testing.B) {
+	value := []byte("benchmark-secret-value")
+	for name, backend := range testBackends(b) {
+		b.Run(name, func(b *testing.B) {
+			SetDefaultBackend(backend)
+			b.Cleanup(func() { SetDefaultBackend(nil) })
+
+			for b.Loop() {
+				if err := Set(testService, "key", value); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for name, backend := range testBackends(b) {
+		for _, cached := range []bool{false, true} {
+			if cached {
+				name += "/cached"
+			}
+			b.Run(name, func(b *testing.B) {
+				SetDefaultBackend(backend)
+				if cached {
+					SetGetCache(time.Minute)
+				}
+				b.Cleanup(func() {
+					SetGetCache(0)
+					SetDefaultBackend(nil)
+				})
+				if err := Set(testService, "key", []byte("benchmark-secret-value")); err != nil {
+					b.Fatal(err)
+				}
+
+				for b.Loop() {
+					if _, err := Get(testService, "key"); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkCommand measures starting a process, using the test binary as a
+// stand-in for the CLI tools the subprocess backends run once per
+// operation.
+func BenchmarkCommand(b *testing.B) {
+	ctx := context.Background()
+	for b.Loop() {
+		if _, _, err := runCommand(ctx, nil, os.Args[0], "-test.run=^$"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
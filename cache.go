@@ -0,0 +1,94 @@
+package vault
+
+import (
+	"bytes"
+	"sync/atomic"
+	"time"
+)
+
+// getCache remembers the value returned by the most recent successful Get,
+// so that code reading the same secret in a loop pays for one backend round
+// trip, which for the subprocess backends is a process spawn, per cache
+// period instead of per call. The zero value is a disabled cache.
+type getCache struct {
+	maxAge atomic.Int64 // time.Duration; 0 disables the cache
+	gen    atomic.Uint64
+	last   atomic.Pointer[cachedGet]
+}
+
+type cachedGet struct {
+	gen          uint64
+	service, key string
+	value        []byte
+	expires      time.Time
+}
+
+// SetGetCache makes Get and GetContext remember the last value they
+// returned for up to maxAge, and answer a following Get of the same
+// service and key from memory. Set, Del and the other writes made through
+// this package, as well as SetDefaultBackend, invalidate it immediately,
+// but changes made by other processes are only seen once the entry
+// expires, so keep maxAge short. A maxAge of 0, the default, disables the
+// cache. Vaults created with New have their own cache, configured with
+// WithGetCache.
+func SetGetCache(maxAge time.Duration) {
+	std.cache.setMaxAge(maxAge)
+}
+
+func (c *getCache) setMaxAge(maxAge time.Duration) {
+	c.maxAge.Store(int64(max(maxAge, 0)))
+	c.invalidate()
+}
+
+// invalidateGetCache invalidates the cache of the package-level functions.
+func invalidateGetCache() {
+	std.cache.invalidate()
+}
+
+// invalidate drops the cached entry, including one a Get running
+// concurrently is about to store. Writers call it after writing, so that a
+// Get that read the old value meanwhile cannot cache it.
+func (c *getCache) invalidate() {
+	c.gen.Add(1)
+	c.last.Store(nil)
+}
+
+// clear drops the cached entry, like invalidate, and zeroes its value.
+func (c *getCache) clear() {
+	c.gen.Add(1)
+	if e := c.last.Swap(nil); e != nil {
+		clear(e.value)
+	}
+}
+
+// generation returns the value to pass to store for a value about to be
+// fetched.
+func (c *getCache) generation() uint64 {
+	return c.gen.Load()
+}
+
+// load returns a copy of the cached value for service and key, if there is
+// a fresh one.
+func (c *getCache) load(service, key string) ([]byte, bool) {
+	e := c.last.Load()
+	if e == nil || e.gen != c.gen.Load() || e.service != service || e.key != key || !now().Before(e.expires) {
+		return nil, false
+	}
+	return bytes.Clone(e.value), true
+}
+
+// store caches value for service and key, unless the cache is disabled or
+// was invalidated since gen was read, before value was fetched.
+func (c *getCache) store(gen uint64, service, key string, value []byte) {
+	age := time.Duration(c.maxAge.Load())
+	if age == 0 || gen != c.gen.Load() {
+		return
+	}
+	c.last.Store(&cachedGet{
+		gen:     gen,
+		service: service,
+		key:     key,
+		value:   bytes.Clone(value),
+		expires: now().Add(age),
+	})
+}
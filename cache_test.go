@@ -0,0 +1,125 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// countingBackend counts the Get calls that reach the wrapped backend.
+type countingBackend struct {
+	Backend
+	gets int
+}
+
+func (b *countingBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	b.gets++
+	return b.Backend.Get(ctx, service, key)
+}
+
+func useGetCache(t *testing.T, maxAge time.Duration) *countingBackend {
+	b := &countingBackend{Backend: NewMemoryBackend()}
+	SetDefaultBackend(b)
+	SetGetCache(maxAge)
+	t.Cleanup(func() {
+		SetGetCache(0)
+		SetDefaultBackend(nil)
+	})
+	return b
+}
+
+func TestGetCache(t *testing.T) {
+	b := useGetCache(t, time.Minute)
+
+	if err := Set(testService, "key", []byte("one")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	for range 3 {
+		got, err := Get(testService, "key")
+		if err != nil || string(got) != "one" {
+			t.Fatalf("Get = %q, %v, want one", got, err)
+		}
+		// Callers may modify what they get
+		got[0] = 'X'
+	}
+	if b.gets != 1 {
+		t.Errorf("backend Get called %d times, want 1", b.gets)
+	}
+
+	if _, err := Get(testService, "other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(other) error = %v, want ErrNotFound", err)
+	}
+	if b.gets != 2 {
+		t.Errorf("backend Get called %d times, want 2", b.gets)
+	}
+
+	if err := Set(testService, "key", []byte("two")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, err := Get(testService, "key"); err != nil || string(got) != "two" {
+		t.Errorf("Get after Set = %q, %v, want two", got, err)
+	}
+
+	if err := Del(testService, "key"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if _, err := Get(testService, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Del error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetCacheExpires(t *testing.T) {
+	b := useGetCache(t, time.Minute)
+	start := time.Now()
+	setNow(t, start)
+
+	if err := Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	for range 2 {
+		if _, err := Get(testService, "key"); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	setNow(t, start.Add(time.Minute))
+	if _, err := Get(testService, "key"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if b.gets != 2 {
+		t.Errorf("backend Get called %d times, want 2", b.gets)
+	}
+}
+
+func TestGetCacheTTL(t *testing.T) {
+	useGetCache(t, time.Hour)
+	start := time.Now()
+	setNow(t, start)
+
+	if err := SetWithTTL(testService, "key", []byte("value"), time.Second); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if _, err := Get(testService, "key"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	setNow(t, start.Add(time.Second))
+	if _, err := Get(testService, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("cached Get of expired secret error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetCacheDisabled(t *testing.T) {
+	b := useGetCache(t, 0)
+
+	if err := Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	for range 2 {
+		if _, err := Get(testService, "key"); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	if b.gets != 2 {
+		t.Errorf("backend Get called %d times, want 2", b.gets)
+	}
+}
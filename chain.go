@@ -0,0 +1,86 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// NewChainBackend returns a Backend that consults backends in order, for
+// layering read-only sources such as NewSystemdCredentialsBackend in front
+// of writable storage:
+//
+//	vault.SetDefaultBackend(vault.NewChainBackend(
+//		vault.NewSystemdCredentialsBackend(),
+//		vault.NativeBackend(),
+//	))
+//
+// Get returns the first result that isn't ErrNotFound, so an earlier
+// backend shadows the later ones, and a failing backend fails the Get
+// rather than letting a later one answer. Set writes to the first backend
+// that doesn't return ErrReadOnly. Del deletes from every backend that
+// isn't read-only and returns ErrNotFound only if none held the secret; a
+// secret in a read-only backend stays readable after it. List merges the
+// keys of every backend.
+func NewChainBackend(backends ...Backend) Backend {
+	return chainBackend(slices.Clone(backends))
+}
+
+type chainBackend []Backend
+
+func (c chainBackend) Set(ctx context.Context, service, key string, value []byte) error {
+	for _, b := range c {
+		if err := b.Set(ctx, service, key, value); !errors.Is(err, ErrReadOnly) {
+			return err
+		}
+	}
+	return ErrReadOnly
+}
+
+func (c chainBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	for i, b := range c {
+		if value, err := b.Get(ctx, service, key); !errors.Is(err, ErrNotFound) {
+			if err == nil {
+				traceChild(ctx, i, b)
+			}
+			return value, err
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (c chainBackend) Del(ctx context.Context, service, key string) error {
+	found, writable := false, false
+	for _, b := range c {
+		err := b.Del(ctx, service, key)
+		switch {
+		case err == nil:
+			found, writable = true, true
+		case errors.Is(err, ErrNotFound):
+			writable = true
+		case errors.Is(err, ErrReadOnly):
+		default:
+			return err
+		}
+	}
+	switch {
+	case found:
+		return nil
+	case writable:
+		return ErrNotFound
+	}
+	return ErrReadOnly
+}
+
+func (c chainBackend) List(ctx context.Context, service string) ([]string, error) {
+	var keys []string
+	for _, b := range c {
+		k, err := b.List(ctx, service)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k...)
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
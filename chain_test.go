@@ -0,0 +1,71 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// readOnlyBackend serves the secrets of a MemoryBackend and refuses writes.
+type readOnlyBackend struct {
+	*MemoryBackend
+}
+
+func (readOnlyBackend) Set(context.Context, string, string, []byte) error { return ErrReadOnly }
+func (readOnlyBackend) Del(context.Context, string, string) error         { return ErrReadOnly }
+
+func TestChainBackend(t *testing.T) {
+	ctx := context.Background()
+	front, back := NewMemoryBackend(), NewMemoryBackend()
+	if err := front.Set(ctx, testService, "shadowed", []byte("front")); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"shadowed", "back"} {
+		if err := back.Set(ctx, testService, key, []byte("back")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := NewChainBackend(readOnlyBackend{front}, back)
+
+	if got, err := b.Get(ctx, testService, "shadowed"); err != nil || string(got) != "front" {
+		t.Errorf("Get of a shadowed key = %q, %v, want front", got, err)
+	}
+	if got, err := b.Get(ctx, testService, "back"); err != nil || string(got) != "back" {
+		t.Errorf("Get falling through = %q, %v, want back", got, err)
+	}
+	if _, err := b.Get(ctx, testService, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing key: expected ErrNotFound, got %v", err)
+	}
+	if keys, err := b.List(ctx, testService); err != nil || !slices.Equal(keys, []string{"back", "shadowed"}) {
+		t.Errorf("List = %q, %v, want [back shadowed]", keys, err)
+	}
+
+	// Writes skip the read-only backend
+	if err := b.Set(ctx, testService, "new", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, err := back.Get(ctx, testService, "new"); err != nil || string(got) != "value" {
+		t.Errorf("Set wrote %q, %v to the writable backend, want value", got, err)
+	}
+	if err := b.Del(ctx, testService, "new"); err != nil {
+		t.Errorf("Del failed: %v", err)
+	}
+	if err := b.Del(ctx, testService, "new"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Del of a missing key: expected ErrNotFound, got %v", err)
+	}
+
+	ro := NewChainBackend(readOnlyBackend{front})
+	if err := ro.Set(ctx, testService, "key", []byte("value")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Set with only read-only backends: expected ErrReadOnly, got %v", err)
+	}
+	if err := ro.Del(ctx, testService, "shadowed"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Del with only read-only backends: expected ErrReadOnly, got %v", err)
+	}
+
+	// Errors other than ErrNotFound stop the chain
+	failing := NewChainBackend(failingBackend{ErrBackendUnavailable}, back)
+	if _, err := failing.Get(ctx, testService, "back"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Get through a failing backend: expected ErrBackendUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package vault
+
+import (
+	"context"
+	"io"
+)
+
+// Close tears the Vault down for services that want deterministic cleanup
+// and tests that must not leak resources: it waits for the backups
+// queued for WithBackupSink, flushes the writes of its backend to stable
+// storage, zeroes and drops the value held by its Get cache, and closes
+// its backend if that implements io.Closer, as the backend of
+// NewEncryptedFileBackend does to zero its key. Give a Vault you close
+// its own backend, or close the shared backend yourself once every Vault
+// using it is done.
+//
+// The Vault is unusable afterwards: its operations return ErrClosed.
+// Close should be called once the operations running on the Vault have
+// returned. Calling it again does nothing. The Vault returned by Default
+// cannot be closed.
+func (v *Vault) Close() error {
+	if v == std {
+		return errCloseDefault
+	}
+	if v.closed.Swap(true) {
+		return nil
+	}
+	v.cache.clear()
+	v.expiries.stopAll()
+	v.waitBackups()
+
+	var err error
+	if s, ok := v.backend.(syncer); ok {
+		err = s.sync()
+	}
+	if c, ok := v.backend.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// closedBackend is the backend of a closed Vault.
+type closedBackend struct{}
+
+func (closedBackend) Set(context.Context, string, string, []byte) error { return ErrClosed }
+func (closedBackend) Get(context.Context, string, string) ([]byte, error) {
+	return nil, ErrClosed
+}
+func (closedBackend) Del(context.Context, string, string) error { return ErrClosed }
+func (closedBackend) List(context.Context, string) ([]string, error) {
+	return nil, ErrClosed
+}
+
+// Close drops the backend's encryption key, zeroing what Go allows, and
+// stops its idle timer. Operations return ErrClosed afterwards.
+func (b *encryptedBackend) Close() error {
+	b.key.close()
+	if b.files.names != nil {
+		b.files.names.forget()
+	}
+	return nil
+}
+
+// Close drops the backend's encryption key, as for encryptedBackend.
+func (b *singleFileBackend) Close() error {
+	b.key.close()
+	return nil
+}
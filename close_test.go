@@ -0,0 +1,55 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVaultClose(t *testing.T) {
+	fastKDF(t)
+	b, err := NewEncryptedFileBackend(t.TempDir(), []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	v, err := New(WithBackend(b), WithGetCache(time.Minute))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := v.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := v.Get(testService, "key"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	cached := v.cache.last.Load().value
+
+	if err := v.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if string(cached) != "\x00\x00\x00\x00\x00" {
+		t.Errorf("cached value %q not zeroed", cached)
+	}
+	if _, err := v.Get(testService, "key"); err != ErrClosed {
+		t.Errorf("Get after Close = %v, want ErrClosed", err)
+	}
+	if err := v.Set(testService, "key", []byte("value")); err != ErrClosed {
+		t.Errorf("Set after Close = %v, want ErrClosed", err)
+	}
+	if _, err := v.List(testService); err != ErrClosed {
+		t.Errorf("List after Close = %v, want ErrClosed", err)
+	}
+
+	// The backend was closed too
+	if b.(*encryptedBackend).key.current() != nil {
+		t.Error("encryption key kept after Close")
+	}
+	if _, err := b.Get(context.Background(), testService, "key"); !errors.Is(err, ErrClosed) {
+		t.Errorf("backend Get after Close = %v, want ErrClosed", err)
+	}
+
+	if err := v.Close(); err != nil {
+		t.Errorf("second Close = %v, want nil", err)
+	}
+}
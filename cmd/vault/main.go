@@ -0,0 +1,124 @@
+// Command vault is a small command-line companion to the vault package,
+// for using platform secure storage from shell scripts and CI.
+//
+// Usage:
+//
+//	vault set <service> <key> [file]
+//	vault get <service> <key>
+//	vault del <service> <key>
+//	vault list <service>
+//	vault verify
+//	vault repair
+//
+// set reads the value from file, or from standard input when no file is
+// given, so the secret never appears in the process arguments. get writes
+// the value to standard output exactly as stored, without a trailing
+// newline. list prints one key per line. verify checks the file storage
+// and prints each problem found; repair also removes stray temporary files
+// and quarantines corrupt entries. Both fail if problems remain.
+//
+// The exit status is 0 on success, 1 on failure, 2 on invalid usage and 3
+// when the key does not exist.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"ella.to/vault"
+)
+
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 3
+)
+
+const usage = `usage:
+  vault set <service> <key> [file]   store the contents of file, or stdin
+  vault get <service> <key>          print a value to stdout
+  vault del <service> <key>          delete a value
+  vault list <service>               print the keys of a service
+  vault verify                       check the file storage for problems
+  vault repair                       fix what verify finds, where possible
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	cmd, args := args[0], args[1:]
+	var err error
+
+	switch {
+	case cmd == "set" && (len(args) == 2 || len(args) == 3):
+		var value []byte
+		if len(args) == 3 {
+			value, err = os.ReadFile(args[2])
+		} else {
+			value, err = io.ReadAll(stdin)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "vault: failed to read value: %v\n", err)
+			return exitError
+		}
+		err = vault.Set(args[0], args[1], value)
+
+	case cmd == "get" && len(args) == 2:
+		var value []byte
+		value, err = vault.Get(args[0], args[1])
+		if err == nil {
+			_, err = stdout.Write(value)
+		}
+
+	case cmd == "del" && len(args) == 2:
+		err = vault.Del(args[0], args[1])
+
+	case cmd == "list" && len(args) == 1:
+		var keys []string
+		keys, err = vault.List(args[0])
+		for _, key := range keys {
+			fmt.Fprintln(stdout, key)
+		}
+
+	case (cmd == "verify" || cmd == "repair") && len(args) == 0:
+		var problems []vault.Problem
+		if cmd == "repair" {
+			problems, err = vault.Repair()
+		} else {
+			problems, err = vault.Verify()
+		}
+		remaining := 0
+		for _, p := range problems {
+			fmt.Fprintln(stdout, p)
+			if !p.Repaired {
+				remaining++
+			}
+		}
+		if err == nil && remaining > 0 {
+			err = fmt.Errorf("vault: %d problems found", remaining)
+		}
+
+	default:
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		if errors.Is(err, vault.ErrNotFound) {
+			return exitNotFound
+		}
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testService = "vault-test-cli-service"
+
+func TestRun(t *testing.T) {
+	key := "cli-key"
+	value := "cli secret\n"
+
+	// Clean up
+	defer run([]string{"del", testService, key}, nil, &bytes.Buffer{}, &bytes.Buffer{})
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"set", testService, key}, strings.NewReader(value), &stdout, &stderr); code != exitOK {
+		t.Fatalf("set exited %d: %s", code, stderr.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"get", testService, key}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("get exited %d: %s", code, stderr.String())
+	}
+	if stdout.String() != value {
+		t.Errorf("get printed %q, want %q", stdout.String(), value)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"list", testService}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("list exited %d: %s", code, stderr.String())
+	}
+	if stdout.String() != key+"\n" {
+		t.Errorf("list printed %q, want %q", stdout.String(), key+"\n")
+	}
+
+	if code := run([]string{"del", testService, key}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("del exited %d: %s", code, stderr.String())
+	}
+}
+
+func TestRunNotFound(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"get", testService, "nonexistent-key-12345"}, nil, &stdout, &stderr); code != exitNotFound {
+		t.Errorf("get of missing key exited %d, want %d", code, exitNotFound)
+	}
+	if code := run([]string{"del", testService, "nonexistent-key-12345"}, nil, &stdout, &stderr); code != exitNotFound {
+		t.Errorf("del of missing key exited %d, want %d", code, exitNotFound)
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	tests := [][]string{
+		nil,
+		{"unknown"},
+		{"get", testService},
+		{"set", testService, "key", "file", "extra"},
+		{"list"},
+	}
+
+	for _, args := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, nil, &stdout, &stderr); code != exitUsage {
+			t.Errorf("run(%q) exited %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"verify"}, nil, &stdout, &stderr)
+	if strings.Contains(stderr.String(), "not in use") {
+		t.Skip("file storage is not in use on this system")
+	}
+	if code != exitOK {
+		t.Errorf("verify of empty storage exited %d: %s", code, stderr.String())
+	}
+	if code := run([]string{"repair"}, nil, &stdout, &stderr); code != exitOK {
+		t.Errorf("repair of empty storage exited %d: %s", code, stderr.String())
+	}
+	if code := run([]string{"verify", "extra"}, nil, &stdout, &stderr); code != exitUsage {
+		t.Errorf("verify with arguments exited %d, want %d", code, exitUsage)
+	}
+}
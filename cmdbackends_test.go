@@ -0,0 +1,205 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// cmdScript is how a stub command behaves: what it prints, and whether it
+// exits non-zero.
+type cmdScript struct {
+	stdout, stderr string
+	fail           bool
+}
+
+// stubCommands makes every command run as script says, and returns the
+// command lines run.
+func stubCommands(t *testing.T, script cmdScript) *[][]string {
+	t.Helper()
+	var calls [][]string
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		var err error
+		if script.fail {
+			err = errors.New("exit status 1")
+		}
+		return []byte(script.stdout), []byte(script.stderr), err
+	})
+	t.Cleanup(func() { SetCommandRunner(nil) })
+	return &calls
+}
+
+// cmdOp is an operation of a command-line client under test.
+type cmdOp struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+
+	stdout string   // printed by the command on success
+	want   string   // result on success
+	args   []string // command line run last on success
+
+	missing    *cmdScript // how the command reports a missing item; nil: not tested
+	missingErr error
+}
+
+// TestCommandBackends drives the clients of the command-line tools the
+// native backend runs, security on macOS and secret-tool on Linux, through
+// stub commands, so that their command lines and error parsing are
+// checked on every platform. Windows calls the Credential Manager API
+// directly and has no command to stub.
+func TestCommandBackends(t *testing.T) {
+	const dump = "keychain: \"/Users/me/Library/Keychains/login.keychain-db\"\n" +
+		"class: \"genp\"\n" +
+		"attributes:\n" +
+		"    \"acct\"<blob>=\"key\"\n" +
+		"    \"svce\"<blob>=\"" + testService + "\"\n"
+	const search = "[/org/freedesktop/secrets/collection/login/1]\n" +
+		"label = " + testService + "/key\n" +
+		"secret = value\n" +
+		"attribute.key = key\n" +
+		"attribute.service = " + testService + "\n"
+
+	keychainMissing := cmdScript{stderr: "security: SecKeychainSearchCopyNext: The specified item could not be found in the keychain.", fail: true}
+	secretToolMissing := cmdScript{fail: true}
+
+	backends := []struct {
+		name           string
+		ops            []cmdOp
+		locked, denied cmdScript
+	}{
+		{
+			name: "security",
+			ops: []cmdOp{
+				{
+					name: "set",
+					run: func(ctx context.Context) (string, error) {
+						return "", keychainSet(ctx, testService, "key", []byte("value"))
+					},
+					args: []string{"security", "add-generic-password", "-a", "key", "-s", testService, "-w", "dmFsdWU=", "-U", "-j", "myapp"},
+				},
+				{
+					name: "get",
+					run: func(ctx context.Context) (string, error) {
+						value, err := keychainGet(ctx, testService, "key")
+						return string(value), err
+					},
+					stdout:     "dmFsdWU=\n",
+					want:       "value",
+					args:       []string{"security", "find-generic-password", "-a", "key", "-s", testService, "-w"},
+					missing:    &keychainMissing,
+					missingErr: ErrNotFound,
+				},
+				{
+					name: "del",
+					run: func(ctx context.Context) (string, error) {
+						return "", deleteItem(ctx, testService, "key")
+					},
+					args:       []string{"security", "delete-generic-password", "-a", "key", "-s", testService},
+					missing:    &keychainMissing,
+					missingErr: ErrNotFound,
+				},
+				{
+					name: "list",
+					run: func(ctx context.Context) (string, error) {
+						keys, err := keychainList(ctx, testService)
+						return strings.Join(keys, ","), err
+					},
+					stdout:  dump,
+					want:    "key",
+					args:    []string{"security", "dump-keychain"},
+					missing: &cmdScript{},
+				},
+			},
+			locked: cmdScript{stderr: "security: SecKeychainItemCopyContent: User interaction is not allowed.", fail: true},
+			denied: cmdScript{stderr: "security: SecKeychainItemCopyAccess: The user name or passphrase you entered is not correct.", fail: true},
+		},
+		{
+			name: "secret-tool",
+			ops: []cmdOp{
+				{
+					name: "set",
+					run: func(ctx context.Context) (string, error) {
+						return "", setSecretTool(ctx, testService, "key", []byte("value"))
+					},
+					args: []string{"secret-tool", "store", "--label", testService + "/key", "service", testService, "key", "key", "app", "myapp"},
+				},
+				{
+					name: "get",
+					run: func(ctx context.Context) (string, error) {
+						value, err := getSecretTool(ctx, testService, "key")
+						return string(value), err
+					},
+					stdout:     "value",
+					want:       "value",
+					args:       []string{"secret-tool", "lookup", "service", testService, "key", "key"},
+					missing:    &secretToolMissing,
+					missingErr: ErrNotFound,
+				},
+				{
+					name: "del",
+					run: func(ctx context.Context) (string, error) {
+						return "", deleteSecretTool(ctx, testService, "key")
+					},
+					args: []string{"secret-tool", "clear", "service", testService, "key", "key"},
+				},
+				{
+					name: "list",
+					run: func(ctx context.Context) (string, error) {
+						keys, err := listSecretTool(ctx, testService)
+						return strings.Join(keys, ","), err
+					},
+					stdout:  search,
+					want:    "key",
+					args:    []string{"secret-tool", "search", "--all", "service", testService},
+					missing: &secretToolMissing,
+				},
+			},
+			locked: cmdScript{stderr: "secret-tool: Cannot create an item in a locked collection", fail: true},
+			denied: cmdScript{stderr: "secret-tool: org.freedesktop.DBus.Error.AccessDenied: Rejected send message", fail: true},
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), appIDKey{}, "myapp")
+	for _, b := range backends {
+		for _, op := range b.ops {
+			t.Run(b.name+"/"+op.name+"/success", func(t *testing.T) {
+				calls := stubCommands(t, cmdScript{stdout: op.stdout})
+				got, err := op.run(ctx)
+				if err != nil || got != op.want {
+					t.Fatalf("%s = %q, %v, want %q", op.name, got, err, op.want)
+				}
+				if len(*calls) == 0 {
+					t.Fatalf("%s ran no command", op.name)
+				}
+				if last := (*calls)[len(*calls)-1]; !slices.Equal(last, op.args) {
+					t.Errorf("%s ran %q, want %q", op.name, last, op.args)
+				}
+			})
+			if op.missing != nil {
+				t.Run(b.name+"/"+op.name+"/not-found", func(t *testing.T) {
+					stubCommands(t, *op.missing)
+					got, err := op.run(ctx)
+					if op.missingErr == nil && (err != nil || got != "") {
+						t.Errorf("%s = %q, %v, want nothing", op.name, got, err)
+					} else if !errors.Is(err, op.missingErr) {
+						t.Errorf("%s = %v, want %v", op.name, err, op.missingErr)
+					}
+				})
+			}
+			for _, refused := range []struct {
+				name   string
+				script cmdScript
+			}{{"locked", b.locked}, {"access-denied", b.denied}} {
+				t.Run(b.name+"/"+op.name+"/"+refused.name, func(t *testing.T) {
+					stubCommands(t, refused.script)
+					if _, err := op.run(ctx); !errors.Is(err, ErrAccessDenied) {
+						t.Errorf("%s = %v, want ErrAccessDenied", op.name, err)
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// maxCoalesced is the number of writes writeCoalescer remembers before it
+// prunes those older than its window.
+const maxCoalesced = 64
+
+// writeCoalescer skips Sets that repeat the value the previous Set of the
+// same secret stored, so that a config-reload loop setting unchanged
+// secrets doesn't rewrite them, which costs a process start, and on macOS
+// may prompt, each time. It only remembers a write while no other write
+// has gone through the Vault since: records are tied to the generation of
+// the Vault's Get cache, which every write advances. The zero value is
+// disabled.
+type writeCoalescer struct {
+	mu      sync.Mutex
+	window  time.Duration // 0: disabled
+	gen     uint64        // the cache generation the records hold for
+	records map[[2]string]coalescedWrite
+}
+
+// coalescedWrite is a value written by a Set, known by its hash.
+type coalescedWrite struct {
+	sum     [sha256.Size]byte
+	written time.Time
+}
+
+// SetWriteCoalescing makes Set and SetContext skip the backend write, and
+// return nil, when the value is the one the previous Set of the same
+// service and key stored less than window ago, with no other write made
+// through the package since. This spares the keychain the churn of callers
+// that set unchanged secrets in a loop, such as a config reload: the
+// secret is written at most once per window as long as its value doesn't
+// change, and a different value, or any other write in between, is always
+// written. Values are compared by their SHA-256 and not kept.
+//
+// Writes made by other processes are not seen: one changing the secret
+// within the window makes a repeated Set of the old value a no-op, so keep
+// window short. A window of 0, the default, disables coalescing. Vaults
+// created with New are configured with WithWriteCoalescing.
+func SetWriteCoalescing(window time.Duration) {
+	std.writes.setWindow(window)
+}
+
+// WithWriteCoalescing makes the Vault skip repeated Sets of unchanged
+// values, as SetWriteCoalescing does for the package-level functions.
+func WithWriteCoalescing(window time.Duration) Option {
+	return func(v *Vault) {
+		v.writes.setWindow(window)
+	}
+}
+
+func (c *writeCoalescer) setWindow(window time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.window = max(window, 0)
+	c.records = nil
+}
+
+func (c *writeCoalescer) currentWindow() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.window
+}
+
+// do calls write to store value under service and key, then invalidates
+// cache, unless the previous call for service and key stored value less
+// than the window ago and cache wasn't invalidated since. Coalesced calls
+// are serialized, so that the Set whose write advances the generation is
+// known.
+func (c *writeCoalescer) do(cache *getCache, service, key string, value []byte, write func() error) error {
+	c.mu.Lock()
+	if c.window == 0 {
+		c.mu.Unlock()
+		defer cache.invalidate()
+		return write()
+	}
+	defer c.mu.Unlock()
+
+	gen := cache.generation()
+	if gen != c.gen {
+		// Written through the Vault meanwhile
+		clear(c.records)
+		c.gen = gen
+	}
+	k := [2]string{service, key}
+	sum := sha256.Sum256(value)
+	if r, ok := c.records[k]; ok && r.sum == sum && now().Sub(r.written) < c.window {
+		return nil
+	}
+	delete(c.records, k)
+
+	err := write()
+	cache.invalidate()
+	if c.gen = cache.generation(); c.gen != gen+1 {
+		// Another write ran concurrently, maybe to the same secret
+		clear(c.records)
+	} else if err == nil {
+		c.record(k, sum)
+	}
+	return err
+}
+
+func (c *writeCoalescer) record(k [2]string, sum [sha256.Size]byte) {
+	if c.records == nil {
+		c.records = make(map[[2]string]coalescedWrite)
+	}
+	t := now()
+	if len(c.records) >= maxCoalesced {
+		for k, r := range c.records {
+			if t.Sub(r.written) >= c.window {
+				delete(c.records, k)
+			}
+		}
+	}
+	c.records[k] = coalescedWrite{sum: sum, written: t}
+}
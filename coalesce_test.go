@@ -0,0 +1,65 @@
+package vault
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type countingSets struct {
+	*MemoryBackend
+	sets int
+}
+
+func (b *countingSets) Set(ctx context.Context, service, key string, value []byte) error {
+	b.sets++
+	return b.MemoryBackend.Set(ctx, service, key, value)
+}
+
+func TestWriteCoalescing(t *testing.T) {
+	start := time.Now()
+	setNow(t, start)
+	b := &countingSets{MemoryBackend: NewMemoryBackend()}
+	v, err := New(WithBackend(b), WithWriteCoalescing(time.Minute))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	set := func(key, value string, wantSets int) {
+		t.Helper()
+		if err := v.Set(testService, key, []byte(value)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		if b.sets != wantSets {
+			t.Fatalf("after Set(%q, %q) the backend was written %d times, want %d", key, value, b.sets, wantSets)
+		}
+	}
+	set("a", "one", 1)
+	set("b", "two", 2)
+	set("a", "one", 2) // coalesced, as are the repeats of b
+	set("b", "two", 2)
+	set("a", "changed", 3)
+	set("a", "one", 4)
+	if got, _ := v.Get(testService, "a"); string(got) != "one" {
+		t.Fatalf("Get = %q, want the last value set", got)
+	}
+
+	// Any other write breaks the run
+	if err := v.Del(testService, "b"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	set("a", "one", 5)
+	set("b", "two", 6)
+
+	// As does the end of the window
+	setNow(t, start.Add(time.Minute))
+	set("a", "one", 7)
+	set("a", "one", 7)
+
+	b = &countingSets{MemoryBackend: NewMemoryBackend()}
+	if v, err = New(WithBackend(b)); err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	set("a", "one", 1)
+	set("a", "one", 2) // off by default
+}
@@ -0,0 +1,162 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+)
+
+// valueCodec converts values to and from the form a backend persists.
+// Encode and Decode must be inverses: Decode(Encode(v)) returns v.
+type valueCodec interface {
+	Encode(value []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+// streamCodec is implemented by codecs that can also encode and decode a
+// value incrementally, so that large values never have to be held in
+// memory whole.
+type streamCodec interface {
+	valueCodec
+
+	// NewEncoder returns a writer that encodes what is written to it onto
+	// w. Close flushes the end of the encoding; it does not close w.
+	NewEncoder(w io.Writer) io.WriteCloser
+
+	// NewDecoder returns a reader of the value decoded from r. Decoding
+	// errors are returned by Read.
+	NewDecoder(r io.Reader) io.Reader
+}
+
+// boundCodec is implemented by codecs that encode each secret's values so
+// that they only decode as that secret's, such as the encrypted codec.
+type boundCodec interface {
+	// bind returns the codec of the values of service and key.
+	bind(service, key string) valueCodec
+}
+
+// asStreamCodec returns c as a streamCodec if it can stream. A codecChain
+// can if all of its codecs can.
+func asStreamCodec(c valueCodec) (streamCodec, bool) {
+	if chain, ok := c.(codecChain); ok {
+		for _, codec := range chain {
+			if _, ok := codec.(streamCodec); !ok {
+				return nil, false
+			}
+		}
+		return chain, true
+	}
+	sc, ok := c.(streamCodec)
+	return sc, ok
+}
+
+// codecChain applies its codecs in order on Encode and in reverse order on
+// Decode, so codecChain{a, b} stores b(a(value)).
+type codecChain []valueCodec
+
+func (c codecChain) Encode(value []byte) ([]byte, error) {
+	var err error
+	for _, codec := range c {
+		if value, err = codec.Encode(value); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+func (c codecChain) Decode(data []byte) ([]byte, error) {
+	var err error
+	for i := len(c) - 1; i >= 0; i-- {
+		if data, err = c[i].Decode(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// NewEncoder chains the encoders of the codecs, which must all be
+// streamCodecs (see asStreamCodec).
+func (c codecChain) NewEncoder(w io.Writer) io.WriteCloser {
+	encoders := make(chainEncoder, len(c))
+	for i := len(c) - 1; i >= 0; i-- {
+		encoders[i] = c[i].(streamCodec).NewEncoder(w)
+		w = encoders[i]
+	}
+	if len(encoders) == 0 {
+		return chainEncoder{nopWriteCloser{w}}
+	}
+	return encoders
+}
+
+// NewDecoder chains the decoders of the codecs, which must all be
+// streamCodecs (see asStreamCodec).
+func (c codecChain) NewDecoder(r io.Reader) io.Reader {
+	for i := len(c) - 1; i >= 0; i-- {
+		r = c[i].(streamCodec).NewDecoder(r)
+	}
+	return r
+}
+
+// chainEncoder writes to its first encoder, which writes to the next, and
+// closes them in that order so each flushes into the one after it.
+type chainEncoder []io.WriteCloser
+
+func (e chainEncoder) Write(p []byte) (int, error) {
+	return e[0].Write(p)
+}
+
+func (e chainEncoder) Close() error {
+	for _, enc := range e {
+		if err := enc.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// base64Codec stores values as standard base64 text so binary data passes
+// safely through CLI tools and text-oriented stores.
+//
+// Decode ignores leading and trailing whitespace, which is never part of
+// base64 but is routinely added in transport: the newline security prints,
+// the CRLF from PowerShell's Write-Output, or an editor's final newline in
+// a storage file. Doing this here, rather than in each backend, keeps the
+// rule identical everywhere and confines it to the transport encoding: the
+// decoded value itself is returned byte for byte.
+type base64Codec struct{}
+
+func (base64Codec) Encode(value []byte) ([]byte, error) {
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(value)))
+	base64.StdEncoding.Encode(out, value)
+	return out, nil
+}
+
+func (base64Codec) Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	out := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(out, data)
+	if err != nil {
+		return nil, err
+	}
+	return out[:n], nil
+}
+
+func (base64Codec) NewEncoder(w io.Writer) io.WriteCloser {
+	return base64.NewEncoder(base64.StdEncoding, w)
+}
+
+// NewDecoder ignores newlines anywhere in the input, which covers the
+// trailing newline Decode trims.
+func (base64Codec) NewDecoder(r io.Reader) io.Reader {
+	return base64.NewDecoder(base64.StdEncoding, r)
+}
+
+// defaultCodec is the codec chain every backend uses to encode values before
+// storing them and to decode them after reading.
+var defaultCodec valueCodec = codecChain{base64Codec{}}
@@ -0,0 +1,109 @@
+package vault
+
+import (
+	"bytes"
+	"testing"
+)
+
+// reverseCodec reverses the bytes of a value. It is its own inverse, which
+// makes the order codecs are applied in observable.
+type reverseCodec struct{}
+
+func (reverseCodec) Encode(value []byte) ([]byte, error) {
+	out := make([]byte, len(value))
+	for i, b := range value {
+		out[len(value)-1-i] = b
+	}
+	return out, nil
+}
+
+func (c reverseCodec) Decode(data []byte) ([]byte, error) {
+	return c.Encode(data)
+}
+
+func TestBase64Codec(t *testing.T) {
+	value := []byte{0x00, 0x01, 0x02, 0xFF, 0xFE, 0x80, 0x7F}
+
+	encoded, err := base64Codec{}.Encode(value)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if want := "AAEC//6Afw=="; string(encoded) != want {
+		t.Errorf("Encode returned %q, want %q", encoded, want)
+	}
+
+	decoded, err := base64Codec{}.Decode(encoded)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !bytes.Equal(decoded, value) {
+		t.Errorf("Decode returned %v, want %v", decoded, value)
+	}
+
+	if _, err := (base64Codec{}).Decode([]byte("not base64!")); err == nil {
+		t.Error("Decode of invalid base64 succeeded, want error")
+	}
+}
+
+func TestCodecChainOrder(t *testing.T) {
+	chain := codecChain{reverseCodec{}, base64Codec{}}
+	value := []byte("abc")
+
+	encoded, err := chain.Encode(value)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	// "cba" base64 encoded: reverse runs first, base64 last.
+	if want := "Y2Jh"; string(encoded) != want {
+		t.Errorf("Encode returned %q, want %q", encoded, want)
+	}
+
+	decoded, err := chain.Decode(encoded)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !bytes.Equal(decoded, value) {
+		t.Errorf("Decode returned %q, want %q", decoded, value)
+	}
+}
+
+func TestDefaultCodecAcrossBackends(t *testing.T) {
+	values := [][]byte{
+		[]byte("test-secret-value"),
+		{0x00, 0x01, 0x02, 0xFF, 0xFE, 0x80, 0x7F},
+		[]byte("hello 世界 🌍 \t\n\r special!@#$%^&*()"),
+		[]byte(" leading and trailing whitespace \n"),
+	}
+
+	// What each backend reads back for a value it stored, relative to the
+	// encoded form it wrote.
+	transports := []struct {
+		name string
+		read func(encoded []byte) []byte
+	}{
+		{"file storage", func(b []byte) []byte { return b }},
+		{"file storage edited by hand", func(b []byte) []byte { return append(b, '\n') }},
+		{"security -w", func(b []byte) []byte { return append(b, '\n') }},
+		{"powershell Write-Output", func(b []byte) []byte { return append(b, '\r', '\n') }},
+		{"IndexedDB", func(b []byte) []byte { return b }},
+	}
+
+	for _, value := range values {
+		encoded, err := defaultCodec.Encode(value)
+		if err != nil {
+			t.Fatalf("Encode(%q) failed: %v", value, err)
+		}
+		for _, tt := range transports {
+			t.Run(tt.name, func(t *testing.T) {
+				stored := append([]byte(nil), encoded...)
+				got, err := defaultCodec.Decode(tt.read(stored))
+				if err != nil {
+					t.Fatalf("Decode failed: %v", err)
+				}
+				if !bytes.Equal(got, value) {
+					t.Errorf("Decode returned %q, want %q", got, value)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CommandRunner runs the program name with args and returns what it wrote
+// to standard output and standard error. err is non-nil if the program
+// could not be run or exited with a non-zero status. The program's
+// standard input must be CommandStdin(ctx), and the program should be
+// stopped when ctx is done. security unlock-keychain must be run without
+// a controlling terminal, for example in a new session, or it prompts for
+// the password on the terminal instead of reading its standard input.
+type CommandRunner func(ctx context.Context, name string, args ...string) (stdout, stderr []byte, err error)
+
+var commandRunner atomic.Pointer[CommandRunner]
+
+// SetCommandRunner makes the backends that shell out to a CLI tool
+// (security on macOS, secret-tool on Linux) run it with fn instead of
+// os/exec, for sandboxes where exec is forbidden or must go through a
+// broker, and for tests that fake the tool. Passing nil restores the
+// os/exec runner. The Windows backend calls the Credential Manager API
+// directly and runs no commands.
+func SetCommandRunner(fn CommandRunner) {
+	if fn == nil {
+		commandRunner.Store(nil)
+		return
+	}
+	commandRunner.Store(&fn)
+}
+
+// commandPaths restricts which binaries the backends run, see
+// SetCommandPath and SetTrustedCommandDirs.
+var commandPaths struct {
+	mu      sync.RWMutex
+	pinned  map[string]string
+	trusted []string
+}
+
+// SetCommandPath pins the CLI tool name, "security" or "secret-tool", to
+// the binary at path, an absolute path such as /usr/bin/security, instead
+// of whichever binary of that name comes first on PATH, which whoever
+// controls the environment could otherwise substitute. If there is no
+// regular file at path when the tool is needed, the operation returns an
+// error wrapping ErrBackendUnavailable. An empty path removes the pin. The
+// path is also what a custom CommandRunner is given as the name. Like
+// SetTrustedCommandDirs, it should be called before the first operation:
+// on Linux, whether secret-tool is usable is checked once per process.
+func SetCommandPath(name, path string) error {
+	if path != "" && !filepath.IsAbs(path) {
+		return &ValidationError{Field: "path", Reason: "is not absolute", Err: ErrInvalidValue}
+	}
+	commandPaths.mu.Lock()
+	defer commandPaths.mu.Unlock()
+	if path == "" {
+		delete(commandPaths.pinned, name)
+		return nil
+	}
+	if commandPaths.pinned == nil {
+		commandPaths.pinned = make(map[string]string)
+	}
+	commandPaths.pinned[name] = path
+	return nil
+}
+
+// SetTrustedCommandDirs makes the backends run a CLI tool without a path
+// pinned by SetCommandPath only if PATH resolves it to a binary in one of
+// dirs, such as /usr/bin, and otherwise fail with an error wrapping
+// ErrBackendUnavailable. Calling it with no directories restores the
+// default of running the first binary on PATH.
+func SetTrustedCommandDirs(dirs ...string) error {
+	trusted := make([]string, len(dirs))
+	for i, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			return &ValidationError{Field: "dirs", Reason: fmt.Sprintf("%q is not absolute", dir), Err: ErrInvalidValue}
+		}
+		trusted[i] = filepath.Clean(dir)
+	}
+	commandPaths.mu.Lock()
+	defer commandPaths.mu.Unlock()
+	commandPaths.trusted = trusted
+	return nil
+}
+
+// commandPath returns the name or path to run the tool name with, after
+// checking it against SetCommandPath and SetTrustedCommandDirs.
+func commandPath(name string) (string, error) {
+	commandPaths.mu.RLock()
+	pinned, trusted := commandPaths.pinned[name], commandPaths.trusted
+	commandPaths.mu.RUnlock()
+
+	if pinned != "" {
+		if info, err := os.Stat(pinned); err != nil || !info.Mode().IsRegular() {
+			return "", fmt.Errorf("%w: %s is not at its pinned path %s", ErrBackendUnavailable, name, pinned)
+		}
+		return pinned, nil
+	}
+	if len(trusted) == 0 {
+		return name, nil
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+	}
+	if !slices.Contains(trusted, filepath.Dir(path)) {
+		return "", fmt.Errorf("%w: %s is not in a trusted directory", ErrBackendUnavailable, path)
+	}
+	return path, nil
+}
+
+// commandPinned reports whether SetCommandPath pinned name.
+func commandPinned(name string) bool {
+	commandPaths.mu.RLock()
+	defer commandPaths.mu.RUnlock()
+	return commandPaths.pinned[name] != ""
+}
+
+// commandError returns the error of a command that failed with err to
+// report instead of what the command wrote to standard error: ctx.Err()
+// if ctx is done, or err if the command was not run because its binary is
+// not trusted. It returns nil otherwise.
+func commandError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(err, ErrBackendUnavailable) {
+		return err
+	}
+	return nil
+}
+
+type (
+	stdinKey      struct{}
+	noTerminalKey struct{}
+)
+
+// CommandStdin returns the standard input a CommandRunner must give the
+// command it runs under ctx, such as the secret secret-tool store reads.
+// It is empty when the command reads nothing.
+func CommandStdin(ctx context.Context) io.Reader {
+	stdin, _ := ctx.Value(stdinKey{}).([]byte)
+	return bytes.NewReader(stdin)
+}
+
+// execCommand is the default CommandRunner.
+func execCommand(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = CommandStdin(ctx)
+	if ctx.Value(noTerminalKey{}) != nil {
+		detachTerminal(cmd)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// runCommand runs name with args and stdin through the command runner,
+// adding its run time to the operation timing carried by ctx, if any.
+func runCommand(ctx context.Context, stdin []byte, name string, args ...string) (stdout, stderr []byte, err error) {
+	// Backends must encode values before they reach argv, where a NUL
+	// would end the argument; fail rather than risk storing a truncated
+	// value through a runner that does not check.
+	for _, arg := range args {
+		if strings.IndexByte(arg, 0) >= 0 {
+			return nil, nil, fmt.Errorf("%w: NUL byte in an argument to %s", ErrInvalidValue, name)
+		}
+	}
+
+	name, err = commandPath(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	run := execCommand
+	if fn := commandRunner.Load(); fn != nil {
+		run = *fn
+	}
+	if stdin != nil {
+		ctx = context.WithValue(ctx, stdinKey{}, stdin)
+	}
+
+	timing, _ := ctx.Value(timingKey{}).(*opTiming)
+	limiter := nativeConfigFrom(ctx).commands
+	if limiter == nil {
+		limiter = defaultCommandLimiter
+	}
+	release, err := limiter.acquire(ctx, timing)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+	if timing == nil {
+		return run(ctx, name, args...)
+	}
+
+	start := time.Now()
+	stdout, stderr, err = run(ctx, name, args...)
+	timing.exec.Add(int64(time.Since(start)))
+	timing.ran.Store(true)
+	return stdout, stderr, err
+}
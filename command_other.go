@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package vault
+
+import "os/exec"
+
+// No command prompts for a password on other platforms.
+
+func detachTerminal(cmd *exec.Cmd) {}
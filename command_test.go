@@ -0,0 +1,135 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestSetCommandRunner(t *testing.T) {
+	var (
+		gotName  string
+		gotArgs  []string
+		gotStdin []byte
+	)
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		gotName, gotArgs = name, args
+		stdin, err := io.ReadAll(CommandStdin(ctx))
+		if err != nil {
+			t.Errorf("reading stdin: %v", err)
+		}
+		gotStdin = stdin
+		return []byte("out"), []byte("err"), errors.New("exit status 1")
+	})
+	t.Cleanup(func() { SetCommandRunner(nil) })
+
+	stdout, stderr, err := runCommand(context.Background(), []byte("secret"), "tool", "a", "b")
+	if err == nil {
+		t.Fatal("runCommand succeeded, want the runner's error")
+	}
+	if string(stdout) != "out" || string(stderr) != "err" {
+		t.Errorf("runCommand = %q, %q, want %q, %q", stdout, stderr, "out", "err")
+	}
+	if gotName != "tool" || !slices.Equal(gotArgs, []string{"a", "b"}) {
+		t.Errorf("runner got %s %v, want tool [a b]", gotName, gotArgs)
+	}
+	if string(gotStdin) != "secret" {
+		t.Errorf("runner stdin = %q, want %q", gotStdin, "secret")
+	}
+}
+
+func TestCommandStdinEmpty(t *testing.T) {
+	stdin, err := io.ReadAll(CommandStdin(context.Background()))
+	if err != nil || len(stdin) != 0 {
+		t.Errorf("CommandStdin = %q, %v, want empty", stdin, err)
+	}
+}
+
+func TestRunCommandRejectsNUL(t *testing.T) {
+	ran := false
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		ran = true
+		return nil, nil, nil
+	})
+	t.Cleanup(func() { SetCommandRunner(nil) })
+
+	_, _, err := runCommand(context.Background(), nil, "tool", "-w", "bin\x00ary")
+	if !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("runCommand error = %v, want ErrInvalidValue", err)
+	}
+	if ran {
+		t.Error("runner ran a command with a NUL byte in its arguments")
+	}
+}
+
+func TestCommandPaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the Windows backend runs no commands")
+	}
+	var gotName string
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		gotName = name
+		return nil, nil, nil
+	})
+	t.Cleanup(func() {
+		SetCommandRunner(nil)
+		SetCommandPath("tool", "")
+		SetTrustedCommandDirs()
+	})
+	ctx := context.Background()
+
+	trusted, untrusted := t.TempDir(), t.TempDir()
+	for _, dir := range []string{trusted, untrusted} {
+		if err := os.WriteFile(filepath.Join(dir, "tool"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A pinned path is run instead of the name, if there is a file there
+	pinned := filepath.Join(trusted, "tool")
+	if err := SetCommandPath("tool", pinned); err != nil {
+		t.Fatalf("SetCommandPath failed: %v", err)
+	}
+	if _, _, err := runCommand(ctx, nil, "tool"); err != nil || gotName != pinned {
+		t.Errorf("runCommand ran %q, %v, want the pinned path %q", gotName, err, pinned)
+	}
+	if err := SetCommandPath("tool", filepath.Join(untrusted, "missing")); err != nil {
+		t.Fatalf("SetCommandPath failed: %v", err)
+	}
+	gotName = ""
+	_, _, err := runCommand(ctx, nil, "tool")
+	if !errors.Is(err, ErrBackendUnavailable) || gotName != "" {
+		t.Errorf("runCommand with a missing pinned binary = %v, ran %q; want ErrBackendUnavailable", err, gotName)
+	}
+	if commandError(ctx, err) != err {
+		t.Errorf("commandError dropped %v", err)
+	}
+	if commandError(ctx, errors.New("exit status 1")) != nil {
+		t.Error("commandError reported a failure of the command itself")
+	}
+	if err := SetCommandPath("tool", "bin/tool"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("SetCommandPath with a relative path = %v, want ErrInvalidValue", err)
+	}
+	SetCommandPath("tool", "")
+
+	// Without a pin, PATH must resolve the tool to a trusted directory
+	if err := SetTrustedCommandDirs(trusted); err != nil {
+		t.Fatalf("SetTrustedCommandDirs failed: %v", err)
+	}
+	t.Setenv("PATH", untrusted+string(os.PathListSeparator)+trusted)
+	if _, _, err := runCommand(ctx, nil, "tool"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("runCommand of a binary outside the trusted directories = %v, want ErrBackendUnavailable", err)
+	}
+	t.Setenv("PATH", trusted)
+	if _, _, err := runCommand(ctx, nil, "tool"); err != nil || gotName != pinned {
+		t.Errorf("runCommand ran %q, %v, want %q", gotName, err, pinned)
+	}
+	if err := SetTrustedCommandDirs("relative"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("SetTrustedCommandDirs with a relative directory = %v, want ErrInvalidValue", err)
+	}
+}
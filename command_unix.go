@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package vault
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachTerminal starts cmd in a new session, without a controlling
+// terminal, so that a tool prompting for a password reads it from its
+// standard input rather than the terminal.
+func detachTerminal(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
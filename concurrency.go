@@ -0,0 +1,68 @@
+package vault
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// commandLimiter bounds how many commands run at once.
+type commandLimiter struct {
+	slots chan struct{} // nil: no limit
+}
+
+func newCommandLimiter(n int) *commandLimiter {
+	if n <= 0 {
+		return &commandLimiter{}
+	}
+	return &commandLimiter{slots: make(chan struct{}, n)}
+}
+
+// defaultCommandLimiter is shared by the native backends created without
+// WithMaxConcurrentOps.
+var defaultCommandLimiter = newCommandLimiter(runtime.GOMAXPROCS(0))
+
+// WithMaxConcurrentOps bounds how many of the backend's operations run a
+// command (security on macOS, secret-tool on Linux) at once; the others
+// queue until one finishes or their context is done. It keeps a burst of
+// Gets from spawning dozens of processes, which spikes CPU and can hit the
+// process limit. The limit applies to the commands of this backend only;
+// native backends created without the option, including the one the
+// package-level functions use by default, share a limit of GOMAXPROCS. n
+// of 0 or less removes the limit. Time spent queuing is reported in
+// Event.Wait.
+func WithMaxConcurrentOps(n int) NativeOption {
+	return func(c *nativeConfig) {
+		c.commands = newCommandLimiter(n)
+	}
+}
+
+// acquire waits for a free slot, recording the wait in timing, and returns
+// the function that frees it.
+func (l *commandLimiter) acquire(ctx context.Context, timing *opTiming) (func(), error) {
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	default:
+	}
+
+	start := time.Now()
+	defer func() {
+		if timing != nil {
+			timing.wait.Add(int64(time.Since(start)))
+		}
+	}()
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *commandLimiter) release() {
+	<-l.slots
+}
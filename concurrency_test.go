@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrentOps(t *testing.T) {
+	var running, peak atomic.Int32
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return nil, nil, nil
+	})
+	t.Cleanup(func() { SetCommandRunner(nil) })
+
+	b := NativeBackend(WithMaxConcurrentOps(2)).(nativeBackend)
+	var waited atomic.Int64
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			ctx, done := observeOp(context.Background(), observers{hook: func(e Event) {
+				waited.Add(int64(e.Wait))
+			}}, "get", testService, "key")
+			_, _, err := runCommand(b.context(ctx), nil, "tool")
+			done(err)
+			if err != nil {
+				t.Errorf("runCommand failed: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p != 2 {
+		t.Errorf("peak concurrency = %d, want 2", p)
+	}
+	if waited.Load() == 0 {
+		t.Error("no Event reported time spent queuing")
+	}
+}
+
+func TestMaxConcurrentOpsCanceled(t *testing.T) {
+	release := make(chan struct{})
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		<-release
+		return nil, nil, nil
+	})
+	t.Cleanup(func() { SetCommandRunner(nil) })
+
+	ctx := NativeBackend(WithMaxConcurrentOps(1)).(nativeBackend).context(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runCommand(ctx, nil, "tool")
+		close(done)
+	}()
+	// Wait for the first command to take the only slot
+	for len(nativeConfigFrom(ctx).commands.slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	queued, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := runCommand(queued, nil, "tool"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("queued runCommand: expected context.DeadlineExceeded, got %v", err)
+	}
+	close(release)
+	<-done
+}
@@ -0,0 +1,181 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// lockName is the file in a storage directory that conditional writes
+// flock. Its name starts with a dot, which no secret file does.
+const lockName = ".vault-lock"
+
+// locker is implemented by backends that can lock their storage against
+// other processes for the read-compare-write of a conditional write.
+type locker interface {
+	lock(ctx context.Context) (unlock func(), err error)
+}
+
+// SetIfAbsent stores value under service and key unless a secret is
+// already stored there, and reports whether it stored it. An expired
+// secret counts as absent. See CompareAndSwap for how atomic it is.
+func SetIfAbsent(service, key string, value []byte) (bool, error) {
+	return std.SetIfAbsentContext(context.Background(), service, key, value)
+}
+
+// SetIfAbsentContext is like SetIfAbsent but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage calls
+// complete.
+func SetIfAbsentContext(ctx context.Context, service, key string, value []byte) (bool, error) {
+	return std.SetIfAbsentContext(ctx, service, key, value)
+}
+
+// CompareAndSwap replaces the value stored under service and key with new
+// if it currently equals old, and reports whether it did, for optimistic
+// concurrency such as rotating a secret shared by several processes. It
+// returns ErrNotFound if no secret is stored, and new is stored as Set
+// stores it.
+//
+// The file-based backends (the Linux fallback, iOS, Android and
+// NewEncryptedFileBackend) hold an flock on the storage directory around
+// the read, compare and write on Linux and macOS, so the swap is atomic
+// with respect to the conditional writes of every process sharing the
+// directory. The other backends, and plain Set, are not locked: the swap is
+// then only atomic with respect to the conditional writes of the Vault
+// within the process, and best effort beyond it.
+func CompareAndSwap(service, key string, old, new []byte) (bool, error) {
+	return std.CompareAndSwapContext(context.Background(), service, key, old, new)
+}
+
+// CompareAndSwapContext is like CompareAndSwap but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage calls
+// complete.
+func CompareAndSwapContext(ctx context.Context, service, key string, old, new []byte) (bool, error) {
+	return std.CompareAndSwapContext(ctx, service, key, old, new)
+}
+
+// SetIfAbsent stores value under service and key unless a secret is
+// already stored there, as the package-level SetIfAbsent does.
+func (v *Vault) SetIfAbsent(service, key string, value []byte) (bool, error) {
+	return v.SetIfAbsentContext(context.Background(), service, key, value)
+}
+
+// SetIfAbsentContext is like SetIfAbsent but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage calls
+// complete.
+func (v *Vault) SetIfAbsentContext(ctx context.Context, service, key string, value []byte) (bool, error) {
+	return v.setIf(ctx, "set", service, key, value, func(_ []byte, err error) (bool, error) {
+		if errors.Is(err, ErrNotFound) {
+			return true, nil
+		}
+		return false, err
+	})
+}
+
+// CompareAndSwap replaces the value stored under service and key with new
+// if it currently equals old, as the package-level CompareAndSwap does.
+func (v *Vault) CompareAndSwap(service, key string, old, new []byte) (bool, error) {
+	return v.CompareAndSwapContext(context.Background(), service, key, old, new)
+}
+
+// CompareAndSwapContext is like CompareAndSwap but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage calls
+// complete.
+func (v *Vault) CompareAndSwapContext(ctx context.Context, service, key string, old, new []byte) (bool, error) {
+	return v.setIf(ctx, "swap", service, key, new, func(current []byte, err error) (bool, error) {
+		if err != nil {
+			return false, err
+		}
+		return bytes.Equal(current, old), nil
+	})
+}
+
+// setIf stores value under service and key if cond, given the current value
+// or the error reading it, returns true. The read bypasses the Get cache,
+// which may be stale with respect to other processes.
+func (v *Vault) setIf(ctx context.Context, op, service, key string, value []byte, cond func(current []byte, err error) (bool, error)) (bool, error) {
+	if err := checkKey(service, key); err != nil {
+		return false, err
+	}
+	if err := checkValue(value); err != nil {
+		return false, err
+	}
+
+	v.writeMu.Lock()
+	defer v.writeMu.Unlock()
+	ctx, done := v.start(ctx, op, service, key)
+	b := v.store()
+	ms, mk := v.mapKey(service, key)
+	ok, err := func() (bool, error) {
+		if l, isLocker := b.(locker); isLocker {
+			unlock, err := l.lock(ctx)
+			if err != nil {
+				return false, err
+			}
+			defer unlock()
+		}
+
+		current, err := b.Get(ctx, ms, mk)
+		if err == nil {
+			current, err = checkExpiryLocked(ctx, b, ms, mk, current)
+		}
+		ok, err := cond(current, err)
+		if !ok || err != nil {
+			return false, err
+		}
+		if err := checkSize(ctx, b, value); err != nil {
+			return false, err
+		}
+		if err := v.checkQuota(ctx, b, ms, mk); err != nil {
+			return false, err
+		}
+		if err := b.Set(ctx, ms, mk, value); err != nil {
+			return false, err
+		}
+		return true, v.tagOwner(ctx, b, ms, mk, value)
+	}()
+	if err != nil {
+		ok = false
+	}
+	v.cache.invalidate()
+	if ok {
+		v.backupChanged(b, ms)
+	}
+	done(err)
+	return ok, err
+}
+
+// lock flocks the storage directory, from which conditional writes read
+// and write the secret files.
+func (s *fileStore) lock(ctx context.Context) (func(), error) {
+	dir, _, err := s.layout()
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockFile(ctx, filepath.Join(dir, lockName))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("vault: failed to lock storage directory: %w", err)
+	}
+	return unlock, nil
+}
+
+func (b nativeBackend) lock(ctx context.Context) (func(), error) {
+	if files := activeFiles(b.context(ctx)); files != nil {
+		return files.lock(ctx)
+	}
+	return func() {}, nil
+}
+
+func (b *encryptedBackend) lock(ctx context.Context) (func(), error) {
+	release, err := b.useKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return b.files.lock(ctx)
+}
@@ -0,0 +1,89 @@
+package vault
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSetIfAbsent(t *testing.T) {
+	v, _ := newTestVault(t)
+
+	if stored, err := v.SetIfAbsent(testService, "key", []byte("first")); err != nil || !stored {
+		t.Fatalf("SetIfAbsent of a new key = %v, %v, want true", stored, err)
+	}
+	if stored, err := v.SetIfAbsent(testService, "key", []byte("second")); err != nil || stored {
+		t.Errorf("SetIfAbsent of an existing key = %v, %v, want false", stored, err)
+	}
+	if got, err := v.Get(testService, "key"); err != nil || string(got) != "first" {
+		t.Errorf("Get = %q, %v, want first", got, err)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	v, _ := newTestVault(t)
+
+	if _, err := v.CompareAndSwap(testService, "key", []byte("old"), []byte("new")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CompareAndSwap of a missing key: expected ErrNotFound, got %v", err)
+	}
+	if err := v.Set(testService, "key", []byte("old")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if swapped, err := v.CompareAndSwap(testService, "key", []byte("other"), []byte("new")); err != nil || swapped {
+		t.Errorf("CompareAndSwap with a stale value = %v, %v, want false", swapped, err)
+	}
+	if swapped, err := v.CompareAndSwap(testService, "key", []byte("old"), []byte("new")); err != nil || !swapped {
+		t.Errorf("CompareAndSwap = %v, %v, want true", swapped, err)
+	}
+	if got, err := v.Get(testService, "key"); err != nil || string(got) != "new" {
+		t.Errorf("Get = %q, %v, want new", got, err)
+	}
+}
+
+// TestCompareAndSwapAcrossStores has stores that share a directory, as
+// processes would, increment a counter concurrently.
+func TestCompareAndSwapAcrossStores(t *testing.T) {
+	dir := t.TempDir()
+	newVault := func() *Vault {
+		v, err := New(WithBackend(filesBackend{&fileStore{dir: func() (string, error) { return dir, nil }, codec: defaultCodec}}))
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		return v
+	}
+	if err := newVault().Set(testService, "counter", []byte("0")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	const workers, increments = 4, 25
+	var wg sync.WaitGroup
+	for range workers {
+		v := newVault()
+		wg.Go(func() {
+			for range increments {
+				for {
+					current, err := v.Get(testService, "counter")
+					if err != nil {
+						t.Errorf("Get failed: %v", err)
+						return
+					}
+					n, _ := strconv.Atoi(string(current))
+					swapped, err := v.CompareAndSwap(testService, "counter", current, []byte(strconv.Itoa(n+1)))
+					if err != nil {
+						t.Errorf("CompareAndSwap failed: %v", err)
+						return
+					}
+					if swapped {
+						break
+					}
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	if got, err := newVault().Get(testService, "counter"); err != nil || string(got) != strconv.Itoa(workers*increments) {
+		t.Errorf("counter = %q, %v, want %d", got, err, workers*increments)
+	}
+}
@@ -0,0 +1,109 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultContainerSecretsPath is the path template NewContainerSecretsBackend
+// uses when given none: where Docker and Podman mount the secrets of a
+// container.
+const DefaultContainerSecretsPath = "/run/secrets/{service}_{key}"
+
+// NewContainerSecretsBackend returns a read-only Backend serving the
+// secrets mounted into a container as files, such as Docker and Podman
+// secrets or Kubernetes secret volumes. pathTemplate names the file of a
+// secret, with "{service}" and "{key}" standing for its service and key:
+// with DefaultContainerSecretsPath, used for "", Get("myapp", "db")
+// reads /run/secrets/myapp_db, and with "/etc/secrets/{service}/{key}"
+// it reads /etc/secrets/myapp/db. "{key}" must appear once, in the last
+// element of the path.
+//
+// Files are returned as mounted, trailing newline included. A missing
+// file returns ErrNotFound, as do services and keys containing a path
+// separator, and Set and Del return ErrReadOnly, so the backend is meant
+// to be put in front of writable storage with NewChainBackend. List
+// returns the keys of the files matching the template for the service,
+// skipping hidden ones such as the ..data link of Kubernetes volumes; with
+// a separator between service and key, such as "_", a service containing
+// it also lists the secrets of services it prefixes.
+func NewContainerSecretsBackend(pathTemplate string) (Backend, error) {
+	if pathTemplate == "" {
+		pathTemplate = DefaultContainerSecretsPath
+	}
+	base := filepath.Base(pathTemplate)
+	if strings.Count(pathTemplate, "{key}") != 1 || !strings.Contains(base, "{key}") {
+		return nil, &ValidationError{Field: "pathTemplate", Reason: `must contain "{key}" once, in its last element`, Err: ErrInvalidValue}
+	}
+	return containerSecrets{template: pathTemplate}, nil
+}
+
+type containerSecrets struct {
+	template string
+}
+
+// path returns the file holding the secret of service and key. ok is
+// false if there can be no such secret.
+func (b containerSecrets) path(service, key string) (string, bool) {
+	if strings.ContainsAny(service+key, `/\`) || key == "." || key == ".." {
+		return "", false
+	}
+	return strings.NewReplacer("{service}", service, "{key}", key).Replace(b.template), true
+}
+
+func (b containerSecrets) Set(context.Context, string, string, []byte) error {
+	return fmt.Errorf("%w: container secrets", ErrReadOnly)
+}
+
+func (b containerSecrets) Get(ctx context.Context, service, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path, ok := b.path(service, key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	value, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("vault: failed to read container secret: %w", err)
+	}
+	return value, nil
+}
+
+func (b containerSecrets) Del(context.Context, string, string) error {
+	return fmt.Errorf("%w: container secrets", ErrReadOnly)
+}
+
+func (b containerSecrets) List(ctx context.Context, service string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(service, `/\`) {
+		return nil, nil
+	}
+	pattern := strings.ReplaceAll(b.template, "{service}", service)
+	prefix, suffix, _ := strings.Cut(filepath.Base(pattern), "{key}")
+	entries, err := os.ReadDir(filepath.Dir(pattern))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("vault: failed to read container secrets directory: %w", err)
+	}
+	var keys []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || len(name) <= len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		keys = append(keys, name[len(prefix):len(name)-len(suffix)])
+	}
+	return keys, nil
+}
@@ -0,0 +1,83 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestContainerSecrets(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, value := range map[string]string{
+		"myapp_api-token": "token\n",
+		"myapp_db":        "password",
+		"other_key":       "other",
+		".hidden":         "hidden",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o400); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := NewContainerSecretsBackend(filepath.Join(dir, "{service}_{key}"))
+	if err != nil {
+		t.Fatalf("NewContainerSecretsBackend failed: %v", err)
+	}
+
+	if got, err := b.Get(ctx, "myapp", "api-token"); err != nil || string(got) != "token\n" {
+		t.Errorf("Get = %q, %v, want the secret as mounted", got, err)
+	}
+	for _, key := range []string{"missing", "../other_key"} {
+		if _, err := b.Get(ctx, "myapp", key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q): expected ErrNotFound, got %v", key, err)
+		}
+	}
+	if keys, err := b.List(ctx, "myapp"); err != nil || !slices.Equal(slices.Sorted(slices.Values(keys)), []string{"api-token", "db"}) {
+		t.Errorf("List = %q, %v, want [api-token db]", keys, err)
+	}
+	if err := b.Set(ctx, "myapp", "db", []byte("new")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Set: expected ErrReadOnly, got %v", err)
+	}
+	if err := b.Del(ctx, "myapp", "db"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Del: expected ErrReadOnly, got %v", err)
+	}
+	if keys, err := b.List(ctx, "absent"); err != nil || len(keys) != 0 {
+		t.Errorf("List of a service without secrets = %q, %v, want none", keys, err)
+	}
+}
+
+func TestContainerSecretsTemplate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "myapp", "..data"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "myapp", "db.txt"), []byte("password"), 0o400); err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewContainerSecretsBackend(filepath.Join(dir, "{service}", "{key}.txt"))
+	if err != nil {
+		t.Fatalf("NewContainerSecretsBackend failed: %v", err)
+	}
+	if got, err := b.Get(ctx, "myapp", "db"); err != nil || string(got) != "password" {
+		t.Errorf("Get = %q, %v, want %q", got, err, "password")
+	}
+	if keys, err := b.List(ctx, "myapp"); err != nil || !slices.Equal(keys, []string{"db"}) {
+		t.Errorf("List = %q, %v, want [db]", keys, err)
+	}
+	if keys, err := b.List(ctx, "missing"); err != nil || len(keys) != 0 {
+		t.Errorf("List of a missing directory = %q, %v, want none", keys, err)
+	}
+
+	for _, template := range []string{"/run/secrets/{service}", "/run/{key}/value", "/run/{key}_{key}"} {
+		if _, err := NewContainerSecretsBackend(template); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("NewContainerSecretsBackend(%q) = %v, want ErrInvalidValue", template, err)
+		}
+	}
+	if _, err := NewContainerSecretsBackend(""); err != nil {
+		t.Errorf("NewContainerSecretsBackend with the default template failed: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// contentTypeKeyPrefix starts the reserved key the content type of a
+// secret is recorded under, in the same service, followed by the secret's
+// key. The record is stamped with the value it describes (see stamp), so
+// a type recorded for an older value is ignored. Expiry is left out of the
+// stamp: Touch keeps the type.
+const contentTypeKeyPrefix = ".vault-type/"
+
+func contentTypeKey(key string) string {
+	return contentTypeKeyPrefix + key
+}
+
+func isContentTypeKey(key string) bool {
+	return strings.HasPrefix(key, contentTypeKeyPrefix)
+}
+
+// SetWithContentType is like Set but also records contentType, a hint of
+// the value's format such as "application/x-pem-file", "application/json"
+// or "text/plain", for tools that present secrets generically. The type is
+// advisory: it isn't checked against the value, and the value is stored
+// and read as with Set. ContentType and GetMetadata return it until the
+// value changes, so a Set of a new value drops it. An empty contentType
+// removes the recorded type. Recording it costs a second backend call.
+func SetWithContentType(service, key string, value []byte, contentType string) error {
+	return std.SetWithContentTypeContext(context.Background(), service, key, value, contentType)
+}
+
+// SetWithContentTypeContext is like SetWithContentType but aborts the
+// operation and returns ctx.Err() if ctx is done before the underlying
+// storage calls complete.
+func SetWithContentTypeContext(ctx context.Context, service, key string, value []byte, contentType string) error {
+	return std.SetWithContentTypeContext(ctx, service, key, value, contentType)
+}
+
+// ContentType returns the content type recorded for the secret stored
+// under service and key with SetWithContentType, or "" if none was. It
+// returns ErrNotFound if there is no such secret.
+func ContentType(service, key string) (string, error) {
+	return std.ContentTypeContext(context.Background(), service, key)
+}
+
+// ContentTypeContext is like ContentType but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage calls
+// complete.
+func ContentTypeContext(ctx context.Context, service, key string) (string, error) {
+	return std.ContentTypeContext(ctx, service, key)
+}
+
+// SetWithContentType stores value under service and key with a content
+// type, as the package-level SetWithContentType does.
+func (v *Vault) SetWithContentType(service, key string, value []byte, contentType string) error {
+	return v.SetWithContentTypeContext(context.Background(), service, key, value, contentType)
+}
+
+// SetWithContentTypeContext is like SetWithContentType but aborts the
+// operation and returns ctx.Err() if ctx is done before the underlying
+// storage calls complete.
+func (v *Vault) SetWithContentTypeContext(ctx context.Context, service, key string, value []byte, contentType string) error {
+	return v.set(ctx, service, key, value, &contentType)
+}
+
+// ContentType returns the content type recorded for the secret stored
+// under service and key, as the package-level ContentType does.
+func (v *Vault) ContentType(service, key string) (string, error) {
+	return v.ContentTypeContext(context.Background(), service, key)
+}
+
+// ContentTypeContext is like ContentType but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage calls
+// complete. Secrets overridden by the environment (see WithEnvOverrides)
+// have no type.
+func (v *Vault) ContentTypeContext(ctx context.Context, service, key string) (string, error) {
+	if err := checkKey(service, key); err != nil {
+		return "", err
+	}
+	if _, ok, err := v.envOverride(service, key); ok {
+		return "", err
+	}
+	ctx, done := v.start(ctx, "contenttype", service, key)
+	ms, mk := v.mapKey(service, key)
+	contentType, err := storedContentType(ctx, v.store(), ms, mk)
+	done(err)
+	return contentType, err
+}
+
+// setContentType records contentType for value, just set under service
+// and key, or removes the record if contentType is empty.
+func setContentType(ctx context.Context, b Backend, service, key string, value []byte, contentType string) error {
+	var err error
+	if contentType == "" {
+		if err = b.Del(ctx, service, contentTypeKey(key)); errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+	} else {
+		err = b.Set(ctx, service, contentTypeKey(key), stamp(value, contentType))
+	}
+	if err != nil {
+		return fmt.Errorf("vault: secret set, but not its content type: %w", err)
+	}
+	return nil
+}
+
+// storedContentType returns the content type recorded for the secret
+// stored in b under service and key, or ErrNotFound if there is none.
+func storedContentType(ctx context.Context, b Backend, service, key string) (string, error) {
+	stored, err := b.Get(ctx, service, key)
+	if err != nil {
+		return "", err
+	}
+	defer clear(stored)
+	value, err := checkExpiry(ctx, b, service, key, stored)
+	if err != nil {
+		return "", err
+	}
+	record, err := b.Get(ctx, service, contentTypeKey(key))
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	contentType, _ := stampPayload(record, value)
+	return contentType, nil
+}
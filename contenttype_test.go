@@ -0,0 +1,57 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestContentType(t *testing.T) {
+	useMemory(t)
+	const pem = "application/x-pem-file"
+
+	if err := SetWithContentType(testService, "cert", []byte("-----BEGIN CERTIFICATE-----"), pem); err != nil {
+		t.Fatalf("SetWithContentType failed: %v", err)
+	}
+	if got, err := ContentType(testService, "cert"); err != nil || got != pem {
+		t.Fatalf("ContentType = %q, %v, want %q", got, err, pem)
+	}
+	if md, err := GetMetadata(testService, "cert"); err != nil || md.ContentType != pem {
+		t.Errorf("GetMetadata = %+v, %v, want ContentType %q", md, err, pem)
+	}
+	if value, err := Get(testService, "cert"); err != nil || string(value) != "-----BEGIN CERTIFICATE-----" {
+		t.Errorf("Get = %q, %v, want the value as set", value, err)
+	}
+	if keys, err := List(testService); err != nil || len(keys) != 1 {
+		t.Errorf("List = %q, %v, want the secret only", keys, err)
+	}
+
+	// Touch keeps the type; a new value drops it
+	if err := Touch(testService, "cert", time.Hour); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	if got, err := ContentType(testService, "cert"); err != nil || got != pem {
+		t.Errorf("ContentType after Touch = %q, %v, want %q", got, err, pem)
+	}
+	if err := Set(testService, "cert", []byte("renewed")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, err := ContentType(testService, "cert"); err != nil || got != "" {
+		t.Errorf("ContentType after Set = %q, %v, want none", got, err)
+	}
+
+	// An empty type removes it
+	if err := SetWithContentType(testService, "cert", []byte("renewed"), pem); err != nil {
+		t.Fatalf("SetWithContentType failed: %v", err)
+	}
+	if err := SetWithContentType(testService, "cert", []byte("renewed"), ""); err != nil {
+		t.Fatalf("SetWithContentType failed: %v", err)
+	}
+	if got, err := ContentType(testService, "cert"); err != nil || got != "" {
+		t.Errorf("ContentType after clearing = %q, %v, want none", got, err)
+	}
+
+	if _, err := ContentType(testService, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ContentType of a missing key = %v, want ErrNotFound", err)
+	}
+}
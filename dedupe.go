@@ -0,0 +1,43 @@
+package vault
+
+import "context"
+
+// deduper is implemented by backends that can hold several items for the
+// same service and key.
+type deduper interface {
+	dedupe(ctx context.Context, service, key string) (int, error)
+}
+
+// Dedupe removes duplicate items stored for service and key, keeping the
+// one Get returns, and reports how many it removed. Duplicates only occur
+// in the macOS Keychain, where other tools can create items with the same
+// service and account that differ in another attribute; security returns
+// the first of them, which may not be the one a program expects. The kept
+// item is left untouched, with its access control list and comment; a
+// duplicate that differs from it only in attributes security cannot
+// select items by, such as the access group, is left too, and reported in
+// an error along with the count removed. Backends that cannot hold
+// duplicates report 0.
+func Dedupe(service, key string) (removed int, err error) {
+	if err := checkKey(service, key); err != nil {
+		return 0, err
+	}
+	b, ok := currentBackend().(deduper)
+	if !ok {
+		return 0, nil
+	}
+
+	ctx, done := startOp(context.Background(), "dedupe", service, key)
+	ms, mk := std.mapKey(service, key)
+	removed, err = b.dedupe(ctx, ms, mk)
+	invalidateGetCache()
+	done(err)
+	return removed, err
+}
+
+func (b nativeBackend) dedupe(ctx context.Context, service, key string) (int, error) {
+	if !validBackendKey(service, key) {
+		return 0, ErrInvalidKey
+	}
+	return dedupe(b.context(ctx), service, key)
+}
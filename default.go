@@ -0,0 +1,49 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errCloseDefault is returned by Close on the Vault returned by Default.
+var errCloseDefault = errors.New("vault: the default Vault cannot be closed")
+
+// Default returns the Vault the package-level functions use, for code
+// moving from them to explicit handles: Default().Get(service, key) is
+// Get(service, key), with the same backend, cache, key mapper and other
+// settings, including those changed later with SetDefaultBackend,
+// SetGetCache and the other package-level setters. Functions without a
+// Vault method, such as GetMetadata, use the same backend. Close returns
+// an error, since the package-level functions keep using it.
+//
+// To hand a library a Vault that behaves like the package-level functions
+// but no longer follows the setters, use NewFromDefaults.
+func Default() *Vault {
+	return std
+}
+
+// NewFromDefaults returns a new Vault configured as the package-level
+// functions currently are: their backend (see SetDefaultBackend), Get
+// cache, write coalescing, key mapper, environment overrides and app
+// identity, followed by opts. Later calls to the package-level setters
+// don't affect it. The hook and audit log set with SetHook and SetAuditLog
+// report the operations of every Vault, so they apply to it without being
+// copied.
+// The Vault shares the backend with the package-level functions, so
+// closing it closes a backend that implements io.Closer for them too.
+func NewFromDefaults(opts ...Option) (*Vault, error) {
+	defaults := []Option{
+		WithBackend(currentBackend()),
+		WithGetCache(time.Duration(std.cache.maxAge.Load())),
+		WithAppIdentity(appIdentity(context.Background())),
+		WithWriteCoalescing(std.writes.currentWindow()),
+	}
+	if m := std.mapper.Load(); m != nil {
+		defaults = append(defaults, WithKeyMapper(*m))
+	}
+	if std.envOverrides.Load() {
+		defaults = append(defaults, WithEnvOverrides())
+	}
+	return New(append(defaults, opts...)...)
+}
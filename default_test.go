@@ -0,0 +1,106 @@
+package vault
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefault(t *testing.T) {
+	useMemory(t)
+	v := Default()
+	if v != Default() {
+		t.Fatal("Default returned different Vaults")
+	}
+
+	// Each side sees what the other sets and deletes
+	if err := Set(testService, "pkg", []byte("from package")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := v.Set(testService, "handle", []byte("from handle")); err != nil {
+		t.Fatalf("Vault.Set failed: %v", err)
+	}
+	for _, key := range []string{"pkg", "handle"} {
+		want, wantErr := Get(testService, key)
+		got, err := v.Get(testService, key)
+		if err != wantErr || !bytes.Equal(got, want) || wantErr != nil {
+			t.Errorf("Get(%q) = %q, %v; Vault.Get = %q, %v", key, want, wantErr, got, err)
+		}
+	}
+	if err := v.Del(testService, "pkg"); err != nil {
+		t.Fatalf("Vault.Del failed: %v", err)
+	}
+	if err := Del(testService, "handle"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	for _, key := range []string{"pkg", "handle"} {
+		if _, err := Get(testService, key); err != ErrNotFound {
+			t.Errorf("Get(%q) after Del = %v, want ErrNotFound", key, err)
+		}
+		if _, err := v.Get(testService, key); err != ErrNotFound {
+			t.Errorf("Vault.Get(%q) after Del = %v, want ErrNotFound", key, err)
+		}
+		if err := Del(testService, key); err != ErrNotFound {
+			t.Errorf("Del(%q) of a missing key = %v, want ErrNotFound", key, err)
+		}
+		if err := v.Del(testService, key); err != ErrNotFound {
+			t.Errorf("Vault.Del(%q) of a missing key = %v, want ErrNotFound", key, err)
+		}
+	}
+
+	// Setters apply to it, and it can't be closed
+	mem := useMemory(t)
+	if err := Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := mem.Get(t.Context(), testService, "key"); err != nil {
+		t.Errorf("Set after SetDefaultBackend missed the new backend: %v", err)
+	}
+	if err := v.Close(); err == nil {
+		t.Error("Close of the default Vault succeeded")
+	}
+	if _, err := Get(testService, "key"); err != nil {
+		t.Errorf("Get after closing the default Vault = %v", err)
+	}
+}
+
+func TestNewFromDefaults(t *testing.T) {
+	mem := useMemory(t)
+	SetKeyMapper(func(service, key string) (string, string) { return "mapped-" + service, key })
+	SetEnvOverrides(true)
+	SetAppIdentity("snapshot-app")
+	t.Cleanup(func() {
+		SetKeyMapper(nil)
+		SetEnvOverrides(false)
+		SetAppIdentity("")
+	})
+
+	v, err := NewFromDefaults(WithTimeout(time.Minute))
+	if err != nil {
+		t.Fatalf("NewFromDefaults failed: %v", err)
+	}
+	// Later settings don't affect it
+	SetDefaultBackend(NewMemoryBackend())
+	SetKeyMapper(nil)
+	SetEnvOverrides(false)
+	SetAppIdentity("other-app")
+
+	if err := v.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	md, err := mem.metadata(t.Context(), "mapped-"+testService, "key")
+	if err != nil {
+		t.Fatalf("the snapshot's backend and key mapper were not used: %v", err)
+	}
+	if md.App != "snapshot-app" {
+		t.Errorf("app identity = %q, want %q", md.App, "snapshot-app")
+	}
+	t.Setenv(envOverrideName(testService, "key"), "override")
+	if got, err := v.Get(testService, "key"); err != nil || string(got) != "override" {
+		t.Errorf("Get = %q, %v, want the environment override", got, err)
+	}
+	if _, err := NewFromDefaults(WithTimeout(-1)); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("NewFromDefaults with an invalid option = %v, want an error", err)
+	}
+}
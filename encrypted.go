@@ -0,0 +1,825 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/fips140"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Encrypted file storage. Each secret is a file, as for the plain file
+// backend, holding encryptedPrefix followed by the base64 encoding of an
+// AES-256-GCM sealed value (random nonce, ciphertext, tag), whose
+// additional data is entryAD of its service and key, so that a file moved
+// over another secret's fails to open instead of passing as its value. The
+// key is derived from a passphrase with a KDF, Argon2id by default (see
+// kdf.go); the derivation function, its parameters and the salt live in a
+// key header, by default the file keyHeaderName in the storage directory
+// (see keyheader.go). In FIPS mode only FIPS 140-3 approved algorithms are
+// used.
+//
+// Values written by SetReader are instead encrypted in chunks, so they can
+// be streamed: encryptedStreamPrefix is followed by the base64 encoding of
+// a sequence of frames, each a big-endian uint32 length and a sealed chunk
+// of up to streamChunkSize bytes. A chunk's additional data is the entry's
+// followed by its index and whether it is the last one, so chunks cannot
+// be reordered, dropped or truncated without Open failing.
+
+const (
+	// encryptedPrefix marks encrypted entries. It contains ':', which is not
+	// in the base64 alphabet, so encrypted entries can never be confused
+	// with legacy base64-only ones.
+	encryptedPrefix       = "vault:aes-256-gcm:"
+	encryptedStreamPrefix = "vault:aes-256-gcm-stream:"
+
+	// entryADContext starts the additional data of entries
+	entryADContext = "ella.to/vault entry\x00"
+
+	streamChunkSize = 64 << 10
+
+	// keyHeaderName is not valid base64url, so List never mistakes it for
+	// a secret.
+	keyHeaderName = ".vault-key"
+
+	kdfPBKDF2SHA256 = "pbkdf2-sha256"
+
+	keyHeaderVersion = 1
+	saltSize         = 16
+	keySize          = 32
+)
+
+// pbkdf2Iterations is the PBKDF2-HMAC-SHA256 work factor for new key
+// headers in FIPS mode, following the OWASP recommendation. Tests lower
+// it.
+var pbkdf2Iterations = 600_000
+
+// keyCheck is sealed into the key header so a wrong passphrase is detected
+// when the backend is opened rather than on the first Get.
+var keyCheck = []byte("ella.to/vault key check")
+
+// EncryptedOption configures NewEncryptedFileBackend.
+type EncryptedOption func(*encryptedConfig)
+
+type encryptedConfig struct {
+	fips        bool
+	sharded     bool
+	indexed     bool
+	requireAuth bool
+	hashNames   bool
+	header      headerStore // nil: keyHeaderName in the backend directory
+	kdf         KDF         // nil: Argon2id, or PBKDF2 in FIPS mode
+
+	idleTimeout time.Duration // 0: keep the key
+	passphrase  func() ([]byte, error)
+}
+
+// FIPSMode restricts the encrypted backend to FIPS 140-3 approved
+// algorithms running in Go's validated cryptographic module. When enabled,
+// NewEncryptedFileBackend fails unless the module is active (for example
+// with GODEBUG=fips140=on, or a binary built with GOFIPS140), and rejects
+// key headers that use a non-approved key derivation function.
+func FIPSMode(enabled bool) EncryptedOption {
+	return func(c *encryptedConfig) {
+		c.fips = enabled
+	}
+}
+
+// ShardByService stores each service's secrets in its own subdirectory of
+// the backend directory, as SetShardByService does for the platform file
+// storage. Entries in the other layout are migrated when the backend is
+// first used.
+func ShardByService(enabled bool) EncryptedOption {
+	return func(c *encryptedConfig) {
+		c.sharded = enabled
+	}
+}
+
+// FileIndex keeps a .vault-index file in the backend directory listing the
+// service and key of every secret next to its file name, as SetFileIndex
+// does for the platform file storage. Names are listed in plain text, as
+// they can already be decoded from the file names; values stay encrypted.
+func FileIndex(enabled bool) EncryptedOption {
+	return func(c *encryptedConfig) {
+		c.indexed = enabled
+	}
+}
+
+// RequireIntegrity makes the encrypted backend refuse entries that are not
+// authenticated: the plain base64 entries of the unencrypted file backend,
+// which NewEncryptedFileBackend otherwise reads so that existing storage
+// can be adopted in place. Get returns ErrCorrupt for them, as for entries
+// that fail decryption. Entries the file storage authenticated with
+// SetFileIntegrityKey are still read. Verify reports unauthenticated
+// entries either way, so they can be found and set again, which encrypts
+// them.
+func RequireIntegrity(enabled bool) EncryptedOption {
+	return func(c *encryptedConfig) {
+		c.requireAuth = enabled
+	}
+}
+
+// keyHeader records how the encryption key of a directory is derived.
+type keyHeader struct {
+	Version int            `json:"version"`
+	KDF     string         `json:"kdf"`
+	Params  map[string]int `json:"params,omitempty"`
+	Salt    []byte         `json:"salt"`
+
+	// Iterations is the PBKDF2 parameter, which headers written before
+	// KDFs were pluggable record here instead of in Params.
+	Iterations int `json:"iterations,omitempty"`
+
+	// Check is keyCheck sealed with the derived key.
+	Check []byte `json:"check"`
+}
+
+// fipsApproved reports whether the header's key derivation is FIPS 140-3
+// approved.
+func (h *keyHeader) fipsApproved() bool {
+	return h.KDF == kdfPBKDF2SHA256
+}
+
+func (h *keyHeader) deriveKey(passphrase []byte, cfg encryptedConfig) ([]byte, error) {
+	kdf, err := headerKDF(h.KDF, cfg)
+	if err != nil {
+		return nil, err
+	}
+	params := h.Params
+	if params == nil && h.KDF == kdfPBKDF2SHA256 {
+		params = map[string]int{"iterations": h.Iterations}
+	}
+	return kdf.DeriveKey(passphrase, h.Salt, params, keySize)
+}
+
+// NewEncryptedFileBackend returns a Backend that stores secrets as
+// AES-256-GCM encrypted files in dir, with a key derived from passphrase.
+// The first call for a directory creates its key header; later calls must
+// use the same passphrase or get ErrWrongPassphrase. Backends keep their
+// header and key to themselves, so several directories can be open at once
+// with different passphrases; NewEncryptedSingleFileBackend keeps a vault
+// in a single file instead.
+//
+// Entries written by the plain base64 file backend (for example the Linux
+// fallback pointed at the same directory) are still readable, so existing
+// storage can be adopted in place; they are encrypted the next time they
+// are set.
+//
+// The backend implements io.Closer: Close drops its key, after which its
+// operations return ErrClosed.
+func NewEncryptedFileBackend(dir string, passphrase []byte, opts ...EncryptedOption) (Backend, error) {
+	cfg, err := encryptedConfigFor(passphrase, opts)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.hashNames && (cfg.sharded || cfg.indexed) {
+		return nil, fmt.Errorf("%w: HashNames cannot be combined with ShardByService or FileIndex", ErrInvalidValue)
+	}
+	if err := mkdirStorage(dir); err != nil {
+		return nil, err
+	}
+	if err := checkHashedNames(dir, cfg); err != nil {
+		return nil, err
+	}
+
+	header := cfg.header
+	if header == nil {
+		header = fileHeader{filepath.Join(dir, keyHeaderName)}
+	}
+	key, err := openCachedKey(header, passphrase, cfg)
+	if err != nil {
+		return nil, err
+	}
+	b := &encryptedBackend{
+		files: fileStore{
+			dir:   func() (string, error) { return dir, nil },
+			codec: &encryptedCodec{key: key, requireAuth: cfg.requireAuth},
+		},
+		key: key,
+	}
+	b.files.setSharded(cfg.sharded)
+	b.files.setIndexed(cfg.indexed)
+	if cfg.hashNames {
+		b.files.names = newNameIndex(key)
+		b.files.namesPending = true
+	}
+	return b, nil
+}
+
+// encryptedConfigFor applies opts and checks the result, and passphrase,
+// for opening an encrypted backend.
+func encryptedConfigFor(passphrase []byte, opts []EncryptedOption) (encryptedConfig, error) {
+	var cfg encryptedConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if len(passphrase) == 0 {
+		return cfg, fmt.Errorf("%w: empty passphrase", ErrInvalidValue)
+	}
+	if cfg.idleTimeout < 0 || cfg.idleTimeout > 0 && cfg.passphrase == nil {
+		return cfg, fmt.Errorf("%w: KeyIdleTimeout needs a positive duration and a passphrase function", ErrInvalidValue)
+	}
+	if cfg.fips && cfg.kdf != nil && cfg.kdf.Name() != kdfPBKDF2SHA256 {
+		return cfg, fmt.Errorf("vault: key derivation function %q is not FIPS approved", cfg.kdf.Name())
+	}
+	if cfg.fips && !fips140.Enabled() {
+		return cfg, errors.New("vault: FIPS mode requires Go's FIPS 140-3 module, enable it with GODEBUG=fips140=on")
+	}
+	return cfg, nil
+}
+
+// openCachedKey opens the key for passphrase with the header in store, as
+// openKey does, and holds it as cfg asks.
+func openCachedKey(store headerStore, passphrase []byte, cfg encryptedConfig) (*cachedKey, error) {
+	aead, err := openKey(store, passphrase, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var reopen func() (cipher.AEAD, error)
+	if cfg.idleTimeout > 0 {
+		reopen = func() (cipher.AEAD, error) {
+			passphrase, err := cfg.passphrase()
+			if err != nil {
+				return nil, fmt.Errorf("vault: failed to get passphrase: %w", err)
+			}
+			defer clear(passphrase)
+			return openKey(store, passphrase, cfg)
+		}
+	}
+	return newCachedKey(aead, cfg.idleTimeout, reopen), nil
+}
+
+// UpgradeFileStorage encrypts, in place, the secrets the platform file
+// storage (the Linux fallback, iOS and Android) holds in the legacy base64
+// format, and returns how many it converted. The directory gets a key
+// header derived from passphrase, as with NewEncryptedFileBackend, which
+// must be used with the same opts to read it from then on:
+//
+//	dir, _ := vault.FileStorageDir()
+//	backend, err := vault.NewEncryptedFileBackend(dir, passphrase)
+//	vault.SetDefaultBackend(backend)
+//
+// Entries that are already encrypted are skipped, so it can be run again
+// safely. Each entry is replaced atomically, so an interrupted upgrade
+// leaves every secret readable in either format and is completed by the
+// next run. In the flat layout, entries whose service and key hold more
+// than one slash between them are left unencrypted, since their file name
+// doesn't tell where the service ends and the value is sealed with both:
+// they stay readable, and are encrypted the next time they are set. On
+// the other platforms it returns an error wrapping errors.ErrUnsupported.
+func UpgradeFileStorage(passphrase []byte, opts ...EncryptedOption) (upgraded int, err error) {
+	if platformFiles == nil {
+		return 0, errNoFileStorage
+	}
+	return upgradeFiles(platformFiles, passphrase, opts...)
+}
+
+// upgradeFiles encrypts the legacy entries of files with the key for
+// passphrase.
+func upgradeFiles(files *fileStore, passphrase []byte, opts ...EncryptedOption) (int, error) {
+	dir, sharded, err := files.layout()
+	if err != nil {
+		return 0, err
+	}
+	b, err := NewEncryptedFileBackend(dir, passphrase, append(opts, ShardByService(sharded))...)
+	if err != nil {
+		return 0, err
+	}
+	release, err := b.(*encryptedBackend).useKey()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	enc := &b.(*encryptedBackend).files
+
+	stored, err := files.files()
+	if err != nil {
+		return 0, err
+	}
+
+	upgraded := 0
+	for _, f := range stored {
+		data, err := readSecretFile(f.path)
+		if os.IsNotExist(err) {
+			// Deleted since the directory was read
+			continue
+		}
+		if err != nil {
+			return upgraded, fmt.Errorf("vault: failed to read secret: %w", err)
+		}
+		if isEncrypted(data) {
+			continue
+		}
+
+		value, err := files.codecFor(f.service, f.key).Decode(data)
+		if err != nil {
+			return upgraded, fmt.Errorf("%w: failed to decode secret %s: %w", ErrCorrupt, filepath.Base(f.path), err)
+		}
+		err = enc.reseal(f, value)
+		clear(value)
+		if err != nil {
+			return upgraded, err
+		}
+		upgraded++
+	}
+
+	if err := files.sync(); err != nil {
+		return upgraded, err
+	}
+	return upgraded, nil
+}
+
+// reseal encrypts the file f again with value, keeping its app identity.
+func (s *fileStore) reseal(f storedFile, value []byte) error {
+	sealed, err := s.codecFor(f.service, f.key).Encode(value)
+	if err != nil {
+		return fmt.Errorf("vault: failed to encrypt secret: %w", err)
+	}
+	app := fileApp(f.path)
+	if err := writeFileAtomic(f.path, func(w io.Writer) error {
+		_, err := w.Write(sealed)
+		return err
+	}); err != nil {
+		return fmt.Errorf("vault: failed to write secret: %w", err)
+	}
+	setFileApp(f.path, app)
+	return nil
+}
+
+// openKey loads the key header from store, creating it on first use, and
+// returns the AEAD for the key passphrase derives from it.
+func openKey(store headerStore, passphrase []byte, cfg encryptedConfig) (cipher.AEAD, error) {
+	data, err := store.load()
+	if errors.Is(err, fs.ErrNotExist) {
+		return createKey(store, passphrase, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to read key header: %w", err)
+	}
+
+	var header keyHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("vault: invalid key header: %w", err)
+	}
+	if header.Version != keyHeaderVersion {
+		return nil, fmt.Errorf("vault: unsupported key header version %d", header.Version)
+	}
+	if cfg.fips && !header.fipsApproved() {
+		return nil, fmt.Errorf("vault: key derivation function %q is not FIPS approved", header.KDF)
+	}
+
+	key, err := header.deriveKey(passphrase, cfg)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	clear(key)
+	if err != nil {
+		return nil, err
+	}
+	if check, err := aead.Open(nil, nil, header.Check, nil); err != nil || !bytes.Equal(check, keyCheck) {
+		return nil, ErrWrongPassphrase
+	}
+	return aead, nil
+}
+
+func createKey(store headerStore, passphrase []byte, cfg encryptedConfig) (cipher.AEAD, error) {
+	kdf := newKDF(cfg)
+	header := keyHeader{
+		Version: keyHeaderVersion,
+		KDF:     kdf.Name(),
+		Params:  kdf.Params(),
+		Salt:    make([]byte, saltSize),
+	}
+	rand.Read(header.Salt)
+
+	key, err := header.deriveKey(passphrase, cfg)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	clear(key)
+	if err != nil {
+		return nil, err
+	}
+	header.Check = aead.Seal(nil, nil, keyCheck, nil)
+
+	data, err := json.Marshal(&header)
+	if err != nil {
+		return nil, err
+	}
+
+	// A concurrent first open that loses the race opens the winner's
+	// header instead of replacing it.
+	err = store.create(data)
+	if errors.Is(err, fs.ErrExist) {
+		return openKey(store, passphrase, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to create key header: %w", err)
+	}
+	return aead, nil
+}
+
+// newAEAD returns AES-256-GCM with random nonces, the mode Go's FIPS
+// module approves: Seal generates the nonce and prepends it to the
+// ciphertext, and Open expects it there.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithRandomNonce(block)
+}
+
+// encryptedCodec seals values with an AEAD. On Decode it also accepts the
+// plain base64 encoding written by the unencrypted file backend.
+type encryptedCodec struct {
+	key         *cachedKey
+	requireAuth bool   // reject plain base64 entries
+	ad          []byte // the entry additional data; see bind
+}
+
+// bind returns the codec of the values of service and key, which seals
+// them with entryAD(service, key).
+func (c *encryptedCodec) bind(service, key string) valueCodec {
+	return &encryptedCodec{key: c.key, requireAuth: c.requireAuth, ad: entryAD(service, key)}
+}
+
+// entryAD returns the additional data the value of service and key is
+// sealed with. The length of service separates it from key.
+func entryAD(service, key string) []byte {
+	ad := binary.BigEndian.AppendUint64([]byte(entryADContext), uint64(len(service)))
+	ad = append(ad, service...)
+	return append(ad, key...)
+}
+
+// errUnauthenticated is returned for plain base64 entries with
+// RequireIntegrity.
+var errUnauthenticated = errors.New("entry is not authenticated")
+
+// cipher returns the AEAD values are sealed with, or nil if the key is
+// evicted.
+func (c *encryptedCodec) cipher() cipher.AEAD {
+	return c.key.current()
+}
+
+func (c *encryptedCodec) Encode(value []byte) ([]byte, error) {
+	aead := c.cipher()
+	if aead == nil {
+		return nil, errKeyLocked
+	}
+	sealed := aead.Seal(nil, nil, value, c.ad)
+
+	out := make([]byte, len(encryptedPrefix)+base64.StdEncoding.EncodedLen(len(sealed)))
+	copy(out, encryptedPrefix)
+	base64.StdEncoding.Encode(out[len(encryptedPrefix):], sealed)
+	return out, nil
+}
+
+func (c *encryptedCodec) Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+
+	if bytes.HasPrefix(data, []byte(encryptedStreamPrefix)) {
+		return io.ReadAll(c.NewDecoder(bytes.NewReader(data)))
+	}
+
+	encoded, ok := bytes.CutPrefix(data, []byte(encryptedPrefix))
+	if !ok {
+		// Legacy entry written before encryption, possibly authenticated
+		if c.requireAuth && !bytes.HasPrefix(data, []byte(integrityPrefix)) {
+			return nil, errUnauthenticated
+		}
+		return fileCodec{}.Decode(data)
+	}
+
+	sealed, err := base64Codec{}.Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	aead := c.cipher()
+	if aead == nil {
+		return nil, errKeyLocked
+	}
+	value, err := aead.Open(nil, nil, sealed, c.ad)
+	if err != nil {
+		return nil, errors.New("authentication failed")
+	}
+	return value, nil
+}
+
+// isEncrypted reports whether data is an encrypted entry, in either format.
+func isEncrypted(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return bytes.HasPrefix(data, []byte(encryptedPrefix)) || bytes.HasPrefix(data, []byte(encryptedStreamPrefix))
+}
+
+// NewEncoder encrypts the value written to it in chunks, in the stream
+// format.
+func (c *encryptedCodec) NewEncoder(w io.Writer) io.WriteCloser {
+	aead := c.cipher()
+	if aead == nil {
+		return &sealWriter{err: errKeyLocked}
+	}
+	return &sealWriter{aead: aead, ad: c.ad, w: w, buf: make([]byte, 0, streamChunkSize)}
+}
+
+// NewDecoder decrypts an entry in any format: the stream format chunk by
+// chunk, single sealed values whole, and legacy base64 entries.
+func (c *encryptedCodec) NewDecoder(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if prefix, _ := br.Peek(len(encryptedStreamPrefix)); string(prefix) == encryptedStreamPrefix {
+		br.Discard(len(prefix))
+		aead := c.cipher()
+		if aead == nil {
+			return errReader{errKeyLocked}
+		}
+		return &openReader{aead: aead, ad: c.ad, r: base64.NewDecoder(base64.StdEncoding, br)}
+	}
+	if prefix, _ := br.Peek(len(encryptedPrefix)); string(prefix) == encryptedPrefix {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return errReader{err}
+		}
+		value, err := c.Decode(data)
+		if err != nil {
+			return errReader{err}
+		}
+		return bytes.NewReader(value)
+	}
+	// Legacy entry written before encryption
+	if prefix, _ := br.Peek(len(integrityPrefix)); c.requireAuth && string(prefix) != integrityPrefix {
+		return errReader{errUnauthenticated}
+	}
+	return fileCodec{}.NewDecoder(br)
+}
+
+// chunkAD returns the additional data chunk index of the entry with
+// additional data entry is sealed with.
+func chunkAD(entry []byte, index uint64, last bool) []byte {
+	ad := binary.BigEndian.AppendUint64(append(make([]byte, 0, len(entry)+9), entry...), index)
+	if last {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+// sealWriter buffers up to a chunk of plaintext and writes each full chunk
+// as a sealed frame. Close seals the remainder, possibly empty, as the last
+// chunk.
+type sealWriter struct {
+	aead  cipher.AEAD
+	ad    []byte // the entry additional data
+	w     io.Writer
+	b64   io.WriteCloser
+	buf   []byte
+	index uint64
+	err   error
+}
+
+func (s *sealWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 && s.err == nil {
+		if len(s.buf) == streamChunkSize {
+			s.emit(false)
+			continue
+		}
+		m := copy(s.buf[len(s.buf):cap(s.buf)], p)
+		s.buf = s.buf[:len(s.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, s.err
+}
+
+func (s *sealWriter) Close() error {
+	s.emit(true)
+	if s.err == nil {
+		s.err = s.b64.Close()
+	}
+	return s.err
+}
+
+func (s *sealWriter) emit(last bool) {
+	if s.err != nil {
+		return
+	}
+	if s.b64 == nil {
+		if _, s.err = io.WriteString(s.w, encryptedStreamPrefix); s.err != nil {
+			return
+		}
+		s.b64 = base64.NewEncoder(base64.StdEncoding, s.w)
+	}
+
+	sealed := s.aead.Seal(nil, nil, s.buf, chunkAD(s.ad, s.index, last))
+	frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(sealed)), uint32(len(sealed)))
+	if _, s.err = s.b64.Write(append(frame, sealed...)); s.err != nil {
+		return
+	}
+	s.buf = s.buf[:0]
+	s.index++
+}
+
+// openReader returns the plaintext of the frames read from r, releasing
+// each chunk only once it has been authenticated.
+type openReader struct {
+	aead  cipher.AEAD
+	ad    []byte // the entry additional data
+	r     io.Reader
+	chunk []byte
+	index uint64
+	done  bool
+	err   error
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for len(o.chunk) == 0 && o.err == nil {
+		o.next()
+	}
+	if len(o.chunk) > 0 {
+		n := copy(p, o.chunk)
+		o.chunk = o.chunk[n:]
+		return n, nil
+	}
+	return 0, o.err
+}
+
+func (o *openReader) next() {
+	var size [4]byte
+	if _, err := io.ReadFull(o.r, size[:]); err != nil {
+		switch {
+		case err == io.EOF && o.done:
+			o.err = io.EOF
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			o.err = errors.New("truncated encrypted stream")
+		default:
+			o.err = err
+		}
+		return
+	}
+	if o.done {
+		o.err = errors.New("data after the last encrypted chunk")
+		return
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n > streamChunkSize+uint32(o.aead.NonceSize()+o.aead.Overhead()) {
+		o.err = errors.New("encrypted chunk too large")
+		return
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(o.r, sealed); err != nil {
+		o.err = errors.New("truncated encrypted stream")
+		return
+	}
+
+	// A chunk is the last one if it opens with the last flag set
+	chunk, err := o.aead.Open(nil, nil, sealed, chunkAD(o.ad, o.index, false))
+	if err != nil {
+		if chunk, err = o.aead.Open(nil, nil, sealed, chunkAD(o.ad, o.index, true)); err != nil {
+			o.err = errors.New("authentication failed")
+			return
+		}
+		o.done = true
+	}
+	o.chunk = chunk
+	o.index++
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+type encryptedBackend struct {
+	files fileStore
+	key   *cachedKey
+}
+
+func (b *encryptedBackend) Set(ctx context.Context, service, key string, value []byte) error {
+	if !validBackendKey(service, key) {
+		return ErrInvalidKey
+	}
+	if len(value) == 0 {
+		return ErrInvalidValue
+	}
+	release, err := b.useKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return b.files.set(ctx, service, key, value)
+}
+
+func (b *encryptedBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	if !validBackendKey(service, key) {
+		return nil, ErrInvalidKey
+	}
+	release, err := b.useKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return b.files.get(ctx, service, key)
+}
+
+func (b *encryptedBackend) Del(ctx context.Context, service, key string) error {
+	if !validBackendKey(service, key) {
+		return ErrInvalidKey
+	}
+	release, err := b.useKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return b.files.del(ctx, service, key)
+}
+
+func (b *encryptedBackend) List(ctx context.Context, service string) ([]string, error) {
+	if service == "" {
+		return nil, ErrInvalidKey
+	}
+	release, err := b.useKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	keys, err := b.files.list(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	return withoutReservedKeys(keys), nil
+}
+
+func (b *encryptedBackend) getRaw(ctx context.Context, service, key string) ([]byte, error) {
+	release, err := b.useKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return b.files.getRaw(ctx, service, key)
+}
+
+func (b *encryptedBackend) metadata(ctx context.Context, service, key string) (Metadata, error) {
+	if !validBackendKey(service, key) {
+		return Metadata{}, ErrInvalidKey
+	}
+	release, err := b.useKey()
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer release()
+	return b.files.metadata(ctx, service, key)
+}
+
+func (b *encryptedBackend) setReader(ctx context.Context, service, key string, r io.Reader) error {
+	if !validBackendKey(service, key) {
+		return ErrInvalidKey
+	}
+	release, err := b.useKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return b.files.setReader(ctx, service, key, r)
+}
+
+func (b *encryptedBackend) getReader(ctx context.Context, service, key string) (io.ReadCloser, error) {
+	if !validBackendKey(service, key) {
+		return nil, ErrInvalidKey
+	}
+	release, err := b.useKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return b.files.getReader(ctx, service, key)
+}
+
+func (b *encryptedBackend) verify(ctx context.Context, repair bool) ([]Problem, error) {
+	release, err := b.useKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return b.files.verify(ctx, repair)
+}
+
+func (b *encryptedBackend) sync() error {
+	return b.files.sync()
+}
@@ -0,0 +1,446 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/fips140"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fastKDF makes key derivation cheap for the duration of a test.
+func fastKDF(t *testing.T) {
+	oldIterations, oldTime, oldMemory := pbkdf2Iterations, argon2Time, argon2Memory
+	pbkdf2Iterations, argon2Time, argon2Memory = 1000, 1, 64
+	t.Cleanup(func() { pbkdf2Iterations, argon2Time, argon2Memory = oldIterations, oldTime, oldMemory })
+}
+
+func secretFile(dir, service, key string) string {
+	return filepath.Join(dir, base64.URLEncoding.EncodeToString([]byte(service+"/"+key)))
+}
+
+func TestEncryptedFileBackend(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	value := []byte("hello 世界 \x00\xff secret")
+
+	backend, err := NewEncryptedFileBackend(dir, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+
+	if err := backend.Set(ctx, testService, "key", value); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	got, err := backend.Get(ctx, testService, "key")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Errorf("Get returned %q, want %q", got, value)
+	}
+
+	// Neither the value nor its base64 form is stored
+	data, err := os.ReadFile(secretFile(dir, testService, "key"))
+	if err != nil {
+		t.Fatalf("reading secret file: %v", err)
+	}
+	if !strings.HasPrefix(string(data), encryptedPrefix) {
+		t.Errorf("stored entry %q lacks the encryption prefix", data)
+	}
+	if bytes.Contains(data, value) || bytes.Contains(data, []byte(base64.StdEncoding.EncodeToString(value))) {
+		t.Error("stored entry contains the plaintext value")
+	}
+
+	// A second instance with the same passphrase reads it back
+	reopened, err := NewEncryptedFileBackend(dir, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	if got, err := reopened.Get(ctx, testService, "key"); err != nil || !bytes.Equal(got, value) {
+		t.Errorf("Get after reopen = %q, %v, want %q", got, err, value)
+	}
+
+	keys, err := backend.List(ctx, testService)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "key" {
+		t.Errorf("List returned %q, want [key]", keys)
+	}
+
+	if err := backend.Del(ctx, testService, "key"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if _, err := backend.Get(ctx, testService, "key"); err != ErrNotFound {
+		t.Errorf("Get after Del = %v, want ErrNotFound", err)
+	}
+}
+
+func TestEncryptedFileBackendWrongPassphrase(t *testing.T) {
+	fastKDF(t)
+	dir := t.TempDir()
+
+	if _, err := NewEncryptedFileBackend(dir, []byte("first")); err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if _, err := NewEncryptedFileBackend(dir, []byte("second")); err != ErrWrongPassphrase {
+		t.Errorf("opening with another passphrase = %v, want ErrWrongPassphrase", err)
+	}
+	if _, err := NewEncryptedFileBackend(dir, nil); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("opening with empty passphrase = %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestEncryptedFileBackendLegacyEntries(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// An entry written by the plain file backend
+	plain := &fileStore{dir: func() (string, error) { return dir, nil }, codec: defaultCodec}
+	if err := plain.set(ctx, testService, "legacy", []byte("old value")); err != nil {
+		t.Fatalf("writing legacy entry: %v", err)
+	}
+
+	backend, err := NewEncryptedFileBackend(dir, []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	got, err := backend.Get(ctx, testService, "legacy")
+	if err != nil {
+		t.Fatalf("Get of legacy entry failed: %v", err)
+	}
+	if string(got) != "old value" {
+		t.Errorf("Get of legacy entry returned %q, want %q", got, "old value")
+	}
+}
+
+func TestEncryptedFileBackendRequireIntegrity(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	plain := &fileStore{dir: func() (string, error) { return dir, nil }, codec: defaultCodec}
+	if err := plain.set(ctx, testService, "legacy", []byte("old value")); err != nil {
+		t.Fatalf("writing legacy entry: %v", err)
+	}
+	useIntegrityKey(t, bytes.Repeat([]byte("k"), 32))
+	authenticated := &fileStore{dir: func() (string, error) { return dir, nil }, codec: fileCodec{}}
+	if err := authenticated.set(ctx, testService, "hmac", []byte("mac value")); err != nil {
+		t.Fatalf("writing authenticated entry: %v", err)
+	}
+
+	backend, err := NewEncryptedFileBackend(dir, []byte("passphrase"), RequireIntegrity(true))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if _, err := backend.Get(ctx, testService, "legacy"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Get of an unauthenticated entry = %v, want ErrCorrupt", err)
+	}
+	r, err := backend.(streamer).getReader(ctx, testService, "legacy")
+	if err == nil {
+		_, err = io.ReadAll(r)
+		r.Close()
+	}
+	if err == nil {
+		t.Error("streaming an unauthenticated entry succeeded")
+	}
+	if got, err := backend.Get(ctx, testService, "hmac"); err != nil || string(got) != "mac value" {
+		t.Errorf("Get of an authenticated entry = %q, %v, want mac value", got, err)
+	}
+
+	// Verify reports the entry, with or without the option, and Repair
+	// leaves it in place
+	lenient, err := NewEncryptedFileBackend(dir, []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	for _, b := range []Backend{backend, lenient} {
+		problems, err := b.(verifier).verify(ctx, true)
+		if err != nil {
+			t.Fatalf("verify failed: %v", err)
+		}
+		if len(problems) != 1 || problems[0].Kind != ProblemUnauthenticated || problems[0].Key != "legacy" || problems[0].Repaired {
+			t.Errorf("verify = %v, want the unauthenticated legacy entry", problems)
+		}
+	}
+
+	// Setting it again encrypts it
+	if err := backend.Set(ctx, testService, "legacy", []byte("new value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, err := backend.Get(ctx, testService, "legacy"); err != nil || string(got) != "new value" {
+		t.Errorf("Get after Set = %q, %v, want new value", got, err)
+	}
+}
+
+func TestEncryptedFileBackendTamperedStream(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	backend, err := NewEncryptedFileBackend(dir, []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	value := bytes.Repeat([]byte("x"), 3*streamChunkSize/2)
+	if err := backend.(streamer).setReader(ctx, testService, "key", bytes.NewReader(value)); err != nil {
+		t.Fatalf("setReader failed: %v", err)
+	}
+
+	path := secretFile(dir, testService, "key")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading secret file: %v", err)
+	}
+	stream, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(string(data), encryptedStreamPrefix))
+	stream[len(stream)/2] ^= 0x01
+	tampered := encryptedStreamPrefix + base64.StdEncoding.EncodeToString(stream)
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatalf("writing tampered entry: %v", err)
+	}
+
+	if _, err := backend.Get(ctx, testService, "key"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Get of a tampered stream = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestEncryptedFileBackendTampered(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	backend, err := NewEncryptedFileBackend(dir, []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if err := backend.Set(ctx, testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	path := secretFile(dir, testService, "key")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading secret file: %v", err)
+	}
+	sealed, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(string(data), encryptedPrefix))
+	sealed[len(sealed)-1] ^= 0x01
+	tampered := encryptedPrefix + base64.StdEncoding.EncodeToString(sealed)
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatalf("writing tampered entry: %v", err)
+	}
+
+	if _, err := backend.Get(ctx, testService, "key"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Get of tampered entry: expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestEncryptedFileBackendSwapped(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	backend, err := NewEncryptedFileBackend(dir, []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if err := backend.Set(ctx, testService, "admin", []byte("admin value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := backend.(streamer).setReader(ctx, testService, "streamed", strings.NewReader("streamed value")); err != nil {
+		t.Fatalf("setReader failed: %v", err)
+	}
+	if err := backend.Set(ctx, testService, "user", []byte("user value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// Files moved over another secret's don't open as its value
+	for _, from := range []string{"admin", "streamed"} {
+		data, err := os.ReadFile(secretFile(dir, testService, from))
+		if err != nil {
+			t.Fatalf("reading secret file: %v", err)
+		}
+		if err := os.WriteFile(secretFile(dir, testService, "user"), data, 0o600); err != nil {
+			t.Fatalf("writing swapped entry: %v", err)
+		}
+		if value, err := backend.Get(ctx, testService, "user"); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Get of %s's file as another key = %q, %v, want ErrCorrupt", from, value, err)
+		}
+	}
+}
+
+func TestEncryptedFileBackendFIPSMode(t *testing.T) {
+	fastKDF(t)
+	dir := t.TempDir()
+
+	_, err := NewEncryptedFileBackend(dir, []byte("passphrase"), FIPSMode(true))
+	if fips140.Enabled() {
+		if err != nil {
+			t.Fatalf("NewEncryptedFileBackend in FIPS mode failed: %v", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatal("NewEncryptedFileBackend in FIPS mode succeeded without the FIPS module")
+	}
+}
+
+func TestKeyHeaderFIPSApproved(t *testing.T) {
+	fastKDF(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, keyHeaderName)
+
+	header := `{"version":1,"kdf":"md5-crypt","iterations":1,"salt":"AAAAAAAAAAAAAAAAAAAAAA==","check":""}`
+	if err := os.WriteFile(path, []byte(header), 0o600); err != nil {
+		t.Fatalf("writing key header: %v", err)
+	}
+
+	if _, err := openKey(fileHeader{path}, []byte("passphrase"), encryptedConfig{fips: true}); err == nil || !strings.Contains(err.Error(), "not FIPS approved") {
+		t.Errorf("openKey in FIPS mode with non-approved KDF = %v, want rejection", err)
+	}
+}
+
+func TestEncryptedFileBackendSharded(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	backend, err := NewEncryptedFileBackend(dir, []byte("correct horse"), ShardByService(true))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if err := backend.Set(ctx, testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := os.Stat(shardFile(dir, testService, "key")); err != nil {
+		t.Errorf("sharded secret file missing: %v", err)
+	}
+	if got, err := backend.Get(ctx, testService, "key"); err != nil || string(got) != "value" {
+		t.Errorf("Get = %q, %v, want value", got, err)
+	}
+}
+
+func TestUpgradeFiles(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	legacy, dir := newTestFileStore(t)
+	secrets := map[string]string{"one": "1", "two": "2 \x00 binary"}
+	for key, value := range secrets {
+		if err := legacy.set(ctx, testService, key, []byte(value)); err != nil {
+			t.Fatalf("set failed: %v", err)
+		}
+	}
+
+	upgraded, err := upgradeFiles(legacy, []byte("correct horse"))
+	if err != nil || upgraded != 2 {
+		t.Fatalf("upgradeFiles = %d, %v, want 2", upgraded, err)
+	}
+	for key := range secrets {
+		data, err := os.ReadFile(secretFile(dir, testService, key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), encryptedPrefix) {
+			t.Errorf("entry %q was not encrypted", key)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".vault-tmp-") {
+			t.Errorf("temporary file %q left behind", entry.Name())
+		}
+	}
+
+	backend, err := NewEncryptedFileBackend(dir, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	for key, value := range secrets {
+		if got, err := backend.Get(ctx, testService, key); err != nil || string(got) != value {
+			t.Errorf("Get %q = %q, %v, want %q", key, got, err, value)
+		}
+	}
+
+	// Running it again converts nothing
+	if upgraded, err := upgradeFiles(legacy, []byte("correct horse")); err != nil || upgraded != 0 {
+		t.Errorf("second upgradeFiles = %d, %v, want 0", upgraded, err)
+	}
+
+	if _, err := upgradeFiles(legacy, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("upgradeFiles with another passphrase: expected ErrWrongPassphrase, got %v", err)
+	}
+}
+
+// TestEncryptedFileSlashes checks that entries whose service contains a
+// slash, so that their flat file name can be split several ways, are
+// neither encrypted with the wrong names nor taken for corrupt.
+func TestEncryptedFileSlashes(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	passphrase := []byte("passphrase")
+	names := [][2]string{{"aws/prod", "root"}, {"aws", "prod/other"}, {"svc", "key"}}
+
+	t.Run("upgrade", func(t *testing.T) {
+		legacy, dir := newTestFileStore(t)
+		for _, name := range names {
+			if err := legacy.set(ctx, name[0], name[1], []byte(name[0]+" "+name[1])); err != nil {
+				t.Fatalf("set failed: %v", err)
+			}
+		}
+		if upgraded, err := upgradeFiles(legacy, passphrase); err != nil || upgraded != 1 {
+			t.Fatalf("upgradeFiles = %d, %v, want only svc/key", upgraded, err)
+		}
+		b, err := NewEncryptedFileBackend(dir, passphrase)
+		if err != nil {
+			t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+		}
+		for _, name := range names {
+			if value, err := b.Get(ctx, name[0], name[1]); err != nil || string(value) != name[0]+" "+name[1] {
+				t.Errorf("Get(%s, %s) after the upgrade = %q, %v", name[0], name[1], value, err)
+			}
+		}
+	})
+
+	for _, opts := range [][]EncryptedOption{nil, {HashNames(true)}, {ShardByService(true)}} {
+		dir := t.TempDir()
+		b, err := NewEncryptedFileBackend(dir, passphrase, opts...)
+		if err != nil {
+			t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+		}
+		for _, name := range names {
+			if err := b.Set(ctx, name[0], name[1], []byte(name[0]+" "+name[1])); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+		}
+		if problems, err := b.(*encryptedBackend).verify(ctx, true); err != nil || len(problems) != 0 {
+			t.Errorf("repair with %d options = %v, %v, want no problems", len(opts), problems, err)
+		}
+		for _, name := range names {
+			if value, err := b.Get(ctx, name[0], name[1]); err != nil || string(value) != name[0]+" "+name[1] {
+				t.Errorf("Get(%s, %s) after repair with %d options = %q, %v", name[0], name[1], len(opts), value, err)
+			}
+		}
+
+		if len(opts) == 0 {
+			// Moving the flat files into shards splits their names too
+			if b, err = NewEncryptedFileBackend(dir, passphrase, ShardByService(true)); err != nil {
+				t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+			}
+			for _, name := range names {
+				if value, err := b.Get(ctx, name[0], name[1]); err != nil || string(value) != name[0]+" "+name[1] {
+					t.Errorf("Get(%s, %s) after sharding = %q, %v", name[0], name[1], value, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Environment variables that select the default backend without code
+// changes, for sandboxes such as gVisor or strict seccomp profiles that
+// block exec, where the backends that run security or secret-tool fail.
+//
+// With VAULT_BACKEND=file, the package-level functions use the encrypted
+// file backend (NewEncryptedFileBackend) on every platform, and never start
+// a subprocess. The passphrase is taken from VAULT_PASSPHRASE, and the
+// directory from VAULT_FILE_DIR, by default the platform's file storage
+// directory (see FileStorageDir), or a vault-secrets directory in the
+// user's configuration directory where there is none. VAULT_BACKEND=native
+// or unset keeps the native storage. SetDefaultBackend takes precedence.
+const (
+	envBackend    = "VAULT_BACKEND"
+	envPassphrase = "VAULT_PASSPHRASE"
+	envFileDir    = "VAULT_FILE_DIR"
+)
+
+// envState holds the backend the environment selects, which is opened once
+// per process: deriving the file key is deliberately slow. Tests replace it.
+var envState = new(envDefault)
+
+type envDefault struct {
+	once sync.Once
+	b    Backend // nil: the native storage
+}
+
+// envDefaultBackend returns the backend the environment selects, or nil
+// for the native storage. A configuration that cannot be used yields a
+// backend failing every operation with ErrBackendUnavailable, rather than
+// silently falling back to storage that runs subprocesses.
+func envDefaultBackend() Backend {
+	s := envState
+	s.once.Do(func() {
+		b, err := openEnvBackend()
+		if err != nil {
+			b = unavailableBackend{err}
+		}
+		s.b = b
+	})
+	return s.b
+}
+
+func openEnvBackend() (Backend, error) {
+	switch kind := os.Getenv(envBackend); kind {
+	case "", "native":
+		return nil, nil
+	case "file":
+	default:
+		return nil, fmt.Errorf("%w: %s=%q, want file or native", ErrBackendUnavailable, envBackend, kind)
+	}
+
+	passphrase := os.Getenv(envPassphrase)
+	if passphrase == "" {
+		return nil, fmt.Errorf("%w: %s=file requires %s", ErrBackendUnavailable, envBackend, envPassphrase)
+	}
+	dir, err := envFileStorageDir()
+	if err != nil {
+		return nil, fmt.Errorf("%w: no directory for %s=file, set %s: %v", ErrBackendUnavailable, envBackend, envFileDir, err)
+	}
+	b, err := NewEncryptedFileBackend(dir, []byte(passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+	}
+	return b, nil
+}
+
+func envFileStorageDir() (string, error) {
+	if dir := os.Getenv(envFileDir); dir != "" {
+		return dir, nil
+	}
+	if platformFiles != nil {
+		return platformFiles.dir()
+	}
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(config, "vault-secrets"), nil
+}
+
+// unavailableBackend fails every operation with err.
+type unavailableBackend struct {
+	err error
+}
+
+func (b unavailableBackend) Set(context.Context, string, string, []byte) error {
+	return b.err
+}
+
+func (b unavailableBackend) Get(context.Context, string, string) ([]byte, error) {
+	return nil, b.err
+}
+
+func (b unavailableBackend) Del(context.Context, string, string) error {
+	return b.err
+}
+
+func (b unavailableBackend) List(context.Context, string) ([]string, error) {
+	return nil, b.err
+}
@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+// useEnv sets the environment variables selecting the default backend and
+// makes it be opened again.
+func useEnv(t *testing.T, env map[string]string) {
+	for _, name := range []string{envBackend, envPassphrase, envFileDir} {
+		t.Setenv(name, env[name])
+	}
+	SetDefaultBackend(nil)
+	old := envState
+	envState = new(envDefault)
+	t.Cleanup(func() { envState = old })
+}
+
+func TestEnvFileBackend(t *testing.T) {
+	fastKDF(t)
+	dir := t.TempDir()
+	useEnv(t, map[string]string{envBackend: "file", envPassphrase: "passphrase", envFileDir: dir})
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		t.Errorf("ran %s with %s=file", name, envBackend)
+		return nil, nil, errors.New("no exec")
+	})
+	t.Cleanup(func() { SetCommandRunner(nil) })
+
+	if err := Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, err := Get(testService, "key"); err != nil || string(got) != "value" {
+		t.Errorf("Get = %q, %v, want value", got, err)
+	}
+	data, err := os.ReadFile(secretFile(dir, testService, "key"))
+	if err != nil || !isEncrypted(data) {
+		t.Errorf("secret file = %q, %v, want an encrypted entry", data, err)
+	}
+	if err := Del(testService, "key"); err != nil {
+		t.Errorf("Del failed: %v", err)
+	}
+
+	// SetDefaultBackend takes precedence
+	mem := useMemory(t)
+	if err := Set(testService, "key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mem.Get(context.Background(), testService, "key"); err != nil {
+		t.Errorf("SetDefaultBackend did not take precedence: %v", err)
+	}
+}
+
+func TestEnvBackendInvalid(t *testing.T) {
+	fastKDF(t)
+	for name, env := range map[string]map[string]string{
+		"unknown kind":  {envBackend: "keychain"},
+		"no passphrase": {envBackend: "file", envFileDir: t.TempDir()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			useEnv(t, env)
+			if err := Set(testService, "key", []byte("value")); !errors.Is(err, ErrBackendUnavailable) {
+				t.Errorf("Set: expected ErrBackendUnavailable, got %v", err)
+			}
+			if _, err := List(testService); !errors.Is(err, ErrBackendUnavailable) {
+				t.Errorf("List: expected ErrBackendUnavailable, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEnvNativeBackend(t *testing.T) {
+	useEnv(t, map[string]string{envBackend: "native"})
+	if _, ok := currentBackend().(nativeBackend); !ok {
+		t.Errorf("currentBackend = %T, want the native storage", currentBackend())
+	}
+}
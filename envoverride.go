@@ -0,0 +1,78 @@
+package vault
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envOverridePrefix starts the names of the variables that override
+// secrets, see SetEnvOverrides.
+const envOverridePrefix = "VAULT_OVERRIDE_"
+
+// envOverrideBase64 marks an override holding base64-encoded bytes.
+const envOverrideBase64 = "base64:"
+
+// SetEnvOverrides makes the package-level Get, and the reads built on it,
+// return the value of the variable VAULT_OVERRIDE_<service>_<key> when it
+// is set and not empty, without consulting the storage, to substitute a
+// secret during local development or a test run without touching the
+// keychain. Service and key are upper-cased and every character other than
+// ASCII letters and digits is replaced with '_', so the override of service
+// "my-app" and key "api.token" is VAULT_OVERRIDE_MY_APP_API_TOKEN. A value
+// starting with "base64:" is decoded, for binary secrets. Set, Del and the
+// other writes ignore overrides and go to the storage.
+//
+// Overrides are off by default: anything that can set the environment of
+// the process could otherwise substitute its secrets. Use WithEnvOverrides
+// for a Vault created with New.
+func SetEnvOverrides(enabled bool) {
+	std.envOverrides.Store(enabled)
+}
+
+// WithEnvOverrides lets environment variables override the Vault's
+// secrets, as SetEnvOverrides does for the package-level functions.
+func WithEnvOverrides() Option {
+	return func(v *Vault) {
+		v.envOverrides.Store(true)
+	}
+}
+
+// envOverrideName returns the variable overriding service and key.
+func envOverrideName(service, key string) string {
+	return envOverridePrefix + envName(service) + "_" + envName(key)
+}
+
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// envOverride returns the value overriding service and key, if the Vault
+// allows overrides and the variable is set.
+func (v *Vault) envOverride(service, key string) ([]byte, bool, error) {
+	if !v.envOverrides.Load() || v.closed.Load() {
+		return nil, false, nil
+	}
+	name := envOverrideName(service, key)
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, false, nil
+	}
+	if encoded, ok := strings.CutPrefix(value, envOverrideBase64); ok {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, true, fmt.Errorf("%w: %s is not valid base64", ErrInvalidValue, name)
+		}
+		return decoded, true, nil
+	}
+	return []byte(value), true, nil
+}
@@ -0,0 +1,57 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	v, b := newTestVault(t)
+	ctx := context.Background()
+	if err := v.Set("my-app", "api.token", []byte("stored")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	t.Setenv("VAULT_OVERRIDE_MY_APP_API_TOKEN", "overridden")
+	t.Setenv("VAULT_OVERRIDE_MY_APP_BINARY", "base64:AAH/")
+
+	// Off by default
+	if got, err := v.Get("my-app", "api.token"); err != nil || string(got) != "stored" {
+		t.Errorf("Get without overrides = %q, %v, want stored", got, err)
+	}
+
+	v, b = newTestVault(t, WithEnvOverrides())
+	b.Set(ctx, "my-app", "api.token", []byte("stored"))
+	if got, err := v.Get("my-app", "api.token"); err != nil || string(got) != "overridden" {
+		t.Errorf("Get = %q, %v, want overridden", got, err)
+	}
+	if got, err := v.GetFresh("my-app", "api.token"); err != nil || string(got) != "overridden" {
+		t.Errorf("GetFresh = %q, %v, want overridden", got, err)
+	}
+	if got, err := v.Get("my-app", "binary"); err != nil || !bytes.Equal(got, []byte{0, 1, 0xff}) {
+		t.Errorf("Get of a base64 override = %q, %v", got, err)
+	}
+
+	// Writes go to the storage
+	if err := v.Set("my-app", "api.token", []byte("written")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, _ := b.Get(ctx, "my-app", "api.token"); string(got) != "written" {
+		t.Errorf("stored value = %q, want written", got)
+	}
+	if err := v.Del("my-app", "binary"); err != ErrNotFound {
+		t.Errorf("Del of an overridden key missing from the storage = %v, want ErrNotFound", err)
+	}
+
+	t.Setenv("VAULT_OVERRIDE_MY_APP_BAD", "base64:!")
+	if _, err := v.Get("my-app", "bad"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Get of an invalid base64 override = %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestEnvOverrideName(t *testing.T) {
+	if got, want := envOverrideName("my-app", "db/password"), "VAULT_OVERRIDE_MY_APP_DB_PASSWORD"; got != want {
+		t.Errorf("envOverrideName = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,218 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// OnExpire calls fn when the secret stored under service and key expires,
+// to refresh tokens set with SetWithTTL before anything reads them
+// expired. A timer fires at the secret's expiry, which OnExpire reads from
+// the storage and SetWithTTL and Touch through the package reset; when it
+// fires, the storage is read again, so that a secret extended by another
+// process only notifies at its new expiry. A Get that finds the secret
+// expired, and PurgeExpired removing it, notify too if the timer hasn't.
+//
+// fn is called once per expiry, on a goroutine of its own. Setting the
+// secret again with a TTL arms the timer for the new expiry and setting
+// it without one disarms it, as deleting it through the package does;
+// either way fn stays registered for later TTLs until stop is called. A
+// secret that doesn't exist yet, or has no TTL, is watched from its next
+// SetWithTTL. It returns the error of reading the secret, other than
+// ErrNotFound.
+func OnExpire(service, key string, fn func()) (stop func(), err error) {
+	return std.OnExpire(service, key, fn)
+}
+
+// OnExpire calls fn when the secret stored under service and key expires,
+// as the package-level OnExpire does. Closing the Vault stops its
+// callbacks.
+func (v *Vault) OnExpire(service, key string, fn func()) (stop func(), err error) {
+	if err := checkKey(service, key); err != nil {
+		return nil, err
+	}
+	if fn == nil {
+		return nil, &ValidationError{Field: "fn", Reason: "must not be nil", Err: ErrInvalidValue}
+	}
+
+	w := &expiryWatch{fn: fn}
+	stop = v.expiries.add(service, key, w)
+	expires, ok, err := v.readExpiry(service, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		stop()
+		return nil, err
+	}
+	if ok {
+		v.expiries.mu.Lock()
+		if !w.stopped && w.seq == 0 {
+			// Not armed by a write meanwhile
+			v.armWatch(service, key, w, expires)
+		}
+		v.expiries.mu.Unlock()
+	}
+	return stop, nil
+}
+
+// expiryWatches holds the callbacks registered with OnExpire, by service
+// and key. The zero value is ready to use.
+type expiryWatches struct {
+	mu      sync.Mutex
+	watches map[[2]string][]*expiryWatch
+}
+
+// expiryWatch is an OnExpire callback and its timer. Its fields are
+// guarded by expiryWatches.mu.
+type expiryWatch struct {
+	fn      func()
+	timer   *time.Timer // nil: disarmed
+	seq     uint64      // incremented on each arm and disarm, to spot stale timers
+	fired   bool        // fn was called for the expiry last armed
+	stopped bool
+}
+
+func (e *expiryWatches) add(service, key string, w *expiryWatch) (stop func()) {
+	k := [2]string{service, key}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.watches == nil {
+		e.watches = make(map[[2]string][]*expiryWatch)
+	}
+	e.watches[k] = append(e.watches[k], w)
+
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if w.stopped {
+			return
+		}
+		w.stop()
+		ws := e.watches[k]
+		for i := range ws {
+			if ws[i] == w {
+				ws = append(ws[:i], ws[i+1:]...)
+				break
+			}
+		}
+		if len(ws) == 0 {
+			delete(e.watches, k)
+		} else {
+			e.watches[k] = ws
+		}
+	}
+}
+
+func (w *expiryWatch) stop() {
+	w.stopped = true
+	w.disarm()
+}
+
+func (w *expiryWatch) disarm() {
+	w.seq++
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+// stopAll stops every callback, for Close.
+func (e *expiryWatches) stopAll() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, ws := range e.watches {
+		for _, w := range ws {
+			w.stop()
+		}
+	}
+	e.watches = nil
+}
+
+// expiryArmed arms the callbacks of service and key for expires, after a
+// write through the Vault gave the secret that expiry.
+func (v *Vault) expiryArmed(service, key string, expires time.Time) {
+	v.expiries.mu.Lock()
+	defer v.expiries.mu.Unlock()
+	for _, w := range v.expiries.watches[[2]string{service, key}] {
+		v.armWatch(service, key, w, expires)
+	}
+}
+
+// expiryDisarmed disarms the callbacks of service and key, after a write
+// through the Vault removed the secret or its TTL.
+func (v *Vault) expiryDisarmed(service, key string) {
+	v.expiries.mu.Lock()
+	defer v.expiries.mu.Unlock()
+	for _, w := range v.expiries.watches[[2]string{service, key}] {
+		w.disarm()
+	}
+}
+
+// expired calls the callbacks of service and key that haven't been called
+// for the secret's expiry, after the Vault found it expired.
+func (v *Vault) expired(service, key string) {
+	v.expiries.mu.Lock()
+	defer v.expiries.mu.Unlock()
+	for _, w := range v.expiries.watches[[2]string{service, key}] {
+		if !w.fired {
+			w.disarm()
+			w.fired = true
+			go w.fn()
+		}
+	}
+}
+
+// armWatch sets the timer of w for expires. The caller holds
+// expiries.mu.
+func (v *Vault) armWatch(service, key string, w *expiryWatch, expires time.Time) {
+	w.disarm()
+	w.fired = false
+	seq := w.seq
+	w.timer = time.AfterFunc(max(expires.Sub(now()), 0), func() {
+		v.checkWatch(service, key, w, seq)
+	})
+}
+
+// checkWatch runs when the timer armed as seq fires. It reads the secret's
+// expiry again, and calls fn unless it has been extended or removed since.
+func (v *Vault) checkWatch(service, key string, w *expiryWatch, seq uint64) {
+	expires, ok, err := v.readExpiry(service, key)
+
+	v.expiries.mu.Lock()
+	defer v.expiries.mu.Unlock()
+	if w.seq != seq {
+		// Stopped, or armed again meanwhile
+		return
+	}
+	switch {
+	case err == nil && !ok:
+		// Set without a TTL by another process
+		w.disarm()
+		return
+	case err == nil && now().Before(expires):
+		v.armWatch(service, key, w, expires)
+		return
+	}
+	w.disarm()
+	w.fired = true
+	go w.fn()
+}
+
+// readExpiry returns the expiry of the secret stored under service and
+// key. ok is false if it has none.
+func (v *Vault) readExpiry(service, key string) (expires time.Time, ok bool, err error) {
+	ctx := context.Background()
+	if v.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.timeout)
+		defer cancel()
+	}
+	ms, mk := v.mapKey(service, key)
+	stored, err := v.store().Get(ctx, ms, mk)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	_, expires, ok = openTTL(stored)
+	clear(stored)
+	return expires, ok, nil
+}
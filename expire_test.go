@@ -0,0 +1,122 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func expiryNotifier(t *testing.T, v *Vault, key string) (<-chan struct{}, func()) {
+	t.Helper()
+	fired := make(chan struct{}, 10)
+	stop, err := v.OnExpire(testService, key, func() { fired <- struct{}{} })
+	if err != nil {
+		t.Fatalf("OnExpire failed: %v", err)
+	}
+	t.Cleanup(stop)
+	return fired, stop
+}
+
+func waitFired(t *testing.T, fired <-chan struct{}, want bool) {
+	t.Helper()
+	wait := 2 * time.Second
+	if !want {
+		wait = 50 * time.Millisecond
+	}
+	select {
+	case <-fired:
+		if !want {
+			t.Fatal("OnExpire callback called unexpectedly")
+		}
+	case <-time.After(wait):
+		if want {
+			t.Fatal("OnExpire callback not called")
+		}
+	}
+}
+
+func TestOnExpire(t *testing.T) {
+	v, b := newTestVault(t)
+	fired, _ := expiryNotifier(t, v, "token")
+
+	// Armed by SetWithTTL, disarmed by Del or a Set without TTL
+	if err := v.SetWithTTL(testService, "token", []byte("a"), time.Hour); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if err := v.Del(testService, "token"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if err := v.SetWithTTL(testService, "token", []byte("a"), 10*time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if err := v.Set(testService, "token", []byte("b")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	waitFired(t, fired, false)
+
+	// Re-setting rearms for the new expiry
+	if err := v.SetWithTTL(testService, "token", []byte("c"), time.Hour); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if err := v.SetWithTTL(testService, "token", []byte("c"), 10*time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	waitFired(t, fired, true)
+	waitFired(t, fired, false)
+
+	// A TTL set before OnExpire, through another Vault, is read
+	other, err := New(WithBackend(b))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := other.SetWithTTL(testService, "existing", []byte("d"), 10*time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	existing, _ := expiryNotifier(t, v, "existing")
+	waitFired(t, existing, true)
+
+	if _, err := v.OnExpire(testService, "token", nil); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("OnExpire with a nil callback = %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestOnExpireOnAccess(t *testing.T) {
+	start := time.Now()
+	setNow(t, start)
+	v, _ := newTestVault(t)
+	fired, stop := expiryNotifier(t, v, "token")
+	if err := v.SetWithTTL(testService, "token", []byte("a"), time.Hour); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+
+	// The timer runs on the real clock; the Get sees the secret expired
+	setNow(t, start.Add(2*time.Hour))
+	if _, err := v.Get(testService, "token"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of an expired secret = %v, want ErrNotFound", err)
+	}
+	waitFired(t, fired, true)
+	if _, err := v.Get(testService, "token"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of an expired secret = %v, want ErrNotFound", err)
+	}
+	waitFired(t, fired, false)
+
+	// PurgeExpired notifies too, until the callback is stopped
+	setNow(t, start)
+	if err := v.SetWithTTL(testService, "token", []byte("a"), time.Hour); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	setNow(t, start.Add(2*time.Hour))
+	if n, err := v.PurgeExpired(testService); err != nil || n != 1 {
+		t.Fatalf("PurgeExpired = %d, %v, want 1", n, err)
+	}
+	waitFired(t, fired, true)
+
+	stop()
+	setNow(t, start)
+	if err := v.SetWithTTL(testService, "token", []byte("a"), time.Hour); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	setNow(t, start.Add(2*time.Hour))
+	v.Get(testService, "token")
+	waitFired(t, fired, false)
+}
@@ -0,0 +1,209 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// fieldsMagic starts a secret holding fields: the magic is followed by the
+// fields as a JSON object mapping each name to its base64-encoded value.
+// The leading NUL keeps it from colliding with text values.
+const fieldsMagic = "\x00vault:fields\x00"
+
+// errNotFields is returned for field operations on a secret that holds a
+// single value.
+var errNotFields = fmt.Errorf("%w: the secret holds a single value, not fields", ErrInvalidValue)
+
+// SetField sets field of the secret stored under service and key to value,
+// creating the secret if needed, so that a set of related values such as
+// connection parameters can be kept in a single keychain item. The secret
+// is rewritten whole, so it never holds a partial update, and updates from
+// the same process are serialized; updates from other processes can still
+// overwrite each other. A secret set with Set holds a single value and
+// cannot have fields.
+func SetField(service, key, field string, value []byte) error {
+	return std.SetFieldContext(context.Background(), service, key, field, value)
+}
+
+// GetField returns field of the secret stored under service and key, or
+// ErrNotFound if the secret or the field does not exist.
+func GetField(service, key, field string) ([]byte, error) {
+	return std.GetFieldContext(context.Background(), service, key, field)
+}
+
+// DelField removes field from the secret stored under service and key,
+// and the secret itself once it has no fields left. It returns ErrNotFound
+// if the secret or the field does not exist.
+func DelField(service, key, field string) error {
+	return std.DelFieldContext(context.Background(), service, key, field)
+}
+
+// Fields returns the sorted names of the fields of the secret stored under
+// service and key.
+func Fields(service, key string) ([]string, error) {
+	return std.FieldsContext(context.Background(), service, key)
+}
+
+// SetFieldContext is like SetField but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage calls complete.
+func SetFieldContext(ctx context.Context, service, key, field string, value []byte) error {
+	return std.SetFieldContext(ctx, service, key, field, value)
+}
+
+// GetFieldContext is like GetField but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage call completes.
+func GetFieldContext(ctx context.Context, service, key, field string) ([]byte, error) {
+	return std.GetFieldContext(ctx, service, key, field)
+}
+
+// DelFieldContext is like DelField but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage calls complete.
+func DelFieldContext(ctx context.Context, service, key, field string) error {
+	return std.DelFieldContext(ctx, service, key, field)
+}
+
+// FieldsContext is like Fields but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage call completes.
+func FieldsContext(ctx context.Context, service, key string) ([]string, error) {
+	return std.FieldsContext(ctx, service, key)
+}
+
+// SetField sets field of the secret stored under service and key, as the
+// package-level SetField does.
+func (v *Vault) SetField(service, key, field string, value []byte) error {
+	return v.SetFieldContext(context.Background(), service, key, field, value)
+}
+
+// GetField returns field of the secret stored under service and key, as
+// the package-level GetField does.
+func (v *Vault) GetField(service, key, field string) ([]byte, error) {
+	return v.GetFieldContext(context.Background(), service, key, field)
+}
+
+// DelField removes field from the secret stored under service and key, as
+// the package-level DelField does.
+func (v *Vault) DelField(service, key, field string) error {
+	return v.DelFieldContext(context.Background(), service, key, field)
+}
+
+// Fields returns the names of the fields of the secret stored under
+// service and key, as the package-level Fields does.
+func (v *Vault) Fields(service, key string) ([]string, error) {
+	return v.FieldsContext(context.Background(), service, key)
+}
+
+// SetFieldContext is like SetField but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage calls complete.
+func (v *Vault) SetFieldContext(ctx context.Context, service, key, field string, value []byte) error {
+	if err := checkField(field); err != nil {
+		return err
+	}
+	if err := checkValue(value); err != nil {
+		return err
+	}
+
+	v.writeMu.Lock()
+	defer v.writeMu.Unlock()
+	fields, err := v.getFields(ctx, service, key)
+	if errors.Is(err, ErrNotFound) {
+		fields, err = map[string][]byte{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	fields[field] = value
+	return v.setFields(ctx, service, key, fields)
+}
+
+// GetFieldContext is like GetField but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage call completes.
+func (v *Vault) GetFieldContext(ctx context.Context, service, key, field string) ([]byte, error) {
+	if err := checkField(field); err != nil {
+		return nil, err
+	}
+	fields, err := v.getFields(ctx, service, key)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := fields[field]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+// DelFieldContext is like DelField but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage calls complete.
+func (v *Vault) DelFieldContext(ctx context.Context, service, key, field string) error {
+	if err := checkField(field); err != nil {
+		return err
+	}
+
+	v.writeMu.Lock()
+	defer v.writeMu.Unlock()
+	fields, err := v.getFields(ctx, service, key)
+	if err != nil {
+		return err
+	}
+	if _, ok := fields[field]; !ok {
+		return ErrNotFound
+	}
+	delete(fields, field)
+	if len(fields) == 0 {
+		return v.DelContext(ctx, service, key)
+	}
+	return v.setFields(ctx, service, key, fields)
+}
+
+// FieldsContext is like Fields but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage call completes.
+func (v *Vault) FieldsContext(ctx context.Context, service, key string) ([]string, error) {
+	fields, err := v.getFields(ctx, service, key)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(fields)), nil
+}
+
+// getFields reads the fields of the secret stored under service and key.
+func (v *Vault) getFields(ctx context.Context, service, key string) (map[string][]byte, error) {
+	stored, err := v.GetContext(ctx, service, key)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFields(stored)
+}
+
+// setFields replaces the secret stored under service and key with fields.
+func (v *Vault) setFields(ctx context.Context, service, key string, fields map[string][]byte) error {
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("vault: failed to encode fields: %w", err)
+	}
+	return v.SetContext(ctx, service, key, append([]byte(fieldsMagic), encoded...))
+}
+
+func decodeFields(stored []byte) (map[string][]byte, error) {
+	encoded, ok := bytes.CutPrefix(stored, []byte(fieldsMagic))
+	if !ok {
+		return nil, errNotFields
+	}
+	var fields map[string][]byte
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		// Syntax errors quote the offending character of the value
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, fmt.Errorf("%w: failed to decode fields: invalid JSON at byte %d", ErrCorrupt, syntaxErr.Offset)
+		}
+		return nil, fmt.Errorf("%w: failed to decode fields: %w", ErrCorrupt, err)
+	}
+	if fields == nil {
+		fields = map[string][]byte{}
+	}
+	return fields, nil
+}
@@ -0,0 +1,103 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestFields(t *testing.T) {
+	b := useMemory(t)
+	service := "vault-test-fields-service"
+
+	if _, err := Fields(service, "db"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Fields of a missing secret: expected ErrNotFound, got %v", err)
+	}
+
+	for field, value := range map[string]string{"host": "localhost", "port": "5432", "password": "hunter2"} {
+		if err := SetField(service, "db", field, []byte(value)); err != nil {
+			t.Fatalf("SetField %s failed: %v", field, err)
+		}
+	}
+	if err := SetField(service, "db", "port", []byte("5433")); err != nil {
+		t.Fatalf("SetField to replace failed: %v", err)
+	}
+
+	if got, err := GetField(service, "db", "port"); err != nil || string(got) != "5433" {
+		t.Errorf("GetField port = %q, %v, want 5433", got, err)
+	}
+	if _, err := GetField(service, "db", "user"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetField of a missing field: expected ErrNotFound, got %v", err)
+	}
+	fields, err := Fields(service, "db")
+	if want := []string{"host", "password", "port"}; err != nil || !slices.Equal(fields, want) {
+		t.Errorf("Fields = %q, %v, want %q", fields, err, want)
+	}
+
+	// All the fields live in one backend entry
+	if keys, _ := b.List(t.Context(), service); !slices.Equal(keys, []string{"db"}) {
+		t.Errorf("backend keys = %q, want [db]", keys)
+	}
+
+	if err := DelField(service, "db", "password"); err != nil {
+		t.Fatalf("DelField failed: %v", err)
+	}
+	if err := DelField(service, "db", "password"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DelField of a missing field: expected ErrNotFound, got %v", err)
+	}
+	if err := DelField(service, "db", "host"); err != nil {
+		t.Fatalf("DelField failed: %v", err)
+	}
+	if err := DelField(service, "db", "port"); err != nil {
+		t.Fatalf("DelField of the last field failed: %v", err)
+	}
+	if _, err := Get(service, "db"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after removing the last field: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestFieldsOfSingleValue(t *testing.T) {
+	useMemory(t)
+	service := "vault-test-fields-service"
+	if err := Set(service, "token", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetField(service, "token", "field", []byte("value")); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("SetField on a single value: expected ErrInvalidValue, got %v", err)
+	}
+	if _, err := GetField(service, "token", "field"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("GetField on a single value: expected ErrInvalidValue, got %v", err)
+	}
+	if got, err := Get(service, "token"); err != nil || string(got) != "value" {
+		t.Errorf("Get after SetField = %q, %v, want the value untouched", got, err)
+	}
+
+	if err := SetField(service, "db", "", []byte("value")); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("SetField with empty field: expected ErrInvalidKey, got %v", err)
+	}
+	if err := SetField(service, "db", "field", nil); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("SetField with empty value: expected ErrInvalidValue, got %v", err)
+	}
+}
+
+func TestSetFieldConcurrent(t *testing.T) {
+	useMemory(t)
+	service := "vault-test-fields-service"
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			if err := SetField(service, "db", fmt.Sprint("field", i), []byte("value")); err != nil {
+				t.Errorf("SetField failed: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if fields, err := Fields(service, "db"); err != nil || len(fields) != 20 {
+		t.Errorf("Fields = %d fields, %v, want all 20", len(fields), err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package vault
+
+// Storage files carry no metadata on platforms without extended attributes
+// support in golang.org/x/sys/unix.
+
+func setFileApp(path, app string) {}
+
+func fileApp(path string) string { return "" }
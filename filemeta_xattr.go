@@ -0,0 +1,33 @@
+//go:build linux || darwin
+
+package vault
+
+import "golang.org/x/sys/unix"
+
+// appXattr is the extended attribute storage files record the app identity
+// in. Linux only allows unprivileged attributes in the user namespace.
+const appXattr = "user.vault.app"
+
+// setFileApp records app on the file at path. It is best effort: on
+// filesystems without extended attributes the identity is not recorded.
+func setFileApp(path, app string) {
+	if app == "" {
+		_ = unix.Removexattr(path, appXattr)
+		return
+	}
+	_ = unix.Setxattr(path, appXattr, []byte(app), 0)
+}
+
+// fileApp returns the app identity recorded on the file at path, or "".
+func fileApp(path string) string {
+	size, err := unix.Getxattr(path, appXattr, nil)
+	if err != nil || size <= 0 {
+		return ""
+	}
+	buf := make([]byte, size)
+	n, err := unix.Getxattr(path, appXattr, buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
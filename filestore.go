@@ -0,0 +1,644 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// fileStore keeps every secret as a single file in a private directory,
+// holding the value encoded with codec.
+//
+// In the flat layout (the default) files are named after the base64url
+// encoding of "service/key". In the sharded layout every service gets a
+// subdirectory named after the base64url encoding of the service, holding
+// one file per key named after the base64url encoding of the key, so that
+// listing a service only reads that service's entries.
+type fileStore struct {
+	// dir returns the storage directory, creating it if needed.
+	dir func() (string, error)
+
+	codec valueCodec
+
+	mu           sync.Mutex
+	sharded      bool
+	pending      bool // entries may still be stored in the other layout
+	indexed      bool // keep an index file, see SetFileIndex
+	indexPending bool // the index file must be built or removed
+
+	names        *nameIndex // nil: base64url file names, see HashNames
+	namesPending bool       // base64url-named entries may remain
+
+	indexMu sync.Mutex // serializes the read-modify-write of the index
+}
+
+// setSharded selects the sharded or flat layout. Entries stored in the
+// previous layout are moved over before the next operation.
+func (s *fileStore) setSharded(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sharded != enabled {
+		s.sharded = enabled
+		s.pending = true
+	}
+}
+
+// layout returns the storage directory and whether it is sharded, first
+// completing a pending migration from the previous layout.
+func (s *fileStore) layout() (string, bool, error) {
+	dir, err := s.dir()
+	if err != nil {
+		return "", false, fmt.Errorf("vault: failed to get storage path: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending {
+		if s.sharded {
+			err = s.shardFiles(dir)
+		} else {
+			err = unshardFiles(dir)
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("vault: failed to migrate storage layout: %w", err)
+		}
+		s.pending = false
+		// Every file was renamed
+		s.indexPending = true
+	}
+	if s.indexPending {
+		if err := s.syncIndex(dir, s.sharded); err != nil {
+			return "", false, fmt.Errorf("vault: failed to update index: %w", err)
+		}
+		s.indexPending = false
+	}
+	if s.namesPending {
+		if err := s.hashFiles(dir); err != nil {
+			return "", false, fmt.Errorf("vault: failed to migrate to hashed names: %w", err)
+		}
+		s.namesPending = false
+	}
+	return dir, s.sharded, nil
+}
+
+// SetShardByService selects the layout of the file storage used by the
+// Linux fallback, iOS and Android. By default every secret is a file in one
+// flat directory. When enabled, each service gets its own subdirectory,
+// named after the base64url encoding of the service, so listing or cleaning
+// up a service only touches its own entries. Secrets stored in the previous
+// layout are moved over on the next operation, and disabling it again moves
+// them back.
+//
+// All programs sharing the storage directory should use the same layout.
+// It has no effect on the other platforms.
+func SetShardByService(enabled bool) {
+	if platformFiles != nil {
+		platformFiles.setSharded(enabled)
+	}
+}
+
+// FileStorageDir returns the directory the file storage of the Linux
+// fallback, iOS and Android keeps secrets in, creating it if needed, for
+// example to open it with NewEncryptedFileBackend after UpgradeFileStorage.
+// On the other platforms it returns an error wrapping errors.ErrUnsupported.
+func FileStorageDir() (string, error) {
+	if platformFiles == nil {
+		return "", errNoFileStorage
+	}
+	return platformFiles.dir()
+}
+
+var errNoFileStorage = fmt.Errorf("vault: file storage is not in use: %w", errors.ErrUnsupported)
+
+// mkdirStorage creates dir, a storage directory or one of its parents or
+// subdirectories. A directory that cannot be created, for lack of
+// permission or because a file is in the way, is reported as
+// ErrBackendUnavailable, so that a failed Set can't be mistaken for a
+// problem with the secret.
+func mkdirStorage(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("%w: failed to create storage directory %s: %w", ErrBackendUnavailable, dir, err)
+	}
+	return nil
+}
+
+// writeError returns the error for a failure to write what, such as
+// "secret". A permission error, from a storage directory that is
+// read-only or on a read-only mount, is reported as ErrBackendUnavailable
+// too.
+func writeError(what string, err error) error {
+	if errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS) {
+		return fmt.Errorf("%w: failed to write %s: %w", ErrBackendUnavailable, what, err)
+	}
+	return fmt.Errorf("vault: failed to write %s: %w", what, err)
+}
+
+func (s *fileStore) path(service, key string) (string, error) {
+	dir, sharded, err := s.layout()
+	if err != nil {
+		return "", err
+	}
+	if sharded {
+		return filepath.Join(dir, shardName(service), fileName(key)), nil
+	}
+	if s.names != nil {
+		name, err := s.names.fileName(dir, service, key)
+		return filepath.Join(dir, name), err
+	}
+	// Use base64 encoding for safe filenames
+	return filepath.Join(dir, fileName(service+"/"+key)), nil
+}
+
+func fileName(s string) string {
+	return base64.URLEncoding.EncodeToString([]byte(s))
+}
+
+func shardName(service string) string {
+	return fileName(service)
+}
+
+// codecFor returns the codec of the values of service and key.
+func (s *fileStore) codecFor(service, key string) valueCodec {
+	if bc, ok := s.codec.(boundCodec); ok {
+		return bc.bind(service, key)
+	}
+	return s.codec
+}
+
+func (s *fileStore) set(ctx context.Context, service, key string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := s.path(service, key)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := s.codecFor(service, key).Encode(value)
+	if err != nil {
+		return fmt.Errorf("vault: failed to encode secret: %w", err)
+	}
+
+	if err := mkdirStorage(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if err := s.nameAdded(path, service, key); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(encoded)
+		return err
+	}); err != nil {
+		return writeError("secret", err)
+	}
+	setFileApp(path, appIdentity(ctx))
+	size, expires := valueInfo(value)
+	return s.indexSet(service, key, path, size, expires)
+}
+
+func (s *fileStore) get(ctx context.Context, service, key string) ([]byte, error) {
+	data, err := s.getRaw(ctx, service, key)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := s.codecFor(service, key).Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode secret: %w", ErrCorrupt, err)
+	}
+	return decoded, nil
+}
+
+// getRaw returns the contents of a secret's file, before decoding.
+func (s *fileStore) getRaw(ctx context.Context, service, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path, err := s.path(service, key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := readSecretFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		if errors.Is(err, ErrInsecureStorage) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("vault: failed to read secret: %w", err)
+	}
+	return data, nil
+}
+
+// metadata returns what is recorded about a secret's file, from the index
+// when the store keeps one. Otherwise the file is read: the app identity is
+// kept in an extended attribute where the filesystem supports them, and
+// the creation time is unknown.
+func (s *fileStore) metadata(ctx context.Context, service, key string) (Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return Metadata{}, err
+	}
+	entries, ok, err := s.indexLookup(service, key)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if ok {
+		if len(entries) == 0 {
+			return Metadata{}, ErrNotFound
+		}
+		return entries[0].metadata(), nil
+	}
+
+	path, err := s.path(service, key)
+	if err != nil {
+		return Metadata{}, err
+	}
+	md, err := s.fileMetadata(path, service, key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Metadata{}, ErrNotFound
+		}
+		return Metadata{}, fmt.Errorf("vault: failed to read secret: %w", err)
+	}
+	return md, nil
+}
+
+func (s *fileStore) del(ctx context.Context, service, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := s.path(service, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("vault: failed to delete secret: %w", err)
+	}
+	if err := s.nameRemoved(path); err != nil {
+		return err
+	}
+	return s.indexDel(service, key)
+}
+
+func (s *fileStore) list(ctx context.Context, service string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dir, sharded, err := s.layout()
+	if err != nil {
+		return nil, err
+	}
+
+	if sharded {
+		keys, err := readNames(filepath.Join(dir, shardName(service)))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("vault: failed to read storage directory: %w", err)
+		}
+		return keys, nil
+	}
+	if s.names != nil {
+		return s.listHashed(dir, service)
+	}
+
+	names, err := readNames(dir)
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to read storage directory: %w", err)
+	}
+
+	prefix := service + "/"
+	var keys []string
+	for _, name := range names {
+		if key, ok := strings.CutPrefix(name, prefix); ok && key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// storedFile is a secret file of a store.
+type storedFile struct {
+	path, service, key string
+}
+
+// files returns every secret file in the store, except the flat files
+// whose name splitName cannot split.
+func (s *fileStore) files() ([]storedFile, error) {
+	dir, sharded, err := s.layout()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.names != nil {
+		names, err := s.names.names(dir)
+		if err != nil {
+			return nil, err
+		}
+		var files []storedFile
+		for file, name := range names {
+			path := filepath.Join(dir, file)
+			if _, err := os.Lstat(path); err == nil {
+				files = append(files, storedFile{path, name.Service, name.Key})
+			}
+		}
+		return files, nil
+	}
+
+	// Directories and the service of their files; "": each file's own
+	dirs := map[string]string{dir: ""}
+	if sharded {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("vault: failed to read storage directory: %w", err)
+		}
+		clear(dirs)
+		for _, entry := range entries {
+			service, err := base64.URLEncoding.DecodeString(entry.Name())
+			if entry.IsDir() && err == nil && len(service) > 0 {
+				dirs[filepath.Join(dir, entry.Name())] = string(service)
+			}
+		}
+	}
+
+	var files []storedFile
+	for d, service := range dirs {
+		names, err := readNames(d)
+		if err != nil {
+			return nil, fmt.Errorf("vault: failed to read storage directory: %w", err)
+		}
+		for _, name := range names {
+			f := storedFile{path: filepath.Join(d, fileName(name)), service: service, key: name}
+			if !sharded {
+				var ok bool
+				if f.service, f.key, ok = s.splitName(context.Background(), f.path, name); !ok {
+					continue
+				}
+			}
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// splitName returns the service and key of the secret stored in the flat
+// layout at path, whose name is "service/key". Both can contain slashes,
+// so a name with several can be read several ways: the additional data of
+// an encrypted entry tells which is right. ok is false if name has no
+// slash between a service and a key, and service is then empty; or if no
+// reading opens the entry, because there are several and it is not
+// encrypted or is corrupt, and service and key are then cut at the first
+// slash.
+func (s *fileStore) splitName(ctx context.Context, path, name string) (service, key string, ok bool) {
+	var readings [][2]string
+	for i := 1; i < len(name)-1; i++ {
+		if name[i] == '/' {
+			readings = append(readings, [2]string{name[:i], name[i+1:]})
+		}
+	}
+	switch {
+	case len(readings) == 0:
+		return "", "", false
+	case len(readings) == 1:
+		return readings[0][0], readings[0][1], true
+	}
+	if _, bound := s.codec.(boundCodec); bound {
+		if data, err := readSecretFile(path); err == nil && isEncrypted(data) {
+			for _, r := range readings {
+				if s.readFile(ctx, path, r[0], r[1]) == nil {
+					return r[0], r[1], true
+				}
+			}
+		}
+	}
+	return readings[0][0], readings[0][1], false
+}
+
+// writeFileAtomic replaces the file at path with what write writes,
+// readable only by its owner. The data is written to a temporary file in
+// the same directory, which is renamed over path, so a crash leaves either
+// the old or the new contents. Temporary names start with a dot, which no
+// secret file does. It refuses to replace anything but a regular file.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	if err := checkSecretFile(path); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".vault-tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(tmp)
+		}
+	}()
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// readNames returns the decoded names of the secret files in dir, skipping
+// directories and files whose names are not base64url.
+func readNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name, err := base64.URLEncoding.DecodeString(entry.Name())
+		if err != nil {
+			// Not a secret file
+			continue
+		}
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+// shardFiles moves the secrets stored in the flat layout into per-service
+// subdirectories. Each file is renamed on its own, so an interrupted
+// migration is completed the next time it runs. Flat names do not record
+// where the service ends: an encrypted entry's additional data tells,
+// others are split at the first slash (see splitName), so a service
+// containing a slash cannot be migrated faithfully unless encrypted.
+func (s *fileStore) shardFiles(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name, err := base64.URLEncoding.DecodeString(entry.Name())
+		if err != nil {
+			continue
+		}
+		service, key, _ := s.splitName(context.Background(), filepath.Join(dir, entry.Name()), string(name))
+		if service == "" {
+			continue
+		}
+
+		shard := filepath.Join(dir, shardName(service))
+		if err := os.MkdirAll(shard, 0o700); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(dir, entry.Name()), filepath.Join(shard, fileName(key))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unshardFiles moves the secrets stored in per-service subdirectories back
+// into the flat layout and removes the emptied subdirectories.
+func unshardFiles(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		service, err := base64.URLEncoding.DecodeString(entry.Name())
+		if err != nil || len(service) == 0 {
+			continue
+		}
+
+		shard := filepath.Join(dir, entry.Name())
+		keys, err := readNames(shard)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := os.Rename(filepath.Join(shard, fileName(key)), filepath.Join(dir, fileName(string(service)+"/"+key))); err != nil {
+				return err
+			}
+		}
+		// Leave the directory in place if it still holds anything else
+		_ = os.Remove(shard)
+	}
+	return nil
+}
+
+// sync flushes every stored secret and the storage directory itself to
+// stable storage, so that writes and deletions made so far survive a crash
+// or power loss.
+func (s *fileStore) sync() error {
+	dir, sharded, err := s.layout()
+	if err != nil {
+		return err
+	}
+
+	dirs := []string{dir}
+	if sharded {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("vault: failed to read storage directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs = append(dirs, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+
+	// Flush the files before the directories that name them
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil {
+			return fmt.Errorf("vault: failed to read storage directory: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			if err := syncPath(filepath.Join(dirs[i], entry.Name())); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("vault: failed to sync secret: %w", err)
+			}
+		}
+		if err := syncPath(dirs[i]); err != nil {
+			return fmt.Errorf("vault: failed to sync storage directory: %w", err)
+		}
+	}
+	return nil
+}
+
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// readSecretFile returns the contents of the secret file at path, which
+// must be a regular file (see openSecretFile).
+func readSecretFile(path string) ([]byte, error) {
+	f, err := openSecretFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// checkSecretFile returns an error wrapping ErrInsecureStorage if there is
+// something other than a regular file at path, which writes must not
+// replace: a symbolic link planted there may point at a file the attacker
+// wants overwritten by a program that follows it.
+func checkSecretFile(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode().IsRegular() {
+		return nil
+	}
+	return insecureFileError(path, info.Mode())
+}
+
+func insecureFileError(path string, mode os.FileMode) error {
+	what := "not a regular file"
+	if mode&os.ModeSymlink != 0 {
+		what = "a symbolic link"
+	}
+	return fmt.Errorf("%w: %s is %s", ErrInsecureStorage, path, what)
+}
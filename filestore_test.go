@@ -0,0 +1,217 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func newTestFileStore(t *testing.T) (*fileStore, string) {
+	dir := t.TempDir()
+	return &fileStore{dir: func() (string, error) { return dir, nil }, codec: defaultCodec}, dir
+}
+
+func shardFile(dir, service, key string) string {
+	return filepath.Join(dir,
+		base64.URLEncoding.EncodeToString([]byte(service)),
+		base64.URLEncoding.EncodeToString([]byte(key)))
+}
+
+func TestFileStoreSharded(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newTestFileStore(t)
+	s.setSharded(true)
+
+	if err := s.set(ctx, "svc-a", "key/1", []byte("a1")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if err := s.set(ctx, "svc-b", "key", []byte("b")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if _, err := os.Stat(shardFile(dir, "svc-a", "key/1")); err != nil {
+		t.Errorf("sharded secret file missing: %v", err)
+	}
+
+	got, err := s.get(ctx, "svc-a", "key/1")
+	if err != nil || string(got) != "a1" {
+		t.Errorf("get = %q, %v, want a1", got, err)
+	}
+	keys, err := s.list(ctx, "svc-a")
+	if err != nil || !slices.Equal(keys, []string{"key/1"}) {
+		t.Errorf("list = %q, %v, want [key/1]", keys, err)
+	}
+	if keys, err := s.list(ctx, "svc-none"); err != nil || len(keys) != 0 {
+		t.Errorf("list of unknown service = %q, %v, want none", keys, err)
+	}
+
+	if err := s.sync(); err != nil {
+		t.Errorf("sync failed: %v", err)
+	}
+	if err := s.del(ctx, "svc-a", "key/1"); err != nil {
+		t.Fatalf("del failed: %v", err)
+	}
+	if _, err := s.get(ctx, "svc-a", "key/1"); err != ErrNotFound {
+		t.Errorf("get after del: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestFileStoreMigrateLayout(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newTestFileStore(t)
+	secrets := map[[2]string][]byte{
+		{"svc-a", "one"}:     []byte("1"),
+		{"svc-a", "two"}:     []byte("2"),
+		{"svc-b", "x/three"}: []byte("3"),
+	}
+	for k, v := range secrets {
+		if err := s.set(ctx, k[0], k[1], v); err != nil {
+			t.Fatalf("set failed: %v", err)
+		}
+	}
+
+	check := func(layout string) {
+		t.Helper()
+		for k, v := range secrets {
+			got, err := s.get(ctx, k[0], k[1])
+			if err != nil || !bytes.Equal(got, v) {
+				t.Errorf("%s: get %s/%s = %q, %v, want %q", layout, k[0], k[1], got, err, v)
+			}
+		}
+		keys, err := s.list(ctx, "svc-a")
+		slices.Sort(keys)
+		if err != nil || !slices.Equal(keys, []string{"one", "two"}) {
+			t.Errorf("%s: list = %q, %v, want [one two]", layout, keys, err)
+		}
+	}
+
+	s.setSharded(true)
+	check("sharded")
+	if _, err := os.Stat(secretFile(dir, "svc-a", "one")); !os.IsNotExist(err) {
+		t.Errorf("flat secret file left behind after sharding: %v", err)
+	}
+	if _, err := os.Stat(shardFile(dir, "svc-a", "one")); err != nil {
+		t.Errorf("sharded secret file missing: %v", err)
+	}
+
+	s.setSharded(false)
+	check("flat")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			t.Errorf("shard directory %q left behind after unsharding", entry.Name())
+		}
+	}
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newTestFileStore(t)
+	if err := os.WriteFile(secretFile(dir, testService, "key"), []byte("not base64!"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.get(ctx, testService, "key"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("get of a corrupt file: expected ErrCorrupt, got %v", err)
+	}
+	rc, err := s.getReader(ctx, testService, "key")
+	if err != nil {
+		t.Fatalf("getReader failed: %v", err)
+	}
+	defer rc.Close()
+	if _, err := io.ReadAll(rc); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("reading a corrupt file: expected ErrCorrupt, got %v", err)
+	}
+	// A corrupt secret is still there to delete
+	if err := s.del(ctx, testService, "key"); err != nil {
+		t.Errorf("del of a corrupt file failed: %v", err)
+	}
+}
+
+func TestFileStoreSymlink(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newTestFileStore(t)
+	target := filepath.Join(t.TempDir(), "sensitive")
+	if err := os.WriteFile(target, []byte("c2Vuc2l0aXZl"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := secretFile(dir, testService, "key")
+	if err := os.Symlink(target, path); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+
+	if _, err := s.get(ctx, testService, "key"); !errors.Is(err, ErrInsecureStorage) {
+		t.Errorf("get through a symlink = %v, want ErrInsecureStorage", err)
+	}
+	if _, err := s.getReader(ctx, testService, "key"); !errors.Is(err, ErrInsecureStorage) {
+		t.Errorf("getReader through a symlink = %v, want ErrInsecureStorage", err)
+	}
+	if err := s.set(ctx, testService, "key", []byte("value")); !errors.Is(err, ErrInsecureStorage) {
+		t.Errorf("set over a symlink = %v, want ErrInsecureStorage", err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "c2Vuc2l0aXZl" {
+		t.Errorf("symlink target = %q, %v, want it unchanged", data, err)
+	}
+	if info, err := os.Lstat(path); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink was replaced: %v", err)
+	}
+
+	// Deleting removes the link, not its target
+	if err := s.del(ctx, testService, "key"); err != nil {
+		t.Errorf("del of a symlink failed: %v", err)
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Errorf("del removed the symlink target: %v", err)
+	}
+}
+
+func TestFileStoreUnavailable(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+
+	// A path below a regular file can never be created, even as root
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(file, "vault")
+	s := &fileStore{dir: func() (string, error) { return dir, nil }, codec: defaultCodec}
+
+	if err := s.set(ctx, testService, "key", []byte("value")); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("set below a file = %v, want ErrBackendUnavailable", err)
+	}
+	if _, err := NewEncryptedFileBackend(dir, []byte("passphrase")); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("NewEncryptedFileBackend below a file = %v, want ErrBackendUnavailable", err)
+	}
+	if _, err := NewEncryptedSingleFileBackend(filepath.Join(dir, "vault.json"), []byte("passphrase")); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("NewEncryptedSingleFileBackend below a file = %v, want ErrBackendUnavailable", err)
+	}
+}
+
+func TestFileStoreReadOnly(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("needs a directory the process cannot write to")
+	}
+	ctx := context.Background()
+	s, dir := newTestFileStore(t)
+	if err := os.Chmod(dir, 0o500); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0o700) })
+
+	if err := s.set(ctx, testService, "key", []byte("value")); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("set in a read-only directory = %v, want ErrBackendUnavailable", err)
+	}
+	if _, err := s.get(ctx, testService, "key"); !errors.Is(err, ErrNotFound) || errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("get of a missing key = %v, want ErrNotFound only", err)
+	}
+}
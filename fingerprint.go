@@ -0,0 +1,77 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// fingerprintKeySize is the size of the random fingerprint keys.
+const fingerprintKeySize = 32
+
+// WithFingerprintKey sets the key the Vault's Fingerprint uses, so that
+// fingerprints stay the same across processes and restarts. key must be at
+// least 16 bytes, and should be random and kept secret, for example stored
+// in the vault itself: with it, a fingerprint can be checked against
+// guessed values. Without it, each Vault uses a random key of its own.
+func WithFingerprintKey(key []byte) Option {
+	return func(v *Vault) {
+		v.fingerprintKey = bytes.Clone(key)
+	}
+}
+
+// Fingerprint returns a fingerprint of the secret stored under service and
+// key, for logging or detecting that a secret changed without handling its
+// value: the hex-encoded HMAC-SHA256 of the value, keyed with a random key
+// of the process. It is the same for the same value until the process
+// exits, whatever service and key hold it, does not reveal the value, and
+// cannot be compared with the fingerprints of another process or Vault. A
+// missing secret returns ErrNotFound.
+func Fingerprint(service, key string) (string, error) {
+	return std.FingerprintContext(context.Background(), service, key)
+}
+
+// FingerprintContext is like Fingerprint but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage call
+// completes.
+func FingerprintContext(ctx context.Context, service, key string) (string, error) {
+	return std.FingerprintContext(ctx, service, key)
+}
+
+// Fingerprint returns a fingerprint of the secret stored under service and
+// key, keyed with the Vault's own key, as the package-level Fingerprint
+// does.
+func (v *Vault) Fingerprint(service, key string) (string, error) {
+	return v.FingerprintContext(context.Background(), service, key)
+}
+
+// FingerprintContext is like Fingerprint but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage call
+// completes.
+func (v *Vault) FingerprintContext(ctx context.Context, service, key string) (string, error) {
+	value, err := v.GetContext(ctx, service, key)
+	if err != nil {
+		return "", err
+	}
+	v.fingerprintOnce.Do(func() {
+		if v.fingerprintKey == nil {
+			v.fingerprintKey = make([]byte, fingerprintKeySize)
+			rand.Read(v.fingerprintKey)
+		}
+	})
+	mac := hmac.New(sha256.New, v.fingerprintKey)
+	mac.Write(value)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// checkFingerprintKey validates a key set with WithFingerprintKey.
+func checkFingerprintKey(key []byte) error {
+	if key != nil && len(key) < minIntegrityKeySize {
+		return fmt.Errorf("%w: fingerprint key is shorter than %d bytes", ErrInvalidValue, minIntegrityKeySize)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package vault
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	v, _ := newTestVault(t)
+	if err := v.Set(testService, "a", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := v.Set(testService, "b", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	fp, err := v.Fingerprint(testService, "a")
+	if err != nil {
+		t.Fatalf("Fingerprint failed: %v", err)
+	}
+	if len(fp) != 64 || strings.Contains(fp, "value") {
+		t.Errorf("Fingerprint = %q, want 64 hex digits", fp)
+	}
+	if again, _ := v.Fingerprint(testService, "a"); again != fp {
+		t.Errorf("Fingerprint changed between calls: %q, then %q", fp, again)
+	}
+	if same, _ := v.Fingerprint(testService, "b"); same != fp {
+		t.Errorf("Fingerprint of the same value under another key = %q, want %q", same, fp)
+	}
+
+	if err := v.Set(testService, "a", []byte("rotated")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if changed, _ := v.Fingerprint(testService, "a"); changed == fp {
+		t.Error("Fingerprint did not change with the value")
+	}
+
+	// Another vault uses another key
+	other, _ := newTestVault(t)
+	other.Set(testService, "a", []byte("value"))
+	if theirs, _ := other.Fingerprint(testService, "a"); theirs == fp {
+		t.Error("two vaults returned the same fingerprint")
+	}
+
+	if _, err := v.Fingerprint(testService, "missing"); err != ErrNotFound {
+		t.Errorf("Fingerprint of a missing key = %v, want ErrNotFound", err)
+	}
+}
+
+func TestWithFingerprintKey(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	a, _ := newTestVault(t, WithFingerprintKey(key))
+	b, _ := newTestVault(t, WithFingerprintKey(key))
+	a.Set(testService, "key", []byte("value"))
+	b.Set(testService, "key", []byte("value"))
+	fa, errA := a.Fingerprint(testService, "key")
+	fb, errB := b.Fingerprint(testService, "key")
+	if errA != nil || errB != nil || fa != fb {
+		t.Errorf("fingerprints with the same key = %q, %v and %q, %v, want equal", fa, errA, fb, errB)
+	}
+
+	if _, err := New(WithBackend(NewMemoryBackend()), WithFingerprintKey([]byte("short"))); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("New with a short fingerprint key = %v, want ErrInvalidValue", err)
+	}
+}
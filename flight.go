@@ -0,0 +1,104 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// getFlights merges concurrent Gets of the same secret into one backend
+// call, so that goroutines reading a secret at once, as they do at
+// startup, cost one subprocess instead of one each. Calls are keyed by the
+// cache generation too: a Get made after a write through the Vault never
+// joins a call that may have read the old value. The zero value is ready
+// to use.
+type getFlights struct {
+	mu    sync.Mutex
+	calls map[flightKey]*flight
+}
+
+type flightKey struct {
+	gen          uint64
+	service, key string
+}
+
+// flight is a backend call in progress. Its results are set before done
+// is closed.
+type flight struct {
+	done    chan struct{}
+	waiters int // callers waiting for the results, under getFlights.mu
+
+	value []byte // private to the flight once shared
+	err   error
+	trace sourceTrace
+
+	// canceled is set when the context of the caller making the call was
+	// done, in which case its waiters with live contexts call again.
+	canceled bool
+}
+
+// errGetPanicked is returned to the callers sharing a backend call that
+// panicked; the panic itself goes to the caller that made it.
+var errGetPanicked = errors.New("vault: backend Get panicked")
+
+// do returns the result of get for k, calling it unless a call for k is in
+// flight, in which case it waits for that call and returns a copy of its
+// value. It returns ctx.Err() if ctx is done first. get runs with the
+// context of the caller making the call, or a derived one.
+func (g *getFlights) do(ctx context.Context, k flightKey, get func(context.Context) ([]byte, error)) ([]byte, error) {
+	for {
+		g.mu.Lock()
+		f, ok := g.calls[k]
+		if !ok {
+			break
+		}
+		f.waiters++
+		g.mu.Unlock()
+
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if f.canceled && ctx.Err() == nil {
+			continue
+		}
+		f.trace.copyTo(ctx)
+		return bytes.Clone(f.value), f.err
+	}
+
+	f := &flight{done: make(chan struct{}), err: errGetPanicked}
+	if g.calls == nil {
+		g.calls = make(map[flightKey]*flight)
+	}
+	g.calls[k] = f
+	g.mu.Unlock()
+
+	var value []byte
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, k)
+		shared := f.waiters > 0
+		g.mu.Unlock()
+		if shared {
+			// The caller may modify value once it is returned
+			f.value = bytes.Clone(value)
+		}
+		close(f.done)
+	}()
+
+	// Record the source for the waiters as well as the caller
+	value, f.err = get(context.WithValue(ctx, sourceKey{}, &f.trace))
+	f.canceled = ctx.Err() != nil
+	f.trace.copyTo(ctx)
+	return value, f.err
+}
+
+// copyTo sets the sourceTrace of a GetWithSource under ctx, if any, to t.
+func (t *sourceTrace) copyTo(ctx context.Context) {
+	if trace, ok := ctx.Value(sourceKey{}).(*sourceTrace); ok {
+		*trace = sourceTrace{name: t.name, leaf: t.leaf, path: slices.Clone(t.path)}
+	}
+}
@@ -0,0 +1,155 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// heldBackend holds every Get until release is closed.
+type heldBackend struct {
+	*MemoryBackend
+	gets    atomic.Int32
+	release chan struct{}
+}
+
+func (b *heldBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	b.gets.Add(1)
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return b.MemoryBackend.Get(ctx, service, key)
+}
+
+// waitForWaiters waits until n callers wait for the Get of key in flight.
+func waitForWaiters(t *testing.T, v *Vault, key string, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		v.flights.mu.Lock()
+		waiters := 0
+		for k, f := range v.flights.calls {
+			if k.key == key {
+				waiters = f.waiters
+			}
+		}
+		v.flights.mu.Unlock()
+		if waiters >= n {
+			return
+		}
+	}
+	t.Fatalf("%d callers did not join the Get in flight", n)
+}
+
+func TestGetSharesCalls(t *testing.T) {
+	b := &heldBackend{MemoryBackend: NewMemoryBackend(), release: make(chan struct{})}
+	v, err := New(WithBackend(b))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx := context.Background()
+	b.MemoryBackend.Set(ctx, testService, "key", []byte("value"))
+
+	const callers = 8
+	results := make([][]byte, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Go(func() {
+			value, err := v.Get(testService, "key")
+			if err != nil {
+				t.Errorf("Get failed: %v", err)
+			}
+			results[i] = value
+		})
+	}
+	waitForWaiters(t, v, "key", callers-1)
+	close(b.release)
+	wg.Wait()
+
+	if n := b.gets.Load(); n != 1 {
+		t.Errorf("backend Gets = %d, want 1", n)
+	}
+	// Every caller owns its copy
+	results[0][0] = 'X'
+	for i, value := range results[1:] {
+		if !bytes.Equal(value, []byte("value")) {
+			t.Errorf("result %d = %q, want %q", i+1, value, "value")
+		}
+	}
+
+	// Later Gets make their own call
+	if _, err := v.Get(testService, "key"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if n := b.gets.Load(); n != 2 {
+		t.Errorf("backend Gets after the shared call = %d, want 2", n)
+	}
+}
+
+// A Get made after a write does not share a call started before it.
+func TestGetSharesCallsAfterWrite(t *testing.T) {
+	b := &heldBackend{MemoryBackend: NewMemoryBackend(), release: make(chan struct{})}
+	v, err := New(WithBackend(b))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	b.MemoryBackend.Set(context.Background(), testService, "key", []byte("old"))
+
+	var wg sync.WaitGroup
+	wg.Go(func() { v.Get(testService, "key") })
+	for b.gets.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := v.Set(testService, "key", []byte("new")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	var got []byte
+	wg.Go(func() { got, _ = v.Get(testService, "key") })
+	for b.gets.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(b.release)
+	wg.Wait()
+	if string(got) != "new" {
+		t.Errorf("Get after Set = %q, want %q", got, "new")
+	}
+}
+
+// Callers waiting for a call whose caller gave up make their own.
+func TestGetSharedCallCanceled(t *testing.T) {
+	b := &heldBackend{MemoryBackend: NewMemoryBackend(), release: make(chan struct{})}
+	v, err := New(WithBackend(b))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	b.MemoryBackend.Set(context.Background(), testService, "key", []byte("value"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	var leaderErr error
+	wg.Go(func() { _, leaderErr = v.GetContext(ctx, testService, "key") })
+	for b.gets.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	var got []byte
+	var waiterErr error
+	wg.Go(func() { got, waiterErr = v.Get(testService, "key") })
+	waitForWaiters(t, v, "key", 1)
+
+	cancel()
+	for b.gets.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(b.release)
+	wg.Wait()
+	if leaderErr != context.Canceled {
+		t.Errorf("canceled Get = %v, want context.Canceled", leaderErr)
+	}
+	if waiterErr != nil || string(got) != "value" {
+		t.Errorf("waiting Get = %q, %v, want %q", got, waiterErr, "value")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package vault
+
+// The free space of storage directories is only known on platforms with
+// statfs.
+
+func freeSpace(dir string) (uint64, bool) { return 0, false }
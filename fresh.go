@@ -0,0 +1,43 @@
+package vault
+
+import "context"
+
+// GetFresh is like Get but always reads the secret from the storage,
+// bypassing the cache set with SetGetCache, for callers that must not act
+// on a stale value, such as a retry after the secret was rejected because
+// a peer rotated it. The value read replaces the cached one.
+//
+// Backends that keep their own copies see the read as fresh through
+// FreshRead: NewMirroredBackend does not fall back to its mirror, which may
+// hold an older value, and custom caching backends should skip their
+// cache.
+func GetFresh(service, key string) ([]byte, error) {
+	return std.GetFreshContext(context.Background(), service, key)
+}
+
+// GetFreshContext is like GetFresh but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage call completes.
+func GetFreshContext(ctx context.Context, service, key string) ([]byte, error) {
+	return std.GetFreshContext(ctx, service, key)
+}
+
+// GetFresh reads the value stored under service and key, bypassing the
+// cache, as the package-level GetFresh does.
+func (v *Vault) GetFresh(service, key string) ([]byte, error) {
+	return v.GetFreshContext(context.Background(), service, key)
+}
+
+// GetFreshContext is like GetFresh but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage call completes.
+func (v *Vault) GetFreshContext(ctx context.Context, service, key string) ([]byte, error) {
+	return v.get(context.WithValue(ctx, freshKey{}, true), service, key, true)
+}
+
+type freshKey struct{}
+
+// FreshRead reports whether the read under ctx was made by GetFresh, so a
+// Backend that caches values must read them from its source.
+func FreshRead(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshKey{}).(bool)
+	return fresh
+}
@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetFresh(t *testing.T) {
+	b := useGetCache(t, time.Minute)
+	ctx := context.Background()
+
+	if err := Set(testService, "key", []byte("one")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := Get(testService, "key"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	// A peer rotates the secret behind the cache
+	if err := b.Set(ctx, testService, "key", []byte("two")); err != nil {
+		t.Fatalf("backend Set failed: %v", err)
+	}
+	if got, _ := Get(testService, "key"); string(got) != "one" {
+		t.Fatalf("Get = %q, want the cached one", got)
+	}
+
+	if got, err := GetFresh(testService, "key"); err != nil || string(got) != "two" {
+		t.Errorf("GetFresh = %q, %v, want two", got, err)
+	}
+	// The fresh value replaces the cached one
+	gets := b.gets
+	if got, err := Get(testService, "key"); err != nil || string(got) != "two" {
+		t.Errorf("Get after GetFresh = %q, %v, want two", got, err)
+	}
+	if b.gets != gets {
+		t.Errorf("Get after GetFresh reached the backend")
+	}
+
+	if _, err := GetFresh(testService, "missing"); err != ErrNotFound {
+		t.Errorf("GetFresh of a missing key = %v, want ErrNotFound", err)
+	}
+}
+
+// freshBackend records whether reads are marked fresh.
+type freshBackend struct {
+	Backend
+	fresh []bool
+}
+
+func (b *freshBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	b.fresh = append(b.fresh, FreshRead(ctx))
+	return b.Backend.Get(ctx, service, key)
+}
+
+func TestGetFreshThroughWrappers(t *testing.T) {
+	inner := &freshBackend{Backend: NewMemoryBackend()}
+	v, err := New(WithBackend(NewChainBackend(NewSystemdCredentialsBackend(), inner)))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := v.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	v.Get(testService, "key")
+	v.GetFresh(testService, "key")
+	if len(inner.fresh) != 2 || inner.fresh[0] || !inner.fresh[1] {
+		t.Errorf("FreshRead seen by the backend = %v, want [false true]", inner.fresh)
+	}
+
+	// A mirror may be stale, so fresh reads don't fall back to it
+	mirror := NewMemoryBackend()
+	mirror.Set(context.Background(), testService, "key", []byte("stale"))
+	v, err = New(WithBackend(NewMirroredBackend(failingBackend{ErrBackendUnavailable}, mirror)))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if got, err := v.Get(testService, "key"); err != nil || string(got) != "stale" {
+		t.Errorf("Get = %q, %v, want the mirror's value", got, err)
+	}
+	if _, err := v.GetFresh(testService, "key"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("GetFresh = %v, want ErrBackendUnavailable", err)
+	}
+}
@@ -0,0 +1,212 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FS returns a read-only fs.FS view of service, for tools that already
+// work with file systems: its root directory holds a file per key, named
+// after the key and holding the value, so fs.ReadFile reads a secret,
+// fs.ReadDir lists the keys and fs.WalkDir or fs.Sub work as usual. Keys
+// that aren't valid file names, such as those containing '/', are left
+// out. Files are opened by reading their value with Get; directory
+// listings use List and report sizes with Size.
+//
+// Missing keys are reported as an *fs.PathError whose error matches both
+// fs.ErrNotExist and ErrNotFound under errors.Is. The view has nothing to
+// write through: store secrets with Set.
+func FS(service string) fs.FS {
+	return std.FS(service)
+}
+
+// FS returns a read-only fs.FS view of service, as the package-level FS
+// does.
+func (v *Vault) FS(service string) fs.FS {
+	return serviceFS{v: v, service: service}
+}
+
+// serviceFS is the fs.FS of FS. It also implements fs.ReadDirFS,
+// fs.ReadFileFS and fs.StatFS, to spare tools opening files they only read
+// or stat.
+type serviceFS struct {
+	v       *Vault
+	service string
+}
+
+// errNotExist is the error of FS for missing keys.
+type errNotExist struct{}
+
+func (errNotExist) Error() string { return ErrNotFound.Error() }
+
+func (errNotExist) Is(target error) bool {
+	return target == ErrNotFound || target == fs.ErrNotExist
+}
+
+// pathError returns err, from reading the key named name, as the
+// *fs.PathError the fs functions expect.
+func pathError(op, name string, err error) error {
+	if err == ErrNotFound {
+		err = errNotExist{}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// isKeyName reports whether name, a valid fs path, names a file of the
+// root directory rather than the directory itself or something below it.
+func isKeyName(name string) bool {
+	return name != "." && fs.ValidPath(name) && !strings.Contains(name, "/")
+}
+
+func (f serviceFS) Open(name string) (fs.File, error) {
+	if name == "." {
+		return &serviceDir{fsys: f}, nil
+	}
+	value, err := f.ReadFile(name)
+	if err != nil {
+		if pe, ok := err.(*fs.PathError); ok {
+			pe.Op = "open"
+		}
+		return nil, err
+	}
+	return &fsFile{Reader: bytes.NewReader(value), info: fileInfo{name: name, size: int64(len(value))}}, nil
+}
+
+func (f serviceFS) ReadFile(name string) ([]byte, error) {
+	if !isKeyName(name) {
+		return nil, pathError("readfile", name, invalidPath(name))
+	}
+	value, err := f.v.GetContext(f.v.listedContext(context.Background()), f.service, name)
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	return value, nil
+}
+
+func (f serviceFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return nil, pathError("readdir", name, invalidPath(name))
+	}
+	keys, err := f.v.List(f.service)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	slices.Sort(keys)
+	entries := make([]fs.DirEntry, 0, len(keys))
+	for _, key := range keys {
+		if isKeyName(key) {
+			entries = append(entries, dirEntry{fsys: f, name: key})
+		}
+	}
+	return entries, nil
+}
+
+func (f serviceFS) Stat(name string) (fs.FileInfo, error) {
+	if name == "." {
+		return fileInfo{name: ".", dir: true}, nil
+	}
+	if !isKeyName(name) {
+		return nil, pathError("stat", name, invalidPath(name))
+	}
+	size, err := f.v.SizeContext(f.v.listedContext(context.Background()), f.service, name)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return fileInfo{name: name, size: int64(size)}, nil
+}
+
+// invalidPath returns the error for a name FS has no file for: paths below
+// a key can't exist, but malformed ones are invalid.
+func invalidPath(name string) error {
+	if fs.ValidPath(name) {
+		return errNotExist{}
+	}
+	return fs.ErrInvalid
+}
+
+// fsFile is a file of FS, holding the value read when it was opened.
+type fsFile struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *fsFile) Close() error { return nil }
+
+// serviceDir is the root directory of FS. It lists the keys on the first
+// ReadDir.
+type serviceDir struct {
+	fsys    serviceFS
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (d *serviceDir) Stat() (fs.FileInfo, error) { return fileInfo{name: ".", dir: true}, nil }
+
+func (d *serviceDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: fs.ErrInvalid}
+}
+
+func (d *serviceDir) Close() error { return nil }
+
+func (d *serviceDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fsys.ReadDir(".")
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// dirEntry is a key listed by serviceDir. Its Info reads the size.
+type dirEntry struct {
+	fsys serviceFS
+	name string
+}
+
+func (e dirEntry) Name() string               { return e.name }
+func (e dirEntry) IsDir() bool                { return false }
+func (e dirEntry) Type() fs.FileMode          { return 0 }
+func (e dirEntry) Info() (fs.FileInfo, error) { return e.fsys.Stat(e.name) }
+
+// fileInfo describes a file or the directory of FS. Secrets are readable
+// by their owner only, as the storage keeps them, and have no
+// modification time: GetMetadata reports it where the storage records it.
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i fileInfo) Name() string { return i.name }
+func (i fileInfo) Size() int64  { return i.size }
+func (i fileInfo) IsDir() bool  { return i.dir }
+func (i fileInfo) Sys() any     { return nil }
+
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o500
+	}
+	return 0o400
+}
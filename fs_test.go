@@ -0,0 +1,61 @@
+package vault
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	v, _ := newTestVault(t)
+	for key, value := range map[string]string{
+		"token":      "t0ken",
+		"password":   "hunter2",
+		"nested/key": "hidden",
+	} {
+		if err := v.Set(testService, key, []byte(value)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	fsys := v.FS(testService)
+	if err := fstest.TestFS(fsys, "token", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := fs.ReadFile(fsys, "token"); err != nil || string(got) != "t0ken" {
+		t.Errorf("ReadFile = %q, %v, want %q", got, err, "t0ken")
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"password", "token"}; !slices.Equal(names, want) {
+		t.Errorf("ReadDir = %q, want %q", names, want)
+	}
+
+	// Missing keys match both errors; keys below a key don't exist either
+	for _, name := range []string{"missing", "token/x", "nested/key"} {
+		_, err := fsys.Open(name)
+		if !errors.Is(err, fs.ErrNotExist) || !errors.Is(err, ErrNotFound) {
+			t.Errorf("Open(%q) = %v, want fs.ErrNotExist and ErrNotFound", name, err)
+		}
+		var pe *fs.PathError
+		if !errors.As(err, &pe) || pe.Path != name {
+			t.Errorf("Open(%q) = %v, want a *fs.PathError for it", name, err)
+		}
+	}
+	if _, err := fsys.Open("../token"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Open of an invalid path = %v, want fs.ErrInvalid", err)
+	}
+
+	v.Close()
+	if _, err := fs.ReadFile(fsys, "token"); !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadFile after Close = %v, want ErrClosed", err)
+	}
+}
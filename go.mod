@@ -1,3 +1,11 @@
 module ella.to/vault
 
 go 1.25.2
+
+require (
+	filippo.io/age v1.3.2
+	golang.org/x/crypto v0.55.0
+	golang.org/x/sys v0.47.0
+)
+
+require filippo.io/hpke v0.4.0 // indirect
@@ -0,0 +1,62 @@
+package vault
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+)
+
+// handleAttempts is how many handles Store generates before giving up.
+// With 128 random bits a collision means the random source is broken.
+const handleAttempts = 3
+
+// Store stores value under service with a key it generates, and returns
+// that key as a handle for Get and Del, for ephemeral values such as
+// tokens whose key doesn't matter. Handles are 22 characters of URL-safe
+// base64 holding 128 random bits, so they can't be guessed, and Store
+// never overwrites an existing secret.
+func Store(service string, value []byte) (string, error) {
+	return std.StoreContext(context.Background(), service, value)
+}
+
+// StoreContext is like Store but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage calls complete.
+func StoreContext(ctx context.Context, service string, value []byte) (string, error) {
+	return std.StoreContext(ctx, service, value)
+}
+
+// Store stores value under service with a generated key and returns it,
+// as the package-level Store does.
+func (v *Vault) Store(service string, value []byte) (string, error) {
+	return v.StoreContext(context.Background(), service, value)
+}
+
+// StoreContext is like Store but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage calls complete.
+func (v *Vault) StoreContext(ctx context.Context, service string, value []byte) (string, error) {
+	if err := checkService(service); err != nil {
+		return "", err
+	}
+	if err := checkValue(value); err != nil {
+		return "", err
+	}
+
+	for range handleAttempts {
+		handle := newHandle()
+		stored, err := v.SetIfAbsentContext(ctx, service, handle, value)
+		if err != nil {
+			return "", err
+		}
+		if stored {
+			return handle, nil
+		}
+	}
+	return "", errors.New("vault: failed to generate a unique handle")
+}
+
+func newHandle() string {
+	b := make([]byte, 16)
+	rand.Read(b) // never returns an error
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,33 @@
+package vault
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	v, _ := newTestVault(t)
+	handleRE := regexp.MustCompile(`^[A-Za-z0-9_-]{22}$`)
+
+	seen := map[string]bool{}
+	for range 10 {
+		handle, err := v.Store(testService, []byte("token"))
+		if err != nil {
+			t.Fatalf("Store failed: %v", err)
+		}
+		if !handleRE.MatchString(handle) {
+			t.Errorf("handle %q is not 22 URL-safe characters", handle)
+		}
+		if seen[handle] {
+			t.Errorf("handle %q returned twice", handle)
+		}
+		seen[handle] = true
+		if got, err := v.Get(testService, handle); err != nil || string(got) != "token" {
+			t.Errorf("Get(%q) = %q, %v, want token", handle, got, err)
+		}
+	}
+
+	if _, err := v.Store("", []byte("token")); err == nil {
+		t.Error("Store accepted an empty service")
+	}
+}
@@ -0,0 +1,217 @@
+// Package hashivault provides a vault.Backend that stores secrets in the
+// KV version 2 secrets engine of a HashiCorp Vault server, so that code
+// written against the vault package can use the platform keychain on a
+// developer machine and a Vault server in production.
+//
+// The secret for a service and key is stored at the KV path
+// <service>/<key>, both path-escaped, as a single "value" field holding
+// the base64 encoding of the value. It only depends on the standard
+// library.
+package hashivault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"ella.to/vault"
+)
+
+// valueField is the KV field a secret's value is stored in.
+const valueField = "value"
+
+// backend is a vault.Backend backed by a Vault server's KV v2 engine.
+type backend struct {
+	addr   string // without a trailing slash
+	token  string
+	mount  string
+	client *http.Client
+}
+
+// NewHashiVaultBackend returns a vault.Backend for the KV v2 engine mounted at
+// mount (such as "secret") on the Vault server at addr (such as
+// "https://vault.example.com:8200"), authenticating with token. The
+// operations' contexts bound the requests; no request is made until the
+// first operation.
+func NewHashiVaultBackend(addr, token, mount string) (vault.Backend, error) {
+	u, err := url.Parse(addr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("hashivault: invalid server address %q", addr)
+	}
+	if token == "" {
+		return nil, errors.New("hashivault: empty token")
+	}
+	mount = strings.Trim(mount, "/")
+	if mount == "" {
+		return nil, errors.New("hashivault: empty mount")
+	}
+	return &backend{
+		addr:   strings.TrimSuffix(u.String(), "/"),
+		token:  token,
+		mount:  mount,
+		client: http.DefaultClient,
+	}, nil
+}
+
+func (b *backend) Set(ctx context.Context, service, key string, value []byte) error {
+	if service == "" || key == "" {
+		return vault.ErrInvalidKey
+	}
+	if len(value) == 0 {
+		return vault.ErrInvalidValue
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"data": map[string]string{valueField: base64.StdEncoding.EncodeToString(value)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = b.do(ctx, http.MethodPost, b.path("data", service, key), body)
+	return err
+}
+
+func (b *backend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	if service == "" || key == "" {
+		return nil, vault.ErrInvalidKey
+	}
+
+	data, err := b.do(ctx, http.MethodGet, b.path("data", service, key), nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("hashivault: invalid response: %w", err)
+	}
+	encoded, ok := resp.Data.Data[valueField].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: secret %s/%s has no %q field", vault.ErrCorrupt, service, key, valueField)
+	}
+	value, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode value: %w", vault.ErrCorrupt, err)
+	}
+	return value, nil
+}
+
+// Del removes every version of the secret and its metadata. It returns
+// vault.ErrNotFound if the secret has no current version, including one
+// deleted by other clients without destroying it.
+func (b *backend) Del(ctx context.Context, service, key string) error {
+	if service == "" || key == "" {
+		return vault.ErrInvalidKey
+	}
+	// Deleting metadata succeeds whether or not the secret exists
+	if _, err := b.do(ctx, http.MethodGet, b.path("data", service, key), nil); err != nil {
+		return err
+	}
+	_, err := b.do(ctx, http.MethodDelete, b.path("metadata", service, key), nil)
+	return err
+}
+
+func (b *backend) List(ctx context.Context, service string) ([]string, error) {
+	if service == "" {
+		return nil, vault.ErrInvalidKey
+	}
+
+	data, err := b.do(ctx, "LIST", b.path("metadata", service, ""), nil)
+	if errors.Is(err, vault.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("hashivault: invalid response: %w", err)
+	}
+
+	var keys []string
+	for _, k := range resp.Data.Keys {
+		// Entries ending in "/" are folders, not secrets of service
+		if strings.HasSuffix(k, "/") {
+			continue
+		}
+		if key, err := url.PathUnescape(k); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// path returns the API path of the secret for service and key under the
+// engine's data or metadata endpoint, or of service's folder if key is "".
+func (b *backend) path(endpoint, service, key string) string {
+	p := "/v1/" + b.mount + "/" + endpoint + "/" + url.PathEscape(service)
+	if key != "" {
+		p += "/" + url.PathEscape(key)
+	}
+	return p
+}
+
+// do sends a request to the server and returns the response body. A 404
+// is reported as vault.ErrNotFound and a 403 as vault.ErrForbidden.
+func (b *backend) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, b.addr+path, r)
+	if err != nil {
+		return nil, fmt.Errorf("hashivault: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", b.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("hashivault: %w: %v", vault.ErrBackendUnavailable, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("hashivault: failed to read response: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, vault.ErrNotFound
+	case resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("%w: %s", vault.ErrForbidden, apiErrors(data))
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("hashivault: %s %s: %s: %s", method, path, resp.Status, apiErrors(data))
+	}
+	return data, nil
+}
+
+// apiErrors returns the messages of a Vault error response.
+func apiErrors(data []byte) string {
+	var resp struct {
+		Errors []string `json:"errors"`
+	}
+	if json.Unmarshal(data, &resp) != nil || len(resp.Errors) == 0 {
+		return "no details"
+	}
+	return strings.Join(resp.Errors, "; ")
+}
@@ -0,0 +1,223 @@
+package hashivault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"ella.to/vault"
+)
+
+const testToken = "test-token"
+
+// fakeKV serves the subset of the KV v2 API the backend uses, for the
+// engine mounted at "secret". It keeps the latest data of each path.
+type fakeKV struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]any
+}
+
+func (kv *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != testToken {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	// The escaped path keeps the service and key apart
+	path := r.URL.EscapedPath()
+	if p, ok := strings.CutPrefix(path, "/v1/secret/data/"); ok {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut:
+			var body struct {
+				Data map[string]any `json:"data"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			kv.secrets[p] = body.Data
+			w.Write([]byte(`{"data":{"version":1}}`))
+		case http.MethodGet:
+			data, ok := kv.secrets[p]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"errors":[]}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"data": data}})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	if p, ok := strings.CutPrefix(path, "/v1/secret/metadata/"); ok {
+		switch r.Method {
+		case http.MethodDelete:
+			delete(kv.secrets, p)
+			w.WriteHeader(http.StatusNoContent)
+		case "LIST":
+			var keys []string
+			for k := range kv.secrets {
+				if key, ok := strings.CutPrefix(k, p+"/"); ok {
+					if i := strings.Index(key, "/"); i >= 0 {
+						key = key[:i+1] // a folder
+					}
+					if !slices.Contains(keys, key) {
+						keys = append(keys, key)
+					}
+				}
+			}
+			if len(keys) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"keys": keys}})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func newTestBackend(t *testing.T, token string) (vault.Backend, *fakeKV) {
+	t.Helper()
+	kv := &fakeKV{secrets: map[string]map[string]any{}}
+	srv := httptest.NewServer(kv)
+	t.Cleanup(srv.Close)
+
+	b, err := NewHashiVaultBackend(srv.URL+"/", token, "/secret/")
+	if err != nil {
+		t.Fatalf("NewHashiVaultBackend: %v", err)
+	}
+	return b, kv
+}
+
+func TestBackend(t *testing.T) {
+	b, _ := newTestBackend(t, testToken)
+	ctx := context.Background()
+
+	if _, err := b.Get(ctx, "svc", "missing"); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("Get missing: got %v, want ErrNotFound", err)
+	}
+	if keys, err := b.List(ctx, "svc"); err != nil || len(keys) != 0 {
+		t.Fatalf("List empty service: got %v, %v", keys, err)
+	}
+
+	values := map[string][]byte{
+		"token":      []byte("secret"),
+		"binary":     {0, 1, 2, 0xff},
+		"with/slash": []byte("nested"),
+	}
+	for key, value := range values {
+		if err := b.Set(ctx, "svc", key, value); err != nil {
+			t.Fatalf("Set %q: %v", key, err)
+		}
+	}
+	for key, want := range values {
+		got, err := b.Get(ctx, "svc", key)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("Get %q: got %q, %v, want %q", key, got, err, want)
+		}
+	}
+
+	keys, err := b.List(ctx, "svc")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	slices.Sort(keys)
+	if want := []string{"binary", "token", "with/slash"}; !slices.Equal(keys, want) {
+		t.Fatalf("List: got %q, want %q", keys, want)
+	}
+
+	if err := b.Del(ctx, "svc", "token"); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+	if _, err := b.Get(ctx, "svc", "token"); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("Get after Del: got %v, want ErrNotFound", err)
+	}
+	if err := b.Del(ctx, "svc", "token"); !errors.Is(err, vault.ErrNotFound) {
+		t.Fatalf("Del missing: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestBackendSkipsFolders(t *testing.T) {
+	b, kv := newTestBackend(t, testToken)
+	kv.secrets["svc/key"] = map[string]any{"value": "dmFsdWU="}
+	kv.secrets["svc/folder/other"] = map[string]any{"value": "dmFsdWU="}
+
+	keys, err := b.List(context.Background(), "svc")
+	if err != nil || !slices.Equal(keys, []string{"key"}) {
+		t.Fatalf("List: got %q, %v, want [key]", keys, err)
+	}
+}
+
+func TestBackendForbidden(t *testing.T) {
+	b, _ := newTestBackend(t, "wrong-token")
+	if _, err := b.Get(context.Background(), "svc", "key"); !errors.Is(err, vault.ErrForbidden) {
+		t.Fatalf("Get with a wrong token: got %v, want ErrForbidden", err)
+	}
+}
+
+func TestBackendUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	b, err := NewHashiVaultBackend(srv.URL, testToken, "secret")
+	if err != nil {
+		t.Fatalf("NewHashiVaultBackend: %v", err)
+	}
+	if _, err := b.Get(context.Background(), "svc", "key"); !errors.Is(err, vault.ErrBackendUnavailable) {
+		t.Fatalf("Get from a stopped server: got %v, want ErrBackendUnavailable", err)
+	}
+}
+
+func TestBackendWithVault(t *testing.T) {
+	b, _ := newTestBackend(t, testToken)
+	v, err := vault.New(vault.WithBackend(b))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := v.Set("svc", "key", []byte("value")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got, err := v.Get("svc", "key"); err != nil || string(got) != "value" {
+		t.Fatalf("Get: got %q, %v", got, err)
+	}
+}
+
+func TestNewHashiVaultBackendInvalid(t *testing.T) {
+	tests := []struct{ addr, token, mount string }{
+		{"", testToken, "secret"},
+		{"vault.example.com:8200", testToken, "secret"},
+		{"ftp://vault.example.com", testToken, "secret"},
+		{"https://vault.example.com", "", "secret"},
+		{"https://vault.example.com", testToken, "/"},
+	}
+	for _, tt := range tests {
+		if _, err := NewHashiVaultBackend(tt.addr, tt.token, tt.mount); err == nil {
+			t.Errorf("NewHashiVaultBackend(%q, %q, %q): got nil error", tt.addr, tt.token, tt.mount)
+		}
+	}
+}
+
+func TestBackendCorrupt(t *testing.T) {
+	b, kv := newTestBackend(t, testToken)
+	kv.secrets["svc/bad"] = map[string]any{"value": "not base64!"}
+	kv.secrets["svc/other"] = map[string]any{"password": "c2VjcmV0"}
+
+	for _, key := range []string{"bad", "other"} {
+		if _, err := b.Get(context.Background(), "svc", key); !errors.Is(err, vault.ErrCorrupt) {
+			t.Errorf("Get %s: got %v, want ErrCorrupt", key, err)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package vault
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Hashed file names. With HashNames, the secret files of an encrypted
+// directory are named after the HMAC-SHA256 of their service and key, hex
+// encoded and followed by hashedNameSuffix, instead of the base64url
+// encoding of "service/key". The HMAC key is random, and kept with the
+// real names in the names index, namesIndexName: a JSON document sealed
+// with the directory's key as the values are, mapping each file name to
+// its service and key. The index is only rewritten when a file is first
+// created or removed, under an flock on namesLockName.
+
+const (
+	namesIndexName    = ".vault-names"
+	namesLockName     = ".vault-names.lock"
+	hashedNameSuffix  = ".secret"
+	namesIndexVersion = 1
+	nameKeySize       = 32
+)
+
+// HashNames names the files of the backend directory after an HMAC of
+// their service and key instead of the base64url encoding of both, which
+// anyone listing the directory can decode, so that names such as
+// "aws/prod-root-key" don't leak. The HMAC key is random and, with the
+// real names, stored in an index encrypted like the values: List reads
+// the index, and the first Set of a key and its Del rewrite it. Entries
+// named the base64url way, written without HashNames or by the plain file
+// storage, are renamed when the backend is first used.
+//
+// Directories with hashed names must be opened with HashNames: without it
+// NewEncryptedFileBackend returns an error wrapping ErrInvalidValue. To go
+// back, copy the secrets to another directory. HashNames cannot be
+// combined with ShardByService or FileIndex, whose subdirectories and
+// index reveal names, and doesn't apply to NewEncryptedSingleFileBackend,
+// which encrypts names already; both return an error wrapping
+// ErrInvalidValue.
+func HashNames(enabled bool) EncryptedOption {
+	return func(c *encryptedConfig) {
+		c.hashNames = enabled
+	}
+}
+
+// checkHashedNames returns an error if dir has hashed names but cfg
+// doesn't ask for them.
+func checkHashedNames(dir string, cfg encryptedConfig) error {
+	if cfg.hashNames {
+		return nil
+	}
+	if _, err := os.Lstat(filepath.Join(dir, namesIndexName)); err == nil {
+		return fmt.Errorf("%w: %s has hashed file names, open it with HashNames", ErrInvalidValue, dir)
+	}
+	return nil
+}
+
+// nameIndex holds the names index of a directory for its fileStore.
+type nameIndex struct {
+	codec valueCodec // seals the index, and rejects it unsealed
+
+	mu  sync.Mutex
+	key []byte // the HMAC key; nil: not read yet
+}
+
+// namesDoc is the content of the names index.
+type namesDoc struct {
+	Version int                  `json:"version"`
+	Key     []byte               `json:"key"`
+	Names   map[string]namedFile `json:"names"` // by file name
+}
+
+// namedFile is the secret a hashed file name stands for.
+type namedFile struct {
+	Service string `json:"service"`
+	Key     string `json:"key"`
+}
+
+// newNameIndex returns the names index sealed with key. It is bound as
+// the secret of no service, so that no secret's file passes for it.
+func newNameIndex(key *cachedKey) *nameIndex {
+	codec := &encryptedCodec{key: key, requireAuth: true}
+	return &nameIndex{codec: codec.bind("", namesIndexName)}
+}
+
+// fileName returns the name of the file of service and key in dir.
+func (n *nameIndex) fileName(dir, service, key string) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.key == nil {
+		doc, err := n.read(dir)
+		switch {
+		case err == nil:
+			n.key = doc.Key
+		case errors.Is(err, fs.ErrNotExist):
+			// First use: create the index, and its key
+			if err := n.updateLocked(dir, func(map[string]namedFile) {}); err != nil {
+				return "", err
+			}
+		default:
+			return "", err
+		}
+	}
+
+	mac := hmac.New(sha256.New, n.key)
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(len(service))))
+	mac.Write([]byte(service))
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil)) + hashedNameSuffix, nil
+}
+
+// read returns the names index of dir, or an error wrapping
+// fs.ErrNotExist if it doesn't exist yet.
+func (n *nameIndex) read(dir string) (namesDoc, error) {
+	data, err := readSecretFile(filepath.Join(dir, namesIndexName))
+	if os.IsNotExist(err) {
+		return namesDoc{}, fs.ErrNotExist
+	}
+	if err != nil {
+		return namesDoc{}, fmt.Errorf("vault: failed to read names index: %w", err)
+	}
+	plain, err := n.codec.Decode(data)
+	if err != nil {
+		return namesDoc{}, fmt.Errorf("%w: failed to decrypt names index: %w", ErrCorrupt, err)
+	}
+	defer clear(plain)
+	var doc namesDoc
+	if err := json.Unmarshal(plain, &doc); err != nil {
+		return namesDoc{}, fmt.Errorf("%w: invalid names index: %w", ErrCorrupt, err)
+	}
+	if doc.Version != namesIndexVersion {
+		return namesDoc{}, fmt.Errorf("vault: unsupported names index version %d", doc.Version)
+	}
+	if len(doc.Key) != nameKeySize {
+		return namesDoc{}, fmt.Errorf("%w: names index has no valid key", ErrCorrupt)
+	}
+	if doc.Names == nil {
+		doc.Names = map[string]namedFile{}
+	}
+	return doc, nil
+}
+
+// names returns the file names recorded in the index of dir, and the
+// secrets they stand for.
+func (n *nameIndex) names(dir string) (map[string]namedFile, error) {
+	doc, err := n.read(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Names, nil
+}
+
+// update applies fn to the names of the index of dir and writes it back.
+func (n *nameIndex) update(dir string, fn func(names map[string]namedFile)) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.updateLocked(dir, fn)
+}
+
+// updateLocked is update for a caller holding n.mu.
+func (n *nameIndex) updateLocked(dir string, fn func(names map[string]namedFile)) error {
+	if err := mkdirStorage(dir); err != nil {
+		return err
+	}
+	unlock, err := lockFile(context.Background(), filepath.Join(dir, namesLockName))
+	if err != nil {
+		return fmt.Errorf("vault: failed to lock names index: %w", err)
+	}
+	defer unlock()
+
+	doc, err := n.read(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		doc = namesDoc{Version: namesIndexVersion, Key: make([]byte, nameKeySize), Names: map[string]namedFile{}}
+		rand.Read(doc.Key)
+	} else if err != nil {
+		return err
+	}
+	fn(doc.Names)
+	plain, err := json.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	sealed, err := n.codec.Encode(plain)
+	clear(plain)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, namesIndexName), func(w io.Writer) error {
+		_, err := w.Write(sealed)
+		return err
+	}); err != nil {
+		return writeError("names index", err)
+	}
+	n.key = doc.Key
+	return nil
+}
+
+// forget drops the HMAC key, for Close.
+func (n *nameIndex) forget() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	clear(n.key)
+	n.key = nil
+}
+
+// nameAdded records service and key in the names index before the first
+// write of their file, at path. An existing file is already recorded.
+func (s *fileStore) nameAdded(path, service, key string) error {
+	if s.names == nil {
+		return nil
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return nil
+	}
+	return s.names.update(filepath.Dir(path), func(names map[string]namedFile) {
+		names[filepath.Base(path)] = namedFile{service, key}
+	})
+}
+
+// nameRemoved removes the file at path from the names index, after it was
+// deleted.
+func (s *fileStore) nameRemoved(path string) error {
+	if s.names == nil {
+		return nil
+	}
+	return s.names.update(filepath.Dir(path), func(names map[string]namedFile) {
+		delete(names, filepath.Base(path))
+	})
+}
+
+// listHashed returns the keys of service the names index of dir records,
+// whose files exist: a crash between recording a name and writing the
+// file leaves the name behind.
+func (s *fileStore) listHashed(dir, service string) ([]string, error) {
+	names, err := s.names.names(dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for file, name := range names {
+		if name.Service != service || name.Key == "" {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(dir, file)); err == nil {
+			keys = append(keys, name.Key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// hashFiles renames the base64url-named secret files of the flat
+// directory dir after their hashed names. The names are recorded first, so
+// an interrupted migration leaves every secret readable under one name or
+// the other, and is completed the next time it runs.
+func (s *fileStore) hashFiles(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	type rename struct {
+		from, to string
+		name     namedFile
+	}
+	var renames []rename
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name, err := base64.URLEncoding.DecodeString(entry.Name())
+		if err != nil {
+			continue
+		}
+		service, key, _ := s.splitName(context.Background(), filepath.Join(dir, entry.Name()), string(name))
+		if service == "" {
+			continue
+		}
+		hashed, err := s.names.fileName(dir, service, key)
+		if err != nil {
+			return err
+		}
+		renames = append(renames, rename{entry.Name(), hashed, namedFile{service, key}})
+	}
+	if len(renames) == 0 {
+		return nil
+	}
+
+	if err := s.names.update(dir, func(names map[string]namedFile) {
+		for _, r := range renames {
+			names[r.to] = r.name
+		}
+	}); err != nil {
+		return err
+	}
+	for _, r := range renames {
+		err := os.Rename(filepath.Join(dir, r.from), filepath.Join(dir, r.to))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
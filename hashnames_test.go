@@ -0,0 +1,154 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// checkNoNames fails if a file of dir, or its content, reveals the names
+// of the storage.
+func checkNoNames(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if decoded, err := base64.URLEncoding.DecodeString(entry.Name()); err == nil && len(decoded) > 0 {
+			t.Errorf("file %s has a base64url name, %q", entry.Name(), decoded)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			if strings.Contains(entry.Name(), name) || bytes.Contains(data, []byte(name)) {
+				t.Errorf("file %s reveals %q", entry.Name(), name)
+			}
+		}
+	}
+}
+
+func TestHashNames(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	passphrase := []byte("passphrase")
+	open := func(opts ...EncryptedOption) Backend {
+		t.Helper()
+		b, err := NewEncryptedFileBackend(dir, passphrase, opts...)
+		if err != nil {
+			t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+		}
+		return b
+	}
+
+	b := open(HashNames(true))
+	for _, key := range []string{"prod-root-key", "staging-key"} {
+		if err := b.Set(ctx, "aws", key, []byte("value of "+key)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if err := b.(*encryptedBackend).setReader(ctx, "aws", "streamed-key", strings.NewReader("streamed")); err != nil {
+		t.Fatalf("setReader failed: %v", err)
+	}
+	if err := b.Set(ctx, "aws", "staging-key", []byte("overwritten")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := b.Del(ctx, "aws", "streamed-key"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	checkNoNames(t, dir, "aws", "prod-root-key", "staging-key", "streamed-key")
+
+	// The names are recovered with the key only
+	b = open(HashNames(true))
+	if keys, err := b.List(ctx, "aws"); err != nil || !slices.Equal(keys, []string{"prod-root-key", "staging-key"}) {
+		t.Errorf("List = %q, %v, want [prod-root-key staging-key]", keys, err)
+	}
+	if value, err := b.Get(ctx, "aws", "staging-key"); err != nil || string(value) != "overwritten" {
+		t.Errorf("Get = %q, %v, want the value last set", value, err)
+	}
+	if _, err := b.Get(ctx, "aws", "streamed-key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted key = %v, want ErrNotFound", err)
+	}
+	if problems, err := b.(*encryptedBackend).verify(ctx, false); err != nil || len(problems) != 0 {
+		t.Errorf("verify = %+v, %v, want no problems", problems, err)
+	}
+
+	if _, err := NewEncryptedFileBackend(dir, passphrase); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("opening hashed names without HashNames = %v, want ErrInvalidValue", err)
+	}
+	if _, err := NewEncryptedFileBackend(t.TempDir(), passphrase, HashNames(true), ShardByService(true)); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("HashNames with ShardByService = %v, want ErrInvalidValue", err)
+	}
+	if _, err := NewEncryptedFileBackend(t.TempDir(), passphrase, HashNames(true), FileIndex(true)); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("HashNames with FileIndex = %v, want ErrInvalidValue", err)
+	}
+	if _, err := NewEncryptedSingleFileBackend(filepath.Join(t.TempDir(), "vault.json"), passphrase, HashNames(true)); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("NewEncryptedSingleFileBackend with HashNames = %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestHashNamesMigrate(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	passphrase := []byte("passphrase")
+
+	// Base64url names, encrypted and plain
+	b, err := NewEncryptedFileBackend(dir, passphrase)
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if err := b.Set(ctx, "aws", "prod-root-key", []byte("encrypted")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	plain := &fileStore{dir: func() (string, error) { return dir, nil }, codec: defaultCodec}
+	if err := plain.set(ctx, "aws", "legacy-key", []byte("plain")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+
+	if b, err = NewEncryptedFileBackend(dir, passphrase, HashNames(true)); err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if keys, err := b.List(ctx, "aws"); err != nil || !slices.Equal(keys, []string{"legacy-key", "prod-root-key"}) {
+		t.Errorf("List after migration = %q, %v, want both keys", keys, err)
+	}
+	for key, want := range map[string]string{"prod-root-key": "encrypted", "legacy-key": "plain"} {
+		if value, err := b.Get(ctx, "aws", key); err != nil || string(value) != want {
+			t.Errorf("Get(%s) after migration = %q, %v, want %q", key, value, err, want)
+		}
+	}
+	checkNoNames(t, dir, "prod-root-key", "legacy-key")
+}
+
+// TestHashNamesSlashes checks that a service containing a slash lists only
+// its own keys, and isn't listed as keys of a shorter service.
+func TestHashNamesSlashes(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	b, err := NewEncryptedFileBackend(t.TempDir(), []byte("passphrase"), HashNames(true))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	for _, name := range [][2]string{{"aws", "key"}, {"aws/prod", "root"}, {"aws", "prod/other"}} {
+		if err := b.Set(ctx, name[0], name[1], []byte("value")); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	for service, want := range map[string][]string{"aws": {"key", "prod/other"}, "aws/prod": {"root"}} {
+		if keys, err := b.List(ctx, service); err != nil || !slices.Equal(keys, want) {
+			t.Errorf("List(%s) = %q, %v, want %q", service, keys, err, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package vault
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Event describes a completed operation, for logging and metrics. It never
+// carries secret values.
+type Event struct {
+	// Op is the operation: "set", "get", "getraw", "metadata", "del",
+	// "dedupe", "list", "size", "contenttype", "touch", "purge" or "swap" for
+	// CompareAndSwap, "mirror" for a failed write to the mirror of a
+	// NewMirroredBackend, "maxage" for a secret read past the age set with
+	// WithMaxAge, "backup" for a backup sent to the sink of WithBackupSink,
+	// or "lock" and "unlock".
+	Op string
+
+	// Service and Key identify the secret. Key is empty for "list" and
+	// "purge", and both are empty for "lock" and "unlock".
+	Service string
+	Key     string
+
+	// Duration is the time spent in the underlying storage. For backends
+	// that shell out to a CLI tool (security on macOS, secret-tool on
+	// Linux) it is the total run time of the subprocesses the operation
+	// spawned. For the others it is the time taken by the whole call.
+	Duration time.Duration
+
+	// Wait is the time the operation spent queuing for the limit of
+	// concurrent commands set with WithMaxConcurrentOps, which is not part
+	// of Duration.
+	Wait time.Duration
+
+	// Err is the error the operation returned, if any.
+	Err error
+}
+
+var hook atomic.Pointer[func(Event)]
+
+// SetHook registers fn to be called after every Set, Get, Del and List,
+// including their Context variants, with a description of the operation.
+// Passing nil removes the hook. fn is called synchronously on the calling
+// goroutine, so it must be fast and safe for concurrent use.
+func SetHook(fn func(Event)) {
+	if fn == nil {
+		hook.Store(nil)
+		return
+	}
+	hook.Store(&fn)
+}
+
+type timingKey struct{}
+
+// opTiming accumulates the time an operation spends in subprocesses.
+type opTiming struct {
+	start time.Time
+	exec  atomic.Int64
+	wait  atomic.Int64
+	ran   atomic.Bool
+}
+
+// observers are the places an operation is reported to, besides the
+// package-wide hook and audit log.
+type observers struct {
+	hook  func(Event)
+	audit *auditLog
+}
+
+// startOp returns a context that records subprocess timing for an
+// operation, and a function that reports the operation to the hook and
+// the audit log.
+func startOp(ctx context.Context, op, service, key string) (context.Context, func(error)) {
+	return observeOp(ctx, observers{}, op, service, key)
+}
+
+// observersKey is the context key of the observers of the Vault running
+// an operation, for the events its backend reports on its own.
+type observersKey struct{}
+
+// contextObservers returns the observers of the operation running under
+// ctx, which are empty outside a Vault's operations.
+func contextObservers(ctx context.Context) observers {
+	local, _ := ctx.Value(observersKey{}).(observers)
+	return local
+}
+
+// observeOp is like startOp but also reports the operation to local.
+func observeOp(ctx context.Context, local observers, op, service, key string) (context.Context, func(error)) {
+	fn, log := hook.Load(), audit.Load()
+	if fn == nil && log == nil && local.hook == nil && local.audit == nil {
+		return ctx, func(error) {}
+	}
+
+	timing := &opTiming{start: time.Now()}
+	ctx = context.WithValue(ctx, timingKey{}, timing)
+	if local.hook != nil || local.audit != nil {
+		ctx = context.WithValue(ctx, observersKey{}, local)
+	}
+
+	return ctx, func(err error) {
+		duration := time.Since(timing.start)
+		if timing.ran.Load() {
+			duration = time.Duration(timing.exec.Load())
+		}
+		e := Event{
+			Op:       op,
+			Service:  service,
+			Key:      key,
+			Duration: duration,
+			Wait:     time.Duration(timing.wait.Load()),
+			Err:      err,
+		}
+		for _, log := range []*auditLog{log, local.audit} {
+			if log != nil {
+				log.record(e)
+			}
+		}
+		if fn != nil {
+			(*fn)(e)
+		}
+		if local.hook != nil {
+			local.hook(e)
+		}
+	}
+}
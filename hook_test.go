@@ -0,0 +1,96 @@
+package vault
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestHook(t *testing.T) {
+	key := "test-hook-key"
+	value := []byte("hook-secret-value")
+
+	var (
+		mu     sync.Mutex
+		events []Event
+	)
+	SetHook(func(e Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	})
+	defer SetHook(nil)
+
+	// Clean up
+	_ = Del(testService, key)
+	events = nil
+
+	if err := Set(testService, key, value); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := Get(testService, key); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if err := Del(testService, key); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	_, _ = Get(testService, key)
+
+	want := []Event{
+		{Op: "set", Service: testService, Key: key},
+		{Op: "get", Service: testService, Key: key},
+		{Op: "del", Service: testService, Key: key},
+		{Op: "get", Service: testService, Key: key, Err: ErrNotFound},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("hook received %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, e := range events {
+		if e.Op != want[i].Op || e.Service != want[i].Service || e.Key != want[i].Key || e.Err != want[i].Err {
+			t.Errorf("event %d = %+v, want %+v", i, e, want[i])
+		}
+		if e.Duration < 0 {
+			t.Errorf("event %d has negative duration %v", i, e.Duration)
+		}
+	}
+
+	// Invalid input is rejected before any operation starts
+	events = nil
+	_ = Set("", key, value)
+	if len(events) != 0 {
+		t.Errorf("hook received %d events for invalid input, want 0", len(events))
+	}
+
+	SetHook(nil)
+	if err := Set(testService, key, value); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	defer Del(testService, key)
+	if len(events) != 0 {
+		t.Errorf("hook received %d events after removal, want 0", len(events))
+	}
+}
+
+func TestRunCommandTiming(t *testing.T) {
+	if runtime.GOOS == "js" {
+		t.Skip("subprocesses are not supported on js/wasm")
+	}
+
+	var got Event
+	SetHook(func(e Event) { got = e })
+	defer SetHook(nil)
+
+	ctx, done := startOp(context.Background(), "get", testService, "key")
+
+	// The test binary is the one command guaranteed to exist everywhere.
+	if _, _, err := runCommand(ctx, nil, os.Args[0], "-test.run=^$"); err != nil {
+		t.Fatalf("runCommand failed: %v", err)
+	}
+	done(nil)
+
+	if got.Duration <= 0 {
+		t.Errorf("Event.Duration = %v, want the subprocess run time", got.Duration)
+	}
+}
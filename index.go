@@ -0,0 +1,450 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// indexName is the sidecar file of a storage directory recording the
+// service, key and metadata of every secret next to the file holding it.
+// Its name starts with a dot, which no secret file does.
+const indexName = ".vault-index"
+
+// indexHeader starts every index file.
+const indexHeader = "# ella.to/vault index: service, key, file, created, modified, expires, size and app of every secret, tab separated\n"
+
+// indexFields is the number of fields of an index line.
+const indexFields = 8
+
+// indexEntry is a line of the index: the file, relative to the storage
+// directory with slash separators, holding the secret of service and key,
+// and its metadata. Times are Unix nanoseconds, and expires is 0 for a
+// secret without a TTL.
+type indexEntry struct {
+	service, key, file string
+
+	created, modified, expires int64
+	size                       int
+	app                        string
+}
+
+// SetFileIndex makes the file storage used by the Linux fallback, iOS and
+// Android keep a .vault-index file in its directory, listing the service
+// and key of every secret next to the name of the file holding it, with
+// when it was created, last set and expires, its size and the app that set
+// it. Operators browsing the directory can tell the entries apart without
+// decoding their names, and GetMetadata and PurgeExpired read the index
+// instead of opening every file. Set and Del keep it up to date; Verify
+// reports an index that no longer matches the directory, for example after
+// a write by a program that doesn't maintain it, and Repair rebuilds it.
+// Enabling it builds the index on the next operation, which reads every
+// secret once, and disabling it removes the file. It has no effect on the
+// other platforms.
+func SetFileIndex(enabled bool) {
+	if platformFiles != nil {
+		platformFiles.setIndexed(enabled)
+	}
+}
+
+// setIndexed enables or disables the index. It is built or removed before
+// the next operation.
+func (s *fileStore) setIndexed(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexed != enabled {
+		s.indexed = enabled
+		s.indexPending = true
+	}
+}
+
+func (s *fileStore) isIndexed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.indexed
+}
+
+// syncIndex builds the index of dir, or removes it when the index is
+// disabled. The caller holds s.mu.
+func (s *fileStore) syncIndex(dir string, sharded bool) error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	if !s.indexed {
+		if err := os.Remove(filepath.Join(dir, indexName)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	entries, err := s.scanIndex(dir, sharded)
+	if err != nil {
+		return err
+	}
+	return writeIndex(dir, entries)
+}
+
+// indexSet records in the index that the secret of service and key was
+// written to path, with a value of size bytes expiring at expires.
+func (s *fileStore) indexSet(service, key, path string, size int, expires int64) error {
+	if !s.isIndexed() {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("vault: failed to update index: %w", err)
+	}
+	e := indexEntry{
+		service:  service,
+		key:      key,
+		modified: info.ModTime().UnixNano(),
+		expires:  expires,
+		size:     size,
+		app:      fileApp(path),
+	}
+	e.created = e.modified
+	return s.updateIndex(service, key, &e)
+}
+
+// indexDel records in the index that the secret of service and key was
+// removed.
+func (s *fileStore) indexDel(service, key string) error {
+	if !s.isIndexed() {
+		return nil
+	}
+	return s.updateIndex(service, key, nil)
+}
+
+// updateIndex replaces the entry of service and key in the index with e,
+// keeping its creation time, or removes it if e is nil.
+func (s *fileStore) updateIndex(service, key string, e *indexEntry) error {
+	dir, sharded, err := s.layout()
+	if err != nil {
+		return err
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	entries, err := readIndex(dir)
+	if os.IsNotExist(err) {
+		// Removed behind our back: the directory is the reference
+		entries, err = s.scanIndex(dir, sharded)
+	} else if err == nil {
+		file := indexFile(service, key, sharded)
+		if i := slices.IndexFunc(entries, func(e indexEntry) bool { return e.file == file }); i >= 0 {
+			if e != nil {
+				e.created = entries[i].created
+			}
+			entries = slices.Delete(entries, i, i+1)
+		}
+		if e != nil {
+			e.file = file
+			entries = append(entries, *e)
+		}
+	}
+	if err == nil {
+		err = writeIndex(dir, entries)
+	}
+	if err != nil {
+		return fmt.Errorf("vault: failed to update index: %w", err)
+	}
+	return nil
+}
+
+// indexFile returns the name in the index of the file holding service and
+// key.
+func indexFile(service, key string, sharded bool) string {
+	if sharded {
+		return shardName(service) + "/" + fileName(key)
+	}
+	return fileName(service + "/" + key)
+}
+
+// indexLookup returns the index entries of service, or of its key alone if
+// key isn't empty. ok is false if the store keeps no index.
+func (s *fileStore) indexLookup(service, key string) (entries []indexEntry, ok bool, err error) {
+	if !s.isIndexed() {
+		return nil, false, nil
+	}
+	dir, _, err := s.layout()
+	if err != nil {
+		return nil, true, err
+	}
+
+	s.indexMu.Lock()
+	all, err := readIndex(dir)
+	s.indexMu.Unlock()
+	if os.IsNotExist(err) {
+		// Rebuilt on the next write; read the files meanwhile
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, true, fmt.Errorf("vault: failed to read index: %w", err)
+	}
+	for _, e := range all {
+		if e.service == service && (key == "" || e.key == key) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, true, nil
+}
+
+// expiring returns the keys of service whose recorded expiry has passed.
+// ok is false if the store keeps no index.
+func (s *fileStore) expiring(ctx context.Context, service string) (keys []string, ok bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, true, err
+	}
+	entries, ok, err := s.indexLookup(service, "")
+	for _, e := range entries {
+		if e.expires != 0 && !now().Before(time.Unix(0, e.expires)) {
+			keys = append(keys, e.key)
+		}
+	}
+	return keys, ok, err
+}
+
+// valueInfo returns the size and expiry, as recorded in the index, of a
+// value as stored.
+func valueInfo(stored []byte) (size int, expires int64) {
+	if value, exp, ok := openTTL(stored); ok {
+		return len(value), exp.UnixNano()
+	}
+	return len(stored), 0
+}
+
+// fileMetadata returns the metadata of the secret file at path, of service
+// and key, from the file itself.
+func (s *fileStore) fileMetadata(path, service, key string) (Metadata, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Metadata{}, err
+	}
+	md := Metadata{App: fileApp(path), Modified: info.ModTime()}
+	data, err := readSecretFile(path)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if value, err := s.codecFor(service, key).Decode(data); err == nil {
+		size, expires := valueInfo(value)
+		md.Size = size
+		if expires != 0 {
+			md.Expires = time.Unix(0, expires)
+		}
+	}
+	return md, nil
+}
+
+func (e indexEntry) metadata() Metadata {
+	md := Metadata{
+		App:      e.app,
+		Created:  time.Unix(0, e.created),
+		Modified: time.Unix(0, e.modified),
+		Size:     e.size,
+	}
+	if e.expires != 0 {
+		md.Expires = time.Unix(0, e.expires)
+	}
+	return md
+}
+
+// scanIndex builds the index of the secret files in dir from the files
+// themselves, keeping the creation times of the current index.
+func (s *fileStore) scanIndex(dir string, sharded bool) ([]indexEntry, error) {
+	type name struct{ service, key string }
+	created := map[name]int64{}
+	if prev, err := readIndex(dir); err == nil {
+		for _, e := range prev {
+			created[name{e.service, e.key}] = e.created
+		}
+	}
+
+	var entries []indexEntry
+	add := func(service, key, file string) {
+		md, err := s.fileMetadata(filepath.Join(dir, filepath.FromSlash(file)), service, key)
+		if err != nil {
+			return // removed meanwhile
+		}
+		e := indexEntry{
+			service:  service,
+			key:      key,
+			file:     file,
+			modified: md.Modified.UnixNano(),
+			size:     md.Size,
+			app:      md.App,
+		}
+		if !md.Expires.IsZero() {
+			e.expires = md.Expires.UnixNano()
+		}
+		e.created = cmp.Or(created[name{service, key}], e.modified)
+		entries = append(entries, e)
+	}
+
+	if !sharded {
+		names, err := readNames(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if service, key, _ := s.splitName(context.Background(), filepath.Join(dir, fileName(name)), name); service != "" {
+				add(service, key, fileName(name))
+			}
+		}
+		return entries, nil
+	}
+
+	shards, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, shard := range shards {
+		service, err := base64.URLEncoding.DecodeString(shard.Name())
+		if !shard.IsDir() || err != nil || len(service) == 0 {
+			continue
+		}
+		keys, err := readNames(filepath.Join(dir, shard.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			add(string(service), key, indexFile(string(service), key, true))
+		}
+	}
+	return entries, nil
+}
+
+// readIndex parses the index file of dir.
+func readIndex(dir string) ([]indexEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, indexName))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []indexEntry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := parseIndexLine(line)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+func parseIndexLine(line string) (indexEntry, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != indexFields {
+		return indexEntry{}, errors.New("malformed index line")
+	}
+	var e indexEntry
+	var errs []error
+	unquote := func(s string) string {
+		u, err := strconv.Unquote(s)
+		errs = append(errs, err)
+		return u
+	}
+	parseTime := func(s string) int64 {
+		if s == "-" {
+			return 0
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		errs = append(errs, err)
+		return t.UnixNano()
+	}
+	e.service, e.key, e.file = unquote(fields[0]), unquote(fields[1]), fields[2]
+	e.created, e.modified, e.expires = parseTime(fields[3]), parseTime(fields[4]), parseTime(fields[5])
+	size, err := strconv.Atoi(fields[6])
+	e.size = size
+	e.app = unquote(fields[7])
+	if err := errors.Join(append(errs, err)...); err != nil {
+		return indexEntry{}, fmt.Errorf("malformed index line: %w", err)
+	}
+	return e, nil
+}
+
+// writeIndex replaces the index file of dir with entries, sorted by
+// service and key.
+func writeIndex(dir string, entries []indexEntry) error {
+	sortIndex(entries)
+	formatTime := func(ns int64) string {
+		if ns == 0 {
+			return "-"
+		}
+		return time.Unix(0, ns).UTC().Format(time.RFC3339Nano)
+	}
+	return writeFileAtomic(filepath.Join(dir, indexName), func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		bw.WriteString(indexHeader)
+		for _, e := range entries {
+			fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				strconv.Quote(e.service), strconv.Quote(e.key), e.file,
+				formatTime(e.created), formatTime(e.modified), formatTime(e.expires),
+				e.size, strconv.Quote(e.app))
+		}
+		return bw.Flush()
+	})
+}
+
+func sortIndex(entries []indexEntry) {
+	slices.SortFunc(entries, func(a, b indexEntry) int {
+		return cmp.Or(strings.Compare(a.service, b.service), strings.Compare(a.key, b.key), strings.Compare(a.file, b.file))
+	})
+}
+
+// verifyIndex reports a Problem if the index of dir does not match the
+// secret files in it, rebuilding it when repair is set.
+func (s *fileStore) verifyIndex(dir string, sharded, repair bool) (*Problem, error) {
+	if !s.isIndexed() {
+		return nil, nil
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	want, err := s.scanIndex(dir, sharded)
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to read storage directory: %w", err)
+	}
+	got, err := readIndex(dir)
+	if err == nil {
+		sortIndex(want)
+		sortIndex(got)
+		if slices.Equal(got, want) {
+			return nil, nil
+		}
+	}
+	p := &Problem{Kind: ProblemStaleIndex, Path: filepath.Join(dir, indexName), Err: err}
+	if repair {
+		p.Repaired = writeIndex(dir, want) == nil
+	}
+	return p, nil
+}
+
+func (b nativeBackend) expiring(ctx context.Context, service string) ([]string, bool, error) {
+	if files := activeFiles(b.context(ctx)); files != nil {
+		return files.expiring(ctx, service)
+	}
+	return nil, false, nil
+}
+
+func (b *encryptedBackend) expiring(ctx context.Context, service string) ([]string, bool, error) {
+	release, err := b.useKey()
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+	return b.files.expiring(ctx, service)
+}
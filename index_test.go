@@ -0,0 +1,168 @@
+package vault
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readTestIndex returns the service, key and file of the entries of the
+// index of dir.
+func readTestIndex(t *testing.T, dir string) []string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, indexName))
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if lines[0]+"\n" != indexHeader {
+		t.Errorf("index starts with %q, want the header", lines[0])
+	}
+	var entries []string
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		if len(fields) != indexFields {
+			t.Fatalf("index line %q has %d fields, want %d", line, len(fields), indexFields)
+		}
+		entries = append(entries, strings.Join(fields[:3], "\t"))
+	}
+	return entries
+}
+
+func TestFileIndex(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newTestFileStore(t)
+	if err := s.set(ctx, "svc", "before", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Enabling indexes the existing entries
+	s.setIndexed(true)
+	for _, key := range []string{"b\tkey", "a"} {
+		if err := s.set(ctx, "svc", key, []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.del(ctx, "svc", "before"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`"svc"` + "\t" + `"a"` + "\t" + fileName("svc/a"),
+		`"svc"` + "\t" + `"b\tkey"` + "\t" + fileName("svc/b\tkey"),
+	}
+	if got := readTestIndex(t, dir); !slices.Equal(got, want) {
+		t.Errorf("index = %q, want %q", got, want)
+	}
+
+	// Sharding renames every file, and the index follows
+	s.setSharded(true)
+	if _, err := s.list(ctx, "svc"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		`"svc"` + "\t" + `"a"` + "\t" + shardName("svc") + "/" + fileName("a"),
+		`"svc"` + "\t" + `"b\tkey"` + "\t" + shardName("svc") + "/" + fileName("b\tkey"),
+	}
+	if got := readTestIndex(t, dir); !slices.Equal(got, want) {
+		t.Errorf("index after sharding = %q, want %q", got, want)
+	}
+
+	// A file written behind the store's back is reported and repaired
+	if err := os.WriteFile(shardFile(dir, "svc", "c"), []byte("dmFsdWU="), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := s.verify(ctx, false)
+	if err != nil || len(problems) != 1 || problems[0].Kind != ProblemStaleIndex {
+		t.Fatalf("verify = %v, %v, want a stale index", problems, err)
+	}
+	if problems, err = s.verify(ctx, true); err != nil || !problems[0].Repaired {
+		t.Fatalf("repair = %v, %v, want the index rebuilt", problems, err)
+	}
+	if got := readTestIndex(t, dir); len(got) != 3 {
+		t.Errorf("repaired index = %q, want 3 entries", got)
+	}
+	if problems, err := s.verify(ctx, false); err != nil || len(problems) != 0 {
+		t.Errorf("verify after repair = %v, %v, want no problems", problems, err)
+	}
+
+	// Disabling removes the index
+	s.setIndexed(false)
+	if _, err := s.list(ctx, "svc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, indexName)); !os.IsNotExist(err) {
+		t.Errorf("index still present after disabling: %v", err)
+	}
+}
+
+func TestFileIndexMetadata(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now().Truncate(time.Second)
+	setNow(t, start)
+
+	for _, indexed := range []bool{false, true} {
+		s, _ := newTestFileStore(t)
+		s.setIndexed(indexed)
+		b := filesBackend{s}
+
+		if err := b.Set(ctx, "svc", "key", []byte("first")); err != nil {
+			t.Fatal(err)
+		}
+		first, err := s.metadata(ctx, "svc", "key")
+		if err != nil {
+			t.Fatalf("metadata failed: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if err := b.Set(ctx, "svc", "key", sealTTL([]byte("second!"), start.Add(time.Minute))); err != nil {
+			t.Fatal(err)
+		}
+		md, err := s.metadata(ctx, "svc", "key")
+		if err != nil {
+			t.Fatalf("metadata failed: %v", err)
+		}
+		if md.Size != len("second!") || !md.Expires.Equal(start.Add(time.Minute)) || !md.Modified.After(first.Modified) {
+			t.Errorf("indexed=%v: metadata = %+v, want size 7, the expiry and a later modification", indexed, md)
+		}
+		if indexed && !md.Created.Equal(first.Modified) {
+			t.Errorf("created = %v, want the time of the first Set, %v", md.Created, first.Modified)
+		}
+		if !indexed && !md.Created.IsZero() {
+			t.Errorf("created without an index = %v, want unknown", md.Created)
+		}
+	}
+}
+
+func TestFileIndexPurgeExpired(t *testing.T) {
+	start := time.Now()
+	setNow(t, start)
+	s, dir := newTestFileStore(t)
+	s.setIndexed(true)
+	v, err := New(WithBackend(filesBackend{s}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.SetWithTTL("svc", "expired", []byte("value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("svc", "kept", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	// Purging only opens the candidates the index names, so a corrupt
+	// entry without a recorded expiry doesn't fail it
+	if err := os.WriteFile(secretFile(dir, "svc", "kept"), []byte("not base64!"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	setNow(t, start.Add(time.Hour))
+
+	if n, err := v.PurgeExpired("svc"); err != nil || n != 1 {
+		t.Errorf("PurgeExpired = %d, %v, want 1", n, err)
+	}
+	if keys, err := v.List("svc"); err != nil || !slices.Equal(keys, []string{"kept"}) {
+		t.Errorf("List = %q, %v, want [kept]", keys, err)
+	}
+}
@@ -0,0 +1,391 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Vault is a handle on a secret store with its own configuration, so that
+// several independently configured vaults, such as one per tenant, can be
+// used in the same process. The package-level functions use a default
+// Vault that follows SetDefaultBackend, SetGetCache and the other
+// package-wide settings. A Vault is safe for concurrent use.
+type Vault struct {
+	backend Backend // nil: the default backend
+	timeout time.Duration
+	appID   string
+	obs     observers
+	cache   getCache
+	flights getFlights
+	writes  writeCoalescer
+	mapper  atomic.Pointer[keyMapper]
+	maxKeys int // 0: no limit
+	closed  atomic.Bool
+
+	expiries expiryWatches // see OnExpire
+	backups  *backupSink   // see WithBackupSink
+
+	emptyDeletes bool   // see WithEmptyValueDeletes
+	owner        string // "": untagged writes, unchecked deletes
+
+	envOverrides atomic.Bool
+
+	maxAge            time.Duration // 0: not checked
+	maxAgeUnsupported atomic.Bool   // the lack of timestamps was reported
+
+	fingerprintKey  []byte // nil: a random key, made by the first Fingerprint
+	fingerprintOnce sync.Once
+
+	auditWriter io.Writer // see WithAuditLog
+	auditKey    []byte    // nil: a random key
+
+	writeMu sync.Mutex // serializes read-modify-writes: fields, conditional writes
+}
+
+// Option configures a Vault created with New.
+type Option func(*Vault)
+
+// std is the Vault the package-level functions use.
+var std = &Vault{}
+
+// WithBackend makes the Vault store secrets in b instead of the platform's
+// native storage.
+func WithBackend(b Backend) Option {
+	return func(v *Vault) {
+		v.backend = b
+	}
+}
+
+// WithTimeout bounds every operation of the Vault: once d has passed, the
+// operation is aborted and returns context.DeadlineExceeded, as if its
+// context had that deadline.
+func WithTimeout(d time.Duration) Option {
+	return func(v *Vault) {
+		v.timeout = d
+	}
+}
+
+// WithAppIdentity sets the identity the Vault records with the secrets it
+// sets, instead of the one set with SetAppIdentity.
+func WithAppIdentity(id string) Option {
+	return func(v *Vault) {
+		v.appID = id
+	}
+}
+
+// WithHook registers fn to be called after every operation of the Vault,
+// like SetHook does for every operation in the process. Both are called.
+func WithHook(fn func(Event)) Option {
+	return func(v *Vault) {
+		v.obs.hook = fn
+	}
+}
+
+// WithAuditLog writes the Vault's operations to w in the format of
+// SetAuditLog, in addition to the process-wide audit log. Key names are
+// hashed with a random key of the Vault, or the one set with
+// WithAuditKey, so they can only be correlated within one log.
+func WithAuditLog(w io.Writer) Option {
+	return func(v *Vault) {
+		v.auditWriter = w
+	}
+}
+
+// WithAuditKey sets the key the Vault's audit log hashes key names with,
+// as SetAuditLogKey does for the process-wide log, so that the logs of
+// Vaults with the same key can be correlated. key must be at least 16
+// bytes, and should be random and kept secret.
+func WithAuditKey(key []byte) Option {
+	return func(v *Vault) {
+		v.auditKey = bytes.Clone(key)
+	}
+}
+
+// WithGetCache gives the Vault a cache of the last value Get returned, as
+// SetGetCache does for the package-level functions.
+func WithGetCache(maxAge time.Duration) Option {
+	return func(v *Vault) {
+		v.cache.setMaxAge(maxAge)
+	}
+}
+
+// WithEmptyValueDeletes makes Set and SetContext with an empty value
+// delete the key instead of returning ErrInvalidValue, as assigning the
+// zero value to a map entry would, and succeed if there was nothing to
+// delete. The operation is reported as a "del". Other writes, such as
+// SetWithTTL or SetIfAbsent, keep rejecting empty values.
+func WithEmptyValueDeletes(enabled bool) Option {
+	return func(v *Vault) {
+		v.emptyDeletes = enabled
+	}
+}
+
+// New returns a Vault configured with opts. Without WithBackend it uses
+// the platform's native storage, whatever SetDefaultBackend is set to.
+func New(opts ...Option) (*Vault, error) {
+	v := &Vault{}
+	for _, opt := range opts {
+		opt(v)
+	}
+	if v.timeout < 0 {
+		return nil, errors.New("vault: negative timeout")
+	}
+	if v.maxKeys < 0 {
+		return nil, errors.New("vault: negative key limit")
+	}
+	if v.maxAge < 0 {
+		return nil, errors.New("vault: negative maximum age")
+	}
+	if err := checkFingerprintKey(v.fingerprintKey); err != nil {
+		return nil, err
+	}
+	if err := checkAuditKey(v.auditKey); err != nil {
+		return nil, err
+	}
+	if v.auditWriter != nil {
+		v.obs.audit = newAuditLog(v.auditWriter, v.auditKey)
+	}
+	if err := checkBackupSink(v.backups); err != nil {
+		return nil, err
+	}
+	if v.backend == nil {
+		v.backend = NativeBackend()
+	}
+	return v, nil
+}
+
+// store returns the backend the Vault's operations use.
+func (v *Vault) store() Backend {
+	if v.closed.Load() {
+		return closedBackend{}
+	}
+	if v.backend != nil {
+		return v.backend
+	}
+	return currentBackend()
+}
+
+// start prepares ctx for an operation of the Vault and returns the
+// function that completes it, as startOp does.
+func (v *Vault) start(ctx context.Context, op, service, key string) (context.Context, func(error)) {
+	cancel := func() {}
+	if v.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, v.timeout)
+	}
+	if v.appID != "" {
+		ctx = context.WithValue(ctx, appIDKey{}, v.appID)
+	}
+	ctx, done := observeOp(ctx, v.obs, op, service, key)
+	return ctx, func(err error) {
+		done(err)
+		cancel()
+	}
+}
+
+// Set stores value under service and key, as the package-level Set does.
+func (v *Vault) Set(service, key string, value []byte) error {
+	return v.SetContext(context.Background(), service, key, value)
+}
+
+// Get retrieves the value stored under service and key, as the
+// package-level Get does.
+func (v *Vault) Get(service, key string) ([]byte, error) {
+	return v.GetContext(context.Background(), service, key)
+}
+
+// Del removes the value stored under service and key, as the package-level
+// Del does.
+func (v *Vault) Del(service, key string) error {
+	return v.DelContext(context.Background(), service, key)
+}
+
+// DelIfExists removes the value stored under service and key if there is
+// one, as the package-level DelIfExists does.
+func (v *Vault) DelIfExists(service, key string) (bool, error) {
+	err := v.DelContext(context.Background(), service, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// List returns the keys stored under service, as the package-level List
+// does.
+func (v *Vault) List(service string) ([]string, error) {
+	return v.ListContext(context.Background(), service)
+}
+
+// SetContext is like Set but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage call completes.
+func (v *Vault) SetContext(ctx context.Context, service, key string, value []byte) error {
+	return v.set(ctx, service, key, value, nil)
+}
+
+// set implements SetContext. Unless contentType is nil, it also records
+// *contentType for the value, as SetWithContentType does.
+func (v *Vault) set(ctx context.Context, service, key string, value []byte, contentType *string) error {
+	if err := checkKey(service, key); err != nil {
+		return err
+	}
+	if len(value) == 0 && v.emptyDeletes {
+		if err := v.DelContext(ctx, service, key); !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+	if err := checkValue(value); err != nil {
+		return err
+	}
+
+	ctx, done := v.start(ctx, "set", service, key)
+	b := v.store()
+	ms, mk := v.mapKey(service, key)
+	err := checkSize(ctx, b, value)
+	if err == nil {
+		err = v.checkQuota(ctx, b, ms, mk)
+	}
+	if err == nil {
+		// A typed write only coalesces with writes of the same type
+		written := value
+		if contentType != nil {
+			written = slices.Concat(value, []byte{0}, []byte(*contentType))
+		}
+		// Invalidates the cache after the write, so that no Get caches the
+		// old value meanwhile
+		err = v.writes.do(&v.cache, service, key, written, func() error {
+			if err := b.Set(ctx, ms, mk, value); err != nil {
+				return err
+			}
+			if err := v.tagOwner(ctx, b, ms, mk, value); err != nil {
+				return err
+			}
+			if contentType != nil {
+				return setContentType(ctx, b, ms, mk, value, *contentType)
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		v.expiryDisarmed(service, key)
+		v.backupChanged(b, ms)
+	}
+	done(err)
+	return err
+}
+
+// GetContext is like Get but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage call completes.
+func (v *Vault) GetContext(ctx context.Context, service, key string) ([]byte, error) {
+	return v.get(ctx, service, key, false)
+}
+
+// get reads the value stored under service and key, from the cache unless
+// fresh is set.
+func (v *Vault) get(ctx context.Context, service, key string, fresh bool) ([]byte, error) {
+	if err := checkKey(service, key); err != nil {
+		return nil, err
+	}
+
+	ctx, done := v.start(ctx, "get", service, key)
+	if value, ok, err := v.envOverride(service, key); ok {
+		traceServed(ctx, "env")
+		done(err)
+		return value, err
+	}
+	b := v.store()
+	// The cache is keyed by the names callers use, which listed keys are
+	// not
+	ms, mk, listed := v.storedKey(ctx, service, key)
+	var (
+		value []byte
+		ok    bool
+		err   error
+	)
+	if !fresh && !listed {
+		value, ok = v.cache.load(service, key)
+	}
+	if ok {
+		traceServed(ctx, "cache")
+	}
+	if !ok {
+		gen := v.cache.generation()
+		if fresh {
+			value, err = b.Get(ctx, ms, mk)
+		} else {
+			value, err = v.flights.do(ctx, flightKey{gen, ms, mk}, func(ctx context.Context) ([]byte, error) {
+				return b.Get(ctx, ms, mk)
+			})
+		}
+		if err == nil && !listed {
+			v.cache.store(gen, service, key, value)
+		}
+	}
+	if err == nil {
+		// The cache holds the stored value, so expiry is checked on hits
+		// too, but the secret is only removed after a storage read: the
+		// storage may hold a newer value than the cache
+		if ok {
+			value, err = openExpiry(value)
+		} else {
+			value, err = checkExpiry(ctx, b, ms, mk, value)
+		}
+		if err != nil {
+			v.expired(service, key)
+		}
+	}
+	var warning error
+	if err == nil {
+		warning = v.checkAge(ctx, b, ms, mk)
+	}
+	done(err)
+	v.warnAge(ctx, service, key, warning)
+	return value, err
+}
+
+// DelContext is like Del but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage call completes.
+func (v *Vault) DelContext(ctx context.Context, service, key string) error {
+	if err := checkKey(service, key); err != nil {
+		return err
+	}
+	if v.owner != "" {
+		return v.DelAsContext(ctx, service, key, v.owner)
+	}
+
+	ctx, done := v.start(ctx, "del", service, key)
+	b := v.store()
+	ms, mk := v.mapKey(service, key)
+	err := b.Del(ctx, ms, mk)
+	v.cache.invalidate()
+	if err == nil {
+		v.expiryDisarmed(service, key)
+		v.backupChanged(b, ms)
+	}
+	done(err)
+	return err
+}
+
+// ListContext is like List but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage call completes.
+func (v *Vault) ListContext(ctx context.Context, service string) ([]string, error) {
+	if err := checkService(service); err != nil {
+		return nil, err
+	}
+	ctx, done := v.start(ctx, "list", service, "")
+	keys, err := v.store().List(ctx, v.mapService(service))
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+	// Backends list in directory, map or keychain order, and the Keychain
+	// can hold duplicate items
+	keys = withoutReservedKeys(keys)
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
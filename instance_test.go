@@ -0,0 +1,156 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestVault(t *testing.T, opts ...Option) (*Vault, *MemoryBackend) {
+	b := NewMemoryBackend()
+	v, err := New(append([]Option{WithBackend(b)}, opts...)...)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return v, b
+}
+
+func TestVaultsAreIndependent(t *testing.T) {
+	useMemory(t)
+	a, _ := newTestVault(t)
+	b, _ := newTestVault(t)
+
+	if err := a.Set(testService, "key", []byte("tenant-a")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := b.Set(testService, "key", []byte("tenant-b")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		v    *Vault
+		want string
+	}{
+		{"a", a, "tenant-a"},
+		{"b", b, "tenant-b"},
+	} {
+		got, err := tc.v.Get(testService, "key")
+		if err != nil || string(got) != tc.want {
+			t.Errorf("%s.Get = %q, %v, want %q", tc.name, got, err, tc.want)
+		}
+	}
+	if _, err := Get(testService, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("package Get error = %v, want ErrNotFound", err)
+	}
+
+	if err := a.Del(testService, "key"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if keys, err := b.List(testService); err != nil || len(keys) != 1 {
+		t.Errorf("b.List after a.Del = %q, %v, want [key]", keys, err)
+	}
+}
+
+func TestVaultAppIdentity(t *testing.T) {
+	v, b := newTestVault(t, WithAppIdentity("tenant-tool"))
+	if err := v.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	md, err := b.metadata(context.Background(), testService, "key")
+	if err != nil || md.App != "tenant-tool" {
+		t.Errorf("metadata = %+v, %v, want App tenant-tool", md, err)
+	}
+}
+
+func TestVaultHook(t *testing.T) {
+	var events []Event
+	v, _ := newTestVault(t, WithHook(func(e Event) { events = append(events, e) }))
+
+	if err := v.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	_, _ = v.Get(testService, "missing")
+	// Another vault's operations are not reported
+	other, _ := newTestVault(t)
+	_ = other.Set(testService, "key", []byte("value"))
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	if events[0].Op != "set" || events[1].Op != "get" || !errors.Is(events[1].Err, ErrNotFound) {
+		t.Errorf("events = %+v, want set, then get failing with ErrNotFound", events)
+	}
+}
+
+// slowBackend blocks every Get until ctx is done.
+type slowBackend struct {
+	Backend
+}
+
+func (slowBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestVaultTimeout(t *testing.T) {
+	v, err := New(WithBackend(slowBackend{NewMemoryBackend()}), WithTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, err := v.Get(testService, "key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get error = %v, want context.DeadlineExceeded", err)
+	}
+
+	if _, err := New(WithTimeout(-time.Second)); err == nil {
+		t.Error("New with a negative timeout succeeded")
+	}
+}
+
+func TestVaultTTLAndGetMany(t *testing.T) {
+	v, _ := newTestVault(t)
+	start := time.Now()
+	setNow(t, start)
+
+	if err := v.SetWithTTL(testService, "token", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if err := v.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	values, err := v.GetMany(testService, "token", "key")
+	if err != nil || len(values) != 2 {
+		t.Errorf("GetMany = %q, %v, want both keys", values, err)
+	}
+
+	setNow(t, start.Add(time.Minute))
+	if _, err := v.Get(testService, "token"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of expired secret error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestEmptyValueDeletes(t *testing.T) {
+	strict, _ := newTestVault(t)
+	if err := strict.Set(testService, "key", nil); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Set of an empty value by default = %v, want ErrInvalidValue", err)
+	}
+
+	v, _ := newTestVault(t, WithEmptyValueDeletes(true))
+	if err := v.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := v.Set(testService, "key", nil); err != nil {
+		t.Fatalf("Set of an empty value failed: %v", err)
+	}
+	if _, err := v.Get(testService, "key"); err != ErrNotFound {
+		t.Errorf("Get after Set of an empty value = %v, want ErrNotFound", err)
+	}
+	// Absent keys are not an error
+	if err := v.Set(testService, "key", []byte{}); err != nil {
+		t.Errorf("Set of an empty value for a missing key = %v, want nil", err)
+	}
+	if err := v.Set(testService, "", nil); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Set with an empty key = %v, want ErrInvalidKey", err)
+	}
+}
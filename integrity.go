@@ -0,0 +1,177 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync/atomic"
+)
+
+// Authenticated entries of the platform file storage. With an integrity
+// key set, an entry is integrityPrefix, the base64 encoding of the value,
+// integritySep and the base64 encoding of the HMAC-SHA256 of the value,
+// keyed with the integrity key. Neither the prefix nor the separator is in
+// the base64 alphabet, so authenticated entries can never be confused with
+// plain base64 ones.
+
+const (
+	integrityPrefix = "vault:hmac-sha256:"
+	integritySep    = '.'
+
+	minIntegrityKeySize = 16
+)
+
+var integrityKey atomic.Pointer[[]byte]
+
+// SetFileIntegrityKey makes the file storage used by the Linux fallback,
+// iOS and Android authenticate the secrets it writes with an HMAC-SHA256
+// keyed with key, which Get verifies: a file modified by anything without
+// the key returns ErrCorrupt. Values are still only base64 encoded, so this
+// detects tampering without hiding them; use NewEncryptedFileBackend for
+// confidentiality. An HMAC only covers the value, so copying one
+// authenticated file over another of the same storage is not detected.
+//
+// key should be at least 32 random bytes kept outside the storage
+// directory; keys shorter than 16 bytes return ErrInvalidValue. Passing nil
+// turns authentication off again, which is the default. Plain entries,
+// such as those written before authentication was turned on, remain
+// readable and are authenticated the next time they are set. It has no
+// effect on the other platforms.
+func SetFileIntegrityKey(key []byte) error {
+	if key == nil {
+		integrityKey.Store(nil)
+		return nil
+	}
+	if len(key) < minIntegrityKeySize {
+		return &ValidationError{Field: "key", Reason: fmt.Sprintf("is shorter than %d bytes", minIntegrityKeySize), Err: ErrInvalidValue}
+	}
+	key = bytes.Clone(key)
+	integrityKey.Store(&key)
+	return nil
+}
+
+var errNoIntegrityKey = errors.New("entry is authenticated but no integrity key is set")
+
+// fileCodec is the codec of the platform file storage: base64, with an
+// HMAC while an integrity key is set.
+type fileCodec struct{}
+
+func (fileCodec) Encode(value []byte) ([]byte, error) {
+	key := integrityKey.Load()
+	if key == nil {
+		return defaultCodec.Encode(value)
+	}
+	mac := hmac.New(sha256.New, *key)
+	mac.Write(value)
+
+	var buf bytes.Buffer
+	buf.WriteString(integrityPrefix)
+	buf.WriteString(base64.StdEncoding.EncodeToString(value))
+	buf.WriteByte(integritySep)
+	buf.WriteString(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return buf.Bytes(), nil
+}
+
+func (fileCodec) Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	rest, ok := bytes.CutPrefix(data, []byte(integrityPrefix))
+	if !ok {
+		return defaultCodec.Decode(data)
+	}
+
+	key := integrityKey.Load()
+	if key == nil {
+		return nil, errNoIntegrityKey
+	}
+	i := bytes.LastIndexByte(rest, integritySep)
+	if i < 0 {
+		return nil, errors.New("authenticated entry has no HMAC")
+	}
+	value, err := base64Codec{}.Decode(rest[:i])
+	if err != nil {
+		return nil, err
+	}
+	tag, err := base64Codec{}.Decode(rest[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, *key)
+	mac.Write(value)
+	if !hmac.Equal(tag, mac.Sum(nil)) {
+		return nil, errors.New("HMAC mismatch, the entry was modified")
+	}
+	return value, nil
+}
+
+// NewEncoder streams the value as base64, and the HMAC of the value once
+// it is closed.
+func (fileCodec) NewEncoder(w io.Writer) io.WriteCloser {
+	key := integrityKey.Load()
+	if key == nil {
+		return base64Codec{}.NewEncoder(w)
+	}
+	return &macEncoder{w: w, mac: hmac.New(sha256.New, *key)}
+}
+
+// NewDecoder streams plain entries; authenticated ones are read whole so
+// that no byte of the value is returned before the HMAC is verified.
+func (c fileCodec) NewDecoder(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if prefix, _ := br.Peek(len(integrityPrefix)); string(prefix) != integrityPrefix {
+		return base64Codec{}.NewDecoder(br)
+	}
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return errReader{err}
+	}
+	value, err := c.Decode(data)
+	if err != nil {
+		return errReader{err}
+	}
+	return bytes.NewReader(value)
+}
+
+// macEncoder writes an authenticated entry for the value written to it.
+type macEncoder struct {
+	w       io.Writer
+	b64     io.WriteCloser
+	mac     hash.Hash
+	started bool
+}
+
+func (e *macEncoder) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	if _, err := io.WriteString(e.w, integrityPrefix); err != nil {
+		return err
+	}
+	e.b64 = base64.NewEncoder(base64.StdEncoding, e.w)
+	return nil
+}
+
+func (e *macEncoder) Write(p []byte) (int, error) {
+	if err := e.start(); err != nil {
+		return 0, err
+	}
+	e.mac.Write(p)
+	return e.b64.Write(p)
+}
+
+func (e *macEncoder) Close() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	if err := e.b64.Close(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, string(integritySep)+base64.StdEncoding.EncodeToString(e.mac.Sum(nil)))
+	return err
+}
@@ -0,0 +1,114 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+var testIntegrityKey = []byte("0123456789abcdef0123456789abcdef")
+
+// useIntegrityKey sets the file integrity key for the duration of a test.
+func useIntegrityKey(t *testing.T, key []byte) {
+	t.Helper()
+	if err := SetFileIntegrityKey(key); err != nil {
+		t.Fatalf("SetFileIntegrityKey failed: %v", err)
+	}
+	t.Cleanup(func() { SetFileIntegrityKey(nil) })
+}
+
+func newIntegrityFileStore(t *testing.T) (*fileStore, string) {
+	dir := t.TempDir()
+	return &fileStore{dir: func() (string, error) { return dir, nil }, codec: fileCodec{}}, dir
+}
+
+func TestFileIntegrity(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newIntegrityFileStore(t)
+
+	// Off by default: entries are plain base64
+	if err := s.set(ctx, testService, "legacy", []byte("old")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if data, _ := os.ReadFile(secretFile(dir, testService, "legacy")); string(data) != "b2xk" {
+		t.Fatalf("entry without integrity key = %q, want plain base64", data)
+	}
+
+	useIntegrityKey(t, testIntegrityKey)
+	if err := s.set(ctx, testService, "key", []byte("value")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	path := secretFile(dir, testService, "key")
+	data, err := os.ReadFile(path)
+	if err != nil || !bytes.HasPrefix(data, []byte(integrityPrefix)) {
+		t.Fatalf("entry = %q, %v, want an authenticated entry", data, err)
+	}
+	if got, err := s.get(ctx, testService, "key"); err != nil || string(got) != "value" {
+		t.Errorf("get = %q, %v, want value", got, err)
+	}
+	// Plain entries remain readable
+	if got, err := s.get(ctx, testService, "legacy"); err != nil || string(got) != "old" {
+		t.Errorf("get of a plain entry = %q, %v, want old", got, err)
+	}
+
+	// Replace the value, keeping the HMAC
+	tampered := strings.Replace(string(data), "dmFsdWU=", "dmFsdWF=", 1)
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.get(ctx, testService, "key"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("get of a tampered entry: expected ErrCorrupt, got %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	useIntegrityKey(t, []byte("another key of 32 bytes, exactly"))
+	if _, err := s.get(ctx, testService, "key"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("get with another key: expected ErrCorrupt, got %v", err)
+	}
+	SetFileIntegrityKey(nil)
+	if _, err := s.get(ctx, testService, "key"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("get of an authenticated entry without a key: expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestFileIntegrityStream(t *testing.T) {
+	useIntegrityKey(t, testIntegrityKey)
+	ctx := context.Background()
+	s, dir := newIntegrityFileStore(t)
+
+	value := bytes.Repeat([]byte("0123456789"), 20_000)
+	if err := s.setReader(ctx, testService, "key", bytes.NewReader(value)); err != nil {
+		t.Fatalf("setReader failed: %v", err)
+	}
+	data, _ := os.ReadFile(secretFile(dir, testService, "key"))
+	if !bytes.HasPrefix(data, []byte(integrityPrefix)) {
+		t.Fatalf("streamed entry is not authenticated: %.40q", data)
+	}
+	if got, err := s.get(ctx, testService, "key"); err != nil || !bytes.Equal(got, value) {
+		t.Fatalf("get of a streamed entry: %d bytes, %v", len(got), err)
+	}
+	rc, err := s.getReader(ctx, testService, "key")
+	if err != nil {
+		t.Fatalf("getReader failed: %v", err)
+	}
+	defer rc.Close()
+	if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, value) {
+		t.Errorf("getReader: %d bytes, %v", len(got), err)
+	}
+}
+
+func TestSetFileIntegrityKeyShort(t *testing.T) {
+	t.Cleanup(func() { SetFileIntegrityKey(nil) })
+	if err := SetFileIntegrityKey([]byte("short")); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("SetFileIntegrityKey with a short key: expected ErrInvalidValue, got %v", err)
+	}
+	if integrityKey.Load() != nil {
+		t.Error("a rejected key was set")
+	}
+}
@@ -0,0 +1,15 @@
+package vault
+
+// WithMacOSInternetPassword stores secrets on macOS as internet passwords
+// (the `security add-internet-password` class) instead of generic
+// passwords, for interoperability with apps that look credentials up by
+// server. The service is used as the server and the key as the account.
+// protocol is the Keychain's four-character protocol code, such as "htps"
+// or "ftp ", and may be empty to match any protocol. Other platforms
+// ignore it.
+func WithMacOSInternetPassword(protocol string) NativeOption {
+	return func(c *nativeConfig) {
+		c.macInternetPassword = true
+		c.macProtocol = protocol
+	}
+}
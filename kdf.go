@@ -0,0 +1,230 @@
+package vault
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KDF derives the encryption key of NewEncryptedFileBackend from its
+// passphrase. The key header records the function's name and parameters
+// when the key is created, and later opens derive the key with the
+// recorded ones, so a directory keeps working when the configured KDF or
+// its parameters change.
+type KDF interface {
+	// Name identifies the function in key headers, such as "argon2id".
+	Name() string
+
+	// Params returns the parameters to record for a new key.
+	Params() map[string]int
+
+	// DeriveKey derives a size-byte key from passphrase and salt with
+	// params, as returned by Params when the key was created. It must
+	// reject parameters it does not understand.
+	DeriveKey(passphrase, salt []byte, params map[string]int, size int) ([]byte, error)
+}
+
+// KeyDerivation derives the key of new encrypted directories with kdf
+// instead of the default, Argon2id. Existing directories are opened with
+// the function recorded in their key header, which must be kdf or one of
+// the package's own. FIPSMode only accepts PBKDF2, which is then the
+// default.
+func KeyDerivation(kdf KDF) EncryptedOption {
+	return func(c *encryptedConfig) {
+		c.kdf = kdf
+	}
+}
+
+const (
+	kdfArgon2id = "argon2id"
+	kdfScrypt   = "scrypt"
+
+	// maxArgon2Memory bounds the memory, in KiB, a key header can make
+	// Argon2id use: 4 GiB.
+	maxArgon2Memory = 4 << 20
+)
+
+// Argon2id parameters of new key headers, following the second
+// recommendation of RFC 9106. Tests lower them.
+var (
+	argon2Time    = 3
+	argon2Memory  = 64 << 10 // KiB
+	argon2Threads = 4
+)
+
+// Argon2id returns the Argon2id KDF with time passes over memory KiB of
+// memory and threads lanes. It is the default, with 3 passes over 64 MiB
+// and 4 lanes; lower the memory for devices that cannot spare it, or use
+// Scrypt.
+func Argon2id(time, memory, threads int) KDF {
+	return argon2idKDF{time: time, memory: memory, threads: threads}
+}
+
+type argon2idKDF struct {
+	time, memory, threads int
+}
+
+func (argon2idKDF) Name() string { return kdfArgon2id }
+
+func (k argon2idKDF) Params() map[string]int {
+	return map[string]int{"time": k.time, "memory": k.memory, "threads": k.threads}
+}
+
+func (argon2idKDF) DeriveKey(passphrase, salt []byte, params map[string]int, size int) ([]byte, error) {
+	time, memory, threads := params["time"], params["memory"], params["threads"]
+	if time < 1 || int64(time) > math.MaxUint32 || memory < 8*threads || memory > maxArgon2Memory || threads < 1 || threads > math.MaxUint8 {
+		return nil, fmt.Errorf("vault: invalid Argon2id parameters %v", params)
+	}
+	return argon2.IDKey(passphrase, salt, uint32(time), uint32(memory), uint8(threads), uint32(size)), nil
+}
+
+// Bounds of the Argon2id parameters CalibrateKDF picks. The floor is
+// OWASP's minimum of 2 passes over 19 MiB, and past 256 MiB longer
+// targets add passes instead of memory, which constrained devices may not
+// have.
+const (
+	minCalibratedTime   = 2
+	minCalibratedMemory = 19 << 10  // KiB
+	maxCalibratedMemory = 256 << 10 // KiB
+)
+
+// CalibrateKDF returns Argon2id with parameters that take about target to
+// derive a key on this machine, for encrypted directories created on
+// hardware as different as a phone and a server: it times one derivation
+// with the weakest parameters it picks, 2 passes over 19 MiB, and scales
+// the memory, up to 256 MiB, then the passes to match. Lanes are the
+// default 4, or fewer on machines with fewer CPUs. The result varies with
+// the machine's load; a target of 0 or less returns the floor without
+// measuring. Pass it to KeyDerivation, or use CalibratedKeyDerivation to
+// calibrate only when a directory is created.
+func CalibrateKDF(target time.Duration) KDF {
+	threads := max(min(argon2Threads, runtime.NumCPU()), 1)
+	if target <= 0 {
+		return Argon2id(minCalibratedTime, minCalibratedMemory, threads)
+	}
+
+	start := time.Now()
+	argon2.IDKey([]byte("calibration"), make([]byte, saltSize), minCalibratedTime, minCalibratedMemory, uint8(threads), keySize)
+	elapsed := max(time.Since(start), 1)
+
+	// The derivation time grows about linearly with passes times memory
+	cost := float64(minCalibratedTime) * minCalibratedMemory * float64(target) / float64(elapsed)
+	memory := math.Min(math.Max(cost/minCalibratedTime, minCalibratedMemory), maxCalibratedMemory)
+	passes := math.Min(math.Max(cost/memory, minCalibratedTime), math.MaxUint32)
+	return Argon2id(int(passes), int(memory), threads)
+}
+
+// CalibratedKeyDerivation derives the key of new encrypted directories with
+// the Argon2id parameters CalibrateKDF picks for target, calibrating when
+// the first directory is created rather than every time a backend is
+// opened. The key header records the parameters, so the directory opens
+// with them on any machine.
+func CalibratedKeyDerivation(target time.Duration) EncryptedOption {
+	return KeyDerivation(&calibratedKDF{target: target})
+}
+
+// calibratedKDF is Argon2id calibrated on its first Params.
+type calibratedKDF struct {
+	argon2idKDF
+	target time.Duration
+	once   sync.Once
+}
+
+func (k *calibratedKDF) Params() map[string]int {
+	k.once.Do(func() {
+		k.argon2idKDF = CalibrateKDF(k.target).(argon2idKDF)
+	})
+	return k.argon2idKDF.Params()
+}
+
+// Scrypt returns the scrypt KDF with CPU/memory cost n, a power of two,
+// block size r and parallelism p. It uses 128*n*r bytes of memory; 2^15,
+// 8 and 1 use 32 MiB.
+func Scrypt(n, r, p int) KDF {
+	return scryptKDF{n: n, r: r, p: p}
+}
+
+type scryptKDF struct {
+	n, r, p int
+}
+
+func (scryptKDF) Name() string { return kdfScrypt }
+
+func (k scryptKDF) Params() map[string]int {
+	return map[string]int{"n": k.n, "r": k.r, "p": k.p}
+}
+
+func (scryptKDF) DeriveKey(passphrase, salt []byte, params map[string]int, size int) ([]byte, error) {
+	n, r, p := params["n"], params["r"], params["p"]
+	// Bound the memory as for Argon2id
+	if r < 1 || int64(n) > int64(maxArgon2Memory)<<10/128/int64(r) {
+		return nil, fmt.Errorf("vault: invalid scrypt parameters %v", params)
+	}
+	key, err := scrypt.Key(passphrase, salt, n, r, p, size)
+	if err != nil {
+		return nil, fmt.Errorf("vault: invalid scrypt parameters %v: %w", params, err)
+	}
+	return key, nil
+}
+
+// PBKDF2 returns PBKDF2-HMAC-SHA256 with the given number of iterations,
+// the only KDF FIPSMode accepts. Its default, in FIPS mode, is 600,000
+// iterations.
+func PBKDF2(iterations int) KDF {
+	return pbkdf2KDF{iterations: iterations}
+}
+
+type pbkdf2KDF struct {
+	iterations int
+}
+
+func (pbkdf2KDF) Name() string { return kdfPBKDF2SHA256 }
+
+func (k pbkdf2KDF) Params() map[string]int {
+	return map[string]int{"iterations": k.iterations}
+}
+
+func (pbkdf2KDF) DeriveKey(passphrase, salt []byte, params map[string]int, size int) ([]byte, error) {
+	iterations := params["iterations"]
+	if iterations < 1 {
+		return nil, fmt.Errorf("vault: invalid PBKDF2 parameters %v", params)
+	}
+	return pbkdf2.Key(sha256.New, string(passphrase), salt, iterations, size)
+}
+
+// newKDF returns the KDF new key headers use under cfg.
+func newKDF(cfg encryptedConfig) KDF {
+	switch {
+	case cfg.kdf != nil:
+		return cfg.kdf
+	case cfg.fips:
+		return PBKDF2(pbkdf2Iterations)
+	default:
+		return Argon2id(argon2Time, argon2Memory, argon2Threads)
+	}
+}
+
+// headerKDF returns the KDF named name in a key header: the configured
+// one, or one of the package's.
+func headerKDF(name string, cfg encryptedConfig) (KDF, error) {
+	if cfg.kdf != nil && cfg.kdf.Name() == name {
+		return cfg.kdf, nil
+	}
+	switch name {
+	case kdfArgon2id:
+		return argon2idKDF{}, nil
+	case kdfScrypt:
+		return scryptKDF{}, nil
+	case kdfPBKDF2SHA256:
+		return pbkdf2KDF{}, nil
+	default:
+		return nil, fmt.Errorf("vault: unsupported key derivation function %q", name)
+	}
+}
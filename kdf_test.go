@@ -0,0 +1,170 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readKeyHeader(t *testing.T, dir string) keyHeader {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, keyHeaderName))
+	if err != nil {
+		t.Fatalf("reading key header: %v", err)
+	}
+	var header keyHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		t.Fatalf("decoding key header: %v", err)
+	}
+	return header
+}
+
+func TestKeyDerivation(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+
+	for _, kdf := range []KDF{nil, Argon2id(1, 128, 2), Scrypt(1<<10, 8, 1), PBKDF2(1000)} {
+		name := "default"
+		var opts []EncryptedOption
+		if kdf != nil {
+			name = kdf.Name()
+			opts = append(opts, KeyDerivation(kdf))
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			backend, err := NewEncryptedFileBackend(dir, []byte("passphrase"), opts...)
+			if err != nil {
+				t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+			}
+			if err := backend.Set(ctx, testService, "key", []byte("value")); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+
+			header := readKeyHeader(t, dir)
+			want := kdf
+			if want == nil {
+				want = Argon2id(argon2Time, argon2Memory, argon2Threads)
+			}
+			if header.KDF != want.Name() || !maps.Equal(header.Params, want.Params()) {
+				t.Errorf("key header records %s %v, want %s %v", header.KDF, header.Params, want.Name(), want.Params())
+			}
+
+			// The header, not the options, decides how the key is derived
+			reopened, err := NewEncryptedFileBackend(dir, []byte("passphrase"), KeyDerivation(Scrypt(1<<12, 8, 1)))
+			if err != nil {
+				t.Fatalf("reopening failed: %v", err)
+			}
+			if got, err := reopened.Get(ctx, testService, "key"); err != nil || string(got) != "value" {
+				t.Errorf("Get after reopen = %q, %v, want value", got, err)
+			}
+			if _, err := NewEncryptedFileBackend(dir, []byte("wrong"), opts...); err != ErrWrongPassphrase {
+				t.Errorf("opening with another passphrase = %v, want ErrWrongPassphrase", err)
+			}
+		})
+	}
+}
+
+// A header written before KDFs were pluggable records the PBKDF2
+// iterations in their own field.
+func TestKeyDerivationLegacyHeader(t *testing.T) {
+	fastKDF(t)
+	dir := t.TempDir()
+	if _, err := NewEncryptedFileBackend(dir, []byte("passphrase"), KeyDerivation(PBKDF2(1000))); err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	header := readKeyHeader(t, dir)
+	header.Iterations, header.Params = header.Params["iterations"], nil
+	data, _ := json.Marshal(&header)
+	if err := os.WriteFile(filepath.Join(dir, keyHeaderName), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewEncryptedFileBackend(dir, []byte("passphrase")); err != nil {
+		t.Errorf("opening a legacy PBKDF2 header failed: %v", err)
+	}
+}
+
+// customKDF is a KDF the package doesn't know.
+type customKDF struct{ pbkdf2KDF }
+
+func (customKDF) Name() string { return "custom" }
+
+func TestKeyDerivationCustom(t *testing.T) {
+	fastKDF(t)
+	dir := t.TempDir()
+	kdf := customKDF{pbkdf2KDF{iterations: 10}}
+	if _, err := NewEncryptedFileBackend(dir, []byte("passphrase"), KeyDerivation(kdf)); err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if _, err := NewEncryptedFileBackend(dir, []byte("passphrase"), KeyDerivation(kdf)); err != nil {
+		t.Errorf("reopening with the custom KDF failed: %v", err)
+	}
+	if _, err := NewEncryptedFileBackend(dir, []byte("passphrase")); err == nil || !strings.Contains(err.Error(), `"custom"`) {
+		t.Errorf("opening without the custom KDF = %v, want an unsupported KDF error", err)
+	}
+}
+
+func TestKeyDerivationInvalid(t *testing.T) {
+	fastKDF(t)
+	for _, kdf := range []KDF{Argon2id(1, 1<<30, 1), Argon2id(0, 64, 1), Scrypt(1000, 8, 1), Scrypt(1<<30, 8, 1), PBKDF2(0)} {
+		if _, err := NewEncryptedFileBackend(t.TempDir(), []byte("passphrase"), KeyDerivation(kdf)); err == nil {
+			t.Errorf("%s with %v succeeded", kdf.Name(), kdf.Params())
+		}
+	}
+
+	_, err := NewEncryptedFileBackend(t.TempDir(), []byte("passphrase"), FIPSMode(true), KeyDerivation(Argon2id(1, 64, 1)))
+	if err == nil || !strings.Contains(err.Error(), "not FIPS approved") {
+		t.Errorf("Argon2id in FIPS mode = %v, want rejection", err)
+	}
+	if errors.Is(err, ErrWrongPassphrase) {
+		t.Error("invalid KDF reported as a wrong passphrase")
+	}
+}
+
+func TestCalibrateKDF(t *testing.T) {
+	floor := CalibrateKDF(0).Params()
+	if floor["time"] != minCalibratedTime || floor["memory"] != minCalibratedMemory || floor["threads"] < 1 || floor["threads"] > argon2Threads {
+		t.Errorf("CalibrateKDF(0) = %v, want 2 passes over 19 MiB", floor)
+	}
+	cost := func(params map[string]int) int { return params["time"] * params["memory"] }
+
+	// Targets faster than the floor get it; slower ones cost more
+	if fast := CalibrateKDF(time.Nanosecond).Params(); !maps.Equal(fast, floor) {
+		t.Errorf("CalibrateKDF(1ns) = %v, want the floor %v", fast, floor)
+	}
+	slow := CalibrateKDF(time.Hour).Params()
+	if slow["memory"] != maxCalibratedMemory || cost(slow) <= cost(floor) {
+		t.Errorf("CalibrateKDF(1h) = %v, want more passes over 256 MiB", slow)
+	}
+}
+
+func TestCalibratedKeyDerivation(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	b, err := NewEncryptedFileBackend(dir, []byte("passphrase"), CalibratedKeyDerivation(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if err := b.Set(ctx, testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	header := readKeyHeader(t, dir)
+	if header.KDF != kdfArgon2id || !maps.Equal(header.Params, CalibrateKDF(0).Params()) {
+		t.Errorf("key header records %s %v, want the calibrated Argon2id parameters", header.KDF, header.Params)
+	}
+
+	// The recorded parameters open the directory without the option
+	reopened, err := NewEncryptedFileBackend(dir, []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	if got, err := reopened.Get(ctx, testService, "key"); err != nil || string(got) != "value" {
+		t.Errorf("Get after reopening = %q, %v, want %q", got, err, "value")
+	}
+}
@@ -0,0 +1,490 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// Client of the macOS `security` command-line tool, which interfaces with
+// the Keychain without requiring CGO; vault_darwin.go backs the native
+// backend with it. It has no build constraint, so that its command lines
+// and error parsing are tested on every platform with a stub
+// CommandRunner. Values are encoded with the default codec (base64) to
+// handle binary data safely. Items are generic passwords, or internet
+// passwords when the backend is configured with WithMacOSInternetPassword.
+
+// maxEncodedPassword bounds the base64 value passed to security as an
+// argument, well under ARG_MAX (1 MiB), which the environment shares.
+const maxEncodedPassword = 512 << 10
+
+// keychainMaxValueSize is the largest value whose encoding fits in
+// maxEncodedPassword.
+const keychainMaxValueSize = maxEncodedPassword / 4 * 3
+
+// keychainItem returns the item class the operation under ctx uses, as the
+// suffix of the security subcommands ("generic-password" or
+// "internet-password"), and the arguments that identify the item.
+func keychainItem(ctx context.Context, service, key string) (string, []string) {
+	cfg := nativeConfigFrom(ctx)
+	if !cfg.macInternetPassword {
+		return "generic-password", []string{
+			"-a", key, // account name
+			"-s", service, // service name
+		}
+	}
+
+	args := []string{
+		"-a", key, // account name
+		"-s", service, // server name
+	}
+	if cfg.macProtocol != "" {
+		args = append(args, "-r", cfg.macProtocol) // protocol code
+	}
+	return "internet-password", args
+}
+
+func keychainSet(ctx context.Context, service, key string, value []byte) error {
+	// Encode the value to safely handle binary data
+	encoded, err := encodeItem(ctx, value)
+	if err != nil {
+		return fmt.Errorf("vault: failed to encode value: %w", err)
+	}
+	if len(encoded) > maxEncodedPassword {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrValueTooLarge, len(value), keychainMaxValueSize)
+	}
+
+	if skipUnchanged.Load() && unchanged(ctx, service, key, encoded) {
+		return nil
+	}
+
+	// -U updates the item in place, which keeps its access control list and
+	// so doesn't prompt again. Replace the item only if that fails, since
+	// deleting it loses the list.
+	err = addItem(ctx, service, key, encoded)
+	if err == nil || ctx.Err() != nil || errors.Is(err, ErrAccessDenied) || errors.Is(err, ErrBackendUnavailable) {
+		return err
+	}
+	_ = keychainDel(ctx, service, key)
+	return addItem(ctx, service, key, encoded)
+}
+
+// addItem adds a Keychain item for service and key whose password is
+// encoded.
+func addItem(ctx context.Context, service, key string, encoded []byte) error {
+	class, args := keychainItem(ctx, service, key)
+	args = append([]string{"add-" + class}, args...)
+	args = append(args,
+		"-w", string(encoded), // password (encoded value)
+		"-U", // update if exists
+	)
+	if app := appIdentity(ctx); app != "" {
+		args = append(args, "-j", app) // comment
+	}
+	_, stderr, err := runCommand(ctx, nil, "security", args...)
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return err
+		}
+		return keychainError("set key", stderr)
+	}
+
+	return nil
+}
+
+// unchanged reports whether the item for service and key already holds
+// encoded and was set with the current app identity. Any read error counts
+// as changed, so that keychainSet goes on to write the item.
+func unchanged(ctx context.Context, service, key string, encoded []byte) bool {
+	raw, err := keychainGetRaw(ctx, service, key)
+	if err != nil || !bytes.Equal(raw, encoded) {
+		return false
+	}
+	md, err := keychainMetadata(ctx, service, key)
+	return err == nil && md.App == appIdentity(ctx)
+}
+
+func keychainGet(ctx context.Context, service, key string) ([]byte, error) {
+	raw, err := keychainGetRaw(ctx, service, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if nativeConfigFrom(ctx).goKeyring {
+		return decodeGoKeyring(raw)
+	}
+	decoded, err := defaultCodec.Decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode value: %w", ErrCorrupt, err)
+	}
+	return decoded, nil
+}
+
+// encodeItem returns the password stored for value: its base64 encoding,
+// or the go-keyring form with WithGoKeyringCompat.
+func encodeItem(ctx context.Context, value []byte) ([]byte, error) {
+	if nativeConfigFrom(ctx).goKeyring {
+		return encodeGoKeyring(value), nil
+	}
+	return defaultCodec.Encode(value)
+}
+
+// keychainGetRaw returns the password stored in the Keychain item, which is the
+// encoded value.
+func keychainGetRaw(ctx context.Context, service, key string) ([]byte, error) {
+	class, args := keychainItem(ctx, service, key)
+	args = append([]string{"find-" + class}, args...)
+	args = append(args, "-w") // output only the password
+	stdout, stderr, err := runCommand(ctx, nil, "security", args...)
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return nil, err
+		}
+		return nil, keychainError("get key", stderr)
+	}
+
+	// security terminates the password with a newline that is not stored
+	return bytes.TrimSuffix(stdout, []byte("\n")), nil
+}
+
+func keychainMetadata(ctx context.Context, service, key string) (Metadata, error) {
+	// Without -w, security prints the item's attributes
+	class, args := keychainItem(ctx, service, key)
+	stdout, stderr, err := runCommand(ctx, nil, "security", append([]string{"find-" + class}, args...)...)
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return Metadata{}, err
+		}
+		return Metadata{}, keychainError("get metadata", stderr)
+	}
+	return Metadata{App: parseKeychainAttribute(stdout, "icmt")}, nil
+}
+
+// maxDuplicates bounds the number of items keychainDel removes, in case security
+// keeps reporting success without removing anything.
+const maxDuplicates = 64
+
+// keychainDel removes every item matching service and key. security deletes one
+// item per call, and other tools can create duplicates that the Keychain
+// accepts as long as some other attribute differs.
+func keychainDel(ctx context.Context, service, key string) error {
+	for deleted := 0; deleted < maxDuplicates; deleted++ {
+		if err := deleteItem(ctx, service, key); err != nil {
+			if errors.Is(err, ErrNotFound) && deleted > 0 {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// keychainSelectors are the attributes besides service and account that
+// security find and delete can match items by, as parseKeychainItems names
+// them, with their flags.
+var keychainSelectors = []struct{ attr, flag string }{
+	{"labl", "-l"}, // label
+	{"icmt", "-j"}, // comment
+	{"desc", "-D"}, // kind
+	{"crtr", "-c"}, // creator
+	{"type", "-C"}, // type
+}
+
+// keychainDedupe removes all but the first item matching service and key,
+// the one security find and so Get return, and reports how many it
+// removed. The kept item is left untouched, with its access control list
+// and comment: each duplicate is deleted by the attributes it differs from
+// the kept one in. Duplicates that only differ in attributes security
+// cannot match by, such as the access group, are left, and reported in
+// the error.
+func keychainDedupe(ctx context.Context, service, key string) (int, error) {
+	items, err := keychainItems(ctx, service, key)
+	if err != nil || len(items) <= 1 {
+		return 0, err
+	}
+	class, args := keychainItem(ctx, service, key)
+	stdout, stderr, err := runCommand(ctx, nil, "security", append([]string{"find-" + class}, args...)...)
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return 0, err
+		}
+		return 0, keychainError("find kept item", stderr)
+	}
+	kept := parseKeychainItems(stdout)
+	if len(kept) != 1 {
+		return 0, fmt.Errorf("vault: unexpected output of security find-%s", class)
+	}
+
+	removed, left := 0, 0
+	found := false
+	for _, item := range items {
+		if !found && maps.Equal(item.attrs, kept[0].attrs) {
+			found = true
+			continue
+		}
+		selector, ok := duplicateSelector(item.attrs, kept[0].attrs)
+		if !ok {
+			left++
+			continue
+		}
+		if err := deleteItem(ctx, service, key, selector...); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	if !found {
+		// The kept item was printed differently, and counted as left
+		left--
+	}
+	if left > 0 {
+		return removed, fmt.Errorf("vault: %d duplicate items cannot be told apart from the kept one by security, and were left", left)
+	}
+	return removed, nil
+}
+
+// duplicateSelector returns the arguments that select the item with attrs
+// among the items of its service and account, and reports whether they
+// exclude the kept item.
+func duplicateSelector(attrs, kept map[string]string) ([]string, bool) {
+	var args []string
+	excludes := false
+	for _, s := range keychainSelectors {
+		value := attrs[s.attr]
+		if value == "" {
+			continue
+		}
+		args = append(args, s.flag, value)
+		if kept[s.attr] != value {
+			excludes = true
+		}
+	}
+	return args, excludes
+}
+
+// keychainItems returns the items of the keychain matching service and
+// key.
+func keychainItems(ctx context.Context, service, key string) ([]keychainDumpItem, error) {
+	stdout, err := dumpKeychain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	itemClass, serviceAttr := "genp", "svce"
+	if nativeConfigFrom(ctx).macInternetPassword {
+		itemClass, serviceAttr = "inet", "srvr"
+	}
+	var items []keychainDumpItem
+	for _, item := range parseKeychainItems(stdout) {
+		if item.class == itemClass && item.attrs[serviceAttr] == service && item.attrs["acct"] == key {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// deleteItem removes the first item matching service and key, and the
+// attributes selected by the flags and values of selector, if any.
+func deleteItem(ctx context.Context, service, key string, selector ...string) error {
+	class, args := keychainItem(ctx, service, key)
+	args = append([]string{"delete-" + class}, args...)
+	_, stderr, err := runCommand(ctx, nil, "security", append(args, selector...)...)
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return err
+		}
+		return keychainError("delete key", stderr)
+	}
+
+	return nil
+}
+
+// keychainDenied are the messages security prints when the Keychain
+// refuses access to an item: errSecAuthFailed, when the calling binary is
+// not in the item's access control list and the user denies it or gives
+// the wrong password, errSecUserCanceled and errSecInteractionNotAllowed,
+// when the keychain is locked and no prompt can be shown.
+var keychainDenied = []string{
+	"The user name or passphrase you entered is not correct",
+	"User canceled the operation",
+	"User interaction is not allowed",
+	"(-25293)",
+	"(-128)",
+	"(-25308)",
+}
+
+// keychainError returns the error for a failed security command, from what
+// it printed on standard error.
+func keychainError(action string, stderr []byte) error {
+	errStr := string(stderr)
+	if strings.Contains(errStr, "could not be found") ||
+		strings.Contains(errStr, "SecKeychainSearchCopyNext") {
+		return ErrNotFound
+	}
+	for _, msg := range keychainDenied {
+		if strings.Contains(errStr, msg) {
+			return fmt.Errorf("%w: failed to %s: %s", ErrAccessDenied, action, errStr)
+		}
+	}
+	return fmt.Errorf("vault: failed to %s: %s", action, errStr)
+}
+
+func keychainList(ctx context.Context, service string) ([]string, error) {
+	stdout, err := dumpKeychain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if nativeConfigFrom(ctx).macInternetPassword {
+		return parseDumpKeychainClass(stdout, "inet", "srvr", service), nil
+	}
+	return parseDumpKeychain(stdout, service), nil
+}
+
+// dumpKeychain returns the description of every item of the keychain.
+func dumpKeychain(ctx context.Context) ([]byte, error) {
+	stdout, stderr, err := runCommand(ctx, nil, "security", "dump-keychain")
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return nil, err
+		}
+		return nil, keychainError("list keys", stderr)
+	}
+	return stdout, nil
+}
+
+// parseDumpKeychain extracts the accounts of the generic passwords stored for
+// service from `security dump-keychain` output, which describes each item as:
+//
+//	keychain: "/Users/me/Library/Keychains/login.keychain-db"
+//	class: "genp"
+//	attributes:
+//	    "acct"<blob>="key"
+//	    "svce"<blob>="service"
+func parseDumpKeychain(out []byte, service string) []string {
+	return parseDumpKeychainClass(out, "genp", "svce", service)
+}
+
+// parseDumpKeychainClass extracts the accounts of the items of class (such
+// as "genp" or "inet") whose serviceAttr attribute ("svce" for generic
+// passwords, "srvr" for internet passwords) is service.
+func parseDumpKeychainClass(out []byte, itemClass, serviceAttr, service string) []string {
+	var keys []string
+	for _, item := range parseKeychainItems(out) {
+		if item.class == itemClass && item.attrs[serviceAttr] == service && item.attrs["acct"] != "" {
+			keys = append(keys, item.attrs["acct"])
+		}
+	}
+	return keys
+}
+
+// keychainDumpItem is an item as security describes it.
+type keychainDumpItem struct {
+	class string
+	attrs map[string]string // by name, such as "acct"
+}
+
+// parseKeychainItems returns the items described in the output of
+// `security dump-keychain`, or of find for a single item. The label,
+// printed as 0x00000007, is named "labl".
+func parseKeychainItems(out []byte) []keychainDumpItem {
+	var items []keychainDumpItem
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "keychain: "):
+			items = append(items, keychainDumpItem{attrs: map[string]string{}})
+		case len(items) == 0:
+			// Before the first item
+		case strings.HasPrefix(line, "class: "):
+			items[len(items)-1].class = strings.Trim(strings.TrimPrefix(line, "class: "), `"`)
+		default:
+			name, value, ok := strings.Cut(line, ">=")
+			if !ok {
+				continue
+			}
+			name, _, _ = strings.Cut(name, "<")
+			name = strings.Trim(strings.TrimSpace(name), `"`)
+			if name == "0x00000007" {
+				name = "labl"
+			}
+			items[len(items)-1].attrs[name] = parseKeychainBlob(value)
+		}
+	}
+	return items
+}
+
+// parseKeychainAttribute returns the value of the blob attribute name (such
+// as "icmt", the comment) in the description of a single item printed by
+// `security find-generic-password`, or "" if it has none.
+func parseKeychainAttribute(out []byte, name string) string {
+	prefix := `"` + name + `"<blob>=`
+	for _, line := range strings.Split(string(out), "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), prefix); ok {
+			return parseKeychainBlob(v)
+		}
+	}
+	return ""
+}
+
+// parseKeychainBlob decodes an attribute value as printed by security:
+// either "text", or 0x<hex> followed by a lossy quoted rendering when the
+// value contains non-printable bytes. <NULL> and anything else yield "".
+func parseKeychainBlob(v string) string {
+	if rest, ok := strings.CutPrefix(v, "0x"); ok {
+		digits, _, _ := strings.Cut(rest, " ")
+		decoded, err := hex.DecodeString(digits)
+		if err != nil {
+			return ""
+		}
+		return string(decoded)
+	}
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		return v[1 : len(v)-1]
+	}
+	return ""
+}
+
+// keychainLock locks the default keychain.
+func keychainLock(ctx context.Context) error {
+	_, stderr, err := runCommand(ctx, nil, "security", "lock-keychain")
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return err
+		}
+		return keychainError("lock keychain", stderr)
+	}
+	return nil
+}
+
+// keychainPasswordMax is the longest password security reads from its
+// standard input; getpass drops what follows.
+const keychainPasswordMax = 128
+
+// keychainUnlock unlocks the default keychain with password. security
+// would take it as an argument with -p, where other processes can read
+// it; without, it prompts for it, and reads it from its standard input
+// when started without a controlling terminal.
+func keychainUnlock(ctx context.Context, password []byte) error {
+	if bytes.ContainsAny(password, "\r\n") {
+		return &ValidationError{Field: "password", Reason: "contains a line break", Err: ErrInvalidValue}
+	}
+	if len(password) > keychainPasswordMax {
+		return &ValidationError{Field: "password", Reason: fmt.Sprintf("is longer than %d bytes", keychainPasswordMax), Err: ErrInvalidValue}
+	}
+	stdin := append(bytes.Clone(password), '\n')
+	defer clear(stdin)
+	ctx = context.WithValue(ctx, noTerminalKey{}, true)
+	_, stderr, err := runCommand(ctx, stdin, "security", "unlock-keychain")
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return err
+		}
+		if strings.Contains(string(stderr), "passphrase you entered is not correct") {
+			return ErrWrongPassphrase
+		}
+		return keychainError("unlock keychain", stderr)
+	}
+	return nil
+}
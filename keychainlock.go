@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// keychainLocker is implemented by backends whose storage can be locked
+// and unlocked as a whole.
+type keychainLocker interface {
+	lockKeychain(ctx context.Context) error
+	unlockKeychain(ctx context.Context, password []byte) error
+}
+
+var errNoKeychainLock = fmt.Errorf("vault: storage cannot be locked: %w", errors.ErrUnsupported)
+
+// Lock locks the storage of the native backend, so that reading its
+// secrets requires unlocking it again, for daemons that unlock it for a
+// batch of operations and want to keep the window short. On macOS it locks
+// the default keychain (security lock-keychain). On Linux with secret-tool
+// it locks the Secret Service collection secrets are stored in: the
+// default one, or the one set with WithSecretToolCollection. Elsewhere,
+// including the Linux session keyring and file storage, it returns an
+// error wrapping errors.ErrUnsupported.
+func Lock() error {
+	return std.LockContext(context.Background())
+}
+
+// LockContext is like Lock but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying command completes.
+func LockContext(ctx context.Context) error {
+	return std.LockContext(ctx)
+}
+
+// Unlock unlocks the storage locked with Lock, with the password of the
+// keychain. On macOS it unlocks the default keychain (security
+// unlock-keychain). On Linux it unlocks the login keyring of GNOME
+// Keyring, passing the password on the standard input of
+// gnome-keyring-daemon --unlock; other Secret Service providers, which
+// prompt the user themselves, are not supported. Elsewhere it returns an
+// error wrapping errors.ErrUnsupported. A wrong password returns
+// ErrWrongPassphrase where the platform reports it.
+//
+// The password never appears in errors, events or the audit log, nor in
+// the arguments of a command: on macOS it is written to the standard input
+// of security, which is started without a controlling terminal so that it
+// reads it there instead of prompting, and must not contain a line break
+// or be longer than 128 bytes.
+func Unlock(password []byte) error {
+	return std.UnlockContext(context.Background(), password)
+}
+
+// UnlockContext is like Unlock but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying command completes.
+func UnlockContext(ctx context.Context, password []byte) error {
+	return std.UnlockContext(ctx, password)
+}
+
+// Lock locks the storage of the Vault's backend, as the package-level Lock
+// does for the native backend.
+func (v *Vault) Lock() error {
+	return v.LockContext(context.Background())
+}
+
+// LockContext is like Lock but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying command completes.
+func (v *Vault) LockContext(ctx context.Context) error {
+	ctx, done := v.start(ctx, "lock", "", "")
+	l, err := v.keychainLocker()
+	if err == nil {
+		err = l.lockKeychain(ctx)
+	}
+	done(err)
+	return err
+}
+
+// Unlock unlocks the storage of the Vault's backend with password, as the
+// package-level Unlock does for the native backend.
+func (v *Vault) Unlock(password []byte) error {
+	return v.UnlockContext(context.Background(), password)
+}
+
+// UnlockContext is like Unlock but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying command completes.
+func (v *Vault) UnlockContext(ctx context.Context, password []byte) error {
+	if len(password) == 0 {
+		return &ValidationError{Field: "password", Reason: "is empty", Err: ErrInvalidValue}
+	}
+	ctx, done := v.start(ctx, "unlock", "", "")
+	l, err := v.keychainLocker()
+	if err == nil {
+		err = l.unlockKeychain(ctx, password)
+	}
+	done(err)
+	return err
+}
+
+// keychainLocker returns the Vault's backend if its storage can be locked.
+func (v *Vault) keychainLocker() (keychainLocker, error) {
+	switch b := v.store().(type) {
+	case keychainLocker:
+		return b, nil
+	case closedBackend:
+		return nil, ErrClosed
+	default:
+		return nil, errNoKeychainLock
+	}
+}
+
+func (b nativeBackend) lockKeychain(ctx context.Context) error {
+	return lockStorage(b.context(ctx))
+}
+
+func (b nativeBackend) unlockKeychain(ctx context.Context, password []byte) error {
+	return unlockStorage(b.context(ctx), password)
+}
@@ -0,0 +1,11 @@
+//go:build (!darwin || ios) && (!linux || android)
+
+package vault
+
+import "context"
+
+// Only the macOS Keychain and the Secret Service on Linux can be locked.
+
+func lockStorage(context.Context) error { return errNoKeychainLock }
+
+func unlockStorage(context.Context, []byte) error { return errNoKeychainLock }
@@ -0,0 +1,24 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLockUnsupported(t *testing.T) {
+	v, _ := newTestVault(t)
+	if err := v.Lock(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Lock of a memory backend = %v, want ErrUnsupported", err)
+	}
+	if err := v.Unlock([]byte("password")); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Unlock of a memory backend = %v, want ErrUnsupported", err)
+	}
+	if err := v.Unlock(nil); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Unlock without a password = %v, want ErrInvalidValue", err)
+	}
+
+	v.Close()
+	if err := v.Lock(); err != ErrClosed {
+		t.Errorf("Lock after Close = %v, want ErrClosed", err)
+	}
+}
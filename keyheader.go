@@ -0,0 +1,95 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// headerStore holds the key header of an encrypted backend. Keeping it
+// away from the encrypted files means a copy of the storage directory
+// alone is not enough to mount an offline attack on the passphrase.
+type headerStore interface {
+	// load returns the header, or an error wrapping fs.ErrNotExist if
+	// there is none yet.
+	load() ([]byte, error)
+
+	// create stores the first header, or returns an error wrapping
+	// fs.ErrExist if one was stored meanwhile.
+	create(data []byte) error
+}
+
+// KeyHeaderPath keeps the encrypted backend's key header, which holds the
+// salt and parameters the key is derived with, in the file at path instead
+// of next to the encrypted files, for example on a separate volume that is
+// not backed up with them. To move the header of an existing directory,
+// move its .vault-key file to path.
+func KeyHeaderPath(path string) EncryptedOption {
+	return func(c *encryptedConfig) {
+		c.header = fileHeader{path}
+	}
+}
+
+// KeyHeaderIn keeps the encrypted backend's key header as a secret of
+// service in b instead of next to the encrypted files. With NativeBackend
+// it lives in the OS keychain. b must not be the encrypted backend itself.
+// To move the header of an existing directory, store the content of its
+// .vault-key file under the key ".vault-key" of service.
+func KeyHeaderIn(b Backend, service string) EncryptedOption {
+	return func(c *encryptedConfig) {
+		c.header = backendHeader{b, service}
+	}
+}
+
+// fileHeader is a key header in a file.
+type fileHeader struct {
+	path string
+}
+
+func (h fileHeader) load() ([]byte, error) {
+	return os.ReadFile(h.path)
+}
+
+func (h fileHeader) create(data []byte) error {
+	if err := mkdirStorage(filepath.Dir(h.path)); err != nil {
+		return err
+	}
+	// O_EXCL makes a concurrent first open lose the race instead of
+	// replacing the other's header
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// backendHeader is a key header stored as the secret keyHeaderName of
+// service in a backend.
+type backendHeader struct {
+	b       Backend
+	service string
+}
+
+func (h backendHeader) load() ([]byte, error) {
+	data, err := h.b.Get(context.Background(), h.service, keyHeaderName)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %w", err, fs.ErrNotExist)
+	}
+	return data, err
+}
+
+// create cannot be atomic across backends: it checks for a header first,
+// which only narrows the window in which two first opens race.
+func (h backendHeader) create(data []byte) error {
+	if _, err := h.b.Get(context.Background(), h.service, keyHeaderName); err == nil {
+		return fs.ErrExist
+	}
+	return h.b.Set(context.Background(), h.service, keyHeaderName, data)
+}
@@ -0,0 +1,81 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyHeaderPath(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	headerPath := filepath.Join(t.TempDir(), "keys", "vault.key")
+
+	backend, err := NewEncryptedFileBackend(dir, []byte("correct horse"), KeyHeaderPath(headerPath))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if err := backend.Set(ctx, testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if _, err := os.Stat(headerPath); err != nil {
+		t.Errorf("key header missing at the configured path: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, keyHeaderName)); !os.IsNotExist(err) {
+		t.Errorf("key header written to the data directory: %v", err)
+	}
+
+	reopened, err := NewEncryptedFileBackend(dir, []byte("correct horse"), KeyHeaderPath(headerPath))
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	if got, err := reopened.Get(ctx, testService, "key"); err != nil || string(got) != "value" {
+		t.Errorf("Get = %q, %v, want value", got, err)
+	}
+	if _, err := NewEncryptedFileBackend(dir, []byte("wrong"), KeyHeaderPath(headerPath)); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("wrong passphrase error = %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestKeyHeaderIn(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	keys := NewMemoryBackend()
+
+	backend, err := NewEncryptedFileBackend(dir, []byte("correct horse"), KeyHeaderIn(keys, "vault-keys"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if err := backend.Set(ctx, testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := keys.Get(ctx, "vault-keys", keyHeaderName); err != nil {
+		t.Errorf("key header not stored in the backend: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, keyHeaderName)); !os.IsNotExist(err) {
+		t.Errorf("key header written to the data directory: %v", err)
+	}
+
+	reopened, err := NewEncryptedFileBackend(dir, []byte("correct horse"), KeyHeaderIn(keys, "vault-keys"))
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	if got, err := reopened.Get(ctx, testService, "key"); err != nil || string(got) != "value" {
+		t.Errorf("Get = %q, %v, want value", got, err)
+	}
+
+	// Without the header the files cannot be decrypted, even with the
+	// passphrase
+	stray, err := NewEncryptedFileBackend(dir, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if _, err := stray.Get(ctx, testService, "key"); err == nil {
+		t.Error("Get with a fresh key header in the data directory succeeded")
+	}
+}
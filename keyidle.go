@@ -0,0 +1,130 @@
+package vault
+
+import (
+	"crypto/cipher"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errKeyLocked is returned by the encrypted codec if it is used while its
+// key is evicted, which the backend prevents by holding the key for the
+// duration of each operation.
+var errKeyLocked = errors.New("vault: encryption key is locked")
+
+// KeyIdleTimeout drops the encrypted backend's key from memory once no
+// operation has used it for d. The next operation derives it again from
+// the passphrase returned by passphrase, which can prompt the user, and
+// fails with ErrWrongPassphrase if it does not match; the backend clears
+// the returned slice after use. The passphrase given to
+// NewEncryptedFileBackend is used only to open the backend and is not
+// kept.
+//
+// The derived key bytes are zeroed as soon as the cipher is set up, but Go
+// offers no way to zero the cipher's own expanded key, which lingers until
+// the garbage collector reclaims it. Without this option the key is kept
+// until the backend is closed.
+func KeyIdleTimeout(d time.Duration, passphrase func() ([]byte, error)) EncryptedOption {
+	return func(c *encryptedConfig) {
+		c.idleTimeout = d
+		c.passphrase = passphrase
+	}
+}
+
+// cachedKey is the encryption key of an encrypted backend, held until the
+// backend is closed. With a timeout, it is evicted after a period without
+// use and reopened on demand.
+type cachedKey struct {
+	timeout time.Duration // 0: never evict
+	reopen  func() (cipher.AEAD, error)
+
+	mu      sync.Mutex
+	aead    cipher.AEAD // nil: evicted or closed
+	closed  bool
+	active  int // operations holding the key
+	lastUse time.Time
+	timer   *time.Timer
+}
+
+// newCachedKey returns aead as a cached key and starts its eviction timer,
+// if it has a timeout.
+func newCachedKey(aead cipher.AEAD, timeout time.Duration, reopen func() (cipher.AEAD, error)) *cachedKey {
+	k := &cachedKey{timeout: timeout, reopen: reopen, aead: aead, lastUse: time.Now()}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if timeout > 0 {
+		k.timer = time.AfterFunc(timeout, k.evict)
+	}
+	return k
+}
+
+// use makes sure the key is loaded, reopening it if it was evicted, and
+// keeps it loaded until release is called.
+func (k *cachedKey) use() (release func(), err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.closed {
+		return nil, ErrClosed
+	}
+	if k.aead == nil {
+		aead, err := k.reopen()
+		if err != nil {
+			return nil, err
+		}
+		k.aead = aead
+	}
+	k.active++
+	return k.release, nil
+}
+
+func (k *cachedKey) release() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.active--
+	k.lastUse = time.Now()
+	if k.timer != nil && !k.closed {
+		k.timer.Reset(k.timeout)
+	}
+}
+
+// evict drops the key unless it is in use or was used within the timeout,
+// as happens when the timer fires while release resets it.
+func (k *cachedKey) evict() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.active > 0 || k.closed {
+		return
+	}
+	if idle := time.Since(k.lastUse); idle < k.timeout {
+		k.timer.Reset(k.timeout - idle)
+		return
+	}
+	k.aead = nil
+}
+
+// close drops the key for good: use returns ErrClosed from then on.
+func (k *cachedKey) close() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.closed = true
+	k.aead = nil
+	if k.timer != nil {
+		k.timer.Stop()
+	}
+}
+
+// current returns the loaded key, or nil if it is evicted.
+func (k *cachedKey) current() cipher.AEAD {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.aead
+}
+
+// useKey holds the backend's key for an operation, reopening it if it was
+// evicted for being idle.
+func (b *encryptedBackend) useKey() (release func(), err error) {
+	return b.key.use()
+}
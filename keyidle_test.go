@@ -0,0 +1,75 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitEvicted waits for the idle key of b to be evicted.
+func waitEvicted(t *testing.T, b Backend) {
+	t.Helper()
+	key := b.(*encryptedBackend).key
+	for deadline := time.Now().Add(5 * time.Second); key.current() != nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("key was not evicted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestKeyIdleTimeout(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	passphrase := "correct horse"
+	var promptErr error
+	prompts := 0
+	prompt := func() ([]byte, error) {
+		prompts++
+		return []byte(passphrase), promptErr
+	}
+	backend, err := NewEncryptedFileBackend(dir, []byte("correct horse"), KeyIdleTimeout(20*time.Millisecond, prompt))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	if err := backend.Set(ctx, testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if prompts != 0 {
+		t.Errorf("passphrase requested %d times while the key was loaded", prompts)
+	}
+
+	// The next operation after eviction derives the key again
+	waitEvicted(t, backend)
+	if got, err := backend.Get(ctx, testService, "key"); err != nil || !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get after eviction = %q, %v, want value", got, err)
+	}
+	if prompts != 1 {
+		t.Errorf("passphrase requested %d times, want 1", prompts)
+	}
+
+	waitEvicted(t, backend)
+	passphrase = "wrong"
+	if _, err := backend.Get(ctx, testService, "key"); err != ErrWrongPassphrase {
+		t.Errorf("Get with a wrong passphrase = %v, want ErrWrongPassphrase", err)
+	}
+	if _, err := backend.List(ctx, testService); err != ErrWrongPassphrase {
+		t.Errorf("List with a wrong passphrase = %v, want ErrWrongPassphrase", err)
+	}
+
+	promptErr = errors.New("prompt canceled")
+	if err := backend.Set(ctx, testService, "key", []byte("other")); !errors.Is(err, promptErr) {
+		t.Errorf("Set with a failing prompt = %v, want %v", err, promptErr)
+	}
+}
+
+func TestKeyIdleTimeoutNeedsPassphrase(t *testing.T) {
+	fastKDF(t)
+	if _, err := NewEncryptedFileBackend(t.TempDir(), []byte("pass"), KeyIdleTimeout(time.Minute, nil)); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("KeyIdleTimeout without a passphrase function = %v, want ErrInvalidValue", err)
+	}
+}
@@ -0,0 +1,81 @@
+package vault
+
+import "context"
+
+// keyMapper translates the service and key callers use into the ones the
+// backend stores.
+type keyMapper = func(service, key string) (string, string)
+
+// SetKeyMapper makes the package-level functions pass every service and
+// key through fn before they reach the backend, so that entries written
+// under another naming scheme, such as a legacy wrapper's "com.example.app"
+// service and "account@host" keys, can be read and written without
+// renaming them. It applies to every operation on a single secret (Set,
+// Get, Del and their variants). The operations that list a service (List,
+// ListSeq, Count, GetAll, PurgeExpired and FS) pass it through fn with an
+// empty key, so the service fn returns must not depend on the key, and
+// return the keys as stored: GetAll and FS read them back without mapping
+// them again. Hooks and the audit log report the names before mapping. fn
+// must be deterministic and safe for concurrent use. Passing nil removes
+// the mapper. Vaults created with New use WithKeyMapper instead.
+func SetKeyMapper(fn func(service, key string) (string, string)) {
+	if fn == nil {
+		std.mapper.Store(nil)
+	} else {
+		std.mapper.Store(&fn)
+	}
+	invalidateGetCache()
+}
+
+// WithKeyMapper passes every service and key the Vault is given through fn
+// before they reach its backend, as SetKeyMapper does for the
+// package-level functions.
+func WithKeyMapper(fn func(service, key string) (string, string)) Option {
+	return func(v *Vault) {
+		if fn != nil {
+			v.mapper.Store(&fn)
+		}
+	}
+}
+
+// mapKey returns the service and key the backend stores the Vault's
+// secret service and key under.
+func (v *Vault) mapKey(service, key string) (string, string) {
+	if fn := v.mapper.Load(); fn != nil {
+		return (*fn)(service, key)
+	}
+	return service, key
+}
+
+// mapService returns the service the backend stores the Vault's service
+// under, for the operations that list it.
+func (v *Vault) mapService(service string) string {
+	if fn := v.mapper.Load(); fn != nil {
+		service, _ = (*fn)(service, "")
+	}
+	return service
+}
+
+// listedKey is the context key marking the keys of the operations run
+// under a context as the stored keys of a listing.
+type listedKey struct{}
+
+// listedContext returns ctx marking the keys of the Vault's operations
+// run under it as listed, so that their service is mapped but not the
+// keys themselves.
+func (v *Vault) listedContext(ctx context.Context) context.Context {
+	if v.mapper.Load() == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, listedKey{}, true)
+}
+
+// storedKey returns the service and key the backend stores the secret
+// the Vault reads under ctx, and whether key is already stored as is.
+func (v *Vault) storedKey(ctx context.Context, service, key string) (string, string, bool) {
+	if listed, _ := ctx.Value(listedKey{}).(bool); listed {
+		return v.mapService(service), key, true
+	}
+	ms, mk := v.mapKey(service, key)
+	return ms, mk, false
+}
@@ -0,0 +1,120 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"slices"
+	"testing"
+	"time"
+)
+
+// legacyNames maps to a reverse-DNS service and account@host keys.
+func legacyNames(service, key string) (string, string) {
+	return "com.example." + service, key + "@legacy-host"
+}
+
+func TestSetKeyMapper(t *testing.T) {
+	b := useMemory(t)
+	SetKeyMapper(legacyNames)
+	t.Cleanup(func() { SetKeyMapper(nil) })
+	ctx := context.Background()
+
+	// An entry written by the legacy wrapper
+	if err := b.Set(ctx, "com.example.app", "alice@legacy-host", []byte("legacy")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, err := Get("app", "alice"); err != nil || string(got) != "legacy" {
+		t.Errorf("Get = %q, %v, want legacy", got, err)
+	}
+
+	if err := Set("app", "bob", []byte("new")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, err := b.Get(ctx, "com.example.app", "bob@legacy-host"); err != nil || string(got) != "new" {
+		t.Errorf("stored under mapped names = %q, %v, want new", got, err)
+	}
+	if _, err := b.Get(ctx, "app", "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("stored under unmapped names: %v", err)
+	}
+	if md, err := GetMetadata("app", "bob"); err != nil {
+		t.Errorf("GetMetadata = %+v, %v", md, err)
+	}
+
+	if err := Del("app", "alice"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if _, err := b.Get(ctx, "com.example.app", "alice@legacy-host"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("legacy entry still present after Del: %v", err)
+	}
+
+	SetKeyMapper(nil)
+	if _, err := Get("app", "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get without mapper error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestWithKeyMapper(t *testing.T) {
+	v, b := newTestVault(t, WithKeyMapper(legacyNames))
+	if err := v.Set("app", "alice", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := b.Get(context.Background(), "com.example.app", "alice@legacy-host"); err != nil {
+		t.Errorf("not stored under mapped names: %v", err)
+	}
+	if got, err := v.Get("app", "alice"); err != nil || string(got) != "value" {
+		t.Errorf("Get = %q, %v, want value", got, err)
+	}
+}
+
+func TestWithKeyMapperList(t *testing.T) {
+	v, _ := newTestVault(t, WithKeyMapper(legacyNames), WithMaxKeysPerService(2))
+	start := time.Now()
+	setNow(t, start)
+	if err := v.Set("app", "alice", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := v.SetWithTTL("app", "bob", []byte("token"), time.Minute); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+
+	// Listing finds the keys under the mapped service, as stored
+	want := []string{"alice@legacy-host", "bob@legacy-host"}
+	if keys, err := v.List("app"); err != nil || !slices.Equal(keys, want) {
+		t.Errorf("List = %q, %v, want %q", keys, err, want)
+	}
+	var streamed []string
+	for key, err := range v.ListSeq("app") {
+		if err != nil {
+			t.Fatalf("ListSeq failed: %v", err)
+		}
+		streamed = append(streamed, key)
+	}
+	if slices.Sort(streamed); !slices.Equal(streamed, want) {
+		t.Errorf("ListSeq = %q, want %q", streamed, want)
+	}
+	if n, err := v.Count("app"); err != nil || n != 2 {
+		t.Errorf("Count = %d, %v, want 2", n, err)
+	}
+	if err := v.Set("app", "carol", []byte("value")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Set over quota: expected ErrQuotaExceeded, got %v", err)
+	}
+	all, err := v.GetAll("app")
+	if err != nil || len(all) != 2 || string(all["alice@legacy-host"]) != "value" {
+		t.Errorf("GetAll = %q, %v, want both secrets by stored key", all, err)
+	}
+	if got, err := fs.ReadFile(v.FS("app"), "alice@legacy-host"); err != nil || string(got) != "value" {
+		t.Errorf("FS ReadFile = %q, %v, want value", got, err)
+	}
+	if info, err := fs.Stat(v.FS("app"), "alice@legacy-host"); err != nil || info.Size() != 5 {
+		t.Errorf("FS Stat = %v, %v, want a 5-byte file", info, err)
+	}
+
+	setNow(t, start.Add(time.Minute))
+	if n, err := v.PurgeExpired("app"); err != nil || n != 1 {
+		t.Errorf("PurgeExpired = %d, %v, want 1", n, err)
+	}
+	if _, err := v.Get("app", "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get purged secret: expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// WithGoKeyringCompat reads and writes secrets the way the
+// github.com/zalando/go-keyring library does, so that Get finds the items
+// an application stored with it before moving to vault, and the library
+// can still read what vault stores. The service and key play the roles of
+// the library's service and user:
+//
+//   - macOS: generic passwords with the service as kSecAttrService and the
+//     key as kSecAttrAccount, as vault uses, but values are stored as text
+//     rather than base64. The library prefixes values it encoded with
+//     "go-keyring-base64:" (or, in old versions, "go-keyring-encoded:"
+//     and hex); other values are returned as stored. Set writes the
+//     "go-keyring-base64:" form. This also reads the items of
+//     github.com/99designs/keyring's keychain backend, which stores values
+//     as given.
+//   - Linux: Secret Service items with the attributes "service" and
+//     "username" instead of "service" and "key", labelled
+//     "Password for '<key>' on '<service>'", with the value as text.
+//
+// The file storage and the other platforms are unaffected.
+func WithGoKeyringCompat() NativeOption {
+	return func(c *nativeConfig) {
+		c.goKeyring = true
+	}
+}
+
+const (
+	goKeyringBase64Prefix = "go-keyring-base64:"
+	goKeyringHexPrefix    = "go-keyring-encoded:"
+)
+
+// encodeGoKeyring returns value in the form go-keyring stores values it
+// encodes.
+func encodeGoKeyring(value []byte) []byte {
+	return append([]byte(goKeyringBase64Prefix), base64.StdEncoding.EncodeToString(value)...)
+}
+
+// decodeGoKeyring returns the value of an item stored by go-keyring.
+func decodeGoKeyring(stored []byte) ([]byte, error) {
+	if encoded, ok := bytes.CutPrefix(stored, []byte(goKeyringBase64Prefix)); ok {
+		value, err := base64.StdEncoding.DecodeString(string(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decode value: %w", ErrCorrupt, err)
+		}
+		return value, nil
+	}
+	if encoded, ok := bytes.CutPrefix(stored, []byte(goKeyringHexPrefix)); ok {
+		value, err := hex.DecodeString(string(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decode value: %w", ErrCorrupt, err)
+		}
+		return value, nil
+	}
+	return stored, nil
+}
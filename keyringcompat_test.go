@@ -0,0 +1,46 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// goKeyringContext returns a context for operations of the native backend
+// with WithGoKeyringCompat.
+func goKeyringContext() context.Context {
+	return NativeBackend(WithGoKeyringCompat()).(nativeBackend).context(context.Background())
+}
+
+func TestDecodeGoKeyring(t *testing.T) {
+	tests := []struct {
+		stored, want string
+	}{
+		// Values go-keyring stores as given
+		{"hunter2", "hunter2"},
+		{"with spaces and ünïcode", "with spaces and ünïcode"},
+		// go-keyring-base64, used by current versions
+		{"go-keyring-base64:aHVudGVyMg==", "hunter2"},
+		{"go-keyring-base64:AAH/", "\x00\x01\xff"},
+		// go-keyring-encoded, hex, used by older versions
+		{"go-keyring-encoded:68756e74657232", "hunter2"},
+	}
+	for _, tt := range tests {
+		got, err := decodeGoKeyring([]byte(tt.stored))
+		if err != nil || string(got) != tt.want {
+			t.Errorf("decodeGoKeyring(%q) = %q, %v, want %q", tt.stored, got, err, tt.want)
+		}
+	}
+
+	for _, stored := range []string{"go-keyring-base64:not base64!", "go-keyring-encoded:xyz"} {
+		if _, err := decodeGoKeyring([]byte(stored)); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("decodeGoKeyring(%q): expected ErrCorrupt, got %v", stored, err)
+		}
+	}
+
+	value := []byte{0, 'a', 0xff}
+	if got, err := decodeGoKeyring(encodeGoKeyring(value)); err != nil || !bytes.Equal(got, value) {
+		t.Errorf("decodeGoKeyring(encodeGoKeyring(%q)) = %q, %v", value, got, err)
+	}
+}
@@ -0,0 +1,156 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// leakCanary is a recognizable secret value that must never appear in an
+// error or an event.
+const leakCanary = "canary-5f3e9d-s3cret"
+
+// checkNoSecretLeaks runs b through the operations of a Vault, with
+// conditions that make them fail along the way, and fails the test if the
+// canary value appears, as is or in a stored encoding, in any returned
+// error, hook event or audit log line.
+func checkNoSecretLeaks(t *testing.T, b Backend) {
+	t.Helper()
+	var texts []string
+	var audit bytes.Buffer
+	v, err := New(
+		WithBackend(b),
+		WithHook(func(e Event) { texts = append(texts, fmt.Sprintf("%+v", e)) }),
+		WithAuditLog(&audit),
+		WithMaxKeysPerService(1),
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	record := func(err error) {
+		if err != nil {
+			texts = append(texts, err.Error())
+		}
+	}
+
+	canary := []byte(leakCanary)
+	record(v.Set(testService, "key", canary))
+	_, err = v.Get(testService, "key")
+	record(err)
+	// Over the quota, a failed swap, an occupied key and not a field map
+	record(v.Set(testService, "other", canary))
+	_, err = v.CompareAndSwap(testService, "key", []byte("not-"+leakCanary), canary)
+	record(err)
+	_, err = v.SetIfAbsent(testService, "key", canary)
+	record(err)
+	_, err = v.GetField(testService, "key", "field")
+	record(err)
+	record(v.SetWithTTL(testService, "key", canary, -time.Second))
+	record(v.Touch(testService, "key", time.Minute))
+	_, err = v.Seal(testService, "key", canary)
+	record(err)
+	_, priv, _ := GenerateBoxKey()
+	record(v.Open(testService, "key", canary, priv))
+	_, err = v.GetAll(testService)
+	record(err)
+	record(v.Del(testService, "key"))
+	_, err = v.Get(testService, "key")
+	record(err)
+
+	texts = append(texts, audit.String())
+	assertNoSecret(t, canary, texts)
+}
+
+// assertNoSecret fails the test if secret, or its base64 or hex encoding,
+// appears in any of texts.
+func assertNoSecret(t *testing.T, secret []byte, texts []string) {
+	t.Helper()
+	forms := []string{
+		string(secret),
+		base64.StdEncoding.EncodeToString(secret),
+		base64.RawURLEncoding.EncodeToString(secret),
+		hex.EncodeToString(secret),
+	}
+	for _, text := range texts {
+		for _, form := range forms {
+			if strings.Contains(text, form) {
+				t.Errorf("secret leaked: %q", text)
+			}
+		}
+	}
+}
+
+func TestNoSecretInErrors(t *testing.T) {
+	fastKDF(t)
+	t.Run("memory", func(t *testing.T) {
+		checkNoSecretLeaks(t, NewMemoryBackend())
+	})
+	t.Run("file", func(t *testing.T) {
+		s, _ := newTestFileStore(t)
+		checkNoSecretLeaks(t, filesBackend{s})
+	})
+	t.Run("encrypted", func(t *testing.T) {
+		b, err := NewEncryptedFileBackend(t.TempDir(), []byte("passphrase"))
+		if err != nil {
+			t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+		}
+		checkNoSecretLeaks(t, b)
+	})
+	t.Run("failing", func(t *testing.T) {
+		checkNoSecretLeaks(t, failingBackend{ErrBackendUnavailable})
+	})
+}
+
+// Values that fail to decode are reported without their content.
+func TestNoSecretInDecodeErrors(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	for name, stored := range map[string]string{
+		"base64":    "!" + leakCanary,
+		"encrypted": encryptedPrefix + leakCanary,
+		"fields":    fieldsMagic + `{"field":` + leakCanary + `}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			b, err := NewEncryptedFileBackend(dir, []byte("passphrase"))
+			if err != nil {
+				t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+			}
+			if name == "fields" {
+				if err := b.Set(ctx, testService, "key", []byte(stored)); err != nil {
+					t.Fatalf("Set failed: %v", err)
+				}
+			} else if err := os.WriteFile(secretFile(dir, testService, "key"), []byte(stored), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			v, err := New(WithBackend(b))
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			var texts []string
+			if _, err := v.Get(testService, "key"); err != nil {
+				texts = append(texts, err.Error())
+			}
+			if _, err := v.GetField(testService, "key", "field"); err != nil {
+				texts = append(texts, err.Error())
+			}
+			if len(texts) == 0 {
+				t.Fatal("reading the corrupt value succeeded")
+			}
+			assertNoSecret(t, []byte(leakCanary), texts)
+			// Not even a character of the value
+			for _, text := range texts {
+				if strings.Contains(text, "'c'") {
+					t.Errorf("error quotes the value: %q", text)
+				}
+			}
+		})
+	}
+}
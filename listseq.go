@@ -0,0 +1,212 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// listBatch is the number of directory entries the file store reads at a
+// time when streaming keys.
+const listBatch = 256
+
+// ListSeq returns an iterator over the keys stored under service, yielding
+// them as the storage enumerates them, so that large file-backed vaults are
+// listed without building the whole list first and a loop that breaks
+// early stops the scan. Keys come in directory order rather than sorted;
+// use List for a sorted list. An error ends the iteration: it is yielded
+// once, with an empty key. On backends that can't enumerate keys
+// incrementally, such as the keychains, ListSeq lists them with List first.
+//
+//	for key, err := range vault.ListSeq("myapp") {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(key)
+//	}
+func ListSeq(service string) iter.Seq2[string, error] {
+	return std.ListSeqContext(context.Background(), service)
+}
+
+// ListSeqContext is like ListSeq but aborts the iteration and yields
+// ctx.Err() if ctx is done before the scan completes.
+func ListSeqContext(ctx context.Context, service string) iter.Seq2[string, error] {
+	return std.ListSeqContext(ctx, service)
+}
+
+// ListSeq returns an iterator over the keys stored under service, as the
+// package-level ListSeq does.
+func (v *Vault) ListSeq(service string) iter.Seq2[string, error] {
+	return v.ListSeqContext(context.Background(), service)
+}
+
+// ListSeqContext is like ListSeq but aborts the iteration and yields
+// ctx.Err() if ctx is done before the scan completes. The Vault's timeout
+// covers the whole iteration, loop body included.
+func (v *Vault) ListSeqContext(ctx context.Context, service string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		if err := checkService(service); err != nil {
+			yield("", err)
+			return
+		}
+		ctx, done := v.start(ctx, "list", service, "")
+		b := v.store()
+		ms := v.mapService(service)
+		s, ok := b.(keyStreamer)
+		if !ok {
+			keys, err := b.List(ctx, ms)
+			done(err)
+			if err != nil {
+				yield("", err)
+				return
+			}
+			keys = withoutReservedKeys(keys)
+			slices.Sort(keys)
+			for _, key := range slices.Compact(keys) {
+				if !yield(key, nil) {
+					return
+				}
+			}
+			return
+		}
+
+		var err error
+		defer func() { done(err) }()
+		stopped := false
+		err = s.listSeq(ctx, ms, func(key string) bool {
+			if isReservedKey(key) {
+				return true
+			}
+			stopped = !yield(key, nil)
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield("", err)
+		}
+	}
+}
+
+// keyStreamer is implemented by backends that can enumerate the keys of a
+// service incrementally. listSeq calls yield with each key, reserved ones
+// included, until it returns false, in which case listSeq returns nil.
+type keyStreamer interface {
+	listSeq(ctx context.Context, service string, yield func(key string) bool) error
+}
+
+func (b nativeBackend) listSeq(ctx context.Context, service string, yield func(string) bool) error {
+	if service == "" {
+		return ErrInvalidKey
+	}
+	ctx = b.context(ctx)
+	if _, legacy := legacyNameContext(ctx); !legacy {
+		if files := activeFiles(ctx); files != nil {
+			return files.listSeq(ctx, service, yield)
+		}
+	}
+	keys, err := listNamed(ctx, service)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !yield(key) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (b *encryptedBackend) listSeq(ctx context.Context, service string, yield func(string) bool) error {
+	if service == "" {
+		return ErrInvalidKey
+	}
+	release, err := b.useKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return b.files.listSeq(ctx, service, yield)
+}
+
+// listSeq is list, calling yield as the storage directory is read.
+func (s *fileStore) listSeq(ctx context.Context, service string, yield func(string) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dir, sharded, err := s.layout()
+	if err != nil {
+		return err
+	}
+	if s.names != nil {
+		// The names index is read whole
+		keys, err := s.listHashed(dir, service)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if !yield(key) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	prefix := service + "/"
+	if sharded {
+		dir, prefix = filepath.Join(dir, shardName(service)), ""
+	}
+	err = scanNames(ctx, dir, func(name string) bool {
+		key, ok := strings.CutPrefix(name, prefix)
+		return !ok || key == "" || yield(key)
+	})
+	switch {
+	case err == nil || err == ctx.Err():
+		return err
+	case sharded && os.IsNotExist(err):
+		return nil
+	default:
+		return fmt.Errorf("vault: failed to read storage directory: %w", err)
+	}
+}
+
+// scanNames is readNames reading dir listBatch entries at a time, calling
+// fn with each name until it returns false. It returns ctx.Err() if ctx is
+// done between batches.
+func scanNames(ctx context.Context, dir string, fn func(string) bool) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entries, err := f.ReadDir(listBatch)
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			name, err := base64.URLEncoding.DecodeString(entry.Name())
+			if err != nil || len(name) == 0 {
+				// Not a secret file
+				continue
+			}
+			if !fn(string(name)) {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
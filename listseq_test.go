@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestListSeq(t *testing.T) {
+	v, b := newTestVault(t)
+	ctx := context.Background()
+	for _, key := range []string{"c", "a", "b"} {
+		if err := b.Set(ctx, testService, key, []byte(key)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if err := b.Set(ctx, testService, ownerKey("a"), []byte("owner")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	var keys []string
+	for key, err := range v.ListSeq(testService) {
+		if err != nil {
+			t.Fatalf("ListSeq failed: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(keys, want) {
+		t.Fatalf("ListSeq = %q, want %q", keys, want)
+	}
+
+	for _, err := range v.ListSeq("") {
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("ListSeq(\"\") error = %v, want ErrInvalidKey", err)
+		}
+	}
+}
+
+func TestListSeqFileStore(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	backend, err := NewEncryptedFileBackend(t.TempDir(), []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	v, err := New(WithBackend(backend))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// More keys than a directory batch, and another service in the same
+	// directory
+	var want []string
+	for i := range listBatch + 10 {
+		key := fmt.Sprintf("key-%04d", i)
+		want = append(want, key)
+		if err := v.Set(testService, key, []byte("v")); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if err := v.Set(testService+"-other", "x", []byte("v")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	for _, sharded := range []bool{false, true} {
+		backend.(*encryptedBackend).files.setSharded(sharded)
+
+		var keys []string
+		for key, err := range v.ListSeqContext(ctx, testService) {
+			if err != nil {
+				t.Fatalf("ListSeq (sharded %v) failed: %v", sharded, err)
+			}
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		if !slices.Equal(keys, want) {
+			t.Fatalf("ListSeq (sharded %v) returned %d keys, want %d", sharded, len(keys), len(want))
+		}
+
+		n := 0
+		for range v.ListSeq(testService) {
+			if n++; n == 3 {
+				break
+			}
+		}
+		if n != 3 {
+			t.Fatalf("ListSeq (sharded %v) yielded %d keys before break, want 3", sharded, n)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	var errs []error
+	for key, err := range v.ListSeqContext(canceled, testService) {
+		if key != "" {
+			t.Fatalf("ListSeq with a canceled context yielded %q", key)
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+		t.Fatalf("ListSeq with a canceled context yielded %v, want context.Canceled once", errs)
+	}
+}
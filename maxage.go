@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// WithMaxAge makes the Vault report the secrets older than d that Get
+// returns, to nudge their rotation without blocking access: the read
+// succeeds, and an Event with Op "maxage" and an Err wrapping
+// ErrSecretTooOld, giving the secret's age, goes to the hook and the audit
+// log. The age is taken from the secret's Metadata, since it was last set
+// (or created, when only that is known). Backends that record no
+// timestamps, such as the Keychain or MemoryBackend, cannot be checked:
+// the first Get of such a secret reports a "maxage" Event with an Err
+// wrapping errors.ErrUnsupported instead, once per Vault.
+//
+// Checking costs a metadata lookup per Get, including those answered from
+// the Get cache.
+func WithMaxAge(d time.Duration) Option {
+	return func(v *Vault) {
+		v.maxAge = d
+	}
+}
+
+// checkAge returns the warning to report about the secret stored in b
+// under service and key, or nil if it is not older than the Vault's
+// maximum age.
+func (v *Vault) checkAge(ctx context.Context, b Backend, service, key string) error {
+	if v.maxAge <= 0 {
+		return nil
+	}
+	modified, err := secretModified(ctx, b, service, key)
+	switch {
+	case errors.Is(err, errors.ErrUnsupported):
+		if v.maxAgeUnsupported.Swap(true) {
+			return nil
+		}
+		return fmt.Errorf("vault: cannot check the age of secrets: %w", err)
+	case err != nil:
+		// Deleted meanwhile, or failing: not a reason to warn
+		return nil
+	}
+	if age := now().Sub(modified); age > v.maxAge {
+		return fmt.Errorf("%w: last set %v ago, the maximum age is %v", ErrSecretTooOld, age.Round(time.Second), v.maxAge)
+	}
+	return nil
+}
+
+// warnAge reports warning, returned by checkAge, for service and key.
+func (v *Vault) warnAge(ctx context.Context, service, key string, warning error) {
+	if warning != nil {
+		_, done := v.start(ctx, "maxage", service, key)
+		done(warning)
+	}
+}
+
+// secretModified returns when the secret stored in b under service and key
+// was last set, or an error wrapping errors.ErrUnsupported if b does not
+// record it.
+func secretModified(ctx context.Context, b Backend, service, key string) (time.Time, error) {
+	mg, ok := b.(metadataGetter)
+	if !ok {
+		return time.Time{}, errNoMetadata
+	}
+	md, err := mg.metadata(ctx, service, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch {
+	case !md.Modified.IsZero():
+		return md.Modified, nil
+	case !md.Created.IsZero():
+		return md.Created, nil
+	}
+	return time.Time{}, fmt.Errorf("vault: backend does not record timestamps: %w", errors.ErrUnsupported)
+}
@@ -0,0 +1,60 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaxAge(t *testing.T) {
+	fastKDF(t)
+	b, err := NewEncryptedFileBackend(t.TempDir(), []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	var warnings []Event
+	v, err := New(WithBackend(b), WithMaxAge(time.Hour), WithHook(func(e Event) {
+		if e.Op == "maxage" {
+			warnings = append(warnings, e)
+		}
+	}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := v.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if _, err := v.Get(testService, "key"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("fresh secret reported: %v", warnings)
+	}
+
+	setNow(t, time.Now().Add(2*time.Hour))
+	if got, err := v.Get(testService, "key"); err != nil || string(got) != "value" {
+		t.Fatalf("Get of an old secret = %q, %v, want value", got, err)
+	}
+	if len(warnings) != 1 || !errors.Is(warnings[0].Err, ErrSecretTooOld) || warnings[0].Key != "key" {
+		t.Errorf("warnings = %v, want one ErrSecretTooOld for key", warnings)
+	}
+}
+
+func TestMaxAgeUnsupported(t *testing.T) {
+	var warnings []Event
+	v, _ := newTestVault(t, WithMaxAge(time.Hour), WithHook(func(e Event) {
+		if e.Op == "maxage" {
+			warnings = append(warnings, e)
+		}
+	}))
+	v.Set(testService, "key", []byte("value"))
+	for range 2 {
+		if _, err := v.Get(testService, "key"); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	if len(warnings) != 1 || !errors.Is(warnings[0].Err, errors.ErrUnsupported) {
+		t.Errorf("warnings = %v, want one ErrUnsupported", warnings)
+	}
+}
@@ -0,0 +1,159 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryBackend is a Backend that keeps secrets in process memory only.
+// Nothing is written to disk or to the platform's secure storage, and
+// everything is lost when the process exits. It is meant for tests of code
+// that uses this package, and for secrets that must never be persisted.
+type MemoryBackend struct {
+	mu       sync.RWMutex
+	services map[string]map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	value []byte
+	app   string
+}
+
+// NewMemoryBackend returns an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{services: make(map[string]map[string]memoryEntry)}
+}
+
+// UseMemoryBackend makes the package-level functions use a new, empty
+// MemoryBackend and returns it. It is shorthand for
+// SetDefaultBackend(NewMemoryBackend()), so that a test suite can stop
+// touching the real keychain with one line:
+//
+//	func TestMain(m *testing.M) {
+//		vault.UseMemoryBackend()
+//		os.Exit(m.Run())
+//	}
+//
+// Call Reset on the returned backend to clear it between tests, or
+// SetDefaultBackend(nil) to go back to the native storage.
+func UseMemoryBackend() *MemoryBackend {
+	b := NewMemoryBackend()
+	SetDefaultBackend(b)
+	return b
+}
+
+// Reset removes every secret in the backend.
+func (b *MemoryBackend) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	clear(b.services)
+}
+
+func (b *MemoryBackend) Set(ctx context.Context, service, key string, value []byte) error {
+	if !validBackendKey(service, key) {
+		return ErrInvalidKey
+	}
+	if len(value) == 0 {
+		return ErrInvalidValue
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	keys := b.services[service]
+	if keys == nil {
+		keys = make(map[string]memoryEntry)
+		b.services[service] = keys
+	}
+	keys[key] = memoryEntry{value: bytes.Clone(value), app: appIdentity(ctx)}
+	return nil
+}
+
+func (b *MemoryBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	if !validBackendKey(service, key) {
+		return nil, ErrInvalidKey
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	entry, ok := b.services[service][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(entry.value), nil
+}
+
+func (b *MemoryBackend) Del(ctx context.Context, service, key string) error {
+	if !validBackendKey(service, key) {
+		return ErrInvalidKey
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	keys := b.services[service]
+	if _, ok := keys[key]; !ok {
+		return ErrNotFound
+	}
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(b.services, service)
+	}
+	return nil
+}
+
+func (b *MemoryBackend) List(ctx context.Context, service string) ([]string, error) {
+	if service == "" {
+		return nil, ErrInvalidKey
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var keys []string
+	for key := range b.services[service] {
+		if !isReservedKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (b *MemoryBackend) metadata(ctx context.Context, service, key string) (Metadata, error) {
+	if !validBackendKey(service, key) {
+		return Metadata{}, ErrInvalidKey
+	}
+	if err := ctx.Err(); err != nil {
+		return Metadata{}, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	entry, ok := b.services[service][key]
+	if !ok {
+		return Metadata{}, ErrNotFound
+	}
+	md := Metadata{App: entry.app}
+	size, expires := valueInfo(entry.value)
+	md.Size = size
+	if expires != 0 {
+		md.Expires = time.Unix(0, expires)
+	}
+	return md, nil
+}
+
+// getRaw returns the value itself, which the backend stores unencoded.
+func (b *MemoryBackend) getRaw(ctx context.Context, service, key string) ([]byte, error) {
+	return b.Get(ctx, service, key)
+}
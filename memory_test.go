@@ -0,0 +1,98 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// useMemory makes the package-level functions use a memory backend for the
+// duration of a test.
+func useMemory(t *testing.T) *MemoryBackend {
+	b := UseMemoryBackend()
+	t.Cleanup(func() { SetDefaultBackend(nil) })
+	return b
+}
+
+func TestMemoryBackend(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend()
+
+	value := []byte("secret")
+	if err := b.Set(ctx, "svc", "key", value); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	// The backend keeps its own copy
+	value[0] = 'S'
+	got, err := b.Get(ctx, "svc", "key")
+	if err != nil || string(got) != "secret" {
+		t.Errorf("Get = %q, %v, want secret", got, err)
+	}
+
+	if keys, err := b.List(ctx, "svc"); err != nil || !slices.Equal(keys, []string{"key"}) {
+		t.Errorf("List = %q, %v, want [key]", keys, err)
+	}
+	if err := b.Del(ctx, "svc", "key"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if _, err := b.Get(ctx, "svc", "key"); err != ErrNotFound {
+		t.Errorf("Get after Del: expected ErrNotFound, got %v", err)
+	}
+	if err := b.Del(ctx, "svc", "key"); err != ErrNotFound {
+		t.Errorf("Del of missing key: expected ErrNotFound, got %v", err)
+	}
+
+	if err := b.Set(ctx, "svc", "", value); err != ErrInvalidKey {
+		t.Errorf("Set with empty key: expected ErrInvalidKey, got %v", err)
+	}
+	if err := b.Set(ctx, "svc", "key", nil); err != ErrInvalidValue {
+		t.Errorf("Set with empty value: expected ErrInvalidValue, got %v", err)
+	}
+}
+
+func TestUseMemoryBackend(t *testing.T) {
+	b := useMemory(t)
+	service := "vault-test-memory-service"
+
+	if err := Set(service, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	// Nothing reached the native storage
+	if _, err := NativeBackend().Get(context.Background(), service, "key"); err != ErrNotFound {
+		t.Errorf("native Get: expected ErrNotFound, got %v", err)
+	}
+	if got, err := b.Get(context.Background(), service, "key"); err != nil || string(got) != "value" {
+		t.Errorf("memory Get = %q, %v, want value", got, err)
+	}
+
+	if err := SetSchemaVersion(service, 2); err != nil {
+		t.Fatalf("SetSchemaVersion failed: %v", err)
+	}
+	if keys, err := List(service); err != nil || !slices.Equal(keys, []string{"key"}) {
+		t.Errorf("List = %q, %v, want [key]", keys, err)
+	}
+	if raw, err := GetRaw(service, "key"); err != nil || string(raw) != "value" {
+		t.Errorf("GetRaw = %q, %v, want value", raw, err)
+	}
+	if err := Sync(); err != nil {
+		t.Errorf("Sync failed: %v", err)
+	}
+
+	b.Reset()
+	if _, err := Get(service, "key"); err != ErrNotFound {
+		t.Errorf("Get after Reset: expected ErrNotFound, got %v", err)
+	}
+	if version, err := SchemaVersion(service); err != nil || version != 0 {
+		t.Errorf("SchemaVersion after Reset = %d, %v, want 0", version, err)
+	}
+}
+
+func TestGetRawUnsupported(t *testing.T) {
+	SetDefaultBackend(NewRestrictedBackend(NewMemoryBackend(), "svc"))
+	t.Cleanup(func() { SetDefaultBackend(nil) })
+
+	if _, err := GetRaw("svc", "key"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("GetRaw: expected ErrUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package vault
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Metadata describes a stored secret without revealing its value.
+type Metadata struct {
+	// App identifies the program that last set the secret, as configured
+	// with SetAppIdentity. It is empty for secrets written before
+	// identities were recorded, or by backends that cannot record it.
+	App string
+
+	// Created is when the secret was first set, Modified when it was last
+	// set, and Expires when it expires, or the zero time if it was set
+	// without a TTL. Size is the size of its value in bytes. They are
+	// recorded by the file storage, which only knows Created when it keeps
+	// an index (see SetFileIndex); MemoryBackend records Expires and Size,
+	// and the other backends leave them zero.
+	Created, Modified, Expires time.Time
+	Size                       int
+
+	// ContentType is the format hint recorded with SetWithContentType, or
+	// "" if none was.
+	ContentType string
+}
+
+// metadataGetter is implemented by backends that record metadata.
+type metadataGetter interface {
+	metadata(ctx context.Context, service, key string) (Metadata, error)
+}
+
+var appID atomic.Pointer[string]
+
+// SetAppIdentity sets the identity recorded with every secret this process
+// sets, so that operators can tell which tool created an entry in a shared
+// keychain. It is stored as the secret-tool "app" attribute, the Keychain
+// item comment, the Windows credential comment, an extended attribute of
+// storage files, or a field of the IndexedDB record. When unset, or set to
+// "", the base name of the running binary is used. A Vault created with
+// WithAppIdentity records its own identity instead.
+func SetAppIdentity(id string) {
+	if id == "" {
+		appID.Store(nil)
+		return
+	}
+	appID.Store(&id)
+}
+
+type appIDKey struct{}
+
+// appIdentity returns the identity to record with the secrets being set
+// under ctx: the one of the Vault running the operation, if it has one.
+func appIdentity(ctx context.Context) string {
+	if id, ok := ctx.Value(appIDKey{}).(string); ok {
+		return id
+	}
+	if id := appID.Load(); id != nil {
+		return *id
+	}
+	if len(os.Args) == 0 {
+		return ""
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// GetMetadata returns the metadata recorded for a secret, or ErrNotFound if
+// it does not exist. A default backend that records no metadata makes it
+// return an error wrapping errors.ErrUnsupported.
+func GetMetadata(service, key string) (Metadata, error) {
+	if err := checkKey(service, key); err != nil {
+		return Metadata{}, err
+	}
+	backend := currentBackend()
+	b, ok := backend.(metadataGetter)
+	if !ok {
+		return Metadata{}, errNoMetadata
+	}
+
+	ctx, done := startOp(context.Background(), "metadata", service, key)
+	ms, mk := std.mapKey(service, key)
+	md, err := b.metadata(ctx, ms, mk)
+	if err == nil {
+		md.ContentType, err = storedContentType(ctx, backend, ms, mk)
+	}
+	done(err)
+	return md, err
+}
@@ -0,0 +1,66 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppIdentity(t *testing.T) {
+	useMemory(t)
+	t.Cleanup(func() { SetAppIdentity("") })
+	service := "vault-test-metadata-service"
+
+	SetAppIdentity("deploy-tool")
+	if err := Set(service, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	md, err := GetMetadata(service, "key")
+	if err != nil || md.App != "deploy-tool" {
+		t.Errorf("GetMetadata = %+v, %v, want App deploy-tool", md, err)
+	}
+
+	// The binary name is the default identity
+	SetAppIdentity("")
+	if err := Set(service, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	md, err = GetMetadata(service, "key")
+	if want := filepath.Base(os.Args[0]); err != nil || md.App != want {
+		t.Errorf("GetMetadata = %+v, %v, want App %s", md, err, want)
+	}
+
+	if _, err := GetMetadata(service, "missing"); err != ErrNotFound {
+		t.Errorf("GetMetadata of missing key: expected ErrNotFound, got %v", err)
+	}
+	if _, err := GetMetadata(service, ""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("GetMetadata with empty key: expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestFileStoreMetadata(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestFileStore(t)
+	t.Cleanup(func() { SetAppIdentity("") })
+
+	SetAppIdentity("deploy-tool")
+	if err := s.set(ctx, "svc", "key", []byte("value")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	md, err := s.metadata(ctx, "svc", "key")
+	if err != nil {
+		t.Fatalf("metadata failed: %v", err)
+	}
+	if md.App == "" {
+		t.Skip("filesystem does not support extended attributes")
+	}
+	if md.App != "deploy-tool" {
+		t.Errorf("metadata App = %q, want deploy-tool", md.App)
+	}
+
+	if _, err := s.metadata(ctx, "svc", "missing"); err != ErrNotFound {
+		t.Errorf("metadata of missing key: expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package vault
+
+import (
+	"context"
+	"errors"
+)
+
+// NewMirroredBackend returns a Backend that writes to both primary and
+// mirror and reads from primary, falling back to mirror when primary
+// fails, so that secrets stay readable while a flaky keychain daemon is
+// down. A typical mirror is an encrypted file backend.
+//
+// Set and Del fail if primary fails, and then leave mirror alone. Writes
+// to mirror are best effort: a failure does not fail the operation but is
+// reported as an Event with Op "mirror" and the error, to the hook set
+// with SetHook and the audit log, and to those of the Vault that made the
+// write. Get and List only fall back to mirror for other errors than
+// ErrNotFound, so a secret missing from primary is missing, whatever
+// mirror holds, and never for GetFresh.
+//
+// The two backends are not kept consistent beyond that: after a failed
+// mirror write, mirror can serve a stale value or a deleted secret until
+// the key is written again, and secrets written to primary by other means
+// are never copied to mirror.
+func NewMirroredBackend(primary, mirror Backend) Backend {
+	return &mirroredBackend{primary: primary, mirror: mirror}
+}
+
+type mirroredBackend struct {
+	primary, mirror Backend
+}
+
+func (b *mirroredBackend) Set(ctx context.Context, service, key string, value []byte) error {
+	if err := b.primary.Set(ctx, service, key, value); err != nil {
+		return err
+	}
+	b.mirrored(ctx, service, key, func(ctx context.Context) error {
+		return b.mirror.Set(ctx, service, key, value)
+	})
+	return nil
+}
+
+func (b *mirroredBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	value, err := b.primary.Get(ctx, service, key)
+	if !b.fallBack(ctx, err) {
+		if err == nil {
+			traceChild(ctx, 0, b.primary)
+		}
+		return value, err
+	}
+	if value, mirrorErr := b.mirror.Get(ctx, service, key); mirrorErr == nil {
+		traceChild(ctx, 1, b.mirror)
+		return value, nil
+	}
+	return nil, err
+}
+
+func (b *mirroredBackend) Del(ctx context.Context, service, key string) error {
+	err := b.primary.Del(ctx, service, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	// Also when primary had nothing, in case only mirror still has it
+	b.mirrored(ctx, service, key, func(ctx context.Context) error {
+		if err := b.mirror.Del(ctx, service, key); !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return nil
+	})
+	return err
+}
+
+func (b *mirroredBackend) List(ctx context.Context, service string) ([]string, error) {
+	keys, err := b.primary.List(ctx, service)
+	if !b.fallBack(ctx, err) {
+		return keys, err
+	}
+	if keys, mirrorErr := b.mirror.List(ctx, service); mirrorErr == nil {
+		return keys, nil
+	}
+	return nil, err
+}
+
+// fallBack reports whether a read that failed on primary with err should
+// be retried on mirror. Fresh reads are not, as mirror may be stale.
+func (b *mirroredBackend) fallBack(ctx context.Context, err error) bool {
+	return err != nil && !errors.Is(err, ErrNotFound) && ctx.Err() == nil && !FreshRead(ctx)
+}
+
+// mirrored runs the write to mirror and reports it to the hooks if it
+// fails.
+func (b *mirroredBackend) mirrored(ctx context.Context, service, key string, write func(context.Context) error) {
+	ctx, done := observeOp(ctx, contextObservers(ctx), "mirror", service, key)
+	if err := write(ctx); err != nil {
+		done(err)
+	}
+}
@@ -0,0 +1,130 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// failingBackend fails every operation with err.
+type failingBackend struct {
+	err error
+}
+
+func (b failingBackend) Set(context.Context, string, string, []byte) error { return b.err }
+func (b failingBackend) Get(context.Context, string, string) ([]byte, error) {
+	return nil, b.err
+}
+func (b failingBackend) Del(context.Context, string, string) error { return b.err }
+func (b failingBackend) List(context.Context, string) ([]string, error) {
+	return nil, b.err
+}
+
+func TestMirroredBackend(t *testing.T) {
+	ctx := context.Background()
+	primary, mirror := NewMemoryBackend(), NewMemoryBackend()
+	b := NewMirroredBackend(primary, mirror)
+
+	if err := b.Set(ctx, testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	for name, backend := range map[string]Backend{"primary": primary, "mirror": mirror} {
+		if got, err := backend.Get(ctx, testService, "key"); err != nil || string(got) != "value" {
+			t.Errorf("%s Get = %q, %v, want value", name, got, err)
+		}
+	}
+
+	// A secret missing from primary is missing
+	if err := primary.Del(ctx, testService, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get(ctx, testService, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get missing from primary: expected ErrNotFound, got %v", err)
+	}
+	if err := b.Del(ctx, testService, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Del missing from primary: expected ErrNotFound, got %v", err)
+	}
+	if _, err := mirror.Get(ctx, testService, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Del left the secret in the mirror: %v", err)
+	}
+}
+
+func TestMirroredBackendPrimaryDown(t *testing.T) {
+	ctx := context.Background()
+	mirror := NewMemoryBackend()
+	if err := mirror.Set(ctx, testService, "key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	b := NewMirroredBackend(failingBackend{ErrBackendUnavailable}, mirror)
+
+	if got, err := b.Get(ctx, testService, "key"); err != nil || string(got) != "value" {
+		t.Errorf("Get with primary down = %q, %v, want the mirror's value", got, err)
+	}
+	if keys, err := b.List(ctx, testService); err != nil || !slices.Equal(keys, []string{"key"}) {
+		t.Errorf("List with primary down = %q, %v, want the mirror's keys", keys, err)
+	}
+	if _, err := b.Get(ctx, testService, "other"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Get missing from the mirror: expected primary's error, got %v", err)
+	}
+
+	// Writes fail without touching the mirror
+	if err := b.Set(ctx, testService, "key", []byte("new")); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Set with primary down: expected ErrBackendUnavailable, got %v", err)
+	}
+	if err := b.Del(ctx, testService, "key"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Del with primary down: expected ErrBackendUnavailable, got %v", err)
+	}
+	if got, _ := mirror.Get(ctx, testService, "key"); string(got) != "value" {
+		t.Errorf("mirror value = %q after failed writes, want value", got)
+	}
+}
+
+func TestMirroredBackendMirrorDown(t *testing.T) {
+	var events []Event
+	SetHook(func(e Event) { events = append(events, e) })
+	t.Cleanup(func() { SetHook(nil) })
+
+	ctx := context.Background()
+	primary := NewMemoryBackend()
+	b := NewMirroredBackend(primary, failingBackend{ErrBackendUnavailable})
+
+	if err := b.Set(ctx, testService, "key", []byte("value")); err != nil {
+		t.Errorf("Set with mirror down failed: %v", err)
+	}
+	if err := b.Del(ctx, testService, "key"); err != nil {
+		t.Errorf("Del with mirror down failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want one per failed mirror write", len(events))
+	}
+	for _, e := range events {
+		if e.Op != "mirror" || e.Key != "key" || !errors.Is(e.Err, ErrBackendUnavailable) {
+			t.Errorf("event = %+v, want a mirror failure", e)
+		}
+	}
+}
+
+func TestMirroredBackendMirrorDownVaultHook(t *testing.T) {
+	var events []Event
+	v, err := New(
+		WithBackend(NewMirroredBackend(NewMemoryBackend(), failingBackend{ErrBackendUnavailable})),
+		WithHook(func(e Event) { events = append(events, e) }),
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if err := v.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set with mirror down failed: %v", err)
+	}
+	var mirrored []Event
+	for _, e := range events {
+		if e.Op == "mirror" {
+			mirrored = append(mirrored, e)
+		}
+	}
+	if len(mirrored) != 1 || mirrored[0].Key != "key" || !errors.Is(mirrored[0].Err, ErrBackendUnavailable) {
+		t.Errorf("Vault hook got mirror events %+v, want the failed mirror write", mirrored)
+	}
+}
@@ -0,0 +1,144 @@
+package vault
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// WithEncodedNames percent-encodes service and key in the names of items
+// that have a single name (see WithSeparator), so that every pair names a
+// distinct item: service "a" and key "b/c" become "a/b%2Fc", and service
+// "a/b" and key "c" become "a%2Fb/c". Every byte other than ASCII letters,
+// digits, '-', '_' and '~', or that appears in the separator, is encoded,
+// which also keeps spaces and non-ASCII characters out of the names.
+//
+// Items stored under the unencoded names keep working: reads fall back to
+// them, Set moves them to the encoded name, Del removes both and List
+// reports both. The Keychain and secret-tool identify items by separate
+// service and key attributes, and the file storage uses its own naming
+// (see ShardByService), so they are not affected.
+func WithEncodedNames() NativeOption {
+	return func(c *nativeConfig) {
+		c.encodedNames = true
+	}
+}
+
+// escapeName returns s percent-encoded for an item name joined with sep.
+func escapeName(s, sep string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isNameByte(c) && strings.IndexByte(sep, c) < 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte("0123456789ABCDEF"[c>>4])
+		b.WriteByte("0123456789ABCDEF"[c&15])
+	}
+	return b.String()
+}
+
+// unescapeName decodes s, encoded by escapeName with sep. It reports false
+// for names escapeName does not produce, which were stored unencoded.
+func unescapeName(s, sep string) (string, bool) {
+	name, err := url.PathUnescape(s)
+	if err != nil || escapeName(name, sep) != s {
+		return "", false
+	}
+	return name, true
+}
+
+func isNameByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '~'
+}
+
+// legacyNameContext returns ctx set up to name items without encoding, and
+// whether the operation under ctx must also look for items named that way:
+// names are encoded and the platform identifies items by their name.
+func legacyNameContext(ctx context.Context) (context.Context, bool) {
+	cfg := nativeConfigFrom(ctx)
+	if !cfg.encodedNames || !namedItems(ctx) {
+		return ctx, false
+	}
+	cfg.encodedNames = false
+	return context.WithValue(ctx, nativeConfigKey{}, cfg), true
+}
+
+// withLegacyName runs op under ctx and, if it reports ErrNotFound and the
+// item may still have its unencoded name, under that name.
+func withLegacyName[T any](ctx context.Context, service, key string, op func(context.Context) (T, error)) (T, error) {
+	result, err := op(ctx)
+	if err != ErrNotFound {
+		return result, err
+	}
+	if legacy, ok := legacyNameContext(ctx); ok && itemName(legacy, service, key) != itemName(ctx, service, key) {
+		return op(legacy)
+	}
+	return result, err
+}
+
+// removeLegacyName deletes the item for service and key stored under its
+// unencoded name, if names are encoded and it differs.
+func removeLegacyName(ctx context.Context, service, key string) error {
+	legacy, ok := legacyNameContext(ctx)
+	if !ok || itemName(legacy, service, key) == itemName(ctx, service, key) {
+		return ErrNotFound
+	}
+	return del(legacy, service, key)
+}
+
+// delNamed deletes the item for service and key under both names.
+func delNamed(ctx context.Context, service, key string) error {
+	err := del(ctx, service, key)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	if legacyErr := removeLegacyName(ctx, service, key); legacyErr != ErrNotFound {
+		return legacyErr
+	}
+	return err
+}
+
+// listNamed lists service's keys under both names.
+func listNamed(ctx context.Context, service string) ([]string, error) {
+	keys, err := list(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	legacy, ok := legacyNameContext(ctx)
+	if !ok {
+		return keys, nil
+	}
+	old, err := list(legacy, service)
+	if err != nil {
+		return nil, err
+	}
+	sep := separatorFrom(ctx)
+	for _, key := range old {
+		// Names escapeName produces were listed, decoded, above when the
+		// prefixes match; the others can only be unencoded
+		if _, encoded := unescapeName(key, sep); encoded && itemPrefix(legacy, service) == itemPrefix(ctx, service) {
+			continue
+		}
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// itemKey returns the key of the item named name in the listing of the
+// items with prefix, as returned by itemPrefix under ctx.
+func itemKey(ctx context.Context, name, prefix string) (string, bool) {
+	key, ok := strings.CutPrefix(name, prefix)
+	if !ok || key == "" {
+		return "", false
+	}
+	if !nativeConfigFrom(ctx).encodedNames {
+		return key, true
+	}
+	return unescapeName(key, separatorFrom(ctx))
+}
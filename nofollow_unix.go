@@ -0,0 +1,33 @@
+//go:build linux || darwin
+
+package vault
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openSecretFile opens the secret file at path for reading, refusing to
+// follow a symbolic link in its place. O_NONBLOCK keeps a FIFO planted
+// there from blocking the open; it has no effect on regular files.
+func openSecretFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|unix.O_NOFOLLOW|unix.O_NONBLOCK, 0)
+	if errors.Is(err, unix.ELOOP) {
+		return nil, insecureFileError(path, os.ModeSymlink)
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, insecureFileError(path, info.Mode())
+	}
+	return f, nil
+}
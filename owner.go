@@ -0,0 +1,158 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ownerKeyPrefix starts the reserved key the owner of a secret is recorded
+// under, in the same service, followed by the secret's key. The record
+// holds the SHA-256 of the stored value the owner set, then the owner, so
+// that a record outliving its secret, or a value set since by a writer
+// without an owner, is recognized as stale and ignored.
+const ownerKeyPrefix = ".vault-owner/"
+
+func ownerKey(key string) string {
+	return ownerKeyPrefix + key
+}
+
+func isOwnerKey(key string) bool {
+	return strings.HasPrefix(key, ownerKeyPrefix)
+}
+
+// WithOwner tags the secrets the Vault sets with owner, and makes its Del
+// and DelContext refuse, with an error wrapping ErrForbidden, to delete a
+// secret tagged with another owner, as DelAs does, so that tenants sharing
+// a keychain don't delete each other's secrets by accident. The tag is
+// recorded under a reserved key next to the secret, which List never
+// returns, so writes of an owned vault cost a second backend call, and
+// its deletes two more.
+//
+// Ownership is a safeguard, not access control: Set and the other writes
+// don't check it and retag the secret with their own owner, and a writer
+// without an owner leaves the secret unowned.
+func WithOwner(owner string) Option {
+	return func(v *Vault) {
+		v.owner = owner
+	}
+}
+
+// DelAs is like Del but returns an error wrapping ErrForbidden, and keeps
+// the secret, if it is tagged with an owner other than owner (see
+// WithOwner). Secrets without an owner are deleted whatever owner is.
+func DelAs(service, key, owner string) error {
+	return std.DelAsContext(context.Background(), service, key, owner)
+}
+
+// DelAsContext is like DelAs but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage calls complete.
+func DelAsContext(ctx context.Context, service, key, owner string) error {
+	return std.DelAsContext(ctx, service, key, owner)
+}
+
+// DelAs removes the value stored under service and key unless another
+// owner holds it, as the package-level DelAs does.
+func (v *Vault) DelAs(service, key, owner string) error {
+	return v.DelAsContext(context.Background(), service, key, owner)
+}
+
+// DelAsContext is like DelAs but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage calls complete.
+func (v *Vault) DelAsContext(ctx context.Context, service, key, owner string) error {
+	if err := checkKey(service, key); err != nil {
+		return err
+	}
+
+	v.writeMu.Lock()
+	defer v.writeMu.Unlock()
+	ctx, done := v.start(ctx, "del", service, key)
+	b := v.store()
+	ms, mk := v.mapKey(service, key)
+	err := func() error {
+		if l, ok := b.(locker); ok {
+			unlock, err := l.lock(ctx)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+		}
+
+		tagged, err := checkOwner(ctx, b, ms, mk, owner)
+		if err != nil {
+			return err
+		}
+		if err := b.Del(ctx, ms, mk); err != nil {
+			return err
+		}
+		if tagged {
+			if err := b.Del(ctx, ms, ownerKey(mk)); err != nil && !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("vault: secret deleted, but not its owner: %w", err)
+			}
+		}
+		return nil
+	}()
+	v.cache.invalidate()
+	if err == nil {
+		v.expiryDisarmed(service, key)
+		v.backupChanged(b, ms)
+	}
+	done(err)
+	return err
+}
+
+// checkOwner returns an error wrapping ErrForbidden if the secret stored
+// under service and key is tagged with an owner other than owner, and
+// ErrNotFound if there is none. It reports whether an owner record exists,
+// stale or not.
+func checkOwner(ctx context.Context, b Backend, service, key, owner string) (bool, error) {
+	record, err := b.Get(ctx, service, ownerKey(key))
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	stored, err := b.Get(ctx, service, key)
+	if err != nil {
+		return true, err
+	}
+	tag, ok := stampPayload(record, stored)
+	if ok && tag != owner {
+		return true, fmt.Errorf("%w: secret is owned by %q", ErrForbidden, tag)
+	}
+	return true, nil
+}
+
+// tagOwner records the Vault's owner, if it has one, for stored, just set
+// under service and key.
+func (v *Vault) tagOwner(ctx context.Context, b Backend, service, key string, stored []byte) error {
+	if v.owner == "" {
+		return nil
+	}
+	if err := b.Set(ctx, service, ownerKey(key), stamp(stored, v.owner)); err != nil {
+		return fmt.Errorf("vault: secret set, but not its owner: %w", err)
+	}
+	return nil
+}
+
+// stamp returns a record of payload for value: the SHA-256 of value, then
+// payload. It is how records kept next to a secret, such as its owner,
+// tell whether they still describe it.
+func stamp(value []byte, payload string) []byte {
+	sum := sha256.Sum256(value)
+	return append(sum[:], payload...)
+}
+
+// stampPayload returns the payload of record, and whether record was
+// stamped for value.
+func stampPayload(record, value []byte) (string, bool) {
+	sum := sha256.Sum256(value)
+	if len(record) < len(sum) || !bytes.Equal(record[:len(sum)], sum[:]) {
+		return "", false // stale
+	}
+	return string(record[len(sum):]), true
+}
@@ -0,0 +1,81 @@
+package vault
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOwner(t *testing.T) {
+	alice, mem := newTestVault(t, WithOwner("alice"))
+	bob, err := New(WithBackend(mem), WithOwner("bob"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	anyone, err := New(WithBackend(mem))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if err := alice.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if keys, err := anyone.List(testService); err != nil || !slices.Equal(keys, []string{"key"}) {
+		t.Errorf("List = %q, %v, want only the secret", keys, err)
+	}
+
+	// Other owners, and callers passing another owner, can't delete it
+	if err := bob.Del(testService, "key"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Del by another owner = %v, want ErrForbidden", err)
+	}
+	if err := anyone.DelAs(testService, "key", "bob"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("DelAs with another owner = %v, want ErrForbidden", err)
+	}
+	if _, err := anyone.Get(testService, "key"); err != nil {
+		t.Errorf("Get after the refused deletes = %v, want the secret", err)
+	}
+	if err := anyone.DelAs(testService, "key", "alice"); err != nil {
+		t.Errorf("DelAs with the owner failed: %v", err)
+	}
+	if _, err := mem.Get(t.Context(), testService, ownerKey("key")); err != ErrNotFound {
+		t.Errorf("owner record after DelAs = %v, want ErrNotFound", err)
+	}
+	if err := alice.Del(testService, "key"); err != ErrNotFound {
+		t.Errorf("Del of a missing secret = %v, want ErrNotFound", err)
+	}
+
+	// Unowned secrets can be deleted by anyone
+	if err := anyone.Set(testService, "free", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := bob.Del(testService, "free"); err != nil {
+		t.Errorf("Del of an unowned secret failed: %v", err)
+	}
+
+	// A writer without an owner leaves the secret unowned
+	if err := alice.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := anyone.Set(testService, "key", []byte("replaced")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := bob.Del(testService, "key"); err != nil {
+		t.Errorf("Del after an unowned write failed: %v", err)
+	}
+
+	// Conditional writes and Touch tag too
+	if _, err := alice.SetIfAbsent(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("SetIfAbsent failed: %v", err)
+	}
+	if err := alice.Touch(testService, "key", 100*time.Second); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	if err := bob.Del(testService, "key"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Del of a touched secret by another owner = %v, want ErrForbidden", err)
+	}
+
+	if err := anyone.Set(testService, ownerKey("key"), []byte("x")); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Set of an owner record = %v, want ErrInvalidKey", err)
+	}
+}
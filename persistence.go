@@ -0,0 +1,29 @@
+package vault
+
+// WindowsPersistence is the scope a Windows credential is persisted in,
+// the Persist field passed to CredWrite.
+type WindowsPersistence int
+
+const (
+	// PersistLocalMachine keeps credentials across logon sessions on this
+	// computer only (CRED_PERSIST_LOCAL_MACHINE). This is the default.
+	PersistLocalMachine WindowsPersistence = iota
+
+	// PersistSession keeps credentials for the current logon session only;
+	// they are removed at logoff (CRED_PERSIST_SESSION). Useful on kiosks
+	// and shared machines.
+	PersistSession
+
+	// PersistEnterprise keeps credentials across logon sessions and lets
+	// them roam with the user's profile in a domain (CRED_PERSIST_ENTERPRISE).
+	PersistEnterprise
+)
+
+// WithWindowsPersistence sets the scope credentials written on Windows are
+// persisted in. It only affects Set; credentials are read and deleted
+// regardless of their scope. Other platforms ignore it.
+func WithWindowsPersistence(p WindowsPersistence) NativeOption {
+	return func(c *nativeConfig) {
+		c.windowsPersistence = p
+	}
+}
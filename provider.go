@@ -0,0 +1,35 @@
+package vault
+
+import "context"
+
+// GetString is like Get but returns the value as a string.
+func GetString(service, key string) (string, error) {
+	return std.GetString(service, key)
+}
+
+// GetString is like Get but returns the value as a string.
+func (v *Vault) GetString(service, key string) (string, error) {
+	value, err := v.GetContext(context.Background(), service, key)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// Provider returns a lookup function for the secrets of service, in the
+// func(key string) (string, bool) shape configuration libraries accept for
+// resolving values, such as a koanf env.ProviderWithValue callback. The
+// boolean is false when the key does not exist, and also when it cannot be
+// read for any other reason; use GetString to see the error.
+func Provider(service string) func(key string) (string, bool) {
+	return std.Provider(service)
+}
+
+// Provider returns a lookup function for the secrets of service in the
+// Vault, as the package-level Provider does.
+func (v *Vault) Provider(service string) func(key string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, err := v.GetString(service, key)
+		return value, err == nil
+	}
+}
@@ -0,0 +1,25 @@
+package vault
+
+import "testing"
+
+func TestProvider(t *testing.T) {
+	useMemory(t)
+	if err := Set(testService, "db-password", []byte("hunter2")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	lookup := Provider(testService)
+	if got, ok := lookup("db-password"); !ok || got != "hunter2" {
+		t.Errorf("lookup(db-password) = %q, %v, want hunter2, true", got, ok)
+	}
+	if got, ok := lookup("missing"); ok || got != "" {
+		t.Errorf("lookup(missing) = %q, %v, want \"\", false", got, ok)
+	}
+	if _, ok := lookup(""); ok {
+		t.Error("lookup of an invalid key succeeded")
+	}
+
+	if got, err := GetString(testService, "db-password"); err != nil || got != "hunter2" {
+		t.Errorf("GetString = %q, %v, want hunter2", got, err)
+	}
+}
@@ -0,0 +1,63 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// WithMaxKeysPerService limits each service of the Vault to n keys: once a
+// service holds n keys, Set of a new key returns ErrQuotaExceeded, while
+// existing keys can still be overwritten. It guards shared machines against
+// a runaway process filling the keychain. The limit is checked with a List
+// before every write, so concurrent writers can overshoot it slightly.
+// Zero, the default, means no limit.
+func WithMaxKeysPerService(n int) Option {
+	return func(v *Vault) {
+		v.maxKeys = n
+	}
+}
+
+// Count returns the number of keys stored under service in the default
+// backend, the length of what List returns.
+func Count(service string) (int, error) {
+	return std.CountContext(context.Background(), service)
+}
+
+// CountContext is like Count but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage call completes.
+func CountContext(ctx context.Context, service string) (int, error) {
+	return std.CountContext(ctx, service)
+}
+
+// Count returns the number of keys stored under service, as the
+// package-level Count does.
+func (v *Vault) Count(service string) (int, error) {
+	return v.CountContext(context.Background(), service)
+}
+
+// CountContext is like Count but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage call completes.
+func (v *Vault) CountContext(ctx context.Context, service string) (int, error) {
+	keys, err := v.ListContext(ctx, service)
+	return len(keys), err
+}
+
+// checkQuota returns ErrQuotaExceeded if setting key would take service
+// in b over the Vault's limit of keys per service.
+func (v *Vault) checkQuota(ctx context.Context, b Backend, service, key string) error {
+	if v.maxKeys == 0 {
+		return nil
+	}
+	keys, err := b.List(ctx, service)
+	if err != nil {
+		return err
+	}
+	keys = withoutReservedKeys(keys)
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+	if len(keys) < v.maxKeys || slices.Contains(keys, key) {
+		return nil
+	}
+	return fmt.Errorf("%w: service %q holds %d keys", ErrQuotaExceeded, service, len(keys))
+}
@@ -0,0 +1,41 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMaxKeysPerService(t *testing.T) {
+	v, _ := newTestVault(t, WithMaxKeysPerService(2))
+
+	for _, key := range []string{"a", "b"} {
+		if err := v.Set(testService, key, []byte("value")); err != nil {
+			t.Fatalf("Set(%q) failed: %v", key, err)
+		}
+	}
+	if err := v.Set(testService, "c", []byte("value")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Set over the limit: expected ErrQuotaExceeded, got %v", err)
+	}
+	// Overwriting is allowed at the limit, and other services are separate
+	if err := v.Set(testService, "a", []byte("new")); err != nil {
+		t.Errorf("overwrite at the limit failed: %v", err)
+	}
+	if err := v.Set("other", "c", []byte("value")); err != nil {
+		t.Errorf("Set in another service failed: %v", err)
+	}
+	if n, err := v.Count(testService); err != nil || n != 2 {
+		t.Errorf("Count = %d, %v, want 2", n, err)
+	}
+
+	// Deleting a key makes room again
+	if err := v.Del(testService, "b"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if err := v.Set(testService, "c", []byte("value")); err != nil {
+		t.Errorf("Set after Del failed: %v", err)
+	}
+
+	if _, err := New(WithMaxKeysPerService(-1)); err == nil {
+		t.Error("New accepted a negative key limit")
+	}
+}
@@ -0,0 +1,52 @@
+package vault
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const refScheme = "vault://"
+
+// Resolve fetches the secret named by a reference of the form
+// vault://service/key, for use in configuration files.
+//
+// Both components are percent-decoded, so a service or key containing "/"
+// (or "?" and "#") must be escaped: vault://my%2Fapp/key refers to key "key"
+// of service "my/app". A malformed reference returns an error wrapping
+// ErrInvalidRef; a well-formed reference to a missing secret returns
+// ErrNotFound.
+func Resolve(ref string) ([]byte, error) {
+	service, key, err := parseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	return Get(service, key)
+}
+
+func parseRef(ref string) (service, key string, err error) {
+	if len(ref) < len(refScheme) || !strings.EqualFold(ref[:len(refScheme)], refScheme) {
+		return "", "", fmt.Errorf("%w %q: want scheme vault://", ErrInvalidRef, ref)
+	}
+	rest := ref[len(refScheme):]
+
+	if strings.ContainsAny(rest, "?#") {
+		return "", "", fmt.Errorf("%w %q: queries and fragments are not supported, escape ? and # as %%3F and %%23", ErrInvalidRef, ref)
+	}
+
+	rawService, rawKey, ok := strings.Cut(rest, "/")
+	if !ok || strings.Contains(rawKey, "/") {
+		return "", "", fmt.Errorf("%w %q: want vault://service/key, escape / inside a component as %%2F", ErrInvalidRef, ref)
+	}
+
+	if service, err = url.PathUnescape(rawService); err != nil {
+		return "", "", fmt.Errorf("%w %q: bad service: %v", ErrInvalidRef, ref, err)
+	}
+	if key, err = url.PathUnescape(rawKey); err != nil {
+		return "", "", fmt.Errorf("%w %q: bad key: %v", ErrInvalidRef, ref, err)
+	}
+	if service == "" || key == "" {
+		return "", "", fmt.Errorf("%w %q: service and key must not be empty", ErrInvalidRef, ref)
+	}
+	return service, key, nil
+}
@@ -0,0 +1,83 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		service string
+		key     string
+	}{
+		{"vault://myapp/api-key", "myapp", "api-key"},
+		{"VAULT://myapp/api-key", "myapp", "api-key"},
+		{"vault://my%2Fapp/api%2Fkey", "my/app", "api/key"},
+		{"vault://my%20app/key%3Fwith%23chars", "my app", "key?with#chars"},
+		{"vault://%E4%B8%96/%E7%95%8C", "世", "界"},
+	}
+
+	for _, tt := range tests {
+		service, key, err := parseRef(tt.ref)
+		if err != nil {
+			t.Errorf("parseRef(%q) failed: %v", tt.ref, err)
+			continue
+		}
+		if service != tt.service || key != tt.key {
+			t.Errorf("parseRef(%q) = %q, %q, want %q, %q", tt.ref, service, key, tt.service, tt.key)
+		}
+	}
+}
+
+func TestParseRefInvalid(t *testing.T) {
+	refs := []string{
+		"",
+		"myapp/api-key",
+		"https://myapp/api-key",
+		"vault:/myapp/api-key",
+		"vault://myapp",
+		"vault://myapp/",
+		"vault:///api-key",
+		"vault://my/app/api-key",
+		"vault://myapp/api-key?version=2",
+		"vault://myapp/api-key#frag",
+		"vault://myapp/bad%zzescape",
+	}
+
+	for _, ref := range refs {
+		if _, _, err := parseRef(ref); !errors.Is(err, ErrInvalidRef) {
+			t.Errorf("parseRef(%q) = %v, want ErrInvalidRef", ref, err)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	key := "test/resolve key"
+	value := []byte("resolved-value")
+
+	// Clean up
+	defer Del(testService, key)
+	_ = Del(testService, key)
+
+	ref := "vault://" + testService + "/test%2Fresolve%20key"
+
+	if _, err := Resolve(ref); err != ErrNotFound {
+		t.Errorf("Resolve of missing secret = %v, want ErrNotFound", err)
+	}
+
+	if err := Set(testService, key, value); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	got, err := Resolve(ref)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if string(got) != string(value) {
+		t.Errorf("Resolve returned %q, want %q", got, value)
+	}
+
+	if _, err := Resolve("file:///etc/passwd"); !errors.Is(err, ErrInvalidRef) {
+		t.Errorf("Resolve with wrong scheme = %v, want ErrInvalidRef", err)
+	}
+}
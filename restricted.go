@@ -0,0 +1,64 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+)
+
+// NewRestrictedBackend returns a Backend that forwards operations to inner
+// only when their service is one of allowedServices, and returns an error
+// wrapping ErrForbidden for any other service. It fails closed: with no
+// allowed services, every operation is forbidden.
+//
+// This is useful for handing a plugin access to its own service namespace
+// and nothing else.
+func NewRestrictedBackend(inner Backend, allowedServices ...string) Backend {
+	allowed := make(map[string]struct{}, len(allowedServices))
+	for _, service := range allowedServices {
+		allowed[service] = struct{}{}
+	}
+	return &restrictedBackend{inner: inner, allowed: allowed}
+}
+
+type restrictedBackend struct {
+	inner   Backend
+	allowed map[string]struct{}
+}
+
+func (b *restrictedBackend) check(service string) error {
+	if len(b.allowed) == 0 {
+		return fmt.Errorf("%w: restricted backend allows no services", ErrForbidden)
+	}
+	if _, ok := b.allowed[service]; !ok {
+		return fmt.Errorf("%w: service %q is not allowed", ErrForbidden, service)
+	}
+	return nil
+}
+
+func (b *restrictedBackend) Set(ctx context.Context, service, key string, value []byte) error {
+	if err := b.check(service); err != nil {
+		return err
+	}
+	return b.inner.Set(ctx, service, key, value)
+}
+
+func (b *restrictedBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	if err := b.check(service); err != nil {
+		return nil, err
+	}
+	return b.inner.Get(ctx, service, key)
+}
+
+func (b *restrictedBackend) Del(ctx context.Context, service, key string) error {
+	if err := b.check(service); err != nil {
+		return err
+	}
+	return b.inner.Del(ctx, service, key)
+}
+
+func (b *restrictedBackend) List(ctx context.Context, service string) ([]string, error) {
+	if err := b.check(service); err != nil {
+		return nil, err
+	}
+	return b.inner.List(ctx, service)
+}
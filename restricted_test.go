@@ -0,0 +1,64 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRestrictedBackend(t *testing.T) {
+	ctx := context.Background()
+	key := "test-restricted-key"
+	value := []byte("restricted-value")
+
+	backend := NewRestrictedBackend(NativeBackend(), testService)
+
+	// Clean up
+	defer Del(testService, key)
+
+	// Allowed service passes through to the inner backend
+	if err := backend.Set(ctx, testService, key, value); err != nil {
+		t.Fatalf("Set on allowed service failed: %v", err)
+	}
+	got, err := backend.Get(ctx, testService, key)
+	if err != nil {
+		t.Fatalf("Get on allowed service failed: %v", err)
+	}
+	if string(got) != string(value) {
+		t.Errorf("Get returned %q, want %q", got, value)
+	}
+
+	// Any other service is forbidden and never reaches the inner backend
+	other := "vault-test-other-service"
+	if err := backend.Set(ctx, other, key, value); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Set on other service = %v, want ErrForbidden", err)
+	}
+	if _, err := backend.Get(ctx, other, key); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Get on other service = %v, want ErrForbidden", err)
+	}
+	if err := backend.Del(ctx, other, key); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Del on other service = %v, want ErrForbidden", err)
+	}
+	if _, err := Get(other, key); err != ErrNotFound {
+		t.Errorf("forbidden Set reached the inner backend: Get = %v, want ErrNotFound", err)
+	}
+
+	if err := backend.Del(ctx, testService, key); err != nil {
+		t.Fatalf("Del on allowed service failed: %v", err)
+	}
+}
+
+func TestRestrictedBackendEmptyAllowlist(t *testing.T) {
+	ctx := context.Background()
+	backend := NewRestrictedBackend(NativeBackend())
+
+	if err := backend.Set(ctx, testService, "key", []byte("value")); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Set with empty allowlist = %v, want ErrForbidden", err)
+	}
+	if _, err := backend.Get(ctx, testService, "key"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Get with empty allowlist = %v, want ErrForbidden", err)
+	}
+	if err := backend.Del(ctx, testService, "key"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Del with empty allowlist = %v, want ErrForbidden", err)
+	}
+}
@@ -0,0 +1,77 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// schemaVersionKey is the reserved key a service's schema version is stored
+// under, in the default backend. The package-level Set, Get and Del reject
+// it and List never returns it, so it cannot collide with a caller's own
+// keys.
+const schemaVersionKey = ".vault-schema-version"
+
+func isReservedKey(key string) bool {
+	return key == schemaVersionKey || isOwnerKey(key) || isContentTypeKey(key)
+}
+
+// SchemaVersion returns the schema version recorded for service with
+// SetSchemaVersion, or 0 if none was ever recorded. Callers can use it to
+// detect entries written in an older format and migrate them.
+func SchemaVersion(service string) (int, error) {
+	if err := checkService(service); err != nil {
+		return 0, err
+	}
+
+	data, err := currentBackend().Get(context.Background(), service, schemaVersionKey)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, fmt.Errorf("vault: invalid schema version for service %q: %w", service, err)
+	}
+	return version, nil
+}
+
+// SetSchemaVersion records the schema version of the entries stored under
+// service. Versions start at 1; 0 means unversioned.
+func SetSchemaVersion(service string, version int) error {
+	if err := checkService(service); err != nil {
+		return err
+	}
+	if version < 1 {
+		return &ValidationError{Field: "version", Reason: "must be at least 1", Err: ErrInvalidValue}
+	}
+	return currentBackend().Set(context.Background(), service, schemaVersionKey, []byte(strconv.Itoa(version)))
+}
+
+// GetVersioned is like Get but refuses to return the value, with an error
+// wrapping ErrSchemaVersion, if the schema version recorded for service is
+// below minVersion.
+func GetVersioned(service, key string, minVersion int) ([]byte, error) {
+	version, err := SchemaVersion(service)
+	if err != nil {
+		return nil, err
+	}
+	if version < minVersion {
+		return nil, fmt.Errorf("%w: service %q is at version %d, need %d", ErrSchemaVersion, service, version, minVersion)
+	}
+	return Get(service, key)
+}
+
+// withoutReservedKeys removes the package's reserved keys from keys.
+func withoutReservedKeys(keys []string) []string {
+	out := keys[:0]
+	for _, key := range keys {
+		if !isReservedKey(key) {
+			out = append(out, key)
+		}
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	service := "vault-test-schema-service"
+	key := "schema-key"
+
+	// Clean up
+	defer del(context.Background(), service, schemaVersionKey)
+	defer Del(service, key)
+	_ = del(context.Background(), service, schemaVersionKey)
+
+	version, err := SchemaVersion(service)
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	if version != 0 {
+		t.Errorf("SchemaVersion of unversioned service = %d, want 0", version)
+	}
+
+	if err := Set(service, key, []byte("v1-token")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := GetVersioned(service, key, 2); !errors.Is(err, ErrSchemaVersion) {
+		t.Errorf("GetVersioned below required version = %v, want ErrSchemaVersion", err)
+	}
+
+	if err := SetSchemaVersion(service, 2); err != nil {
+		t.Fatalf("SetSchemaVersion failed: %v", err)
+	}
+	if version, err = SchemaVersion(service); err != nil || version != 2 {
+		t.Errorf("SchemaVersion = %d, %v, want 2, nil", version, err)
+	}
+	got, err := GetVersioned(service, key, 2)
+	if err != nil {
+		t.Fatalf("GetVersioned at required version failed: %v", err)
+	}
+	if string(got) != "v1-token" {
+		t.Errorf("GetVersioned returned %q, want %q", got, "v1-token")
+	}
+
+	// The marker is invisible to the regular API
+	keys, err := List(service)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != key {
+		t.Errorf("List returned %q, want only %q", keys, key)
+	}
+	if _, err := Get(service, schemaVersionKey); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Get of reserved key = %v, want ErrInvalidKey", err)
+	}
+	if err := Set(service, schemaVersionKey, []byte("9")); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Set of reserved key = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestSetSchemaVersionInvalid(t *testing.T) {
+	if err := SetSchemaVersion("", 1); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("SetSchemaVersion with empty service = %v, want ErrInvalidKey", err)
+	}
+	if err := SetSchemaVersion(testService, 0); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("SetSchemaVersion(0) = %v, want ErrInvalidValue", err)
+	}
+	if _, err := SchemaVersion(""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("SchemaVersion with empty service = %v, want ErrInvalidKey", err)
+	}
+}
@@ -0,0 +1,113 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// sealedPrefix marks a secret sealed by Seal, followed by a NaCl anonymous
+// box (X25519, XSalsa20-Poly1305) holding the value.
+const sealedPrefix = "vault:box:"
+
+// boxKeySize is the size of NaCl box public and private keys.
+const boxKeySize = 32
+
+// GenerateBoxKey returns a new key pair for Seal and Open. The recipient
+// keeps privateKey secret, for example in its own vault, and hands
+// publicKey to whoever sends it secrets.
+func GenerateBoxKey() (publicKey, privateKey []byte, err error) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("vault: failed to generate key: %w", err)
+	}
+	return pub[:], priv[:], nil
+}
+
+// Seal returns the secret stored under service and key encrypted to the
+// holder of the private key matching recipientPubKey, a 32-byte NaCl box
+// public key such as GenerateBoxKey returns, to hand a single credential
+// to another machine or person over an untrusted channel. The blob uses an
+// anonymous box: only the recipient can open it and tampering is detected,
+// but it does not prove who sealed it, so authenticate the channel it
+// arrives through.
+func Seal(service, key string, recipientPubKey []byte) ([]byte, error) {
+	return std.SealContext(context.Background(), service, key, recipientPubKey)
+}
+
+// SealContext is like Seal but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage calls complete.
+func SealContext(ctx context.Context, service, key string, recipientPubKey []byte) ([]byte, error) {
+	return std.SealContext(ctx, service, key, recipientPubKey)
+}
+
+// Open decrypts blob, sealed by Seal to the public key matching privKey,
+// and stores the secret under service and key, which need not be the names
+// it was sealed from.
+func Open(service, key string, blob []byte, privKey []byte) error {
+	return std.OpenContext(context.Background(), service, key, blob, privKey)
+}
+
+// OpenContext is like Open but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage calls complete.
+func OpenContext(ctx context.Context, service, key string, blob []byte, privKey []byte) error {
+	return std.OpenContext(ctx, service, key, blob, privKey)
+}
+
+// Seal encrypts the secret under service and key to recipientPubKey, as
+// the package-level Seal does.
+func (v *Vault) Seal(service, key string, recipientPubKey []byte) ([]byte, error) {
+	return v.SealContext(context.Background(), service, key, recipientPubKey)
+}
+
+// SealContext is like Seal but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage calls complete.
+func (v *Vault) SealContext(ctx context.Context, service, key string, recipientPubKey []byte) ([]byte, error) {
+	if len(recipientPubKey) != boxKeySize {
+		return nil, fmt.Errorf("%w: recipient public key is %d bytes, want %d", ErrInvalidValue, len(recipientPubKey), boxKeySize)
+	}
+	value, err := v.GetContext(ctx, service, key)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := box.SealAnonymous([]byte(sealedPrefix), value, (*[boxKeySize]byte)(recipientPubKey), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to seal secret: %w", err)
+	}
+	return blob, nil
+}
+
+// Open decrypts blob with privKey and stores the secret under service and
+// key, as the package-level Open does.
+func (v *Vault) Open(service, key string, blob []byte, privKey []byte) error {
+	return v.OpenContext(context.Background(), service, key, blob, privKey)
+}
+
+// OpenContext is like Open but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage calls complete.
+func (v *Vault) OpenContext(ctx context.Context, service, key string, blob []byte, privKey []byte) error {
+	if len(privKey) != boxKeySize {
+		return fmt.Errorf("%w: private key is %d bytes, want %d", ErrInvalidValue, len(privKey), boxKeySize)
+	}
+	sealed, ok := bytes.CutPrefix(blob, []byte(sealedPrefix))
+	if !ok {
+		return fmt.Errorf("%w: not a sealed secret", ErrInvalidValue)
+	}
+
+	// OpenAnonymous also needs the recipient's public key
+	ecdhKey, err := ecdh.X25519().NewPrivateKey(privKey)
+	if err != nil {
+		return fmt.Errorf("%w: invalid private key: %w", ErrInvalidValue, err)
+	}
+	pub := (*[boxKeySize]byte)(ecdhKey.PublicKey().Bytes())
+	value, ok := box.OpenAnonymous(nil, sealed, pub, (*[boxKeySize]byte)(privKey))
+	if !ok {
+		return fmt.Errorf("%w: sealed secret does not open with this key or was tampered with", ErrInvalidValue)
+	}
+	return v.SetContext(ctx, service, key, value)
+}
@@ -0,0 +1,62 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	sender, _ := newTestVault(t)
+	recipient, _ := newTestVault(t)
+	value := []byte("api token \x00\xff")
+	if err := sender.Set(testService, "token", value); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	pub, priv, err := GenerateBoxKey()
+	if err != nil {
+		t.Fatalf("GenerateBoxKey failed: %v", err)
+	}
+	blob, err := sender.Seal(testService, "token", pub)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if bytes.Contains(blob, value) {
+		t.Error("sealed blob contains the plaintext value")
+	}
+
+	if err := recipient.Open(testService, "imported", blob, priv); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if got, err := recipient.Get(testService, "imported"); err != nil || !bytes.Equal(got, value) {
+		t.Errorf("Get after Open = %q, %v, want %q", got, err, value)
+	}
+
+	// Another key pair, a tampered blob and malformed keys are rejected
+	_, otherPriv, _ := GenerateBoxKey()
+	if err := recipient.Open(testService, "other", blob, otherPriv); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Open with another private key = %v, want ErrInvalidValue", err)
+	}
+	tampered := bytes.Clone(blob)
+	tampered[len(tampered)-1] ^= 1
+	if err := recipient.Open(testService, "other", tampered, priv); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Open of a tampered blob = %v, want ErrInvalidValue", err)
+	}
+	if err := recipient.Open(testService, "other", []byte("garbage"), priv); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Open of a foreign blob = %v, want ErrInvalidValue", err)
+	}
+	if _, err := recipient.Get(testService, "other"); err != ErrNotFound {
+		t.Errorf("failed Open stored a value: Get = %v, want ErrNotFound", err)
+	}
+	if _, err := sender.Seal(testService, "token", pub[:16]); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Seal with a short public key = %v, want ErrInvalidValue", err)
+	}
+	if err := recipient.Open(testService, "other", blob, nil); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Open without a private key = %v, want ErrInvalidValue", err)
+	}
+
+	if _, err := sender.Seal(testService, "missing", pub); err != ErrNotFound {
+		t.Errorf("Seal of a missing secret = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,355 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Client of secret-tool, the libsecret command-line tool, which interfaces
+// with the Secret Service API (GNOME Keyring, KWallet, etc.);
+// vault_linux.go backs the native backend with it when a Secret Service is
+// reachable. It has no build constraint, so that its command lines and
+// error parsing are tested on every platform with a stub CommandRunner.
+
+// WithSecretToolCollection stores new secrets on Linux in the Secret
+// Service collection named collection, such as "session" for one kept in
+// memory until logout, instead of the default collection, usually
+// "login". Lookups, deletions and lists search every collection.
+//
+// It needs a secret-tool recent enough to support store --collection,
+// which the backend detects once per process; with an older one Set
+// returns an error wrapping errors.ErrUnsupported. Other platforms, the
+// session keyring and the file storage ignore it.
+func WithSecretToolCollection(collection string) NativeOption {
+	return func(c *nativeConfig) {
+		c.secretToolCollection = collection
+	}
+}
+
+// secretToolStoreFlags caches the flags the installed secret-tool store
+// accepts. secret-tool has no version flag, so they are read from its help
+// once per process, the first time a flag that older versions lack is
+// needed.
+var secretToolStoreFlags struct {
+	mu    sync.Mutex
+	done  bool
+	flags string // store --help output
+}
+
+// secretToolSupports reports whether secret-tool store accepts flag.
+func secretToolSupports(ctx context.Context, flag string) (bool, error) {
+	secretToolStoreFlags.mu.Lock()
+	defer secretToolStoreFlags.mu.Unlock()
+	if !secretToolStoreFlags.done {
+		// The help goes to stdout, or to stderr along with a non-zero exit
+		// status when the usage is printed instead
+		stdout, stderr, err := runCommand(ctx, nil, "secret-tool", "store", "--help")
+		if err != nil && ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		secretToolStoreFlags.flags = string(stdout) + string(stderr)
+		secretToolStoreFlags.done = true
+	}
+	return strings.Contains(secretToolStoreFlags.flags, flag), nil
+}
+
+// secretToolKeyAttr returns the attribute holding the key of items: "key",
+// or "username" as go-keyring names it.
+func secretToolKeyAttr(ctx context.Context) string {
+	if nativeConfigFrom(ctx).goKeyring {
+		return "username"
+	}
+	return "key"
+}
+
+// secretToolLabel returns the label of the item for service and key, which
+// secret stores show users.
+func secretToolLabel(ctx context.Context, service, key string) string {
+	if nativeConfigFrom(ctx).goKeyring {
+		return fmt.Sprintf("Password for '%s' on '%s'", key, service)
+	}
+	return itemName(ctx, service, key)
+}
+
+// Secret Service implementation using secret-tool
+func setSecretTool(ctx context.Context, service, key string, value []byte) error {
+	attrs := []string{
+		"service", service,
+		secretToolKeyAttr(ctx), key,
+	}
+	if app := appIdentity(ctx); app != "" {
+		attrs = append(attrs, "app", app)
+	}
+	args := []string{"store", "--label", secretToolLabel(ctx, service, key)}
+	if collection := nativeConfigFrom(ctx).secretToolCollection; collection != "" {
+		supported, err := secretToolSupports(ctx, "--collection")
+		if err != nil {
+			return err
+		}
+		if !supported {
+			return fmt.Errorf("vault: the installed secret-tool does not support --collection, which WithSecretToolCollection needs: %w", errors.ErrUnsupported)
+		}
+		args = append(args, "--collection", collection)
+	}
+	args = append(args, attrs...)
+
+	// secret-tool only replaces an item with exactly the same attributes,
+	// so the items stored with others, such as another app identity, are
+	// found first and removed once the new value is stored: the old value
+	// stays readable until then, and is kept if the store fails
+	stale, replace := secretToolStale(ctx, attrs)
+	if err := storeSecretTool(ctx, args, value); err != nil {
+		return err
+	}
+	if replace {
+		// An item with fewer attributes, written before the app identity
+		// was recorded, matches every clear of the new one: remove both
+		// and store the value again
+		_ = deleteSecretTool(ctx, service, key)
+		return storeSecretTool(ctx, args, value)
+	}
+	for _, item := range stale {
+		_ = clearSecretTool(ctx, item)
+	}
+	return nil
+}
+
+// storeSecretTool runs secret-tool store with args, value on its input.
+func storeSecretTool(ctx context.Context, args []string, value []byte) error {
+	_, stderr, err := runCommand(ctx, encodeSecretToolValue(value), "secret-tool", args...)
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return err
+		}
+		return secretToolError("set key", stderr)
+	}
+	return nil
+}
+
+// secretToolStale returns the attributes, as clear takes them, of the
+// items matching the service and key of attrs but stored with other
+// attributes, and whether one of them has only a subset of attrs, so that
+// it can't be cleared alone. Errors are ignored: the store that follows
+// reports them.
+func secretToolStale(ctx context.Context, attrs []string) (stale [][]string, replace bool) {
+	stdout, _, err := runCommand(ctx, nil, "secret-tool", append([]string{"search", "--all"}, attrs[:4]...)...)
+	defer clear(stdout)
+	if err != nil {
+		return nil, false
+	}
+	want := map[string]string{}
+	for i := 0; i < len(attrs); i += 2 {
+		want[attrs[i]] = attrs[i+1]
+	}
+	for _, item := range parseSecretToolItems(stdout) {
+		delete(item, "xdg:schema")
+		if item[attrs[0]] != attrs[1] || item[attrs[2]] != attrs[3] || maps.Equal(item, want) {
+			continue
+		}
+		subset := true
+		var args []string
+		for name, value := range item {
+			if want[name] != value {
+				subset = false
+			}
+			args = append(args, name, value)
+		}
+		if subset {
+			return nil, true
+		}
+		stale = append(stale, args)
+	}
+	return stale, false
+}
+
+// clearSecretTool removes the items with the attributes attrs, given as
+// name, value pairs.
+func clearSecretTool(ctx context.Context, attrs []string) error {
+	_, stderr, err := runCommand(ctx, nil, "secret-tool", append([]string{"clear"}, attrs...)...)
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return err
+		}
+		return secretToolError("delete key", stderr)
+	}
+	return nil
+}
+
+// secretToolBinaryPrefix marks values stored base64-encoded. secret-tool
+// stores secrets as text: text values are kept as given, readable with
+// secret-tool and other Secret Service clients, but values containing NUL
+// bytes or invalid UTF-8 could be truncated or rejected, and are encoded.
+const secretToolBinaryPrefix = "vault:base64:"
+
+func encodeSecretToolValue(value []byte) []byte {
+	if utf8.Valid(value) && bytes.IndexByte(value, 0) < 0 && !bytes.HasPrefix(value, []byte(secretToolBinaryPrefix)) {
+		return value
+	}
+	return append([]byte(secretToolBinaryPrefix), base64.StdEncoding.EncodeToString(value)...)
+}
+
+func decodeSecretToolValue(stored []byte) ([]byte, error) {
+	encoded, ok := bytes.CutPrefix(stored, []byte(secretToolBinaryPrefix))
+	if !ok {
+		return stored, nil
+	}
+	value, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode value: %w", ErrCorrupt, err)
+	}
+	return value, nil
+}
+
+func getSecretTool(ctx context.Context, service, key string) ([]byte, error) {
+	stdout, stderr, err := runCommand(ctx, nil, "secret-tool", "lookup",
+		"service", service,
+		secretToolKeyAttr(ctx), key,
+	)
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return nil, err
+		}
+		if len(stdout) == 0 && !secretToolRefused(stderr) {
+			return nil, ErrNotFound
+		}
+		return nil, secretToolError("get key", stderr)
+	}
+
+	result := stdout
+	if len(result) == 0 {
+		return nil, ErrNotFound
+	}
+	return result, nil
+}
+
+func deleteSecretTool(ctx context.Context, service, key string) error {
+	return clearSecretTool(ctx, []string{
+		"service", service,
+		secretToolKeyAttr(ctx), key,
+	})
+}
+
+func metadataSecretTool(ctx context.Context, service, key string) (Metadata, error) {
+	stdout, stderr, err := runCommand(ctx, nil, "secret-tool", "search", "--all",
+		"service", service,
+		secretToolKeyAttr(ctx), key,
+	)
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return Metadata{}, err
+		}
+		if len(stdout) == 0 && len(stderr) == 0 {
+			return Metadata{}, ErrNotFound
+		}
+		return Metadata{}, secretToolError("get metadata", stderr)
+	}
+
+	if len(parseSecretToolAttribute(stdout, secretToolKeyAttr(ctx))) == 0 {
+		return Metadata{}, ErrNotFound
+	}
+	var md Metadata
+	if apps := parseSecretToolAttribute(stdout, "app"); len(apps) > 0 {
+		md.App = apps[0]
+	}
+	return md, nil
+}
+
+func listSecretTool(ctx context.Context, service string) ([]string, error) {
+	stdout, stderr, err := runCommand(ctx, nil, "secret-tool", "search", "--all",
+		"service", service,
+	)
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return nil, err
+		}
+		// secret-tool exits non-zero without output when nothing matches
+		if len(stdout) == 0 && len(stderr) == 0 {
+			return nil, nil
+		}
+		return nil, secretToolError("list keys", stderr)
+	}
+	return parseSecretToolSearch(stdout, secretToolKeyAttr(ctx)), nil
+}
+
+// secretToolDenied are the messages secret-tool prints when the Secret
+// Service refuses access: to a locked collection, when the unlock prompt
+// can't be shown or is dismissed, or by D-Bus policy.
+var secretToolDenied = []string{
+	"locked collection",
+	"org.freedesktop.Secret.Error.IsLocked",
+	"Operation was cancelled",
+	"org.freedesktop.DBus.Error.AccessDenied",
+}
+
+// secretToolRefused reports whether secret-tool failed because the Secret
+// Service refused access, from what it printed on standard error.
+func secretToolRefused(stderr []byte) bool {
+	for _, msg := range secretToolDenied {
+		if bytes.Contains(stderr, []byte(msg)) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretToolError returns the error for a failed secret-tool command,
+// from what it printed on standard error.
+func secretToolError(action string, stderr []byte) error {
+	if secretToolRefused(stderr) {
+		return fmt.Errorf("%w: failed to %s: %s", ErrAccessDenied, action, stderr)
+	}
+	return fmt.Errorf("vault: failed to %s: %s", action, stderr)
+}
+
+// parseSecretToolSearch extracts the key attribute, named keyAttr, of every
+// item printed by `secret-tool search`, which describes each match as:
+//
+//	[/org/freedesktop/secrets/collection/login/1]
+//	label = service/key
+//	...
+//	attribute.key = key
+//	attribute.service = service
+func parseSecretToolSearch(out []byte, keyAttr string) []string {
+	return parseSecretToolAttribute(out, keyAttr)
+}
+
+// parseSecretToolItems returns the attributes of every item printed by
+// `secret-tool search`.
+func parseSecretToolItems(out []byte) []map[string]string {
+	var items []map[string]string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			items = append(items, map[string]string{})
+			continue
+		}
+		attr, ok := strings.CutPrefix(line, "attribute.")
+		if !ok || len(items) == 0 {
+			continue
+		}
+		if name, value, ok := strings.Cut(attr, " = "); ok {
+			items[len(items)-1][name] = value
+		}
+	}
+	return items
+}
+
+// parseSecretToolAttribute returns the non-empty values of attribute name
+// of every item printed by `secret-tool search`.
+func parseSecretToolAttribute(out []byte, name string) []string {
+	prefix := "attribute." + name + " = "
+	var values []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), prefix); ok && value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
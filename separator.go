@@ -0,0 +1,52 @@
+package vault
+
+import "context"
+
+// defaultSeparator joins service and key in the names of items that have a
+// single name, such as Windows credential targets.
+const defaultSeparator = "/"
+
+// WithSeparator sets the separator joining service and key in the names
+// of items that have a single name: the Windows credential target and user
+// name, the IndexedDB record key in browsers, and the secret-tool label.
+// Use it to share items with tools that name them "service:key" or
+// "service.key". The default, and the value used when sep is "", is "/".
+//
+// The separator is not escaped unless WithEncodedNames is used, so a
+// service or key that contains it may collide with another pair: with "/",
+// service "a/b" and key "c" name the same item as service "a" and key
+// "b/c". Pick a separator that does not appear in your services, or encode
+// the names. The Keychain stores service and key as separate
+// attributes and the file storage uses its own naming, so neither is
+// affected.
+func WithSeparator(sep string) NativeOption {
+	return func(c *nativeConfig) {
+		c.separator = sep
+	}
+}
+
+// itemName returns the single name of the item for service and key under
+// the native configuration carried by ctx.
+func itemName(ctx context.Context, service, key string) string {
+	if nativeConfigFrom(ctx).encodedNames {
+		key = escapeName(key, separatorFrom(ctx))
+	}
+	return itemPrefix(ctx, service) + key
+}
+
+// itemPrefix returns the prefix shared by the names of service's items.
+func itemPrefix(ctx context.Context, service string) string {
+	sep := separatorFrom(ctx)
+	if nativeConfigFrom(ctx).encodedNames {
+		service = escapeName(service, sep)
+	}
+	return service + sep
+}
+
+// separatorFrom returns the separator of item names under ctx.
+func separatorFrom(ctx context.Context) string {
+	if sep := nativeConfigFrom(ctx).separator; sep != "" {
+		return sep
+	}
+	return defaultSeparator
+}
@@ -0,0 +1,59 @@
+package vault
+
+import (
+	"context"
+	"testing"
+)
+
+func TestItemName(t *testing.T) {
+	ctx := context.Background()
+	if got := itemName(ctx, "svc", "key"); got != "svc/key" {
+		t.Errorf("default itemName = %q, want %q", got, "svc/key")
+	}
+
+	for _, sep := range []string{":", ".", "::"} {
+		ctx := NativeBackend(WithSeparator(sep)).(nativeBackend).context(ctx)
+		if got, want := itemName(ctx, "svc", "key"), "svc"+sep+"key"; got != want {
+			t.Errorf("itemName with %q = %q, want %q", sep, got, want)
+		}
+		if got, want := itemPrefix(ctx, "svc"), "svc"+sep; got != want {
+			t.Errorf("itemPrefix with %q = %q, want %q", sep, got, want)
+		}
+	}
+
+	ctx = NativeBackend(WithSeparator("")).(nativeBackend).context(ctx)
+	if got := itemName(ctx, "svc", "key"); got != "svc/key" {
+		t.Errorf("itemName with empty separator = %q, want %q", got, "svc/key")
+	}
+}
+
+func TestEncodedNames(t *testing.T) {
+	ctx := NativeBackend(WithEncodedNames()).(nativeBackend).context(context.Background())
+	for _, tt := range []struct{ service, key, want string }{
+		{"svc", "key", "svc/key"},
+		{"a", "b/c", "a/b%2Fc"},
+		{"a/b", "c", "a%2Fb/c"},
+		{"my app", "clé.v1", "my%20app/cl%C3%A9%2Ev1"},
+		{"100%", "x", "100%25/x"},
+	} {
+		if got := itemName(ctx, tt.service, tt.key); got != tt.want {
+			t.Errorf("itemName(%q, %q) = %q, want %q", tt.service, tt.key, got, tt.want)
+		}
+		if got, ok := itemKey(ctx, tt.want, itemPrefix(ctx, tt.service)); !ok || got != tt.key {
+			t.Errorf("itemKey(%q) = %q, %v, want %q", tt.want, got, ok, tt.key)
+		}
+	}
+
+	// The separator is escaped too
+	ctx = NativeBackend(WithEncodedNames(), WithSeparator(":")).(nativeBackend).context(context.Background())
+	if got, want := itemName(ctx, "a:b", "c"), "a%3Ab:c"; got != want {
+		t.Errorf("itemName with %q = %q, want %q", ":", got, want)
+	}
+
+	// Unencoded names are not taken for encoded ones
+	for _, name := range []string{"b/c", "my key", "%2f", "%zz"} {
+		if key, ok := unescapeName(name, "/"); ok {
+			t.Errorf("unescapeName(%q) = %q, want not encoded", name, key)
+		}
+	}
+}
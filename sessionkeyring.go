@@ -0,0 +1,17 @@
+package vault
+
+// WithLinuxSessionKeyring stores secrets on Linux in the kernel session
+// keyring, through the keyctl system calls, instead of the Secret Service
+// or the file storage. Secrets there are never written to disk and vanish
+// when the login session ends, which suits ephemeral secrets such as
+// short-lived tokens. A process without a session keyring uses the user's
+// session keyring, which lasts until the user's last process exits.
+//
+// When the kernel keyring cannot be used, for example because a seccomp
+// profile blocks keyctl in a container, the usual storage is used
+// instead. Other platforms ignore it.
+func WithLinuxSessionKeyring() NativeOption {
+	return func(c *nativeConfig) {
+		c.linuxSessionKeyring = true
+	}
+}
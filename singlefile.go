@@ -0,0 +1,333 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Single-file encrypted storage. The file is a JSON document holding the
+// key header, as keyheader.go stores it, and the entries: a JSON object
+// mapping each service to an object mapping its keys to their values,
+// sealed as a whole with AES-256-GCM, so names are encrypted as well as
+// values. Every write rewrites the file atomically.
+
+const (
+	singleFileVersion = 1
+
+	// singleFileLockSuffix names the file, next to the vault file, that
+	// writes flock while they read and rewrite it.
+	singleFileLockSuffix = ".lock"
+)
+
+// singleFileDoc is the content of a single-file vault.
+type singleFileDoc struct {
+	Version int             `json:"version"`
+	Header  json.RawMessage `json:"header,omitempty"` // none with KeyHeaderPath or KeyHeaderIn
+	Entries []byte          `json:"entries,omitempty"`
+}
+
+// singleFileEntries are the decrypted entries of a single-file vault, by
+// service and key.
+type singleFileEntries map[string]map[string][]byte
+
+// NewEncryptedSingleFileBackend returns a Backend that keeps all its
+// secrets in the encrypted file at path, for portable vaults that can be
+// copied or backed up as one file, such as a vault per project. The key
+// is derived from passphrase as for NewEncryptedFileBackend, and the first
+// call for a path creates the file with its own key header; later calls
+// must use the same passphrase or get ErrWrongPassphrase. Each file is
+// independent of the others, so several can be open at once with
+// different passphrases.
+//
+// Services and keys are encrypted along with the values. Set and Del
+// decrypt the whole file and rewrite it atomically, replacing it with a
+// new file, so they cost time linear in the size of the vault and suit
+// vaults of up to a few thousand secrets. On Linux and macOS writes hold an
+// flock on path+".lock", so processes sharing the file don't lose each
+// other's writes.
+//
+// The options of NewEncryptedFileBackend apply, except ShardByService and
+// FileIndex, which return an error wrapping ErrInvalidValue. With
+// KeyHeaderPath or KeyHeaderIn the file holds the entries only. The
+// backend implements io.Closer: Close drops its key, after which its
+// operations return ErrClosed.
+func NewEncryptedSingleFileBackend(path string, passphrase []byte, opts ...EncryptedOption) (Backend, error) {
+	cfg, err := encryptedConfigFor(passphrase, opts)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.sharded || cfg.indexed || cfg.hashNames {
+		return nil, fmt.Errorf("%w: ShardByService, FileIndex and HashNames apply to storage directories", ErrInvalidValue)
+	}
+	if err := mkdirStorage(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	// Creating the file is not atomic: hold the lock so that a concurrent
+	// first open waits for it
+	unlock, err := lockFile(context.Background(), path+singleFileLockSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to lock vault file: %w", err)
+	}
+	defer unlock()
+
+	header := cfg.header
+	if header == nil {
+		header = singleFileHeader{path}
+	}
+	key, err := openCachedKey(header, passphrase, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &singleFileBackend{path: path, key: key}, nil
+}
+
+// singleFileHeader is the key header embedded in a single-file vault.
+type singleFileHeader struct {
+	path string
+}
+
+func (h singleFileHeader) load() ([]byte, error) {
+	doc, err := readSingleFile(h.path)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Header == nil {
+		return nil, fmt.Errorf("%w: vault file has no key header", ErrCorrupt)
+	}
+	return doc.Header, nil
+}
+
+// create writes a vault file without entries. The caller holds the lock.
+func (h singleFileHeader) create(data []byte) error {
+	if _, err := os.Lstat(h.path); err == nil {
+		return fs.ErrExist
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return writeSingleFile(h.path, singleFileDoc{Version: singleFileVersion, Header: data})
+}
+
+// readSingleFile reads and parses the vault file at path. Errors reading
+// it are returned as they are.
+func readSingleFile(path string) (singleFileDoc, error) {
+	data, err := readSecretFile(path)
+	if err != nil {
+		return singleFileDoc{}, err
+	}
+	var doc singleFileDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return singleFileDoc{}, fmt.Errorf("%w: invalid vault file: %w", ErrCorrupt, err)
+	}
+	if doc.Version != singleFileVersion {
+		return singleFileDoc{}, fmt.Errorf("vault: unsupported vault file version %d", doc.Version)
+	}
+	return doc, nil
+}
+
+func writeSingleFile(path string, doc singleFileDoc) error {
+	data, err := json.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+type singleFileBackend struct {
+	path string
+	key  *cachedKey
+	mu   sync.Mutex // serializes the rewrites of the process
+}
+
+func (b *singleFileBackend) Set(ctx context.Context, service, key string, value []byte) error {
+	if !validBackendKey(service, key) {
+		return ErrInvalidKey
+	}
+	if len(value) == 0 {
+		return ErrInvalidValue
+	}
+	return b.update(ctx, func(entries singleFileEntries) error {
+		keys := entries[service]
+		if keys == nil {
+			keys = make(map[string][]byte)
+			entries[service] = keys
+		}
+		clear(keys[key])
+		keys[key] = bytes.Clone(value)
+		return nil
+	})
+}
+
+func (b *singleFileBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	if !validBackendKey(service, key) {
+		return nil, ErrInvalidKey
+	}
+	var value []byte
+	err := b.view(ctx, func(entries singleFileEntries) error {
+		stored, ok := entries[service][key]
+		if !ok {
+			return ErrNotFound
+		}
+		value = bytes.Clone(stored)
+		return nil
+	})
+	return value, err
+}
+
+func (b *singleFileBackend) Del(ctx context.Context, service, key string) error {
+	if !validBackendKey(service, key) {
+		return ErrInvalidKey
+	}
+	return b.update(ctx, func(entries singleFileEntries) error {
+		keys := entries[service]
+		if _, ok := keys[key]; !ok {
+			return ErrNotFound
+		}
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(entries, service)
+		}
+		return nil
+	})
+}
+
+func (b *singleFileBackend) List(ctx context.Context, service string) ([]string, error) {
+	if service == "" {
+		return nil, ErrInvalidKey
+	}
+	var keys []string
+	err := b.view(ctx, func(entries singleFileEntries) error {
+		for key := range entries[service] {
+			if !isReservedKey(key) {
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	})
+	slices.Sort(keys)
+	return keys, err
+}
+
+// view calls fn with the entries of the file. The values are zeroed once
+// it returns.
+func (b *singleFileBackend) view(ctx context.Context, fn func(singleFileEntries) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	release, err := b.key.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, entries, err := b.read()
+	if err != nil {
+		return err
+	}
+	defer clearEntries(entries)
+	return fn(entries)
+}
+
+// update calls fn with the entries of the file, under the lock, and writes
+// them back unless it returns an error.
+func (b *singleFileBackend) update(ctx context.Context, fn func(singleFileEntries) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	release, err := b.key.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	unlock, err := lockFile(ctx, b.path+singleFileLockSuffix)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("vault: failed to lock vault file: %w", err)
+	}
+	defer unlock()
+
+	doc, entries, err := b.read()
+	if err != nil {
+		return err
+	}
+	defer clearEntries(entries)
+	if err := fn(entries); err != nil {
+		return err
+	}
+	return b.write(doc, entries)
+}
+
+// read returns the vault file and its decrypted entries. The caller holds
+// the key.
+func (b *singleFileBackend) read() (singleFileDoc, singleFileEntries, error) {
+	entries := make(singleFileEntries)
+	doc, err := readSingleFile(b.path)
+	if os.IsNotExist(err) {
+		// Not written yet, with a key header kept elsewhere
+		return singleFileDoc{Version: singleFileVersion}, entries, nil
+	}
+	if err != nil {
+		return doc, nil, fmt.Errorf("vault: failed to read vault file: %w", err)
+	}
+	if doc.Entries == nil {
+		return doc, entries, nil
+	}
+
+	aead := b.key.current()
+	if aead == nil {
+		return doc, nil, errKeyLocked
+	}
+	plain, err := aead.Open(nil, nil, doc.Entries, nil)
+	if err != nil {
+		return doc, nil, fmt.Errorf("%w: vault file entries failed authentication", ErrCorrupt)
+	}
+	defer clear(plain)
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return doc, nil, fmt.Errorf("%w: invalid vault file entries: %w", ErrCorrupt, err)
+	}
+	return doc, entries, nil
+}
+
+// write seals entries into doc and replaces the vault file with it. The
+// caller holds the key and the lock.
+func (b *singleFileBackend) write(doc singleFileDoc, entries singleFileEntries) error {
+	aead := b.key.current()
+	if aead == nil {
+		return errKeyLocked
+	}
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	doc.Entries = aead.Seal(nil, nil, plain, nil)
+	clear(plain)
+	if err := writeSingleFile(b.path, doc); err != nil {
+		return writeError("vault file", err)
+	}
+	return nil
+}
+
+// clearEntries zeroes the values of entries.
+func clearEntries(entries singleFileEntries) {
+	for _, keys := range entries {
+		for _, value := range keys {
+			clear(value)
+		}
+	}
+}
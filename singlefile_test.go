@@ -0,0 +1,116 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestEncryptedSingleFileBackend(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "project.vault")
+	value := []byte("hello 世界 \x00\xff secret")
+
+	backend, err := NewEncryptedSingleFileBackend(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("NewEncryptedSingleFileBackend failed: %v", err)
+	}
+	if err := backend.Set(ctx, testService, "api-token", value); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := backend.Set(ctx, testService, "other", []byte("x")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := backend.Del(ctx, testService, "other"); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if err := backend.Del(ctx, testService, "other"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Del of a deleted key = %v, want ErrNotFound", err)
+	}
+	if _, err := backend.Get(ctx, testService, "other"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a deleted key = %v, want ErrNotFound", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	for _, plain := range []string{testService, "api-token", "secret"} {
+		if bytes.Contains(data, []byte(plain)) {
+			t.Errorf("vault file contains %q in plain text", plain)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 2 {
+		t.Errorf("directory holds %d files, want the vault file and its lock", len(entries))
+	}
+
+	backend.(io.Closer).Close()
+	if _, err := NewEncryptedSingleFileBackend(path, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("reopening with another passphrase = %v, want ErrWrongPassphrase", err)
+	}
+	backend, err = NewEncryptedSingleFileBackend(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	got, err := backend.Get(ctx, testService, "api-token")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Fatalf("Get = %q, want %q", got, value)
+	}
+	keys, err := backend.List(ctx, testService)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if want := []string{"api-token"}; !slices.Equal(keys, want) {
+		t.Fatalf("List = %q, want %q", keys, want)
+	}
+
+	if _, err := NewEncryptedSingleFileBackend(path, []byte("correct horse"), ShardByService(true)); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("ShardByService = %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestEncryptedBackendsAreIndependent(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	open := []func(passphrase string) (Backend, error){
+		func(p string) (Backend, error) {
+			return NewEncryptedSingleFileBackend(filepath.Join(dir, "a.vault"), []byte(p))
+		},
+		func(p string) (Backend, error) {
+			return NewEncryptedSingleFileBackend(filepath.Join(dir, "b.vault"), []byte(p))
+		},
+		func(p string) (Backend, error) { return NewEncryptedFileBackend(filepath.Join(dir, "c"), []byte(p)) },
+		func(p string) (Backend, error) { return NewEncryptedFileBackend(filepath.Join(dir, "d"), []byte(p)) },
+	}
+	var backends []Backend
+	for i, opener := range open {
+		b, err := opener(string(rune('a' + i)))
+		if err != nil {
+			t.Fatalf("opening backend %d failed: %v", i, err)
+		}
+		if err := b.Set(ctx, testService, "key", []byte{byte(i)}); err != nil {
+			t.Fatalf("Set on backend %d failed: %v", i, err)
+		}
+		backends = append(backends, b)
+	}
+	for i, b := range backends {
+		got, err := b.Get(ctx, testService, "key")
+		if err != nil || !bytes.Equal(got, []byte{byte(i)}) {
+			t.Errorf("backend %d Get = %v, %v, want its own value", i, got, err)
+		}
+		if _, err := open[i]("z"); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("backend %d opened with another's passphrase: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// sizeLimiter is implemented by backends that know the largest value they
+// can store.
+type sizeLimiter interface {
+	maxValueSize(ctx context.Context) int
+}
+
+// MaxValueSize returns the size in bytes of the largest value the default
+// backend is expected to accept right now, so that callers can split large
+// data before storing it. It is advisory: some limits, such as free disk
+// space, change by the time Set runs, and backends that know of no limit
+// report math.MaxInt. Set checks values against it before calling the
+// backend and returns ErrValueTooLarge for larger ones. The limits are:
+//
+//   - Windows: 960 bytes, the CRED_MAX_CREDENTIAL_BLOB_SIZE of 2560 bytes
+//     holding the value as base64 in UTF-16.
+//   - macOS: 384 KiB, so that the base64 value passed to security as an
+//     argument stays well under ARG_MAX.
+//   - File storage: the free space of its directory, less the encoding
+//     overhead.
+//   - Secret Service, IndexedDB and the memory backend: no known limit.
+func MaxValueSize() int {
+	return std.MaxValueSize()
+}
+
+// MaxValueSize returns the size of the largest value the Vault's backend
+// is expected to accept, as the package-level MaxValueSize does.
+func (v *Vault) MaxValueSize() int {
+	if b, ok := v.store().(sizeLimiter); ok {
+		return b.maxValueSize(context.Background())
+	}
+	return math.MaxInt
+}
+
+// Size returns the length in bytes of the value stored under service and
+// key, to decide whether to load a large secret, or ErrNotFound if there
+// is none. The file storage and NewEncryptedFileBackend answer from their
+// index when they keep one (see SetFileIndex), without decoding the value;
+// without an index they read the file, and every other backend, such as
+// the Keychain or secret-tool, fetches the whole value as Get does, which
+// for the subprocess backends costs a process start.
+func Size(service, key string) (int, error) {
+	return std.SizeContext(context.Background(), service, key)
+}
+
+// SizeContext is like Size but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage call completes.
+func SizeContext(ctx context.Context, service, key string) (int, error) {
+	return std.SizeContext(ctx, service, key)
+}
+
+// Size returns the length of the value stored under service and key, as
+// the package-level Size does.
+func (v *Vault) Size(service, key string) (int, error) {
+	return v.SizeContext(context.Background(), service, key)
+}
+
+// SizeContext is like Size but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage call completes.
+func (v *Vault) SizeContext(ctx context.Context, service, key string) (int, error) {
+	if err := checkKey(service, key); err != nil {
+		return 0, err
+	}
+	if value, ok, err := v.envOverride(service, key); ok {
+		return len(value), err
+	}
+	ctx, done := v.start(ctx, "size", service, key)
+	b := v.store()
+	ms, mk, _ := v.storedKey(ctx, service, key)
+	size, err := storedSize(ctx, b, ms, mk)
+	done(err)
+	return size, err
+}
+
+// storedSize returns the length of the value stored in b under service and
+// key, from its metadata if b records the size.
+func storedSize(ctx context.Context, b Backend, service, key string) (int, error) {
+	if mg, ok := b.(metadataGetter); ok {
+		md, err := mg.metadata(ctx, service, key)
+		switch {
+		case err == nil && md.Size > 0:
+			if !md.Expires.IsZero() && !now().Before(md.Expires) {
+				return 0, ErrNotFound
+			}
+			return md.Size, nil
+		case err == ErrNotFound, ctx.Err() != nil:
+			return 0, err
+		}
+	}
+	value, err := b.Get(ctx, service, key)
+	if err == nil {
+		value, err = checkExpiry(ctx, b, service, key, value)
+	}
+	return len(value), err
+}
+
+// checkSize returns ErrValueTooLarge if value is larger than b expects to
+// accept, so that the value is rejected before the backend is called.
+func checkSize(ctx context.Context, b Backend, value []byte) error {
+	l, ok := b.(sizeLimiter)
+	if !ok {
+		return nil
+	}
+	if limit := l.maxValueSize(ctx); len(value) > limit {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrValueTooLarge, len(value), limit)
+	}
+	return nil
+}
+
+// base64ValueLimit returns the size of the largest value whose base64
+// encoding fits in n bytes.
+func base64ValueLimit(n uint64) uint64 {
+	return n / 4 * 3
+}
+
+func (b nativeBackend) maxValueSize(ctx context.Context) int {
+	ctx = b.context(ctx)
+	if files := activeFiles(ctx); files != nil {
+		return files.maxValueSize(ctx)
+	}
+	return maxNativeValueSize
+}
+
+func (b *encryptedBackend) maxValueSize(ctx context.Context) int {
+	return b.files.maxValueSize(ctx)
+}
+
+// maxValueSize returns the largest value that fits in the free space of
+// the storage directory once encoded, or math.MaxInt if the free space is
+// unknown.
+func (s *fileStore) maxValueSize(ctx context.Context) int {
+	dir, err := s.dir()
+	if err != nil {
+		return math.MaxInt
+	}
+	free, ok := freeSpace(dir)
+	if !ok {
+		return math.MaxInt
+	}
+	// Base64 is the larger of the encodings files use; encryption adds a
+	// constant overhead that is negligible next to disk space.
+	return int(min(base64ValueLimit(free), uint64(math.MaxInt)))
+}
@@ -0,0 +1,153 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMaxValueSize(t *testing.T) {
+	useMemory(t)
+	if got := MaxValueSize(); got != math.MaxInt {
+		t.Errorf("MaxValueSize of the memory backend = %d, want math.MaxInt", got)
+	}
+
+	SetDefaultBackend(nil)
+	if got := MaxValueSize(); got <= 0 {
+		t.Errorf("MaxValueSize of the native backend = %d, want a positive limit", got)
+	}
+}
+
+func TestFileStoreMaxValueSize(t *testing.T) {
+	s, _ := newTestFileStore(t)
+	got := s.maxValueSize(t.Context())
+	if got <= 0 {
+		t.Errorf("maxValueSize = %d, want the free space", got)
+	}
+	if free, ok := freeSpace(t.TempDir()); ok && uint64(got) > free {
+		t.Errorf("maxValueSize = %d, more than the %d bytes free", got, free)
+	}
+}
+
+// limitedBackend is a memory backend with a value size limit that counts
+// the values it is asked to set.
+type limitedBackend struct {
+	*MemoryBackend
+	limit int
+	sets  int
+}
+
+func (b *limitedBackend) Set(ctx context.Context, service, key string, value []byte) error {
+	b.sets++
+	return b.MemoryBackend.Set(ctx, service, key, value)
+}
+
+func (b *limitedBackend) maxValueSize(context.Context) int {
+	return b.limit
+}
+
+func TestSetValueTooLargePreflight(t *testing.T) {
+	b := &limitedBackend{MemoryBackend: NewMemoryBackend(), limit: 16}
+	SetDefaultBackend(b)
+	t.Cleanup(func() { SetDefaultBackend(nil) })
+
+	if got := MaxValueSize(); got != b.limit {
+		t.Fatalf("MaxValueSize = %d, want %d", got, b.limit)
+	}
+	if err := Set("svc", "key", make([]byte, b.limit)); err != nil {
+		t.Fatalf("Set at the limit: %v", err)
+	}
+	if b.sets != 1 {
+		t.Fatalf("backend got %d sets, want 1", b.sets)
+	}
+
+	err := Set("svc", "key", make([]byte, b.limit+1))
+	if !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Set over the limit: got %v, want ErrValueTooLarge", err)
+	}
+	// The TTL envelope counts towards the limit
+	err = SetWithTTL("svc", "key", make([]byte, b.limit), time.Hour)
+	if !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("SetWithTTL at the limit: got %v, want ErrValueTooLarge", err)
+	}
+	v, err := New(WithBackend(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("svc", "key", make([]byte, b.limit+1)); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Vault.Set over the limit: got %v, want ErrValueTooLarge", err)
+	}
+	if b.sets != 1 {
+		t.Fatalf("backend got %d sets, want oversized values rejected before it is called", b.sets)
+	}
+}
+
+func TestBase64ValueLimit(t *testing.T) {
+	for _, n := range []uint64{4, 5, 7, 8, 1000, 1280, 512 << 10} {
+		limit := base64ValueLimit(n)
+		if got := base64.StdEncoding.EncodedLen(int(limit)); uint64(got) > n {
+			t.Errorf("base64ValueLimit(%d) = %d, which encodes to %d bytes", n, limit, got)
+		}
+		if got := base64.StdEncoding.EncodedLen(int(limit) + 1); uint64(got) <= n {
+			t.Errorf("base64ValueLimit(%d) = %d, but %d bytes encode to %d", n, limit, limit+1, got)
+		}
+	}
+}
+
+// countingMemory counts the Get calls of a MemoryBackend, whose metadata
+// stays visible.
+type countingMemory struct {
+	*MemoryBackend
+	gets int
+}
+
+func (b *countingMemory) Get(ctx context.Context, service, key string) ([]byte, error) {
+	b.gets++
+	return b.MemoryBackend.Get(ctx, service, key)
+}
+
+func TestSize(t *testing.T) {
+	fastKDF(t)
+	counting := &countingMemory{MemoryBackend: NewMemoryBackend()}
+	encrypted, err := NewEncryptedFileBackend(t.TempDir(), []byte("passphrase"), FileIndex(true))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	for name, b := range map[string]Backend{"memory": counting, "encrypted": encrypted} {
+		t.Run(name, func(t *testing.T) {
+			v, err := New(WithBackend(b))
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			if err := v.Set(testService, "key", make([]byte, 1000)); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			if err := v.SetWithTTL(testService, "ttl", []byte("short"), time.Hour); err != nil {
+				t.Fatalf("SetWithTTL failed: %v", err)
+			}
+
+			if got, err := v.Size(testService, "key"); err != nil || got != 1000 {
+				t.Errorf("Size = %d, %v, want 1000", got, err)
+			}
+			// The TTL is not part of the value
+			if got, err := v.Size(testService, "ttl"); err != nil || got != 5 {
+				t.Errorf("Size of a secret with a TTL = %d, %v, want 5", got, err)
+			}
+			if _, err := v.Size(testService, "missing"); err != ErrNotFound {
+				t.Errorf("Size of a missing key = %v, want ErrNotFound", err)
+			}
+
+			setNow(t, time.Now().Add(2*time.Hour))
+			if _, err := v.Size(testService, "ttl"); err != ErrNotFound {
+				t.Errorf("Size of an expired secret = %v, want ErrNotFound", err)
+			}
+		})
+	}
+	// Answered from the metadata, without fetching the value
+	if counting.gets != 0 {
+		t.Errorf("Size fetched the value %d times", counting.gets)
+	}
+}
@@ -0,0 +1,130 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Source identifies where GetWithSource found a value.
+type Source struct {
+	// Name describes what served the value: "cache" for the Get cache,
+	// "env" for an override (see SetEnvOverrides), or the backend:
+	// "native", "memory", "encrypted-file", "systemd-credentials",
+	// "container-secrets", the String method of a Backend implementing
+	// fmt.Stringer, or else its Go type.
+	Name string
+
+	// Path is the position of the backend within the chain and mirrored
+	// backends it was reached through, outermost first: [1] is the second
+	// backend of a NewChainBackend, and [0, 1] the mirror of a
+	// NewMirroredBackend that is the first backend of a chain. It is
+	// empty when the Vault's backend served the value itself.
+	Path []int
+}
+
+// String returns the name of the source followed by its path, if any.
+func (s Source) String() string {
+	if len(s.Path) == 0 {
+		return s.Name
+	}
+	return fmt.Sprintf("%s at %v", s.Name, s.Path)
+}
+
+// GetWithSource is like Get but also reports where the value came from,
+// for diagnosing setups with several backends, such as a value served
+// from the cache or a stale mirror instead of the primary storage.
+func GetWithSource(service, key string) ([]byte, Source, error) {
+	return std.GetWithSourceContext(context.Background(), service, key)
+}
+
+// GetWithSourceContext is like GetWithSource but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage call
+// completes.
+func GetWithSourceContext(ctx context.Context, service, key string) ([]byte, Source, error) {
+	return std.GetWithSourceContext(ctx, service, key)
+}
+
+// GetWithSource retrieves the value stored under service and key and
+// reports where it came from, as the package-level GetWithSource does.
+func (v *Vault) GetWithSource(service, key string) ([]byte, Source, error) {
+	return v.GetWithSourceContext(context.Background(), service, key)
+}
+
+// GetWithSourceContext is like GetWithSource but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage call
+// completes.
+func (v *Vault) GetWithSourceContext(ctx context.Context, service, key string) ([]byte, Source, error) {
+	trace := &sourceTrace{}
+	value, err := v.get(context.WithValue(ctx, sourceKey{}, trace), service, key, false)
+	if err != nil {
+		return nil, Source{}, err
+	}
+	source := Source{Name: trace.name, Path: trace.path}
+	if source.Name == "" {
+		leaf := trace.leaf
+		if leaf == nil {
+			leaf = v.store()
+		}
+		source.Name = sourceName(leaf)
+	}
+	return value, source, nil
+}
+
+type sourceKey struct{}
+
+// sourceTrace collects the source of a value as the Get it is returned by
+// unwinds through the wrapping backends.
+type sourceTrace struct {
+	name string  // set when the Vault answered without its backend
+	leaf Backend // the backend that served the value, if below a composite
+	path []int
+}
+
+// traceServed records, for a GetWithSource under ctx, that the backend
+// named name answered without consulting the storage.
+func traceServed(ctx context.Context, name string) {
+	if trace, ok := ctx.Value(sourceKey{}).(*sourceTrace); ok {
+		trace.name = name
+	}
+}
+
+// traceChild records, for a GetWithSource under ctx, that a composite
+// backend returned the value of child, its backend at index. Composites
+// call it once the child returned a value, so inner ones record first.
+func traceChild(ctx context.Context, index int, child Backend) {
+	trace, ok := ctx.Value(sourceKey{}).(*sourceTrace)
+	if !ok {
+		return
+	}
+	if trace.leaf == nil {
+		trace.leaf = child
+	}
+	trace.path = slices.Insert(trace.path, 0, index)
+}
+
+// sourceName names b in a Source.
+func sourceName(b Backend) string {
+	switch b := b.(type) {
+	case nativeBackend:
+		return "native"
+	case *MemoryBackend:
+		return "memory"
+	case *encryptedBackend:
+		return "encrypted-file"
+	case systemdCredentials:
+		return "systemd-credentials"
+	case containerSecrets:
+		return "container-secrets"
+	case chainBackend:
+		return "chain"
+	case *mirroredBackend:
+		return "mirror"
+	case *restrictedBackend:
+		return sourceName(b.inner)
+	case fmt.Stringer:
+		return b.String()
+	default:
+		return fmt.Sprintf("%T", b)
+	}
+}
@@ -0,0 +1,47 @@
+package vault
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetWithSource(t *testing.T) {
+	ctx := context.Background()
+	first, second := NewMemoryBackend(), NewMemoryBackend()
+	second.Set(ctx, testService, "key", []byte("value"))
+	primary := NewMemoryBackend()
+	v, err := New(WithBackend(NewChainBackend(first, NewMirroredBackend(failingBackend{ErrBackendUnavailable}, second), primary)))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	value, source, err := v.GetWithSource(testService, "key")
+	if err != nil || string(value) != "value" {
+		t.Fatalf("GetWithSource = %q, %v, want value", value, err)
+	}
+	if source.Name != "memory" || !slices.Equal(source.Path, []int{1, 1}) {
+		t.Errorf("source = %v, want memory at [1 1]", source)
+	}
+
+	plain, _ := newTestVault(t)
+	if _, _, err := plain.GetWithSource(testService, "missing"); err != ErrNotFound {
+		t.Errorf("GetWithSource of a missing key = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetWithSourceCache(t *testing.T) {
+	v, _ := newTestVault(t, WithGetCache(time.Minute), WithEnvOverrides())
+	v.Set(testService, "key", []byte("value"))
+	if _, source, _ := v.GetWithSource(testService, "key"); source.String() != "memory" {
+		t.Errorf("first read source = %v, want memory", source)
+	}
+	if _, source, _ := v.GetWithSource(testService, "key"); source.String() != "cache" {
+		t.Errorf("second read source = %v, want cache", source)
+	}
+	t.Setenv(envOverrideName(testService, "key"), "overridden")
+	if _, source, _ := v.GetWithSource(testService, "key"); source.String() != "env" {
+		t.Errorf("overridden read source = %v, want env", source)
+	}
+}
@@ -0,0 +1,238 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// streamer is implemented by backends that can store and read values
+// without holding them in memory whole.
+type streamer interface {
+	setReader(ctx context.Context, service, key string, r io.Reader) error
+	getReader(ctx context.Context, service, key string) (io.ReadCloser, error)
+}
+
+// SetReader is like Set but reads the value from r. The file-based
+// backends (the Linux fallback, iOS, Android and NewEncryptedFileBackend)
+// stream it through the codec to storage, buffering at most a bounded
+// chunk, which suits large values such as certificates or keytabs. The
+// other backends read r fully and store the value as Set does. An empty
+// value returns ErrInvalidValue.
+func SetReader(service, key string, r io.Reader) error {
+	return SetReaderContext(context.Background(), service, key, r)
+}
+
+// SetReaderContext is like SetReader but stops reading and returns
+// ctx.Err() if ctx is done before the value is stored.
+func SetReaderContext(ctx context.Context, service, key string, r io.Reader) error {
+	if err := checkKey(service, key); err != nil {
+		return err
+	}
+
+	ctx, done := startOp(ctx, "set", service, key)
+	ms, mk := std.mapKey(service, key)
+	err := setReader(ctx, currentBackend(), ms, mk, r)
+	invalidateGetCache()
+	done(err)
+	return err
+}
+
+func setReader(ctx context.Context, b Backend, service, key string, r io.Reader) error {
+	if s, ok := b.(streamer); ok {
+		return s.setReader(ctx, service, key, r)
+	}
+	return setBuffered(ctx, b, service, key, r)
+}
+
+func setBuffered(ctx context.Context, b Backend, service, key string, r io.Reader) error {
+	value, err := io.ReadAll(&ctxReader{ctx: ctx, r: r})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("vault: failed to read value: %w", err)
+	}
+	return b.Set(ctx, service, key, value)
+}
+
+// GetWriter is like Get but writes the value to w. The file-based backends
+// stream it from storage through the codec, buffering at most a bounded
+// chunk; the other backends read it whole first. Encrypted values are
+// authenticated chunk by chunk, so if a stored value was tampered with, the
+// chunks before the damage may already have been written to w when
+// GetWriter returns the error.
+func GetWriter(service, key string, w io.Writer) error {
+	return GetWriterContext(context.Background(), service, key, w)
+}
+
+// GetWriterContext is like GetWriter but stops and returns ctx.Err() if
+// ctx is done before the value is written.
+func GetWriterContext(ctx context.Context, service, key string, w io.Writer) error {
+	if err := checkKey(service, key); err != nil {
+		return err
+	}
+
+	ctx, done := startOp(ctx, "get", service, key)
+	ms, mk := std.mapKey(service, key)
+	err := getWriter(ctx, currentBackend(), ms, mk, w)
+	done(err)
+	return err
+}
+
+func getWriter(ctx context.Context, b Backend, service, key string, w io.Writer) error {
+	var rc io.ReadCloser
+	if s, ok := b.(streamer); ok {
+		var err error
+		if rc, err = s.getReader(ctx, service, key); err != nil {
+			return err
+		}
+	} else {
+		value, err := b.Get(ctx, service, key)
+		if err != nil {
+			return err
+		}
+		rc = io.NopCloser(bytes.NewReader(value))
+	}
+	defer rc.Close()
+
+	// Values set with a TTL start with their expiry
+	br := bufio.NewReader(rc)
+	if head, _ := br.Peek(len(ttlMagic) + 8); len(head) > 0 {
+		if _, err := checkExpiry(ctx, b, service, key, head); err != nil {
+			return err
+		}
+		if _, _, ok := openTTL(head); ok {
+			br.Discard(len(head))
+		}
+	}
+
+	if _, err := io.Copy(w, &ctxReader{ctx: ctx, r: br}); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// ctxReader reads from r until ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// decodeErrReader labels the errors of a decoder as decoding failures,
+// which are ErrCorrupt.
+type decodeErrReader struct {
+	r io.Reader
+}
+
+func (r decodeErrReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: failed to decode secret: %w", ErrCorrupt, err)
+	}
+	return n, err
+}
+
+// setReader streams r through the codec into a secret's file, replacing it
+// atomically once the whole value has been written.
+func (s *fileStore) setReader(ctx context.Context, service, key string, r io.Reader) error {
+	sc, ok := asStreamCodec(s.codecFor(service, key))
+	if !ok {
+		value, err := io.ReadAll(&ctxReader{ctx: ctx, r: r})
+		if err != nil {
+			return fmt.Errorf("vault: failed to read value: %w", err)
+		}
+		if len(value) == 0 {
+			return ErrInvalidValue
+		}
+		return s.set(ctx, service, key, value)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := s.path(service, key)
+	if err != nil {
+		return err
+	}
+	if err := mkdirStorage(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if err := s.nameAdded(path, service, key); err != nil {
+		return err
+	}
+
+	var n int64
+	err = writeFileAtomic(path, func(w io.Writer) error {
+		enc := sc.NewEncoder(w)
+		var err error
+		n, err = io.Copy(enc, &ctxReader{ctx: ctx, r: r})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrInvalidValue
+		}
+		return enc.Close()
+	})
+	switch {
+	case err == nil:
+	case err == ErrInvalidValue:
+		return err
+	case ctx.Err() != nil:
+		return ctx.Err()
+	default:
+		return writeError("secret", err)
+	}
+	setFileApp(path, appIdentity(ctx))
+	return s.indexSet(service, key, path, int(n), 0)
+}
+
+// getReader returns a reader of a secret's value decoded from its file.
+func (s *fileStore) getReader(ctx context.Context, service, key string) (io.ReadCloser, error) {
+	sc, ok := asStreamCodec(s.codecFor(service, key))
+	if !ok {
+		value, err := s.get(ctx, service, key)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(value)), nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path, err := s.path(service, key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := openSecretFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		if errors.Is(err, ErrInsecureStorage) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("vault: failed to read secret: %w", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{decodeErrReader{sc.NewDecoder(f)}, f}, nil
+}
@@ -0,0 +1,142 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func randomValue(t *testing.T, n int) []byte {
+	value := make([]byte, n)
+	rand.Read(value)
+	return value
+}
+
+func TestFileStoreStream(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestFileStore(t)
+
+	for _, n := range []int{1, 1000, 3*streamChunkSize + 17} {
+		value := randomValue(t, n)
+		// Hide the length and type of the source from io.Copy
+		if err := s.setReader(ctx, "svc", "blob", io.MultiReader(bytes.NewReader(value))); err != nil {
+			t.Fatalf("setReader(%d bytes) failed: %v", n, err)
+		}
+
+		rc, err := s.getReader(ctx, "svc", "blob")
+		if err != nil {
+			t.Fatalf("getReader failed: %v", err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(got, value) {
+			t.Errorf("streamed %d bytes back as %d bytes, %v", n, len(got), err)
+		}
+
+		// The buffered path reads the same entry
+		if got, err := s.get(ctx, "svc", "blob"); err != nil || !bytes.Equal(got, value) {
+			t.Errorf("get of streamed %d bytes returned %d bytes, %v", n, len(got), err)
+		}
+	}
+
+	if err := s.setReader(ctx, "svc", "empty", strings.NewReader("")); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("setReader of empty value: expected ErrInvalidValue, got %v", err)
+	}
+	if _, err := s.getReader(ctx, "svc", "missing"); err != ErrNotFound {
+		t.Errorf("getReader of missing key: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestEncryptedStream(t *testing.T) {
+	fastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	b, err := NewEncryptedFileBackend(dir, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+
+	for _, n := range []int{1, streamChunkSize, 2*streamChunkSize + 5} {
+		value := randomValue(t, n)
+		if err := setReader(ctx, b, testService, "blob", bytes.NewReader(value)); err != nil {
+			t.Fatalf("setReader(%d bytes) failed: %v", n, err)
+		}
+		var buf bytes.Buffer
+		if err := getWriter(ctx, b, testService, "blob", &buf); err != nil || !bytes.Equal(buf.Bytes(), value) {
+			t.Errorf("streamed %d bytes back as %d bytes, %v", n, buf.Len(), err)
+		}
+		if got, err := b.Get(ctx, testService, "blob"); err != nil || !bytes.Equal(got, value) {
+			t.Errorf("Get of streamed %d bytes returned %d bytes, %v", n, len(got), err)
+		}
+	}
+
+	data, err := os.ReadFile(secretFile(dir, testService, "blob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), encryptedStreamPrefix) {
+		t.Fatalf("streamed entry lacks the stream prefix")
+	}
+	codec := b.(*encryptedBackend).files.codec
+
+	// Dropping the last chunk is detected
+	frames, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(string(data), encryptedStreamPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offsets []int
+	for off := 0; off < len(frames); off += 4 + int(binary.BigEndian.Uint32(frames[off:])) {
+		offsets = append(offsets, off)
+	}
+	truncated := encryptedStreamPrefix + base64.StdEncoding.EncodeToString(frames[:offsets[len(offsets)-1]])
+	if _, err := codec.Decode([]byte(truncated)); err == nil {
+		t.Error("Decode of truncated stream succeeded")
+	}
+
+	// So is tampering with a chunk
+	frames[offsets[1]+10] ^= 1
+	tampered := encryptedStreamPrefix + base64.StdEncoding.EncodeToString(frames)
+	if _, err := codec.Decode([]byte(tampered)); err == nil {
+		t.Error("Decode of tampered stream succeeded")
+	}
+}
+
+func TestSetReaderBuffered(t *testing.T) {
+	useMemory(t)
+	service := "vault-test-stream-service"
+	start := time.Unix(1_700_000_000, 0)
+	setNow(t, start)
+
+	if err := SetReader(service, "key", strings.NewReader("value")); err != nil {
+		t.Fatalf("SetReader failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := GetWriter(service, "key", &buf); err != nil || buf.String() != "value" {
+		t.Errorf("GetWriter = %q, %v, want value", buf.String(), err)
+	}
+
+	// GetWriter honors TTLs
+	if err := SetWithTTL(service, "token", []byte("secret"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := GetWriter(service, "token", &buf); err != nil || buf.String() != "secret" {
+		t.Errorf("GetWriter of TTL secret = %q, %v, want secret", buf.String(), err)
+	}
+	setNow(t, start.Add(time.Hour))
+	if err := GetWriter(service, "token", &buf); err != ErrNotFound {
+		t.Errorf("GetWriter of expired secret: expected ErrNotFound, got %v", err)
+	}
+
+	if err := SetReader(service, "", strings.NewReader("value")); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("SetReader with empty key: expected ErrInvalidKey, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NewSystemdCredentialsBackend returns a read-only Backend serving the
+// credentials systemd passes to a service, with LoadCredential=,
+// LoadCredentialEncrypted= or SetCredential=, from the directory named by
+// $CREDENTIALS_DIRECTORY. The secret of service and key is the credential
+// named "<service>_<key>", so
+//
+//	LoadCredentialEncrypted=myapp_api-token:/etc/credstore.encrypted/myapp_api-token
+//
+// is read with Get("myapp", "api-token"). Credentials are returned as
+// systemd decrypted them. A missing credential, or a process not started
+// with credentials, returns ErrNotFound, and Set and Del return
+// ErrReadOnly, so the backend is meant to be put in front of writable
+// storage with NewChainBackend. List returns the keys of the credentials
+// named after the service; since the separator is not escaped, a service
+// containing "_" also lists the credentials of services it prefixes.
+//
+// The directory is looked up when the backend is created.
+func NewSystemdCredentialsBackend() Backend {
+	return systemdCredentials{dir: os.Getenv("CREDENTIALS_DIRECTORY")}
+}
+
+type systemdCredentials struct {
+	dir string // "": no credentials
+}
+
+// path returns the file holding the credential of service and key. ok is
+// false if there can be no such credential.
+func (b systemdCredentials) path(service, key string) (string, bool) {
+	name := service + "_" + key
+	if b.dir == "" || strings.ContainsAny(name, `/\`) {
+		return "", false
+	}
+	return filepath.Join(b.dir, name), true
+}
+
+func (b systemdCredentials) Set(context.Context, string, string, []byte) error {
+	return fmt.Errorf("%w: systemd credentials", ErrReadOnly)
+}
+
+func (b systemdCredentials) Get(ctx context.Context, service, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path, ok := b.path(service, key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	value, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("vault: failed to read credential: %w", err)
+	}
+	return value, nil
+}
+
+func (b systemdCredentials) Del(context.Context, string, string) error {
+	return fmt.Errorf("%w: systemd credentials", ErrReadOnly)
+}
+
+func (b systemdCredentials) List(ctx context.Context, service string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if b.dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("vault: failed to read credentials directory: %w", err)
+	}
+	var keys []string
+	for _, entry := range entries {
+		if key, ok := strings.CutPrefix(entry.Name(), service+"_"); ok && key != "" && !entry.IsDir() {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,54 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSystemdCredentials(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, value := range map[string]string{
+		"myapp_api-token": "token\n",
+		"myapp_db":        "password",
+		"other_key":       "other",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o400); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+	b := NewSystemdCredentialsBackend()
+
+	if got, err := b.Get(ctx, "myapp", "api-token"); err != nil || string(got) != "token\n" {
+		t.Errorf("Get = %q, %v, want the credential as is", got, err)
+	}
+	for _, key := range []string{"missing", "../other_key"} {
+		if _, err := b.Get(ctx, "myapp", key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q): expected ErrNotFound, got %v", key, err)
+		}
+	}
+	if keys, err := b.List(ctx, "myapp"); err != nil || !slices.Equal(slices.Sorted(slices.Values(keys)), []string{"api-token", "db"}) {
+		t.Errorf("List = %q, %v, want [api-token db]", keys, err)
+	}
+	if err := b.Set(ctx, "myapp", "db", []byte("new")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Set: expected ErrReadOnly, got %v", err)
+	}
+	if err := b.Del(ctx, "myapp", "db"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Del: expected ErrReadOnly, got %v", err)
+	}
+
+	// Outside systemd there are no credentials
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+	b = NewSystemdCredentialsBackend()
+	if _, err := b.Get(ctx, "myapp", "db"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get without credentials: expected ErrNotFound, got %v", err)
+	}
+	if keys, err := b.List(ctx, "myapp"); err != nil || len(keys) != 0 {
+		t.Errorf("List without credentials = %q, %v, want none", keys, err)
+	}
+}
@@ -0,0 +1,301 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// ttlMagic starts a value stored with an expiry: the magic is followed by
+// the expiry time in Unix nanoseconds as a big-endian uint64, then the
+// value. The leading NUL keeps it from colliding with text values.
+const ttlMagic = "\x00vault:ttl\x00"
+
+// maxTTLJitter is the largest fraction of a TTL SetTTLJitter applies.
+const maxTTLJitter = 0.5
+
+// now returns the current time; tests replace it.
+var now = time.Now
+
+var ttlJitter atomic.Uint64 // math.Float64bits of the jitter fraction
+
+// SetWithTTL is like Set but the secret expires after ttl: once it has
+// expired, Get returns ErrNotFound and removes it. Expiry is checked when
+// the secret is read, not by a background process.
+func SetWithTTL(service, key string, value []byte, ttl time.Duration) error {
+	return SetWithTTLContext(context.Background(), service, key, value, ttl)
+}
+
+// SetWithTTLContext is like SetWithTTL but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage call
+// completes.
+func SetWithTTLContext(ctx context.Context, service, key string, value []byte, ttl time.Duration) error {
+	return std.SetWithTTLContext(ctx, service, key, value, ttl)
+}
+
+// SetWithTTL is like Set but the secret expires after ttl, as with the
+// package-level SetWithTTL.
+func (v *Vault) SetWithTTL(service, key string, value []byte, ttl time.Duration) error {
+	return v.SetWithTTLContext(context.Background(), service, key, value, ttl)
+}
+
+// SetWithTTLContext is like SetWithTTL but aborts the operation and
+// returns ctx.Err() if ctx is done before the underlying storage call
+// completes.
+func (v *Vault) SetWithTTLContext(ctx context.Context, service, key string, value []byte, ttl time.Duration) error {
+	if err := checkTTL(ttl); err != nil {
+		return err
+	}
+	if err := checkValue(value); err != nil {
+		return err
+	}
+	expires := now().Add(jitterTTL(ttl))
+	if err := v.SetContext(ctx, service, key, sealTTL(value, expires)); err != nil {
+		return err
+	}
+	v.expiryArmed(service, key, expires)
+	return nil
+}
+
+// Touch sets the expiry of the secret stored under service and key to ttl
+// from now, keeping its value, for sliding-expiration caches that extend a
+// secret's life on each use. A secret set without a TTL gets one. It
+// returns ErrNotFound if the secret does not exist or has already expired.
+// The secret is rewritten with its new expiry, which updates its
+// modification time.
+func Touch(service, key string, ttl time.Duration) error {
+	return std.TouchContext(context.Background(), service, key, ttl)
+}
+
+// TouchContext is like Touch but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage calls complete.
+func TouchContext(ctx context.Context, service, key string, ttl time.Duration) error {
+	return std.TouchContext(ctx, service, key, ttl)
+}
+
+// Touch sets the expiry of the secret stored under service and key to ttl
+// from now, as the package-level Touch does.
+func (v *Vault) Touch(service, key string, ttl time.Duration) error {
+	return v.TouchContext(context.Background(), service, key, ttl)
+}
+
+// TouchContext is like Touch but aborts the operation and returns
+// ctx.Err() if ctx is done before the underlying storage calls complete.
+func (v *Vault) TouchContext(ctx context.Context, service, key string, ttl time.Duration) error {
+	if err := checkKey(service, key); err != nil {
+		return err
+	}
+	if err := checkTTL(ttl); err != nil {
+		return err
+	}
+
+	ctx, done := v.start(ctx, "touch", service, key)
+	b := v.store()
+	ms, mk := v.mapKey(service, key)
+	stored, err := b.Get(ctx, ms, mk)
+	if err == nil {
+		var value []byte
+		if value, err = checkExpiry(ctx, b, ms, mk, stored); err == nil {
+			expires := now().Add(ttl)
+			stored := sealTTL(value, expires)
+			if err = b.Set(ctx, ms, mk, stored); err == nil {
+				v.expiryArmed(service, key, expires)
+				v.backupChanged(b, ms)
+				err = v.tagOwner(ctx, b, ms, mk, stored)
+			}
+		} else {
+			v.expired(service, key)
+		}
+	}
+	v.cache.invalidate()
+	done(err)
+	return err
+}
+
+// PurgeExpired removes the secrets of service whose TTL has passed and
+// returns how many it removed, for programs such as cron jobs that want to
+// clean up without waiting for the secrets to be read. Secrets without a
+// TTL are left alone. TTLs are stored with the values, so every backend
+// supports it.
+func PurgeExpired(service string) (int, error) {
+	return std.PurgeExpiredContext(context.Background(), service)
+}
+
+// PurgeExpiredContext is like PurgeExpired but stops and returns ctx.Err()
+// once ctx is done, along with the number of secrets removed so far.
+func PurgeExpiredContext(ctx context.Context, service string) (int, error) {
+	return std.PurgeExpiredContext(ctx, service)
+}
+
+// PurgeExpired removes the expired secrets of service, as the package-level
+// PurgeExpired does.
+func (v *Vault) PurgeExpired(service string) (int, error) {
+	return v.PurgeExpiredContext(context.Background(), service)
+}
+
+// PurgeExpiredContext is like PurgeExpired but stops and returns ctx.Err()
+// once ctx is done, along with the number of secrets removed so far.
+func (v *Vault) PurgeExpiredContext(ctx context.Context, service string) (int, error) {
+	if err := checkService(service); err != nil {
+		return 0, err
+	}
+
+	ctx, done := v.start(ctx, "purge", service, "")
+	b := v.store()
+	ms := v.mapService(service)
+	n, err := purgeExpired(ctx, b, ms, func(key string) {
+		v.expired(service, key)
+	})
+	if n > 0 {
+		v.cache.invalidate()
+		v.backupChanged(b, ms)
+	}
+	done(err)
+	return n, err
+}
+
+// expiryIndexer is implemented by backends that can tell which secrets
+// have expired without reading them.
+type expiryIndexer interface {
+	// expiring returns the keys of service whose expiry has passed. ok is
+	// false if the backend can't tell right now.
+	expiring(ctx context.Context, service string) (keys []string, ok bool, err error)
+}
+
+// purgeExpired removes the expired secrets of service from b, calling
+// removed with the key of each.
+func purgeExpired(ctx context.Context, b Backend, service string, removed func(key string)) (int, error) {
+	var keys []string
+	var err error
+	ok := false
+	if idx, isIndexer := b.(expiryIndexer); isIndexer {
+		// Only the candidates are read, to check their expiry
+		keys, ok, err = idx.expiring(ctx, service)
+	}
+	if !ok && err == nil {
+		keys, err = b.List(ctx, service)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, key := range withoutReservedKeys(keys) {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		ok, err := removeExpired(ctx, b, service, key, false)
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			continue
+		}
+		removed(key)
+		n++
+	}
+	return n, nil
+}
+
+// SetTTLJitter makes SetWithTTL shorten every TTL by a random amount of up
+// to fraction of it, so that secrets set together, such as a batch of
+// refreshed tokens, do not all expire at the same moment. fraction is
+// clamped to [0, 0.5]; 0, the default, disables jitter. A secret never
+// lives longer than the TTL it was set with.
+func SetTTLJitter(fraction float64) {
+	fraction = min(max(fraction, 0), maxTTLJitter)
+	ttlJitter.Store(math.Float64bits(fraction))
+}
+
+func jitterTTL(ttl time.Duration) time.Duration {
+	fraction := math.Float64frombits(ttlJitter.Load())
+	if fraction == 0 {
+		return ttl
+	}
+	return ttl - time.Duration(rand.Float64()*fraction*float64(ttl))
+}
+
+func sealTTL(value []byte, expires time.Time) []byte {
+	out := make([]byte, 0, len(ttlMagic)+8+len(value))
+	out = append(out, ttlMagic...)
+	out = binary.BigEndian.AppendUint64(out, uint64(expires.UnixNano()))
+	return append(out, value...)
+}
+
+// openTTL splits a value stored by SetWithTTL into the value and its
+// expiry. ok is false for values stored without a TTL.
+func openTTL(stored []byte) (value []byte, expires time.Time, ok bool) {
+	rest, ok := bytes.CutPrefix(stored, []byte(ttlMagic))
+	if !ok || len(rest) < 8 {
+		return stored, time.Time{}, false
+	}
+	expires = time.Unix(0, int64(binary.BigEndian.Uint64(rest)))
+	return rest[8:], expires, true
+}
+
+// checkExpiry returns the value of a secret read from b, or ErrNotFound
+// if its TTL has passed, after removing it from b unless b holds a value
+// that hasn't expired by now, such as one another process just set.
+func checkExpiry(ctx context.Context, b Backend, service, key string, stored []byte) ([]byte, error) {
+	value, err := openExpiry(stored)
+	if err != nil {
+		_, _ = removeExpired(ctx, b, service, key, false)
+	}
+	return value, err
+}
+
+// checkExpiryLocked is checkExpiry for a caller holding the lock of b.
+func checkExpiryLocked(ctx context.Context, b Backend, service, key string, stored []byte) ([]byte, error) {
+	value, err := openExpiry(stored)
+	if err != nil {
+		_, _ = removeExpired(ctx, b, service, key, true)
+	}
+	return value, err
+}
+
+// openExpiry returns the value of a secret as stored, or ErrNotFound if
+// its TTL has passed.
+func openExpiry(stored []byte) ([]byte, error) {
+	value, expires, ok := openTTL(stored)
+	if !ok {
+		return stored, nil
+	}
+	if !now().Before(expires) {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+// removeExpired deletes the secret stored in b under service and key if
+// it has expired, and reports whether it did. The secret is read again
+// first, under the lock of b unless the caller holds it: the value that
+// was found expired may have been replaced since.
+func removeExpired(ctx context.Context, b Backend, service, key string, locked bool) (bool, error) {
+	if l, isLocker := b.(locker); isLocker && !locked {
+		unlock, err := l.lock(ctx)
+		if err != nil {
+			return false, err
+		}
+		defer unlock()
+	}
+	stored, err := b.Get(ctx, service, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil // removed meanwhile
+	}
+	if err != nil {
+		return false, err
+	}
+	defer clear(stored)
+	if _, err := openExpiry(stored); err == nil {
+		return false, nil
+	}
+	if err := b.Del(ctx, service, key); err != nil && !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+	return true, nil
+}
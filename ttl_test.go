@@ -0,0 +1,219 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// setNow fixes the clock for the duration of a test.
+func setNow(t *testing.T, tm time.Time) {
+	old := now
+	now = func() time.Time { return tm }
+	t.Cleanup(func() { now = old })
+}
+
+func TestSetWithTTL(t *testing.T) {
+	useMemory(t)
+	service := "vault-test-ttl-service"
+	start := time.Unix(1_700_000_000, 0)
+	setNow(t, start)
+
+	if err := SetWithTTL(service, "token", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if got, err := Get(service, "token"); err != nil || string(got) != "value" {
+		t.Errorf("Get before expiry = %q, %v, want value", got, err)
+	}
+
+	setNow(t, start.Add(time.Minute))
+	if _, err := Get(service, "token"); err != ErrNotFound {
+		t.Errorf("Get after expiry: expected ErrNotFound, got %v", err)
+	}
+	// The expired secret was removed
+	if keys, err := List(service); err != nil || len(keys) != 0 {
+		t.Errorf("List after expiry = %q, %v, want none", keys, err)
+	}
+
+	if err := SetWithTTL(service, "token", []byte("value"), 0); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("SetWithTTL with zero TTL: expected ErrInvalidValue, got %v", err)
+	}
+}
+
+// replacedBackend returns stale from the first Get, as a read racing with
+// the write of the value it holds would.
+type replacedBackend struct {
+	Backend
+	stale []byte
+}
+
+func (b *replacedBackend) Get(ctx context.Context, service, key string) ([]byte, error) {
+	if stale := b.stale; stale != nil {
+		b.stale = nil
+		return stale, nil
+	}
+	return b.Backend.Get(ctx, service, key)
+}
+
+// TestExpiryKeepsNewValue checks that reading an expired value doesn't
+// remove the value stored meanwhile.
+func TestExpiryKeepsNewValue(t *testing.T) {
+	ctx := context.Background()
+	start := time.Unix(1_700_000_000, 0)
+	setNow(t, start)
+
+	// A stale entry of the cache
+	mem := NewMemoryBackend()
+	v, err := New(WithBackend(mem), WithGetCache(time.Hour))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := v.SetWithTTL(testService, "token", []byte("old"), time.Minute); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	if _, err := v.Get(testService, "token"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if err := mem.Set(ctx, testService, "token", []byte("new")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	setNow(t, start.Add(time.Minute))
+	if _, err := v.Get(testService, "token"); err != ErrNotFound {
+		t.Errorf("Get of an expired cached value = %v, want ErrNotFound", err)
+	}
+	if value, err := mem.Get(ctx, testService, "token"); err != nil || string(value) != "new" {
+		t.Errorf("stored value after an expired cache hit = %q, %v, want new", value, err)
+	}
+
+	// A read of the storage that raced with a write
+	b := &replacedBackend{Backend: NewMemoryBackend(), stale: sealTTL([]byte("old"), start)}
+	if err := b.Backend.Set(ctx, testService, "token", []byte("new")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if v, err = New(WithBackend(b)); err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, err := v.Get(testService, "token"); err != ErrNotFound {
+		t.Errorf("Get of an expired value = %v, want ErrNotFound", err)
+	}
+	if value, err := v.Get(testService, "token"); err != nil || string(value) != "new" {
+		t.Errorf("Get after reading an expired value = %q, %v, want new", value, err)
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	t.Cleanup(func() { SetTTLJitter(0) })
+
+	if got := jitterTTL(time.Hour); got != time.Hour {
+		t.Errorf("jitterTTL without jitter = %v, want 1h", got)
+	}
+
+	SetTTLJitter(2) // clamped to maxTTLJitter
+	spread := false
+	for range 100 {
+		got := jitterTTL(time.Hour)
+		if got > time.Hour || got < time.Hour/2 {
+			t.Fatalf("jitterTTL = %v, want between 30m and 1h", got)
+		}
+		if got != time.Hour {
+			spread = true
+		}
+	}
+	if !spread {
+		t.Error("jitterTTL never changed the TTL")
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	useMemory(t)
+	service := "vault-test-purge-service"
+	start := time.Unix(1_700_000_000, 0)
+	setNow(t, start)
+
+	if n, err := PurgeExpired(service); n != 0 || err != nil {
+		t.Errorf("PurgeExpired of an empty service = %d, %v, want 0, nil", n, err)
+	}
+
+	for key, ttl := range map[string]time.Duration{"short": time.Minute, "short2": time.Second, "long": time.Hour} {
+		if err := SetWithTTL(service, key, []byte("value"), ttl); err != nil {
+			t.Fatalf("SetWithTTL %s failed: %v", key, err)
+		}
+	}
+	if err := Set(service, "forever", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if n, err := PurgeExpired(service); n != 0 || err != nil {
+		t.Errorf("PurgeExpired before expiry = %d, %v, want 0, nil", n, err)
+	}
+
+	setNow(t, start.Add(time.Minute))
+	if n, err := PurgeExpired(service); n != 2 || err != nil {
+		t.Errorf("PurgeExpired = %d, %v, want 2, nil", n, err)
+	}
+	keys, err := List(service)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	slices.Sort(keys)
+	if want := []string{"forever", "long"}; !slices.Equal(keys, want) {
+		t.Errorf("List after PurgeExpired = %q, want %q", keys, want)
+	}
+
+	if _, err := PurgeExpired(""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("PurgeExpired with empty service: expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	useMemory(t)
+	service := "vault-test-ttl-service"
+	start := time.Unix(1_700_000_000, 0)
+	setNow(t, start)
+
+	if err := SetWithTTL(service, "token", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	// Each touch extends the TTL from the time of the touch
+	for i := range 3 {
+		setNow(t, start.Add(time.Duration(i+1)*50*time.Second))
+		if err := Touch(service, "token", time.Minute); err != nil {
+			t.Fatalf("Touch %d failed: %v", i, err)
+		}
+		if got, err := Get(service, "token"); err != nil || string(got) != "value" {
+			t.Fatalf("Get after Touch %d = %q, %v, want value", i, got, err)
+		}
+	}
+	setNow(t, start.Add(150*time.Second+time.Minute))
+	if _, err := Get(service, "token"); err != ErrNotFound {
+		t.Errorf("Get after the touched TTL: expected ErrNotFound, got %v", err)
+	}
+	if err := Touch(service, "token", time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Touch of a missing secret: expected ErrNotFound, got %v", err)
+	}
+
+	// A secret without a TTL gets one
+	if err := Set(service, "plain", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Touch(service, "plain", time.Minute); err != nil {
+		t.Fatalf("Touch of a secret without TTL failed: %v", err)
+	}
+	setNow(t, start.Add(10*time.Minute))
+	if _, err := Get(service, "plain"); err != ErrNotFound {
+		t.Errorf("Get after the TTL from Touch: expected ErrNotFound, got %v", err)
+	}
+	// An expired secret is not revived
+	if err := SetWithTTL(service, "token", []byte("value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	setNow(t, start.Add(20*time.Minute))
+	if err := Touch(service, "token", time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Touch of an expired secret: expected ErrNotFound, got %v", err)
+	}
+
+	if err := Touch(service, "token", 0); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Touch with zero TTL: expected ErrInvalidValue, got %v", err)
+	}
+}
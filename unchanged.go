@@ -0,0 +1,14 @@
+package vault
+
+import "sync/atomic"
+
+var skipUnchanged atomic.Bool
+
+// SkipUnchangedWrites makes Set on macOS read the Keychain item first and
+// leave it untouched when it already holds the same value and app
+// identity, instead of deleting and re-adding it. This avoids keychain
+// churn and the access prompts re-adding can trigger, at the cost of one
+// or two extra reads per Set. Other platforms ignore it.
+func SkipUnchangedWrites(enabled bool) {
+	skipUnchanged.Store(enabled)
+}
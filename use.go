@@ -0,0 +1,36 @@
+package vault
+
+import "context"
+
+// Use reads the secret stored under service and key, calls fn with it and
+// zeroes it as soon as fn returns or panics, to keep the secret in memory
+// no longer than it is needed. fn must not retain the slice. The error is
+// the one reading the secret, without calling fn, or the one fn returns.
+// Copies made by the storage, such as a subprocess's output, and the Get
+// cache (see SetGetCache) are beyond its reach.
+func Use(service, key string, fn func([]byte) error) error {
+	return std.UseContext(context.Background(), service, key, fn)
+}
+
+// UseContext is like Use but aborts the read and returns ctx.Err() if ctx
+// is done before the underlying storage call completes.
+func UseContext(ctx context.Context, service, key string, fn func([]byte) error) error {
+	return std.UseContext(ctx, service, key, fn)
+}
+
+// Use calls fn with the secret stored under service and key and zeroes it
+// afterwards, as the package-level Use does.
+func (v *Vault) Use(service, key string, fn func([]byte) error) error {
+	return v.UseContext(context.Background(), service, key, fn)
+}
+
+// UseContext is like Use but aborts the read and returns ctx.Err() if ctx
+// is done before the underlying storage call completes.
+func (v *Vault) UseContext(ctx context.Context, service, key string, fn func([]byte) error) error {
+	value, err := v.GetContext(ctx, service, key)
+	if err != nil {
+		return err
+	}
+	defer clear(value)
+	return fn(value)
+}
@@ -0,0 +1,57 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestUse(t *testing.T) {
+	v, _ := newTestVault(t)
+	if err := v.Set(testService, "key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	var seen, kept []byte
+	if err := v.Use(testService, "key", func(value []byte) error {
+		seen = bytes.Clone(value)
+		kept = value
+		return nil
+	}); err != nil {
+		t.Fatalf("Use failed: %v", err)
+	}
+	if string(seen) != "value" {
+		t.Errorf("fn got %q, want %q", seen, "value")
+	}
+	if !bytes.Equal(kept, make([]byte, len(kept))) {
+		t.Errorf("the value was not zeroed after fn returned: %q", kept)
+	}
+	if got, err := v.Get(testService, "key"); err != nil || string(got) != "value" {
+		t.Errorf("Get after Use = %q, %v, want the stored value intact", got, err)
+	}
+
+	// fn's error is returned, and a panic zeroes the value too
+	errFn := errors.New("fn failed")
+	if err := v.Use(testService, "key", func([]byte) error { return errFn }); err != errFn {
+		t.Errorf("Use = %v, want fn's error", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("the panic of fn did not propagate")
+			}
+		}()
+		v.Use(testService, "key", func(value []byte) error {
+			kept = value
+			panic("fn panicked")
+		})
+	}()
+	if !bytes.Equal(kept, make([]byte, len(kept))) {
+		t.Errorf("the value was not zeroed after fn panicked: %q", kept)
+	}
+
+	called := false
+	if err := v.Use(testService, "missing", func([]byte) error { called = true; return nil }); err != ErrNotFound || called {
+		t.Errorf("Use of a missing secret = %v, called fn: %v; want ErrNotFound without calling it", err, called)
+	}
+}
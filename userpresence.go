@@ -0,0 +1,26 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WithRequireUserPresence asks for secrets to be stored so that reading
+// them needs the user present: on macOS, a Keychain item whose access
+// control requires Touch ID or the login password on every read, so that
+// a Get prompts instead of succeeding silently.
+//
+// Setting an item's access control needs the Security framework's SecItem
+// API, through CGO, and supported hardware. The security command-line tool
+// the macOS backend runs only sets the list of trusted applications, and
+// no other platform has an equivalent, so with this option Set and
+// SetReader return an error wrapping errors.ErrUnsupported rather than
+// store a secret without the protection asked for. Get, Del and List are
+// unaffected.
+func WithRequireUserPresence() NativeOption {
+	return func(c *nativeConfig) {
+		c.userPresence = true
+	}
+}
+
+var errNoUserPresence = fmt.Errorf("vault: storing secrets that require user presence needs the Keychain SecItem API, which this build does not use: %w", errors.ErrUnsupported)
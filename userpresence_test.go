@@ -0,0 +1,24 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRequireUserPresence(t *testing.T) {
+	calls := stubCommands(t, cmdScript{})
+	b := NativeBackend(WithRequireUserPresence())
+	ctx := context.Background()
+
+	if err := b.Set(ctx, testService, "key", []byte("value")); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Set = %v, want ErrUnsupported", err)
+	}
+	if err := b.(nativeBackend).setReader(ctx, testService, "key", strings.NewReader("value")); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("setReader = %v, want ErrUnsupported", err)
+	}
+	if len(*calls) != 0 {
+		t.Errorf("ran %q, want nothing stored", *calls)
+	}
+}
@@ -0,0 +1,79 @@
+package vault
+
+import "time"
+
+// ValidationError reports which argument of an operation is invalid. It
+// wraps ErrInvalidKey for a bad service or key and ErrInvalidValue for a
+// bad value, so errors.Is keeps matching those:
+//
+//	var verr *vault.ValidationError
+//	if errors.As(err, &verr) {
+//		log.Printf("bad %s: %s", verr.Field, verr.Reason)
+//	}
+type ValidationError struct {
+	// Field is the invalid argument: "service", "key", "field", "value",
+	// "ttl" or "version".
+	Field string
+
+	// Reason says what is wrong with it, such as "is empty".
+	Reason string
+
+	// Err is ErrInvalidKey or ErrInvalidValue.
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error() + ": " + e.Field + " " + e.Reason
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// checkKey returns a *ValidationError if service and key cannot address a
+// secret.
+func checkKey(service, key string) error {
+	if err := checkService(service); err != nil {
+		return err
+	}
+	switch {
+	case key == "":
+		return &ValidationError{Field: "key", Reason: "is empty", Err: ErrInvalidKey}
+	case isReservedKey(key):
+		return &ValidationError{Field: "key", Reason: "is reserved", Err: ErrInvalidKey}
+	}
+	return nil
+}
+
+// checkService returns a *ValidationError if service cannot hold secrets.
+func checkService(service string) error {
+	if service == "" {
+		return &ValidationError{Field: "service", Reason: "is empty", Err: ErrInvalidKey}
+	}
+	return nil
+}
+
+// checkField returns a *ValidationError if field cannot name a field of a
+// secret.
+func checkField(field string) error {
+	if field == "" {
+		return &ValidationError{Field: "field", Reason: "is empty", Err: ErrInvalidKey}
+	}
+	return nil
+}
+
+// checkValue returns a *ValidationError if value cannot be stored.
+func checkValue(value []byte) error {
+	if len(value) == 0 {
+		return &ValidationError{Field: "value", Reason: "is empty", Err: ErrInvalidValue}
+	}
+	return nil
+}
+
+// checkTTL returns a *ValidationError if ttl is not a usable lifetime.
+func checkTTL(ttl time.Duration) error {
+	if ttl <= 0 {
+		return &ValidationError{Field: "ttl", Reason: "must be positive", Err: ErrInvalidValue}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidationError(t *testing.T) {
+	useMemory(t)
+
+	tests := []struct {
+		name      string
+		err       error
+		wantField string
+		wantIs    error
+	}{
+		{"empty service", Set("", "key", []byte("value")), "service", ErrInvalidKey},
+		{"empty key", Set(testService, "", []byte("value")), "key", ErrInvalidKey},
+		{"reserved key", Set(testService, schemaVersionKey, []byte("value")), "key", ErrInvalidKey},
+		{"empty value", Set(testService, "key", nil), "value", ErrInvalidValue},
+		{"zero ttl", SetWithTTL(testService, "key", []byte("value"), 0), "ttl", ErrInvalidValue},
+		{"list empty service", func() error { _, err := List(""); return err }(), "service", ErrInvalidKey},
+		{"get empty key", func() error { _, err := Get(testService, ""); return err }(), "key", ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.wantIs) {
+				t.Errorf("error = %v, want one matching %v", tt.err, tt.wantIs)
+			}
+			var verr *ValidationError
+			if !errors.As(tt.err, &verr) {
+				t.Fatalf("error %v is not a *ValidationError", tt.err)
+			}
+			if verr.Field != tt.wantField {
+				t.Errorf("Field = %q, want %q", verr.Field, tt.wantField)
+			}
+		})
+	}
+}
@@ -2,8 +2,13 @@
 // and delete secrets using platform-native secure storage.
 package vault
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
+// Errors returned by this package never include secret values, only
+// service and key names and the output of the tools it runs.
 var (
 	// ErrNotFound is returned when a key is not found in the vault.
 	ErrNotFound = errors.New("vault: key not found")
@@ -13,34 +18,179 @@ var (
 
 	// ErrInvalidValue is returned when a value is empty or invalid.
 	ErrInvalidValue = errors.New("vault: invalid value")
+
+	// ErrForbidden is returned when an operation is not permitted, such as
+	// accessing a service outside a restricted backend's allowlist, or
+	// deleting a secret another owner holds with DelAs.
+	ErrForbidden = errors.New("vault: forbidden")
+
+	// ErrInvalidRef is returned by Resolve when a reference is not a valid
+	// vault://service/key URI.
+	ErrInvalidRef = errors.New("vault: invalid reference")
+
+	// ErrSchemaVersion is returned by GetVersioned when a service's entries
+	// are at an older schema version than required.
+	ErrSchemaVersion = errors.New("vault: schema version too old")
+
+	// ErrBackendUnavailable is returned when the platform's storage cannot
+	// be used, such as a storage directory that cannot be created or
+	// written to, by the file storage and the file backends alike. It is
+	// distinct from ErrNotFound: a Set that fails with it tells nothing
+	// about the secret.
+	ErrBackendUnavailable = errors.New("vault: backend unavailable")
+
+	// ErrValueTooLarge is returned when a value exceeds what the backend
+	// can store. MaxValueSize reports the limit.
+	ErrValueTooLarge = errors.New("vault: value too large")
+
+	// ErrCorrupt is returned when a stored value cannot be decoded or
+	// decrypted, such as a file that was truncated or edited by hand. It is
+	// distinct from ErrNotFound so that callers can choose between deleting
+	// and regenerating the secret and reporting a hard error.
+	ErrCorrupt = errors.New("vault: corrupt value")
+
+	// ErrWrongPassphrase is returned when an encrypted backend is opened
+	// with a passphrase other than the one its key was created with.
+	ErrWrongPassphrase = errors.New("vault: wrong passphrase")
+
+	// ErrQuotaExceeded is returned when setting a new key would take a
+	// service over the limit set with WithMaxKeysPerService.
+	ErrQuotaExceeded = errors.New("vault: quota exceeded")
+
+	// ErrReadOnly is returned when writing to a backend that can only be
+	// read, such as NewSystemdCredentialsBackend.
+	ErrReadOnly = errors.New("vault: read-only backend")
+
+	// ErrAccessDenied is returned when the platform's credential store
+	// refuses access to an existing secret, such as a macOS Keychain item
+	// whose access control list doesn't include the calling binary and the
+	// user denies the prompt, or to a locked Secret Service collection whose
+	// unlock prompt is dismissed. Unlike ErrNotFound, the secret may exist;
+	// ask the user to grant access, for example with "Always Allow" in the
+	// prompt or in Keychain Access, or to unlock the keyring.
+	ErrAccessDenied = errors.New("vault: access denied")
+
+	// ErrClosed is returned by the operations of a Vault or backend after
+	// its Close method was called.
+	ErrClosed = errors.New("vault: closed")
+
+	// ErrSecretTooOld is never returned: it is the Err of the Events that
+	// report reading a secret older than the age set with WithMaxAge.
+	ErrSecretTooOld = errors.New("vault: secret too old")
+
+	// ErrInsecureStorage is returned when a file of the file storage or
+	// NewEncryptedFileBackend is a symbolic link, or anything other than a
+	// regular file, which someone with write access to the directory may
+	// have planted to make vault read or overwrite a file elsewhere.
+	ErrInsecureStorage = errors.New("vault: insecure storage file")
 )
 
 // Set stores a value securely in the platform's native secure storage.
 // The service parameter is used to namespace the keys.
+//
+// An existing value is replaced in a single write wherever the storage
+// allows it: the Keychain item is updated in place (security -U), which
+// keeps its access control list, and is only deleted and re-added if the
+// update fails; Windows CredWrite, the kernel session keyring and
+// IndexedDB put all overwrite; and storage files are replaced atomically
+// by renaming a new file over them. secret-tool store replaces an item
+// with the same attributes; items of the key stored with others, such as
+// another app identity, are removed after it, but one written before app
+// identities were recorded can't be told apart from the new item, and
+// the key is deleted and stored again, briefly missing.
 func Set(service, key string, value []byte) error {
-	if service == "" || key == "" {
-		return ErrInvalidKey
-	}
-	if len(value) == 0 {
-		return ErrInvalidValue
-	}
-	return set(service, key, value)
+	return SetContext(context.Background(), service, key, value)
 }
 
 // Get retrieves a value from the platform's native secure storage.
-// Returns ErrNotFound if the key does not exist.
+// Returns ErrNotFound if the key does not exist. Concurrent Gets of the
+// same key share one backend call, and each gets its own copy of the
+// value; GetFresh always makes its own call.
 func Get(service, key string) ([]byte, error) {
-	if service == "" || key == "" {
-		return nil, ErrInvalidKey
-	}
-	return get(service, key)
+	return GetContext(context.Background(), service, key)
 }
 
 // Del removes a value from the platform's native secure storage.
 // Returns ErrNotFound if the key does not exist.
 func Del(service, key string) error {
-	if service == "" || key == "" {
-		return ErrInvalidKey
+	return DelContext(context.Background(), service, key)
+}
+
+// DelIfExists is like Del but treats a missing key as already deleted: it
+// reports whether there was a value to remove, and returns ErrNotFound
+// never.
+func DelIfExists(service, key string) (bool, error) {
+	return std.DelIfExists(service, key)
+}
+
+// List returns the keys stored under service, sorted lexicographically
+// (by byte value) and each listed once, whatever order the backend
+// enumerates them in. A service without keys yields an empty list, not
+// ErrNotFound.
+func List(service string) ([]string, error) {
+	return ListContext(context.Background(), service)
+}
+
+// SetContext is like Set but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage call completes.
+func SetContext(ctx context.Context, service, key string, value []byte) error {
+	return std.SetContext(ctx, service, key, value)
+}
+
+// GetContext is like Get but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage call completes.
+func GetContext(ctx context.Context, service, key string) ([]byte, error) {
+	return std.GetContext(ctx, service, key)
+}
+
+// GetRaw returns the bytes a secret is stored as, before the package decodes
+// them: the base64 text in the Keychain, Credential Manager (as UTF-16LE),
+// IndexedDB or a storage file, or under secret-tool the value itself, base64
+// encoded behind a "vault:base64:" prefix if it is not NUL-free UTF-8. It is
+// a debugging aid for diagnosing decode failures and should not be used to
+// read secrets; the format is not stable. Like Get it returns ErrInvalidKey
+// and ErrNotFound. A default backend that does not keep encoded bytes, such
+// as one set with SetDefaultBackend outside this package, makes it return
+// an error wrapping errors.ErrUnsupported.
+func GetRaw(service, key string) ([]byte, error) {
+	if err := checkKey(service, key); err != nil {
+		return nil, err
+	}
+
+	b, ok := currentBackend().(rawGetter)
+	if !ok {
+		return nil, errNoRaw
+	}
+
+	ctx, done := startOp(context.Background(), "getraw", service, key)
+	ms, mk := std.mapKey(service, key)
+	value, err := b.getRaw(ctx, ms, mk)
+	done(err)
+	return value, err
+}
+
+// DelContext is like Del but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage call completes.
+func DelContext(ctx context.Context, service, key string) error {
+	return std.DelContext(ctx, service, key)
+}
+
+// ListContext is like List but aborts the operation and returns ctx.Err()
+// if ctx is done before the underlying storage call completes.
+func ListContext(ctx context.Context, service string) ([]string, error) {
+	return std.ListContext(ctx, service)
+}
+
+// Sync flushes the secrets written so far to stable storage. On the
+// file-based backends (the Linux fallback, iOS and Android) it fsyncs every
+// stored secret and the storage directory. On the other backends the
+// keychain, Credential Manager, Secret Service or browser manages
+// durability itself, and Sync is a no-op that returns nil. With a default
+// backend set by SetDefaultBackend, Sync flushes that backend if it is file
+// based and is otherwise a no-op.
+func Sync() error {
+	if b, ok := currentBackend().(syncer); ok {
+		return b.sync()
 	}
-	return del(service, key)
+	return nil
 }
@@ -2,89 +2,59 @@
 
 package vault
 
-import (
-	"bytes"
-	"encoding/base64"
-	"fmt"
-	"os/exec"
-	"strings"
-)
+import "context"
 
-// macOS implementation using the `security` command-line tool
-// which interfaces with the Keychain without requiring CGO.
-// Values are base64 encoded to handle binary data safely.
+// macOS implementation using the `security` command-line tool (see
+// keychain.go), which interfaces with the Keychain without requiring CGO.
 
-func set(service, key string, value []byte) error {
-	// Delete existing item first (ignore errors if it doesn't exist)
-	_ = del(service, key)
+// maxNativeValueSize is the largest value security can store.
+const maxNativeValueSize = keychainMaxValueSize
 
-	// Base64 encode the value to safely handle binary data
-	encoded := base64.StdEncoding.EncodeToString(value)
-
-	// Add new item to keychain
-	cmd := exec.Command("security", "add-generic-password",
-		"-a", key, // account name
-		"-s", service, // service name
-		"-w", encoded, // password (base64 encoded value)
-		"-U", // update if exists
-	)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+func set(ctx context.Context, service, key string, value []byte) error {
+	return keychainSet(ctx, service, key, value)
+}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("vault: failed to set key: %s", stderr.String())
-	}
+func get(ctx context.Context, service, key string) ([]byte, error) {
+	return keychainGet(ctx, service, key)
+}
 
-	return nil
+func getRaw(ctx context.Context, service, key string) ([]byte, error) {
+	return keychainGetRaw(ctx, service, key)
 }
 
-func get(service, key string) ([]byte, error) {
-	cmd := exec.Command("security", "find-generic-password",
-		"-a", key, // account name
-		"-s", service, // service name
-		"-w", // output only the password
-	)
+func metadata(ctx context.Context, service, key string) (Metadata, error) {
+	return keychainMetadata(ctx, service, key)
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+func del(ctx context.Context, service, key string) error {
+	return keychainDel(ctx, service, key)
+}
 
-	if err := cmd.Run(); err != nil {
-		errStr := stderr.String()
-		if strings.Contains(errStr, "could not be found") ||
-			strings.Contains(errStr, "SecKeychainSearchCopyNext") {
-			return nil, ErrNotFound
-		}
-		return nil, fmt.Errorf("vault: failed to get key: %s", errStr)
-	}
+func dedupe(ctx context.Context, service, key string) (int, error) {
+	return keychainDedupe(ctx, service, key)
+}
 
-	// Remove trailing newline and decode base64
-	result := strings.TrimSpace(stdout.String())
-	decoded, err := base64.StdEncoding.DecodeString(result)
-	if err != nil {
-		return nil, fmt.Errorf("vault: failed to decode value: %w", err)
-	}
-	return decoded, nil
+func list(ctx context.Context, service string) ([]string, error) {
+	return keychainList(ctx, service)
 }
 
-func del(service, key string) error {
-	cmd := exec.Command("security", "delete-generic-password",
-		"-a", key, // account name
-		"-s", service, // service name
-	)
+// lockStorage locks the default keychain.
+func lockStorage(ctx context.Context) error {
+	return keychainLock(ctx)
+}
 
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+// unlockStorage unlocks the default keychain with password.
+func unlockStorage(ctx context.Context, password []byte) error {
+	return keychainUnlock(ctx, password)
+}
 
-	if err := cmd.Run(); err != nil {
-		errStr := stderr.String()
-		if strings.Contains(errStr, "could not be found") ||
-			strings.Contains(errStr, "SecKeychainSearchCopyNext") {
-			return ErrNotFound
-		}
-		return fmt.Errorf("vault: failed to delete key: %s", errStr)
-	}
+// namedItems reports whether the operation under ctx identifies items by
+// the name itemName returns.
+func namedItems(context.Context) bool {
+	return false
+}
 
+func syncStorage() error {
+	// The Keychain persists items as soon as the security tool returns.
 	return nil
 }
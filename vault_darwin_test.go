@@ -0,0 +1,462 @@
+//go:build darwin && !ios
+
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseDumpKeychain(t *testing.T) {
+	out := []byte(`keychain: "/Users/me/Library/Keychains/login.keychain-db"
+version: 512
+class: "genp"
+attributes:
+    0x00000007 <blob>="myapp"
+    "acct"<blob>="api-key"
+    "svce"<blob>="myapp"
+keychain: "/Users/me/Library/Keychains/login.keychain-db"
+version: 512
+class: "genp"
+attributes:
+    "acct"<blob>=0x6B6579E4B896E7958C  "key\344\270\226\347\225\214"
+    "svce"<blob>="myapp"
+keychain: "/Users/me/Library/Keychains/login.keychain-db"
+version: 512
+class: "genp"
+attributes:
+    "acct"<blob>="other-key"
+    "svce"<blob>="otherapp"
+keychain: "/Users/me/Library/Keychains/login.keychain-db"
+version: 512
+class: "inet"
+attributes:
+    "acct"<blob>="inet-key"
+    "svce"<blob>="myapp"
+`)
+
+	got := parseDumpKeychain(out, "myapp")
+	want := []string{"api-key", "key世界"}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseDumpKeychain returned %q, want %q", got, want)
+	}
+}
+
+func TestParseKeychainAttribute(t *testing.T) {
+	out := []byte(`keychain: "/Users/me/Library/Keychains/login.keychain-db"
+version: 512
+class: "genp"
+attributes:
+    "acct"<blob>="api-key"
+    "icmt"<blob>="deploy-tool"
+    "svce"<blob>="myapp"
+`)
+	if got := parseKeychainAttribute(out, "icmt"); got != "deploy-tool" {
+		t.Errorf("parseKeychainAttribute(icmt) = %q, want deploy-tool", got)
+	}
+	if got := parseKeychainAttribute(out, "gena"); got != "" {
+		t.Errorf("parseKeychainAttribute(gena) = %q, want empty", got)
+	}
+}
+
+func TestInternetPassword(t *testing.T) {
+	out := []byte(`keychain: "/Users/me/Library/Keychains/login.keychain-db"
+version: 512
+class: "inet"
+attributes:
+    "acct"<blob>="alice"
+    "ptcl"<uint32>="htps"
+    "srvr"<blob>="example.com"
+keychain: "/Users/me/Library/Keychains/login.keychain-db"
+version: 512
+class: "genp"
+attributes:
+    "acct"<blob>="bob"
+    "svce"<blob>="example.com"
+`)
+	if got := parseDumpKeychainClass(out, "inet", "srvr", "example.com"); !slices.Equal(got, []string{"alice"}) {
+		t.Errorf("parseDumpKeychainClass(inet) = %q, want [alice]", got)
+	}
+
+	b := NativeBackend(WithMacOSInternetPassword("htps")).(nativeBackend)
+	class, args := keychainItem(b.context(context.Background()), "example.com", "alice")
+	want := []string{"-a", "alice", "-s", "example.com", "-r", "htps"}
+	if class != "internet-password" || !slices.Equal(args, want) {
+		t.Errorf("keychainItem = %q, %q, want internet-password, %q", class, args, want)
+	}
+
+	class, _ = keychainItem(context.Background(), "example.com", "alice")
+	if class != "generic-password" {
+		t.Errorf("default keychainItem class = %q, want generic-password", class)
+	}
+}
+
+func TestSkipUnchangedWrites(t *testing.T) {
+	encoded, err := defaultCodec.Encode([]byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var subcommands []string
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		subcommands = append(subcommands, args[0])
+		switch {
+		case args[0] == "find-generic-password" && slices.Contains(args, "-w"):
+			return append(encoded, '\n'), nil, nil
+		case args[0] == "find-generic-password":
+			return []byte(`    "icmt"<blob>="vault-test"` + "\n"), nil, nil
+		}
+		return nil, nil, nil
+	})
+	SetAppIdentity("vault-test")
+	SkipUnchangedWrites(true)
+	t.Cleanup(func() {
+		SetCommandRunner(nil)
+		SetAppIdentity("")
+		SkipUnchangedWrites(false)
+	})
+
+	ctx := context.Background()
+	if err := set(ctx, testService, "key", []byte("value")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if slices.Contains(subcommands, "add-generic-password") || slices.Contains(subcommands, "delete-generic-password") {
+		t.Errorf("unchanged set ran %v, want only reads", subcommands)
+	}
+
+	subcommands = nil
+	if err := set(ctx, testService, "key", []byte("other")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if !slices.Contains(subcommands, "add-generic-password") {
+		t.Errorf("changed set ran %v, want add-generic-password", subcommands)
+	}
+}
+
+// fakeKeychain is a CommandRunner standing in for security with a keychain
+// holding the passwords of duplicate generic-password items for one
+// service and key, first match first, and their labels, if any.
+type fakeKeychain struct {
+	items  []string
+	labels []string
+}
+
+// match returns the index of the first item the label selected by args,
+// if any, matches, or -1.
+func (k *fakeKeychain) match(args []string) int {
+	i := slices.Index(args, "-l")
+	for j := range k.items {
+		if i < 0 || k.label(j) == args[i+1] {
+			return j
+		}
+	}
+	return -1
+}
+
+func (k *fakeKeychain) label(i int) string {
+	if i < len(k.labels) {
+		return k.labels[i]
+	}
+	return ""
+}
+
+// describe returns the attributes of item i as security prints them.
+func (k *fakeKeychain) describe(i int) string {
+	out := "keychain: \"/Users/me/Library/Keychains/login.keychain-db\"\n" +
+		"class: \"genp\"\nattributes:\n"
+	if label := k.label(i); label != "" {
+		out += "    0x00000007 <blob>=\"" + label + "\"\n"
+	}
+	return out + "    \"acct\"<blob>=\"key\"\n" +
+		"    \"svce\"<blob>=\"" + testService + "\"\n"
+}
+
+func (k *fakeKeychain) run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	notFound := []byte("security: SecKeychainSearchCopyNext: The specified item could not be found in the keychain.\n")
+	switch args[0] {
+	case "dump-keychain":
+		var out strings.Builder
+		for i := range k.items {
+			out.WriteString(k.describe(i))
+		}
+		return []byte(out.String()), nil, nil
+	case "find-generic-password":
+		i := k.match(args)
+		if i < 0 {
+			return nil, notFound, errors.New("exit status 44")
+		}
+		if !slices.Contains(args, "-w") {
+			return []byte(k.describe(i)), nil, nil
+		}
+		return []byte(k.items[i] + "\n"), nil, nil
+	case "delete-generic-password":
+		i := k.match(args)
+		if i < 0 {
+			return nil, notFound, errors.New("exit status 44")
+		}
+		k.items = slices.Delete(k.items, i, i+1)
+		if i < len(k.labels) {
+			k.labels = slices.Delete(k.labels, i, i+1)
+		}
+		return nil, nil, nil
+	case "add-generic-password":
+		password := args[slices.Index(args, "-w")+1]
+		if slices.Contains(args, "-U") && len(k.items) > 0 {
+			k.items[0] = password
+		} else {
+			k.items = append(k.items, password)
+		}
+		return nil, nil, nil
+	}
+	return nil, nil, errors.New("unexpected command")
+}
+
+func useFakeKeychain(t *testing.T, items ...string) *fakeKeychain {
+	k := &fakeKeychain{items: items}
+	SetCommandRunner(k.run)
+	t.Cleanup(func() { SetCommandRunner(nil) })
+	return k
+}
+
+func TestDelRemovesDuplicates(t *testing.T) {
+	k := useFakeKeychain(t, "Zmlyc3Q=", "c2Vjb25k", "dGhpcmQ=")
+
+	if err := del(context.Background(), testService, "key"); err != nil {
+		t.Fatalf("del failed: %v", err)
+	}
+	if len(k.items) != 0 {
+		t.Errorf("del left %d items, want 0", len(k.items))
+	}
+	if err := del(context.Background(), testService, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("del of missing item error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	first := base64.StdEncoding.EncodeToString([]byte("first"))
+	k := useFakeKeychain(t, first, "c2Vjb25k", "dGhpcmQ=")
+	k.labels = []string{"kept", "copy", "other copy"}
+	var calls [][]string
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		calls = append(calls, args)
+		return k.run(ctx, name, args...)
+	})
+
+	removed, err := Dedupe(testService, "key")
+	if err != nil {
+		t.Fatalf("Dedupe failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Dedupe removed %d, want 2", removed)
+	}
+	if !slices.Equal(k.items, []string{first}) || !slices.Equal(k.labels, []string{"kept"}) {
+		t.Errorf("items after Dedupe = %q, %q, want [%s], [kept]", k.items, k.labels, first)
+	}
+	// The kept item is neither deleted nor written again
+	for _, args := range calls {
+		if args[0] == "add-generic-password" || args[0] == "delete-generic-password" && !slices.Contains(args, "-l") {
+			t.Errorf("Dedupe ran security %q", args)
+		}
+	}
+
+	removed, err = Dedupe(testService, "key")
+	if err != nil || removed != 0 {
+		t.Errorf("Dedupe without duplicates = %d, %v, want 0, nil", removed, err)
+	}
+	if got, err := Get(testService, "key"); err != nil || string(got) != "first" {
+		t.Errorf("Get after Dedupe = %q, %v, want first", got, err)
+	}
+
+	// A duplicate security cannot select without the kept item is left
+	k.items, k.labels = []string{first, "c2Vjb25k", "dGhpcmQ="}, []string{"kept", "", "copy"}
+	removed, err = Dedupe(testService, "key")
+	if err == nil || removed != 1 {
+		t.Errorf("Dedupe of an unselectable duplicate = %d, %v, want 1 and an error", removed, err)
+	}
+	if !slices.Equal(k.items, []string{first, "c2Vjb25k"}) {
+		t.Errorf("items after Dedupe = %q, want [%s c2Vjb25k]", k.items, first)
+	}
+}
+
+func TestSetValueTooLarge(t *testing.T) {
+	k := useFakeKeychain(t)
+	value := make([]byte, maxNativeValueSize+1)
+	if err := set(context.Background(), testService, "key", value); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("set of %d bytes error = %v, want ErrValueTooLarge", len(value), err)
+	}
+	if len(k.items) != 0 {
+		t.Error("set of a value over the limit added an item")
+	}
+	if err := set(context.Background(), testService, "key", make([]byte, maxNativeValueSize)); err != nil {
+		t.Errorf("set of %d bytes failed: %v", maxNativeValueSize, err)
+	}
+}
+
+func TestGetCorruptItem(t *testing.T) {
+	useFakeKeychain(t, "not base64!")
+	if _, err := get(context.Background(), testService, "key"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("get of a corrupt item: expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestGoKeyringCompat(t *testing.T) {
+	ctx := goKeyringContext()
+	// Items as go-keyring and 99designs/keyring store them
+	for stored, want := range map[string]string{
+		"hunter2":                           "hunter2",
+		"go-keyring-base64:aHVudGVyMg==":    "hunter2",
+		"go-keyring-encoded:68756e74657232": "hunter2",
+	} {
+		useFakeKeychain(t, stored)
+		if got, err := get(ctx, testService, "key"); err != nil || string(got) != want {
+			t.Errorf("get of %q = %q, %v, want %q", stored, got, err, want)
+		}
+	}
+
+	k := useFakeKeychain(t)
+	if err := set(ctx, testService, "key", []byte("hunter2")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if want := []string{"go-keyring-base64:aHVudGVyMg=="}; !slices.Equal(k.items, want) {
+		t.Errorf("stored items = %q, want %q", k.items, want)
+	}
+}
+
+func TestWhitespaceValue(t *testing.T) {
+	useFakeKeychain(t)
+	ctx := context.Background()
+	// security -w ends its output with a newline of its own
+	value := []byte("secret \n")
+	if err := set(ctx, testService, "key", value); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if got, err := get(ctx, testService, "key"); err != nil || !bytes.Equal(got, value) {
+		t.Errorf("get = %q, %v, want %q", got, err, value)
+	}
+}
+
+func TestKeychainAccessDenied(t *testing.T) {
+	for _, stderr := range []string{
+		"security: SecKeychainItemCopyContent: The user name or passphrase you entered is not correct.\n",
+		"security: SecKeychainFindGenericPassword: User interaction is not allowed.\n",
+		"security: SecKeychainItemCopyContent: User canceled the operation.\n",
+	} {
+		SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+			return nil, []byte(stderr), errors.New("exit status 51")
+		})
+		t.Cleanup(func() { SetCommandRunner(nil) })
+
+		ctx := context.Background()
+		if _, err := get(ctx, testService, "key"); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("get with %q: expected ErrAccessDenied, got %v", stderr, err)
+		}
+		if err := del(ctx, testService, "key"); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("del with %q: expected ErrAccessDenied, got %v", stderr, err)
+		}
+		if err := set(ctx, testService, "key", []byte("value")); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("set with %q: expected ErrAccessDenied, got %v", stderr, err)
+		}
+	}
+}
+
+func TestSetUpdatesInPlace(t *testing.T) {
+	old := base64.StdEncoding.EncodeToString([]byte("old"))
+	k := useFakeKeychain(t, old)
+	var subcommands []string
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		subcommands = append(subcommands, args[0])
+		return k.run(ctx, name, args...)
+	})
+
+	if err := set(context.Background(), testService, "key", []byte("new")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if want := []string{"add-generic-password"}; !slices.Equal(subcommands, want) {
+		t.Errorf("set ran %v, want %v", subcommands, want)
+	}
+	if want := []string{base64.StdEncoding.EncodeToString([]byte("new"))}; !slices.Equal(k.items, want) {
+		t.Errorf("items = %q, want %q", k.items, want)
+	}
+}
+
+func TestSetReplacesWhenUpdateFails(t *testing.T) {
+	k := useFakeKeychain(t, base64.StdEncoding.EncodeToString([]byte("old")))
+	var subcommands []string
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		subcommands = append(subcommands, args[0])
+		if args[0] == "add-generic-password" && len(subcommands) == 1 {
+			return nil, []byte("security: SecKeychainItemModifyContent: The specified attribute does not exist.\n"), errors.New("exit status 1")
+		}
+		return k.run(ctx, name, args...)
+	})
+
+	if err := set(context.Background(), testService, "key", []byte("new")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if !slices.Contains(subcommands, "delete-generic-password") {
+		t.Errorf("set ran %v, want a delete after the failed update", subcommands)
+	}
+	if want := []string{base64.StdEncoding.EncodeToString([]byte("new"))}; !slices.Equal(k.items, want) {
+		t.Errorf("items = %q, want %q", k.items, want)
+	}
+}
+
+func TestNoSecretInErrorsKeychain(t *testing.T) {
+	t.Run("working", func(t *testing.T) {
+		useFakeKeychain(t)
+		checkNoSecretLeaks(t, NativeBackend())
+	})
+	t.Run("failing", func(t *testing.T) {
+		SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+			return nil, []byte("security: SecKeychainItemModifyContent: The keychain is not writable.\n"), errors.New("exit status 1")
+		})
+		t.Cleanup(func() { SetCommandRunner(nil) })
+		checkNoSecretLeaks(t, NativeBackend())
+	})
+}
+
+func TestKeychainLock(t *testing.T) {
+	var calls [][]string
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		calls = append(calls, args)
+		stdin, _ := io.ReadAll(CommandStdin(ctx))
+		if args[0] == "unlock-keychain" && ctx.Value(noTerminalKey{}) == nil {
+			t.Errorf("security %q run with a controlling terminal", args)
+		}
+		if args[0] == "unlock-keychain" && string(stdin) != "hunter2\n" {
+			return nil, []byte("security: SecKeychainUnlock <NULL>: The user name or passphrase you entered is not correct.\n"), errors.New("exit status 51")
+		}
+		return nil, nil, nil
+	})
+	t.Cleanup(func() { SetCommandRunner(nil) })
+
+	if err := Lock(); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if err := Unlock([]byte("hunter2")); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	want := [][]string{{"lock-keychain"}, {"unlock-keychain"}}
+	if !slices.EqualFunc(calls, want, slices.Equal) {
+		t.Errorf("security arguments = %q, want %q", calls, want)
+	}
+
+	if err := Unlock([]byte("wrong-password")); err != ErrWrongPassphrase {
+		t.Errorf("Unlock with a wrong password = %v, want ErrWrongPassphrase", err)
+	}
+	calls = nil
+	for _, password := range []string{"two\nlines", strings.Repeat("x", 129)} {
+		if err := Unlock([]byte(password)); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("Unlock(%.10q...) = %v, want ErrInvalidValue", password, err)
+		}
+	}
+	if len(calls) != 0 {
+		t.Errorf("security run with an invalid password: %q", calls)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build linux || ios
+
+package vault
+
+import "math"
+
+// platformFiles is the file storage shared by the platforms that keep
+// secrets as files in a private directory: the Linux fallback, iOS and
+// Android. Each platform provides getStorageDir.
+//
+// Values are only base64 encoded, which is obfuscation rather than
+// encryption; the platform's file permissions and sandbox protect them.
+// SetFileIntegrityKey adds tamper detection, and NewEncryptedFileBackend
+// provides encrypted file storage.
+var platformFiles = &fileStore{dir: getStorageDir, codec: fileCodec{}}
+
+// maxNativeValueSize is the limit of the Linux Secret Service, which has
+// none: secret-tool reads the secret from standard input. The file storage
+// reports its own.
+const maxNativeValueSize = math.MaxInt
@@ -3,11 +3,10 @@
 package vault
 
 import (
-	"encoding/base64"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
 // iOS implementation using file-based storage in the app's secure container.
@@ -17,55 +16,43 @@ import (
 // Note: For true Keychain access on iOS, CGO with Security.framework is required.
 // This implementation provides a secure fallback using iOS file protection.
 
-func set(service, key string, value []byte) error {
-	path, err := getStoragePath(service, key)
-	if err != nil {
-		return fmt.Errorf("vault: failed to get storage path: %w", err)
-	}
+func set(ctx context.Context, service, key string, value []byte) error {
+	return platformFiles.set(ctx, service, key, value)
+}
 
-	// Encode the value for storage
-	encoded := base64.StdEncoding.EncodeToString(value)
+func get(ctx context.Context, service, key string) ([]byte, error) {
+	return platformFiles.get(ctx, service, key)
+}
 
-	if err := os.WriteFile(path, []byte(encoded), 0o600); err != nil {
-		return fmt.Errorf("vault: failed to write secret: %w", err)
-	}
-	return nil
+func getRaw(ctx context.Context, service, key string) ([]byte, error) {
+	return platformFiles.getRaw(ctx, service, key)
 }
 
-func get(service, key string) ([]byte, error) {
-	path, err := getStoragePath(service, key)
-	if err != nil {
-		return nil, fmt.Errorf("vault: failed to get storage path: %w", err)
-	}
+func metadata(ctx context.Context, service, key string) (Metadata, error) {
+	return platformFiles.metadata(ctx, service, key)
+}
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrNotFound
-		}
-		return nil, fmt.Errorf("vault: failed to read secret: %w", err)
-	}
+func del(ctx context.Context, service, key string) error {
+	return platformFiles.del(ctx, service, key)
+}
 
-	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
-	if err != nil {
-		return nil, fmt.Errorf("vault: failed to decode secret: %w", err)
-	}
-	return decoded, nil
+func list(ctx context.Context, service string) ([]string, error) {
+	return platformFiles.list(ctx, service)
 }
 
-func del(service, key string) error {
-	path, err := getStoragePath(service, key)
-	if err != nil {
-		return fmt.Errorf("vault: failed to get storage path: %w", err)
-	}
+// activeFiles returns the file storage, which holds every secret.
+func activeFiles(context.Context) *fileStore {
+	return platformFiles
+}
 
-	if err := os.Remove(path); err != nil {
-		if os.IsNotExist(err) {
-			return ErrNotFound
-		}
-		return fmt.Errorf("vault: failed to delete secret: %w", err)
-	}
-	return nil
+// namedItems reports whether the operation under ctx identifies items by
+// the name itemName returns.
+func namedItems(context.Context) bool {
+	return false
+}
+
+func syncStorage() error {
+	return platformFiles.sync()
 }
 
 func getStorageDir() (string, error) {
@@ -73,18 +60,8 @@ func getStorageDir() (string, error) {
 	// The Library/Application Support directory is recommended for app data
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: no home directory for file storage: %w", ErrBackendUnavailable, err)
 	}
 	dir := filepath.Join(home, "Library", "Application Support", "vault-secrets")
-	return dir, os.MkdirAll(dir, 0o700)
-}
-
-func getStoragePath(service, key string) (string, error) {
-	dir, err := getStorageDir()
-	if err != nil {
-		return "", err
-	}
-	// Use base64 encoding for safe filenames
-	filename := base64.URLEncoding.EncodeToString([]byte(service + "/" + key))
-	return filepath.Join(dir, filename), nil
+	return dir, mkdirStorage(dir)
 }
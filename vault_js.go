@@ -3,13 +3,17 @@
 package vault
 
 import (
-	"encoding/base64"
+	"context"
 	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
 	"syscall/js"
 )
 
 // WASM/Browser implementation using IndexedDB for storage.
-// Values are base64 encoded for safe storage.
+// Values are encoded with the default codec (base64) for safe storage.
 //
 // Note: Browser storage is NOT as secure as native keychains:
 // - Data is accessible to JavaScript running on the same origin
@@ -26,151 +30,316 @@ var (
 	storeName = "secrets"
 )
 
+// maxNativeValueSize is unknown for IndexedDB, whose quota depends on the
+// browser and the free disk space.
+const maxNativeValueSize = math.MaxInt
+
 func init() {
 	indexedDB = js.Global().Get("indexedDB")
 }
 
-func set(service, key string, value []byte) error {
-	encoded := base64.StdEncoding.EncodeToString(value)
-	storeKey := service + "/" + key
-
-	return withStore("readwrite", func(store js.Value) error {
-		done := make(chan error, 1)
+func set(ctx context.Context, service, key string, value []byte) error {
+	encoded, err := defaultCodec.Encode(value)
+	if err != nil {
+		return fmt.Errorf("vault: failed to encode value: %w", err)
+	}
+	storeKey := itemName(ctx, service, key)
 
+	return withStore(ctx, "readwrite", func(store js.Value, o *op) {
+		// The store uses in-line keys (keyPath "key"), so the key must not
+		// be passed separately.
 		request := store.Call("put", map[string]any{
 			"key":   storeKey,
-			"value": encoded,
-		}, storeKey)
-
-		request.Set("onsuccess", js.FuncOf(func(this js.Value, args []js.Value) any {
-			done <- nil
-			return nil
-		}))
+			"value": string(encoded),
+			"app":   appIdentity(ctx),
+		})
+
+		// The write succeeds when its transaction completes
+		o.on(request, "onerror", func() {
+			o.finish(errors.New("vault: failed to set key in IndexedDB"))
+		})
+	})
+}
 
-		request.Set("onerror", js.FuncOf(func(this js.Value, args []js.Value) any {
-			done <- errors.New("vault: failed to set key in IndexedDB")
-			return nil
-		}))
+func get(ctx context.Context, service, key string) ([]byte, error) {
+	raw, err := getRaw(ctx, service, key)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := defaultCodec.Decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode value: %w", ErrCorrupt, err)
+	}
+	return decoded, nil
+}
 
-		return <-done
+// getRaw returns the value field of the stored record, which is the encoded
+// value.
+func getRaw(ctx context.Context, service, key string) ([]byte, error) {
+	var result []byte
+	err := readRecord(ctx, service, key, func(record js.Value) {
+		result = []byte(record.Get("value").String())
 	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-func get(service, key string) ([]byte, error) {
-	storeKey := service + "/" + key
-	var result []byte
+func metadata(ctx context.Context, service, key string) (Metadata, error) {
+	var md Metadata
+	err := readRecord(ctx, service, key, func(record js.Value) {
+		// Records written before identities were recorded have no app
+		if app := record.Get("app"); app.Type() == js.TypeString {
+			md.App = app.String()
+		}
+	})
+	return md, err
+}
 
-	err := withStore("readonly", func(store js.Value) error {
-		done := make(chan error, 1)
+// readRecord fetches the record stored for service and key and passes it
+// to fn from the request's success callback.
+func readRecord(ctx context.Context, service, key string, fn func(record js.Value)) error {
+	storeKey := itemName(ctx, service, key)
 
+	return withStore(ctx, "readonly", func(store js.Value, o *op) {
 		request := store.Call("get", storeKey)
 
-		request.Set("onsuccess", js.FuncOf(func(this js.Value, args []js.Value) any {
+		o.on(request, "onsuccess", func() {
 			res := request.Get("result")
 			if res.IsUndefined() || res.IsNull() {
-				done <- ErrNotFound
-				return nil
+				o.finish(ErrNotFound)
+				return
 			}
 
-			encoded := res.Get("value").String()
-			decoded, err := base64.StdEncoding.DecodeString(encoded)
-			if err != nil {
-				done <- err
-				return nil
-			}
-			result = decoded
-			done <- nil
-			return nil
-		}))
+			fn(res)
+			o.finish(nil)
+		})
 
-		request.Set("onerror", js.FuncOf(func(this js.Value, args []js.Value) any {
-			done <- errors.New("vault: failed to get key from IndexedDB")
-			return nil
-		}))
-
-		return <-done
+		o.on(request, "onerror", func() {
+			o.finish(errors.New("vault: failed to get key from IndexedDB"))
+		})
 	})
-
-	return result, err
 }
 
-func del(service, key string) error {
-	storeKey := service + "/" + key
-
-	return withStore("readwrite", func(store js.Value) error {
-		done := make(chan error, 1)
+func del(ctx context.Context, service, key string) error {
+	storeKey := itemName(ctx, service, key)
 
+	return withStore(ctx, "readwrite", func(store js.Value, o *op) {
 		// First check if key exists
 		getRequest := store.Call("get", storeKey)
 
-		getRequest.Set("onsuccess", js.FuncOf(func(this js.Value, args []js.Value) any {
+		o.on(getRequest, "onsuccess", func() {
 			res := getRequest.Get("result")
 			if res.IsUndefined() || res.IsNull() {
-				done <- ErrNotFound
-				return nil
+				o.finish(ErrNotFound)
+				return
 			}
 
-			// Key exists, delete it
+			// Key exists, delete it. The delete succeeds when the
+			// transaction completes
 			deleteRequest := store.Call("delete", storeKey)
 
-			deleteRequest.Set("onsuccess", js.FuncOf(func(this js.Value, args []js.Value) any {
-				done <- nil
-				return nil
-			}))
+			o.on(deleteRequest, "onerror", func() {
+				o.finish(errors.New("vault: failed to delete key from IndexedDB"))
+			})
+		})
 
-			deleteRequest.Set("onerror", js.FuncOf(func(this js.Value, args []js.Value) any {
-				done <- errors.New("vault: failed to delete key from IndexedDB")
-				return nil
-			}))
+		o.on(getRequest, "onerror", func() {
+			o.finish(errors.New("vault: failed to check key in IndexedDB"))
+		})
+	})
+}
 
-			return nil
-		}))
+func list(ctx context.Context, service string) ([]string, error) {
+	prefix := itemPrefix(ctx, service)
+	var keys []string
 
-		getRequest.Set("onerror", js.FuncOf(func(this js.Value, args []js.Value) any {
-			done <- errors.New("vault: failed to check key in IndexedDB")
-			return nil
-		}))
+	err := withStore(ctx, "readonly", func(store js.Value, o *op) {
+		request := store.Call("getAllKeys")
 
-		return <-done
+		o.on(request, "onsuccess", func() {
+			res := request.Get("result")
+			for i := 0; i < res.Length(); i++ {
+				if key, ok := itemKey(ctx, res.Index(i).String(), prefix); ok {
+					keys = append(keys, key)
+				}
+			}
+			o.finish(nil)
+		})
+
+		o.on(request, "onerror", func() {
+			o.finish(errors.New("vault: failed to list keys in IndexedDB"))
+		})
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
 }
 
-// withStore opens the database and executes fn with an object store
-func withStore(mode string, fn func(store js.Value) error) error {
-	done := make(chan error, 1)
+// namedItems reports whether the operation under ctx identifies items by
+// the name itemName returns.
+func namedItems(context.Context) bool {
+	return true
+}
+
+func syncStorage() error {
+	// Writes return once their transaction has committed durably.
+	return nil
+}
+
+// liveFuncs counts the js.Func callbacks that have been registered but not
+// yet released. It lets tests check that operations don't leak callbacks.
+var liveFuncs atomic.Int64
+
+// op tracks a single IndexedDB operation: its outcome and the js.Func
+// callbacks registered for it.
+type op struct {
+	done chan error
+
+	mu  sync.Mutex
+	fns []js.Func
+}
+
+func newOp() *op {
+	return &op{done: make(chan error, 1)}
+}
+
+// finish reports the outcome of the operation. Only the first call counts;
+// it never blocks, so it is safe to call from any callback.
+func (o *op) finish(err error) {
+	select {
+	case o.done <- err:
+	default:
+	}
+}
+
+// on registers fn as the handler for event on target. The handler is
+// released together with every other callback of the operation.
+func (o *op) on(target js.Value, event string, fn func()) {
+	f := js.FuncOf(func(this js.Value, args []js.Value) any {
+		fn()
+		return nil
+	})
+
+	o.mu.Lock()
+	o.fns = append(o.fns, f)
+	o.mu.Unlock()
+	liveFuncs.Add(1)
+
+	target.Set(event, f)
+}
+
+// release frees every callback registered so far. It must only be called
+// once no more events can fire for the operation, which is when its
+// transaction has completed or aborted, or when the database could not be
+// opened at all. Releasing from within a running callback is allowed.
+func (o *op) release() {
+	o.mu.Lock()
+	fns := o.fns
+	o.fns = nil
+	o.mu.Unlock()
+
+	for _, f := range fns {
+		f.Release()
+		liveFuncs.Add(-1)
+	}
+}
+
+// withStore opens the database, starts a transaction in the given mode and
+// hands its object store to fn. fn must issue its requests before returning,
+// while the transaction is still active, and report the outcome through
+// o.finish. Callbacks never block: only the calling goroutine waits, either
+// for the outcome or for ctx to be done, in which case the pending
+// transaction is aborted and ctx.Err() is returned.
+//
+// A read's outcome is known before the transaction settles, so the
+// callbacks are released from the transaction's oncomplete/onabort handler
+// rather than when withStore returns. Writes leave success to oncomplete,
+// which fires once the transaction is committed: readwrite transactions
+// ask for strict durability, so that a write that returned is on disk.
+func withStore(ctx context.Context, mode string, fn func(store js.Value, o *op)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	o := newOp()
+
+	var (
+		mu        sync.Mutex
+		tx        js.Value
+		txDone    bool
+		cancelled bool
+	)
 
 	request := indexedDB.Call("open", dbName, 1)
 
-	request.Set("onupgradeneeded", js.FuncOf(func(this js.Value, args []js.Value) any {
+	o.on(request, "onupgradeneeded", func() {
 		db := request.Get("result")
-		if !db.Call("objectStoreNames").Call("contains", storeName).Bool() {
+		if !db.Get("objectStoreNames").Call("contains", storeName).Bool() {
 			db.Call("createObjectStore", storeName, map[string]any{
 				"keyPath": "key",
 			})
 		}
-		return nil
-	}))
+	})
 
-	request.Set("onsuccess", js.FuncOf(func(this js.Value, args []js.Value) any {
+	o.on(request, "onsuccess", func() {
 		db := request.Get("result")
-		tx := db.Call("transaction", storeName, mode)
-		store := tx.Call("objectStore", storeName)
 
-		err := fn(store)
+		mu.Lock()
+		defer mu.Unlock()
 
-		tx.Set("oncomplete", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if cancelled {
 			db.Call("close")
-			return nil
-		}))
+			o.release()
+			return
+		}
 
-		done <- err
-		return nil
-	}))
+		args := []any{storeName, mode}
+		if mode == "readwrite" {
+			args = append(args, map[string]any{"durability": "strict"})
+		}
+		tx = db.Call("transaction", args...)
 
-	request.Set("onerror", js.FuncOf(func(this js.Value, args []js.Value) any {
-		done <- errors.New("vault: failed to open IndexedDB")
-		return nil
-	}))
+		o.on(tx, "oncomplete", func() {
+			mu.Lock()
+			txDone = true
+			mu.Unlock()
+			db.Call("close")
+			o.finish(nil)
+			o.release()
+		})
+
+		o.on(tx, "onabort", func() {
+			mu.Lock()
+			txDone = true
+			mu.Unlock()
+			db.Call("close")
+			o.finish(errors.New("vault: IndexedDB transaction aborted"))
+			o.release()
+		})
+
+		fn(tx.Call("objectStore", storeName), o)
+	})
 
-	return <-done
+	o.on(request, "onerror", func() {
+		o.finish(errors.New("vault: failed to open IndexedDB"))
+		o.release()
+	})
+
+	select {
+	case err := <-o.done:
+		return err
+	case <-ctx.Done():
+		mu.Lock()
+		defer mu.Unlock()
+
+		cancelled = true
+		if tx.Truthy() && !txDone {
+			tx.Call("abort")
+		}
+		return ctx.Err()
+	}
 }
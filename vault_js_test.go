@@ -0,0 +1,39 @@
+//go:build js && wasm
+
+package vault
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCallbacksReleased(t *testing.T) {
+	if !indexedDB.Truthy() {
+		t.Skip("IndexedDB is not available in this runtime")
+	}
+
+	key := "test-release-key"
+	value := []byte("test-release-value")
+
+	for i := 0; i < 20; i++ {
+		if err := Set(testService, key, value); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		if _, err := Get(testService, key); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if err := Del(testService, key); err != nil {
+			t.Fatalf("Del failed: %v", err)
+		}
+	}
+
+	// Callbacks are released once each transaction settles, which may be
+	// shortly after the operation itself has returned.
+	deadline := time.Now().Add(5 * time.Second)
+	for liveFuncs.Load() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d js.Func callbacks still registered after repeated operations", liveFuncs.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
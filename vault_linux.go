@@ -4,176 +4,241 @@ package vault
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 // Linux implementation using secret-tool (libsecret CLI) which interfaces
 // with the Secret Service API (GNOME Keyring, KWallet, etc.)
-// Falls back to encrypted file storage if secret-tool is not available.
+// Falls back to file storage if secret-tool is not installed or the Secret
+// Service cannot be reached. WithLinuxSessionKeyring selects the kernel
+// session keyring instead (see vault_linux_keyring.go).
 
-func set(service, key string, value []byte) error {
+func set(ctx context.Context, service, key string, value []byte) error {
+	if useSessionKeyring(ctx) {
+		return setKeyring(keyringDescription(ctx, service, key), value)
+	}
 	// Try secret-tool first (requires libsecret-tools package)
 	if hasSecretTool() {
-		return setSecretTool(service, key, value)
+		return setSecretTool(ctx, service, key, value)
 	}
 	// Fallback to encrypted file storage
-	return setFileStorage(service, key, value)
+	return platformFiles.set(ctx, service, key, value)
 }
 
-func get(service, key string) ([]byte, error) {
+func get(ctx context.Context, service, key string) ([]byte, error) {
+	if useSessionKeyring(ctx) {
+		return getKeyring(keyringDescription(ctx, service, key))
+	}
 	if hasSecretTool() {
-		return getSecretTool(service, key)
+		raw, err := getSecretTool(ctx, service, key)
+		if err != nil {
+			return nil, err
+		}
+		return decodeSecretToolValue(raw)
 	}
-	return getFileStorage(service, key)
+	return platformFiles.get(ctx, service, key)
 }
 
-func del(service, key string) error {
+func getRaw(ctx context.Context, service, key string) ([]byte, error) {
+	if useSessionKeyring(ctx) {
+		// Keys hold the value as given
+		return getKeyring(keyringDescription(ctx, service, key))
+	}
 	if hasSecretTool() {
-		return deleteSecretTool(service, key)
+		// secret-tool stores text values as given
+		return getSecretTool(ctx, service, key)
 	}
-	return deleteFileStorage(service, key)
+	return platformFiles.getRaw(ctx, service, key)
 }
 
-func hasSecretTool() bool {
-	_, err := exec.LookPath("secret-tool")
-	return err == nil
+func metadata(ctx context.Context, service, key string) (Metadata, error) {
+	if useSessionKeyring(ctx) {
+		return metadataKeyring(keyringDescription(ctx, service, key))
+	}
+	if hasSecretTool() {
+		return metadataSecretTool(ctx, service, key)
+	}
+	return platformFiles.metadata(ctx, service, key)
 }
 
-// Secret Service implementation using secret-tool
-func setSecretTool(service, key string, value []byte) error {
-	cmd := exec.Command("secret-tool", "store",
-		"--label", service+"/"+key,
-		"service", service,
-		"key", key,
-	)
-	cmd.Stdin = bytes.NewReader(value)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("vault: failed to set key: %s", stderr.String())
+func del(ctx context.Context, service, key string) error {
+	if useSessionKeyring(ctx) {
+		return deleteKeyring(keyringDescription(ctx, service, key))
 	}
-	return nil
+	if hasSecretTool() {
+		return deleteSecretTool(ctx, service, key)
+	}
+	return platformFiles.del(ctx, service, key)
 }
 
-func getSecretTool(service, key string) ([]byte, error) {
-	cmd := exec.Command("secret-tool", "lookup",
-		"service", service,
-		"key", key,
-	)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		if stdout.Len() == 0 {
-			return nil, ErrNotFound
-		}
-		return nil, fmt.Errorf("vault: failed to get key: %s", stderr.String())
+func list(ctx context.Context, service string) ([]string, error) {
+	if useSessionKeyring(ctx) {
+		return listKeyring(ctx, service)
 	}
-
-	result := stdout.Bytes()
-	if len(result) == 0 {
-		return nil, ErrNotFound
+	if hasSecretTool() {
+		return listSecretTool(ctx, service)
 	}
-	return result, nil
+	return platformFiles.list(ctx, service)
 }
 
-func deleteSecretTool(service, key string) error {
-	cmd := exec.Command("secret-tool", "clear",
-		"service", service,
-		"key", key,
-	)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+// secretAliasPrefix starts the D-Bus object paths of Secret Service
+// collection aliases.
+const secretAliasPrefix = "/org/freedesktop/secrets/aliases/"
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("vault: failed to delete key: %s", stderr.String())
+// lockStorage locks the Secret Service collection new secrets are stored
+// in.
+func lockStorage(ctx context.Context) error {
+	if useSessionKeyring(ctx) || !hasSecretTool() {
+		return errNoKeychainLock
+	}
+	collection := nativeConfigFrom(ctx).secretToolCollection
+	if collection == "" {
+		collection = "default"
+	}
+	if !strings.HasPrefix(collection, "/") {
+		collection = secretAliasPrefix + collection
+	}
+	_, stderr, err := runCommand(ctx, nil, "secret-tool", "lock", "--collection", collection)
+	if err != nil {
+		if err := commandError(ctx, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("vault: failed to lock keyring: %s", string(stderr))
 	}
 	return nil
 }
 
-// File-based fallback storage (XDG Base Directory compliant)
-// Note: This is less secure than the Secret Service but works without dependencies
-func getStorageDir() (string, error) {
-	dataHome := os.Getenv("XDG_DATA_HOME")
-	if dataHome == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", err
+// unlockStorage unlocks the login keyring of GNOME Keyring, which reads
+// the password from the standard input. The Secret Service API itself has
+// no way to pass a password: providers prompt the user.
+func unlockStorage(ctx context.Context, password []byte) error {
+	if useSessionKeyring(ctx) || !hasSecretTool() {
+		return errNoKeychainLock
+	}
+	if commandRunner.Load() == nil && !commandPinned("gnome-keyring-daemon") {
+		if _, err := exec.LookPath("gnome-keyring-daemon"); err != nil {
+			return fmt.Errorf("vault: unlocking the Secret Service needs gnome-keyring-daemon: %w", errors.ErrUnsupported)
 		}
-		dataHome = filepath.Join(home, ".local", "share")
 	}
-	dir := filepath.Join(dataHome, "vault-secrets")
-	return dir, os.MkdirAll(dir, 0o700)
-}
-
-func getStoragePath(service, key string) (string, error) {
-	dir, err := getStorageDir()
+	_, stderr, err := runCommand(ctx, password, "gnome-keyring-daemon", "--unlock")
 	if err != nil {
-		return "", err
+		if err := commandError(ctx, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("vault: failed to unlock keyring: %s", string(stderr))
 	}
-	// Use base64 encoding for safe filenames
-	filename := base64.URLEncoding.EncodeToString([]byte(service + "/" + key))
-	return filepath.Join(dir, filename), nil
+	return nil
 }
 
-func setFileStorage(service, key string, value []byte) error {
-	path, err := getStoragePath(service, key)
-	if err != nil {
-		return fmt.Errorf("vault: failed to get storage path: %w", err)
-	}
+// namedItems reports whether the operation under ctx identifies items by
+// the name itemName returns, which only the session keyring does.
+func namedItems(ctx context.Context) bool {
+	return useSessionKeyring(ctx)
+}
 
-	// Simple obfuscation (not true encryption, but better than plaintext)
-	// For production, consider using golang.org/x/crypto/nacl/secretbox
-	encoded := base64.StdEncoding.EncodeToString(value)
+func syncStorage() error {
+	if hasSecretTool() {
+		// The Secret Service provider manages its own persistence.
+		return nil
+	}
+	return platformFiles.sync()
+}
 
-	if err := os.WriteFile(path, []byte(encoded), 0o600); err != nil {
-		return fmt.Errorf("vault: failed to write secret: %w", err)
+// activeFiles returns the file storage when the operation under ctx uses
+// it instead of the Secret Service or the session keyring, or nil.
+func activeFiles(ctx context.Context) *fileStore {
+	if useSessionKeyring(ctx) || hasSecretTool() {
+		return nil
 	}
-	return nil
+	return platformFiles
 }
 
-func getFileStorage(service, key string) ([]byte, error) {
-	path, err := getStoragePath(service, key)
-	if err != nil {
-		return nil, fmt.Errorf("vault: failed to get storage path: %w", err)
+// secretToolProbe caches whether the Secret Service can be used, which is
+// probed once per process.
+var secretToolProbe struct {
+	mu       sync.Mutex
+	done, ok bool
+}
+
+// secretToolProbeTimeout bounds the probe, in case D-Bus hangs.
+const secretToolProbeTimeout = 5 * time.Second
+
+// hasSecretTool reports whether secrets go to the Secret Service. Having
+// secret-tool installed is not enough: on headless servers there is often
+// no keyring daemon or no session bus, and every call fails with a D-Bus
+// error. The file storage is used then.
+func hasSecretTool() bool {
+	secretToolProbe.mu.Lock()
+	defer secretToolProbe.mu.Unlock()
+	if !secretToolProbe.done {
+		secretToolProbe.ok = probeSecretTool()
+		secretToolProbe.done = true
 	}
+	return secretToolProbe.ok
+}
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrNotFound
+// probeSecretTool looks up an item that does not exist. A working Secret
+// Service answers with an empty failure; an unreachable one makes
+// secret-tool report why on stderr.
+func probeSecretTool() bool {
+	// A custom command runner may provide secret-tool without it being on
+	// PATH
+	if commandRunner.Load() == nil && !commandPinned("secret-tool") {
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return false
 		}
-		return nil, fmt.Errorf("vault: failed to read secret: %w", err)
+	}
+	// An installed secret-tool that may not be run is not a reason to fall
+	// back to the file storage: operations report it
+	if _, err := commandPath("secret-tool"); err != nil {
+		return true
 	}
 
-	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
-	if err != nil {
-		return nil, fmt.Errorf("vault: failed to decode secret: %w", err)
+	ctx, cancel := context.WithTimeout(context.Background(), secretToolProbeTimeout)
+	defer cancel()
+	_, stderr, err := runCommand(ctx, nil, "secret-tool", "lookup",
+		"service", ".vault-probe",
+		"key", ".vault-probe",
+	)
+	if err == nil {
+		return true
 	}
-	return decoded, nil
+	return ctx.Err() == nil && len(bytes.TrimSpace(stderr)) == 0
 }
 
-func deleteFileStorage(service, key string) error {
-	path, err := getStoragePath(service, key)
-	if err != nil {
-		return fmt.Errorf("vault: failed to get storage path: %w", err)
+// File-based fallback storage (XDG Base Directory compliant)
+// Note: This is less secure than the Secret Service but works without dependencies
+//
+// A directory that cannot be created or written to, for example because
+// XDG_DATA_HOME points at a read-only or missing mount, is reported as
+// ErrBackendUnavailable rather than as the bare filesystem error.
+func getStorageDir() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("%w: no home directory for file storage, set XDG_DATA_HOME: %v", ErrBackendUnavailable, err)
+		}
+		dataHome = filepath.Join(home, ".local", "share")
 	}
+	dir := filepath.Join(dataHome, "vault-secrets")
 
-	if err := os.Remove(path); err != nil {
-		if os.IsNotExist(err) {
-			return ErrNotFound
-		}
-		return fmt.Errorf("vault: failed to delete secret: %w", err)
+	err := os.MkdirAll(dir, 0o700)
+	if err == nil {
+		err = unix.Access(dir, unix.W_OK)
 	}
-	return nil
+	if err != nil {
+		return "", fmt.Errorf("%w: file storage directory %s is not writable, set XDG_DATA_HOME to a writable location or install secret-tool: %v", ErrBackendUnavailable, dir, err)
+	}
+	return dir, nil
 }
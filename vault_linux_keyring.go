@@ -0,0 +1,173 @@
+//go:build linux && !android
+
+package vault
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Kernel session keyring storage, selected with WithLinuxSessionKeyring.
+// Each secret is a "user" key linked into the session keyring, whose
+// description is keyringPrefix followed by the item name ("service/key",
+// or service and key joined by the separator set with WithSeparator) and
+// whose payload is the value as given.
+
+const (
+	// keyringPrefix keeps the descriptions of the vault's keys apart from
+	// those of other programs sharing the session keyring.
+	keyringPrefix = "vault:"
+
+	// maxKeyringValueSize is the largest payload of a "user" key.
+	maxKeyringValueSize = 32767
+)
+
+// keyringProbe caches whether the session keyring can be used, which is
+// probed once per process.
+var keyringProbe struct {
+	once sync.Once
+	ok   bool
+}
+
+// useSessionKeyring reports whether the operation under ctx stores secrets
+// in the session keyring: it was selected and keyctl works.
+func useSessionKeyring(ctx context.Context) bool {
+	if !nativeConfigFrom(ctx).linuxSessionKeyring {
+		return false
+	}
+	keyringProbe.once.Do(func() {
+		// Fails with ENOSYS or EPERM where keyctl is unavailable or blocked
+		_, err := unix.KeyctlGetKeyringID(unix.KEY_SPEC_SESSION_KEYRING, true)
+		keyringProbe.ok = err == nil
+	})
+	return keyringProbe.ok
+}
+
+func keyringDescription(ctx context.Context, service, key string) string {
+	return keyringPrefix + itemName(ctx, service, key)
+}
+
+func setKeyring(desc string, value []byte) error {
+	if len(value) > maxKeyringValueSize {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrValueTooLarge, len(value), maxKeyringValueSize)
+	}
+	// add_key replaces the payload of an existing key with the description
+	if _, err := unix.AddKey("user", desc, value, unix.KEY_SPEC_SESSION_KEYRING); err != nil {
+		if errors.Is(err, unix.EDQUOT) {
+			return fmt.Errorf("%w: the keyring quota is exhausted", ErrValueTooLarge)
+		}
+		return fmt.Errorf("vault: failed to set key: %w", err)
+	}
+	return nil
+}
+
+// searchKeyring returns the serial number of the key with desc.
+func searchKeyring(desc string) (int, error) {
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_SESSION_KEYRING, "user", desc, 0)
+	if err != nil {
+		// EKEYREVOKED and EKEYEXPIRED are keys on their way out
+		if errors.Is(err, unix.ENOKEY) || errors.Is(err, unix.EKEYREVOKED) || errors.Is(err, unix.EKEYEXPIRED) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+func getKeyring(desc string) ([]byte, error) {
+	id, err := searchKeyring(desc)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("vault: failed to get key: %w", err)
+	}
+	value, err := readKey(id)
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to get key: %w", err)
+	}
+	if len(value) == 0 {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+// readKey returns the payload of key id, which may grow between reading
+// its size and its content.
+func readKey(id int) ([]byte, error) {
+	buf := make([]byte, 512)
+	for {
+		n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		if n <= len(buf) {
+			return buf[:n], nil
+		}
+		buf = make([]byte, n)
+	}
+}
+
+func metadataKeyring(desc string) (Metadata, error) {
+	// Keys have no room for the app identity
+	if _, err := searchKeyring(desc); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Metadata{}, err
+		}
+		return Metadata{}, fmt.Errorf("vault: failed to get metadata: %w", err)
+	}
+	return Metadata{}, nil
+}
+
+func deleteKeyring(desc string) error {
+	id, err := searchKeyring(desc)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("vault: failed to delete key: %w", err)
+	}
+	// Invalidating rather than unlinking removes the key from every keyring
+	// it was linked into
+	if _, err := unix.KeyctlInt(unix.KEYCTL_INVALIDATE, id, 0, 0, 0); err != nil {
+		return fmt.Errorf("vault: failed to delete key: %w", err)
+	}
+	return nil
+}
+
+func listKeyring(ctx context.Context, service string) ([]string, error) {
+	prefix := keyringPrefix + itemPrefix(ctx, service)
+	ring, err := unix.KeyctlGetKeyringID(unix.KEY_SPEC_SESSION_KEYRING, false)
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to list keys: %w", err)
+	}
+	// Reading a keyring returns the serial numbers of its keys as int32s
+	ids, err := readKey(ring)
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to list keys: %w", err)
+	}
+
+	var keys []string
+	for i := 0; i+4 <= len(ids); i += 4 {
+		id := int(int32(binary.NativeEndian.Uint32(ids[i:])))
+		// The description is "type;uid;gid;perm;description"
+		info, err := unix.KeyctlString(unix.KEYCTL_DESCRIBE, id)
+		if err != nil {
+			continue // removed meanwhile, or not viewable
+		}
+		fields := strings.SplitN(info, ";", 5)
+		if len(fields) != 5 || fields[0] != "user" {
+			continue
+		}
+		if key, ok := itemKey(ctx, fields[4], prefix); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,648 @@
+//go:build linux && !android
+
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSecretToolSearch(t *testing.T) {
+	out := []byte(`[/org/freedesktop/secrets/collection/login/12]
+label = myapp/api-key
+secret = c2VjcmV0
+created = 2024-01-02 03:04:05
+modified = 2024-01-02 03:04:05
+schema = org.freedesktop.Secret.Generic
+attribute.key = api-key
+attribute.service = myapp
+[/org/freedesktop/secrets/collection/login/13]
+label = myapp/db password
+secret = cGFzcw==
+created = 2024-01-02 03:04:05
+modified = 2024-01-02 03:04:05
+schema = org.freedesktop.Secret.Generic
+attribute.key = db password
+attribute.service = myapp
+`)
+
+	got := parseSecretToolSearch(out, "key")
+	want := []string{"api-key", "db password"}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseSecretToolSearch returned %q, want %q", got, want)
+	}
+
+	if got := parseSecretToolSearch(nil, "key"); len(got) != 0 {
+		t.Errorf("parseSecretToolSearch of empty output returned %q, want no keys", got)
+	}
+}
+
+func TestStorageDirUnavailable(t *testing.T) {
+	// A path below a regular file can never be created, even as root
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_DATA_HOME", filepath.Join(file, "data"))
+
+	if _, err := getStorageDir(); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("getStorageDir: expected ErrBackendUnavailable, got %v", err)
+	}
+	if err := platformFiles.set(context.Background(), testService, "key", []byte("value")); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("set: expected ErrBackendUnavailable, got %v", err)
+	}
+}
+
+func TestStorageDirReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	dataHome := t.TempDir()
+	if err := os.Chmod(dataHome, 0o500); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dataHome, 0o700) })
+	t.Setenv("XDG_DATA_HOME", dataHome)
+
+	if _, err := getStorageDir(); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("getStorageDir: expected ErrBackendUnavailable, got %v", err)
+	}
+}
+
+func TestParseSecretToolAttribute(t *testing.T) {
+	out := []byte(`[/org/freedesktop/secrets/collection/login/12]
+label = myapp/api-key
+secret = c2VjcmV0
+attribute.app = deploy-tool
+attribute.key = api-key
+attribute.service = myapp
+`)
+	if got := parseSecretToolAttribute(out, "app"); !slices.Equal(got, []string{"deploy-tool"}) {
+		t.Errorf("parseSecretToolAttribute(app) = %q, want [deploy-tool]", got)
+	}
+	if got := parseSecretToolAttribute(out, "owner"); len(got) != 0 {
+		t.Errorf("parseSecretToolAttribute(owner) = %q, want none", got)
+	}
+}
+
+func TestSecretToolCommandRunner(t *testing.T) {
+	var calls [][]string
+	var stored []byte
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		switch args[0] {
+		case "store":
+			stored, _ = io.ReadAll(CommandStdin(ctx))
+		case "lookup":
+			return stored, nil, nil
+		}
+		return nil, nil, nil
+	})
+	t.Cleanup(func() { SetCommandRunner(nil) })
+
+	ctx := context.Background()
+	if err := setSecretTool(ctx, testService, "key", []byte("value")); err != nil {
+		t.Fatalf("setSecretTool failed: %v", err)
+	}
+	got, err := getSecretTool(ctx, testService, "key")
+	if err != nil {
+		t.Fatalf("getSecretTool failed: %v", err)
+	}
+	if string(got) != "value" {
+		t.Errorf("getSecretTool = %q, want %q", got, "value")
+	}
+
+	var subcommands []string
+	for _, call := range calls {
+		if call[0] != "secret-tool" {
+			t.Errorf("ran %q, want secret-tool", call[0])
+		}
+		subcommands = append(subcommands, call[1])
+	}
+	if want := []string{"search", "store", "lookup"}; !slices.Equal(subcommands, want) {
+		t.Errorf("subcommands = %v, want %v", subcommands, want)
+	}
+}
+
+// probeSecretToolWith makes hasSecretTool probe again with run as the
+// command runner.
+func probeSecretToolWith(t *testing.T, run CommandRunner) {
+	reset := func() {
+		secretToolProbe.mu.Lock()
+		secretToolProbe.done = false
+		secretToolProbe.mu.Unlock()
+	}
+	SetCommandRunner(run)
+	reset()
+	t.Cleanup(func() {
+		SetCommandRunner(nil)
+		reset()
+	})
+}
+
+// TestSecretToolStaleItems checks that Set stores the new item before
+// removing the ones stored with other attributes, and only those.
+func TestSecretToolStaleItems(t *testing.T) {
+	const items = "[/org/freedesktop/secrets/collection/login/1]\n" +
+		"attribute.app = myapp\n" +
+		"attribute.key = key\n" +
+		"attribute.service = " + testService + "\n" +
+		"[/org/freedesktop/secrets/collection/login/2]\n" +
+		"attribute.app = other\n" +
+		"attribute.key = key\n" +
+		"attribute.service = " + testService + "\n"
+	const legacy = "[/org/freedesktop/secrets/collection/login/3]\n" +
+		"attribute.key = key\n" +
+		"attribute.service = " + testService + "\n"
+
+	for _, tc := range []struct {
+		name, search string
+		storeFails   bool
+		want         [][]string
+	}{
+		{
+			name:   "other app",
+			search: items,
+			want: [][]string{
+				{"search", "--all", "service", testService, "key", "key"},
+				{"store", "--label", testService + "/key", "service", testService, "key", "key", "app", "myapp"},
+				{"clear", "app", "other", "key", "key", "service", testService},
+			},
+		},
+		{
+			name:       "store fails",
+			search:     items,
+			storeFails: true,
+			want: [][]string{
+				{"search", "--all", "service", testService, "key", "key"},
+				{"store", "--label", testService + "/key", "service", testService, "key", "key", "app", "myapp"},
+			},
+		},
+		{
+			name:   "no app",
+			search: legacy,
+			want: [][]string{
+				{"search", "--all", "service", testService, "key", "key"},
+				{"store", "--label", testService + "/key", "service", testService, "key", "key", "app", "myapp"},
+				{"clear", "key", "key", "service", testService},
+				{"store", "--label", testService + "/key", "service", testService, "key", "key", "app", "myapp"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls [][]string
+			SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+				if args[0] == "clear" {
+					// Stale items are cleared with their attributes in map
+					// order: sort them by name
+					pairs := make([][]string, 0, len(args)/2)
+					for i := 1; i+1 < len(args); i += 2 {
+						pairs = append(pairs, args[i:i+2])
+					}
+					slices.SortFunc(pairs, func(a, b []string) int { return strings.Compare(a[0], b[0]) })
+					args = []string{"clear"}
+					for _, pair := range pairs {
+						args = append(args, pair...)
+					}
+				}
+				calls = append(calls, args)
+				switch args[0] {
+				case "search":
+					return []byte(tc.search), nil, nil
+				case "store":
+					if tc.storeFails {
+						return nil, []byte("secret-tool: No such secret collection at path"), errors.New("exit status 1")
+					}
+				}
+				return nil, nil, nil
+			})
+			t.Cleanup(func() { SetCommandRunner(nil) })
+
+			err := setSecretTool(context.WithValue(context.Background(), appIDKey{}, "myapp"), testService, "key", []byte("value"))
+			if tc.storeFails != (err != nil) {
+				t.Fatalf("setSecretTool = %v", err)
+			}
+			if !slices.EqualFunc(calls, tc.want, slices.Equal) {
+				t.Errorf("ran %q, want %q", calls, tc.want)
+			}
+		})
+	}
+}
+
+func TestSecretToolWithoutDBus(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	var calls int
+	probeSecretToolWith(t, func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		calls++
+		return nil, []byte("secret-tool: Cannot autolaunch D-Bus without X11 $DISPLAY\n"), errors.New("exit status 1")
+	})
+
+	if hasSecretTool() {
+		t.Fatal("hasSecretTool = true with an unreachable Secret Service")
+	}
+
+	ctx := context.Background()
+	if err := set(ctx, testService, "key", []byte("value")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	got, err := get(ctx, testService, "key")
+	if err != nil || string(got) != "value" {
+		t.Errorf("get = %q, %v, want value", got, err)
+	}
+	if calls != 1 {
+		t.Errorf("ran secret-tool %d times, want only the probe", calls)
+	}
+	if activeFiles(context.Background()) == nil {
+		t.Error("activeFiles = nil, want the file storage")
+	}
+}
+
+func TestSecretToolProbe(t *testing.T) {
+	// A lookup that finds nothing exits non-zero silently
+	probeSecretToolWith(t, func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		return nil, nil, errors.New("exit status 1")
+	})
+	if !hasSecretTool() {
+		t.Error("hasSecretTool = false with a working Secret Service")
+	}
+}
+
+func TestSecretToolBinaryValues(t *testing.T) {
+	var stored []byte
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		switch args[0] {
+		case "store":
+			// Like a C string, the secret ends at the first NUL
+			stored, _ = io.ReadAll(CommandStdin(ctx))
+			stored, _, _ = bytes.Cut(stored, []byte{0})
+		case "lookup":
+			return stored, nil, nil
+		}
+		return nil, nil, nil
+	})
+	t.Cleanup(func() { SetCommandRunner(nil) })
+
+	ctx := context.Background()
+	for _, value := range [][]byte{
+		[]byte("plain text"),
+		[]byte("secret \n"),
+		[]byte("with\x00nul"),
+		{0xFF, 0xFE},
+		[]byte(secretToolBinaryPrefix + "looks encoded"),
+	} {
+		if err := setSecretTool(ctx, testService, "key", value); err != nil {
+			t.Fatalf("setSecretTool failed: %v", err)
+		}
+		raw, err := getSecretTool(ctx, testService, "key")
+		if err != nil {
+			t.Fatalf("getSecretTool failed: %v", err)
+		}
+		got, err := decodeSecretToolValue(raw)
+		if err != nil || !bytes.Equal(got, value) {
+			t.Errorf("round trip of %q = %q, %v", value, got, err)
+		}
+	}
+	if string(encodeSecretToolValue([]byte("plain text"))) != "plain text" {
+		t.Error("text values are not stored as given")
+	}
+}
+
+func TestSessionKeyring(t *testing.T) {
+	b := NativeBackend(WithLinuxSessionKeyring())
+	ctx := context.Background()
+	if !useSessionKeyring(b.(nativeBackend).context(ctx)) {
+		t.Skip("the kernel keyring is not available")
+	}
+	service := "vault-test-keyring-service"
+
+	values := map[string][]byte{
+		"token":  []byte("secret"),
+		"binary": {0, 1, 2, 0xff},
+		"padded": []byte("secret \n"),
+	}
+	for key, value := range values {
+		if err := b.Set(ctx, service, key, value); err != nil {
+			t.Fatalf("Set %s: %v", key, err)
+		}
+		t.Cleanup(func() { b.Del(ctx, service, key) })
+	}
+	for key, want := range values {
+		if got, err := b.Get(ctx, service, key); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Get %s = %q, %v, want %q", key, got, err, want)
+		}
+	}
+	if err := b.Set(ctx, service, "token", []byte("replaced")); err != nil {
+		t.Fatalf("Set to replace: %v", err)
+	}
+	if got, err := b.Get(ctx, service, "token"); err != nil || string(got) != "replaced" {
+		t.Errorf("Get after replacing = %q, %v, want replaced", got, err)
+	}
+
+	keys, err := b.List(ctx, service)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	slices.Sort(keys)
+	if want := []string{"binary", "padded", "token"}; !slices.Equal(keys, want) {
+		t.Errorf("List = %q, want %q", keys, want)
+	}
+
+	if err := b.Del(ctx, service, "token"); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+	if _, err := b.Get(ctx, service, "token"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Del: expected ErrNotFound, got %v", err)
+	}
+	if err := b.Del(ctx, service, "token"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Del of a missing key: expected ErrNotFound, got %v", err)
+	}
+
+	// The other storage is untouched
+	if _, err := NativeBackend().Get(ctx, service, "binary"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get from the default storage: expected ErrNotFound, got %v", err)
+	}
+
+	if err := b.Set(ctx, service, "big", make([]byte, maxKeyringValueSize+1)); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("Set over the key size limit: expected ErrValueTooLarge, got %v", err)
+	}
+}
+
+func TestSessionKeyringEncodedNames(t *testing.T) {
+	legacy := NativeBackend(WithLinuxSessionKeyring())
+	b := NativeBackend(WithLinuxSessionKeyring(), WithEncodedNames())
+	ctx := context.Background()
+	if !useSessionKeyring(b.(nativeBackend).context(ctx)) {
+		t.Skip("the kernel keyring is not available")
+	}
+	service := "vault-test-encoded"
+	t.Cleanup(func() {
+		for _, key := range []string{"a/b", "c", "plain", "new key"} {
+			legacy.Del(ctx, service, key)
+			b.Del(ctx, service, key)
+		}
+	})
+
+	// Items stored with the unencoded names
+	for key, value := range map[string]string{"a/b": "old", "plain": "same"} {
+		if err := legacy.Set(ctx, service, key, []byte(value)); err != nil {
+			t.Fatalf("Set %s: %v", key, err)
+		}
+	}
+	if err := b.Set(ctx, service, "new key", []byte("new")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got, err := b.Get(ctx, service, "a/b"); err != nil || string(got) != "old" {
+		t.Errorf("Get of an unencoded item = %q, %v, want old", got, err)
+	}
+	keys, err := b.List(ctx, service)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	slices.Sort(keys)
+	if want := []string{"a/b", "new key", "plain"}; !slices.Equal(keys, want) {
+		t.Errorf("List = %q, want %q", keys, want)
+	}
+
+	// Set moves the item to its encoded name
+	if err := b.Set(ctx, service, "a/b", []byte("moved")); err != nil {
+		t.Fatalf("Set to move: %v", err)
+	}
+	if _, err := legacy.Get(ctx, service, "a/b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unencoded item after Set: expected ErrNotFound, got %v", err)
+	}
+	if got, err := b.Get(ctx, service, "a/b"); err != nil || string(got) != "moved" {
+		t.Errorf("Get after moving = %q, %v, want moved", got, err)
+	}
+
+	// Service "vault-test-encoded/a" and key "b" no longer collide
+	if _, err := b.Get(ctx, service+"/a", "b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a colliding pair: expected ErrNotFound, got %v", err)
+	}
+
+	if err := b.Del(ctx, service, "plain"); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+	if err := b.Del(ctx, service, "plain"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Del of a missing key: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSecretToolLock(t *testing.T) {
+	var calls []string
+	var stdin []byte
+	probeSecretToolWith(t, func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		if len(args) > 0 && args[0] == "lookup" {
+			return nil, nil, errors.New("exit status 1")
+		}
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		stdin, _ = io.ReadAll(CommandStdin(ctx))
+		if name == "gnome-keyring-daemon" && string(stdin) != "hunter2" {
+			return nil, []byte("gnome-keyring-daemon: couldn't unlock login keyring\n"), errors.New("exit status 1")
+		}
+		return nil, nil, nil
+	})
+
+	if err := Lock(); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	b := NativeBackend(WithSecretToolCollection("session")).(nativeBackend)
+	if err := b.lockKeychain(context.Background()); err != nil {
+		t.Fatalf("lock of a collection failed: %v", err)
+	}
+	if err := Unlock([]byte("hunter2")); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	want := []string{
+		"secret-tool lock --collection /org/freedesktop/secrets/aliases/default",
+		"secret-tool lock --collection /org/freedesktop/secrets/aliases/session",
+		"gnome-keyring-daemon --unlock",
+	}
+	if !slices.Equal(calls, want) {
+		t.Errorf("commands = %q, want %q", calls, want)
+	}
+
+	// The password goes through stdin, never into errors
+	err := Unlock([]byte("wrong-password"))
+	if err == nil || strings.Contains(err.Error(), "wrong-password") {
+		t.Errorf("Unlock with a wrong password = %v", err)
+	}
+	for _, call := range calls {
+		if strings.Contains(call, "hunter2") || strings.Contains(call, "wrong-password") {
+			t.Errorf("password passed as an argument: %q", call)
+		}
+	}
+}
+
+func TestSecretToolCorruptValue(t *testing.T) {
+	if _, err := decodeSecretToolValue([]byte(secretToolBinaryPrefix + "not base64!")); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("decodeSecretToolValue of a corrupt value: expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestSecretToolGoKeyringCompat(t *testing.T) {
+	// An item as go-keyring stores it, through the Secret Service API
+	search := []byte(`[/org/freedesktop/secrets/collection/login/7]
+label = Password for 'alice' on 'myapp'
+secret = hunter2
+created = 2024-01-02 03:04:05
+modified = 2024-01-02 03:04:05
+schema = org.freedesktop.Secret.Generic
+attribute.service = myapp
+attribute.username = alice
+`)
+	var calls [][]string
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		calls = append(calls, args)
+		switch args[0] {
+		case "lookup":
+			if slices.Equal(args[1:], []string{"service", "myapp", "username", "alice"}) {
+				return []byte("hunter2"), nil, nil
+			}
+			return nil, nil, errors.New("exit status 1")
+		case "search":
+			return search, nil, nil
+		}
+		return nil, nil, nil
+	})
+	t.Cleanup(func() { SetCommandRunner(nil) })
+
+	ctx := goKeyringContext()
+	if got, err := getSecretTool(ctx, "myapp", "alice"); err != nil || string(got) != "hunter2" {
+		t.Errorf("getSecretTool = %q, %v, want hunter2", got, err)
+	}
+	if keys, err := listSecretTool(ctx, "myapp"); err != nil || !slices.Equal(keys, []string{"alice"}) {
+		t.Errorf("listSecretTool = %q, %v, want [alice]", keys, err)
+	}
+	if _, err := metadataSecretTool(ctx, "myapp", "alice"); err != nil {
+		t.Errorf("metadataSecretTool failed: %v", err)
+	}
+
+	calls = nil
+	if err := setSecretTool(ctx, "myapp", "bob", []byte("secret")); err != nil {
+		t.Fatalf("setSecretTool failed: %v", err)
+	}
+	store := calls[len(calls)-1]
+	want := []string{"store", "--label", "Password for 'bob' on 'myapp'", "service", "myapp", "username", "bob"}
+	if !slices.Equal(store[:len(want)], want) {
+		t.Errorf("store arguments = %q, want %q", store, want)
+	}
+}
+
+func TestSecretToolCollection(t *testing.T) {
+	reset := func() {
+		secretToolStoreFlags.mu.Lock()
+		secretToolStoreFlags.done = false
+		secretToolStoreFlags.mu.Unlock()
+	}
+	t.Cleanup(reset)
+
+	for _, tc := range []struct {
+		name, help string
+		supported  bool
+	}{
+		{"old", "Usage:\n  secret-tool store [OPTION…]\n\n  -l, --label     the label for the new stored item\n", false},
+		{"new", "Usage:\n  secret-tool store [OPTION…]\n\n  -l, --label       the label for the new stored item\n  -c, --collection  the collection in which to place the stored item\n", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reset()
+			var helps, clears int
+			var store []string
+			SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+				switch {
+				case slices.Equal(args, []string{"store", "--help"}):
+					helps++
+					return []byte(tc.help), nil, nil
+				case args[0] == "store":
+					store = args
+				case args[0] == "clear":
+					clears++
+				}
+				return nil, nil, nil
+			})
+			t.Cleanup(func() { SetCommandRunner(nil) })
+
+			ctx := NativeBackend(WithSecretToolCollection("session")).(nativeBackend).context(context.Background())
+			for range 2 {
+				err := setSecretTool(ctx, testService, "key", []byte("value"))
+				if tc.supported {
+					if err != nil {
+						t.Fatalf("setSecretTool failed: %v", err)
+					}
+					if i := slices.Index(store, "--collection"); i < 0 || store[i+1] != "session" {
+						t.Errorf("store arguments = %q, want --collection session", store)
+					}
+				} else {
+					if !errors.Is(err, errors.ErrUnsupported) {
+						t.Errorf("setSecretTool with an old secret-tool = %v, want errors.ErrUnsupported", err)
+					}
+					if clears != 0 {
+						t.Error("setSecretTool with an old secret-tool removed the existing item")
+					}
+				}
+			}
+			if helps != 1 {
+				t.Errorf("read the secret-tool help %d times, want 1", helps)
+			}
+		})
+	}
+
+	// Without the option the help is never read
+	reset()
+	SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		if args[0] == "store" && slices.Contains(args, "--help") {
+			t.Error("read the secret-tool help without WithSecretToolCollection")
+		}
+		return nil, nil, nil
+	})
+	t.Cleanup(func() { SetCommandRunner(nil) })
+	if err := setSecretTool(context.Background(), testService, "key", []byte("value")); err != nil {
+		t.Errorf("setSecretTool failed: %v", err)
+	}
+}
+
+func TestNoSecretInErrorsSecretTool(t *testing.T) {
+	t.Run("working", func(t *testing.T) {
+		stored := map[string][]byte{}
+		probeSecretToolWith(t, func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+			i := slices.Index(args, "service")
+			id := args[i+1] + "/" + args[min(i+3, len(args)-1)]
+			switch args[0] {
+			case "store":
+				stored[id], _ = io.ReadAll(CommandStdin(ctx))
+			case "lookup":
+				if value, ok := stored[id]; ok {
+					return value, nil, nil
+				}
+				return nil, nil, errors.New("exit status 1")
+			case "clear":
+				delete(stored, id)
+			case "search":
+				var out strings.Builder
+				for id := range stored {
+					service, key, _ := strings.Cut(id, "/")
+					fmt.Fprintf(&out, "[/org/freedesktop/secrets/collection/login/1]\nattribute.service = %s\nattribute.key = %s\n", service, key)
+				}
+				return []byte(out.String()), nil, nil
+			}
+			return nil, nil, nil
+		})
+		checkNoSecretLeaks(t, NativeBackend())
+	})
+	t.Run("failing", func(t *testing.T) {
+		probeSecretToolWith(t, func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+			if args[0] == "lookup" && args[2] == ".vault-probe" {
+				return nil, nil, errors.New("exit status 1")
+			}
+			return nil, []byte("secret-tool: Cannot create an item in a locked collection\n"), errors.New("exit status 1")
+		})
+		checkNoSecretLeaks(t, NativeBackend())
+	})
+}
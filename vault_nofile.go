@@ -0,0 +1,11 @@
+//go:build !linux && !ios
+
+package vault
+
+import "context"
+
+// platformFiles is nil on the platforms that store secrets in a native
+// credential store.
+var platformFiles *fileStore
+
+func activeFiles(context.Context) *fileStore { return nil }
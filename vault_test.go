@@ -1,6 +1,11 @@
 package vault
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"sort"
 	"testing"
 )
 
@@ -82,6 +87,25 @@ func TestDelNotFound(t *testing.T) {
 	}
 }
 
+func TestDelIfExists(t *testing.T) {
+	key := "test-del-if-exists-key"
+	if err := Set(testService, key, []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	deleted, err := DelIfExists(testService, key)
+	if err != nil || !deleted {
+		t.Errorf("DelIfExists of existing key = %v, %v, want true, nil", deleted, err)
+	}
+	deleted, err = DelIfExists(testService, key)
+	if err != nil || deleted {
+		t.Errorf("DelIfExists of missing key = %v, %v, want false, nil", deleted, err)
+	}
+	if _, err := DelIfExists("", key); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("DelIfExists with empty service error = %v, want ErrInvalidKey", err)
+	}
+}
+
 func TestInvalidInputs(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -99,25 +123,25 @@ func TestInvalidInputs(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			err := Set(tt.service, tt.key, tt.value)
-			if err != tt.wantErr {
+			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("Set(%q, %q, %v) = %v, want %v", tt.service, tt.key, tt.value, err, tt.wantErr)
 			}
 		})
 	}
 
 	// Test Get with invalid inputs
-	if _, err := Get("", "key"); err != ErrInvalidKey {
+	if _, err := Get("", "key"); !errors.Is(err, ErrInvalidKey) {
 		t.Errorf("Get with empty service = %v, want ErrInvalidKey", err)
 	}
-	if _, err := Get("service", ""); err != ErrInvalidKey {
+	if _, err := Get("service", ""); !errors.Is(err, ErrInvalidKey) {
 		t.Errorf("Get with empty key = %v, want ErrInvalidKey", err)
 	}
 
 	// Test Del with invalid inputs
-	if err := Del("", "key"); err != ErrInvalidKey {
+	if err := Del("", "key"); !errors.Is(err, ErrInvalidKey) {
 		t.Errorf("Del with empty service = %v, want ErrInvalidKey", err)
 	}
-	if err := Del("service", ""); err != ErrInvalidKey {
+	if err := Del("service", ""); !errors.Is(err, ErrInvalidKey) {
 		t.Errorf("Del with empty key = %v, want ErrInvalidKey", err)
 	}
 }
@@ -171,3 +195,221 @@ func TestSpecialCharacters(t *testing.T) {
 		t.Errorf("Get returned %q, want %q", got, value)
 	}
 }
+
+func TestContextCanceled(t *testing.T) {
+	key := "test-context-key"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := SetContext(ctx, testService, key, []byte("value")); err != context.Canceled {
+		t.Errorf("SetContext with canceled context = %v, want context.Canceled", err)
+	}
+	if _, err := GetContext(ctx, testService, key); err != context.Canceled {
+		t.Errorf("GetContext with canceled context = %v, want context.Canceled", err)
+	}
+	if err := DelContext(ctx, testService, key); err != context.Canceled {
+		t.Errorf("DelContext with canceled context = %v, want context.Canceled", err)
+	}
+
+	// Nothing should have been stored
+	if _, err := Get(testService, key); err != ErrNotFound {
+		t.Errorf("Get after canceled SetContext returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	key := "test-sync-key"
+
+	// Clean up
+	defer Del(testService, key)
+
+	if err := Set(testService, key, []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+}
+
+func TestGetRaw(t *testing.T) {
+	key := "test-raw-key"
+	value := []byte("raw \x00 value")
+
+	// Clean up
+	defer Del(testService, key)
+	_ = Del(testService, key)
+
+	if _, err := GetRaw(testService, ""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("GetRaw with empty key: expected ErrInvalidKey, got %v", err)
+	}
+	if _, err := GetRaw(testService, key); err != ErrNotFound {
+		t.Errorf("GetRaw of missing key: expected ErrNotFound, got %v", err)
+	}
+
+	if err := Set(testService, key, value); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	raw, err := GetRaw(testService, key)
+	if err != nil {
+		t.Fatalf("GetRaw failed: %v", err)
+	}
+	if len(raw) == 0 {
+		t.Error("GetRaw returned no bytes")
+	}
+}
+
+func TestList(t *testing.T) {
+	service := "vault-test-list-service"
+	keys := []string{"list-key-a", "list-key-b", "list-key-c"}
+
+	// Clean up
+	for _, key := range keys {
+		defer Del(service, key)
+		_ = Del(service, key)
+	}
+
+	got, err := List(service)
+	if err != nil {
+		t.Fatalf("List on empty service failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("List on empty service returned %q, want no keys", got)
+	}
+
+	for _, key := range keys {
+		if err := Set(service, key, []byte("value")); err != nil {
+			t.Fatalf("Set %q failed: %v", key, err)
+		}
+	}
+	// A key in another service must not be listed
+	defer Del(testService, "list-key-other")
+	if err := Set(testService, "list-key-other", []byte("value")); err != nil {
+		t.Fatalf("Set in other service failed: %v", err)
+	}
+
+	got, err = List(service)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	sort.Strings(got)
+	if !slices.Equal(got, keys) {
+		t.Errorf("List returned %q, want %q", got, keys)
+	}
+
+	if _, err := List(""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("List with empty service = %v, want ErrInvalidKey", err)
+	}
+}
+
+// unorderedBackend lists keys in the order given, duplicates included, as
+// a directory scan or the Keychain can.
+type unorderedBackend struct {
+	*MemoryBackend
+	keys []string
+}
+
+func (b unorderedBackend) List(context.Context, string) ([]string, error) {
+	return slices.Clone(b.keys), nil
+}
+
+func TestListSorted(t *testing.T) {
+	b := useMemory(t)
+	service := "vault-test-list-service"
+	want := []string{"A", "a", "aa", "b", "key-10", "key-2", "z"}
+	for _, i := range []int{4, 0, 6, 2, 5, 1, 3} {
+		if err := b.Set(context.Background(), service, want[i], []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Map iteration order varies between calls
+	for range 10 {
+		if got, err := List(service); err != nil || !slices.Equal(got, want) {
+			t.Fatalf("List = %q, %v, want %q", got, err, want)
+		}
+	}
+
+	SetDefaultBackend(unorderedBackend{NewMemoryBackend(), []string{"b", "a", "b", ".vault-schema-version", "a"}})
+	if got, err := List(service); err != nil || !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("List = %q, %v, want [a b]", got, err)
+	}
+}
+
+// TestNULValues checks that values with NUL bytes, which would be cut short
+// if they reached a CLI tool unencoded, survive every backend.
+func TestNULValues(t *testing.T) {
+	values := [][]byte{
+		{0x00},
+		[]byte("before\x00after"),
+		[]byte("trailing\x00\x00"),
+		{0x00, 0xFF, 0x00, 0x80},
+	}
+
+	backends := testBackends(t)
+	backends["native"] = NativeBackend()
+	encrypted, err := NewEncryptedFileBackend(t.TempDir(), []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	backends["encrypted"] = encrypted
+
+	ctx := context.Background()
+	for name, b := range backends {
+		t.Run(name, func(t *testing.T) {
+			defer b.Del(ctx, testService, "test-nul-key")
+			for _, value := range values {
+				if err := b.Set(ctx, testService, "test-nul-key", value); err != nil {
+					t.Fatalf("Set(%q) failed: %v", value, err)
+				}
+				got, err := b.Get(ctx, testService, "test-nul-key")
+				if err != nil {
+					t.Fatalf("Get failed: %v", err)
+				}
+				if !bytes.Equal(got, value) {
+					t.Errorf("Get = %q, want %q", got, value)
+				}
+			}
+		})
+	}
+}
+
+// TestWhitespaceRoundTrip checks that whitespace trimmed from the transport
+// encoding never reaches the value: a value that starts or ends with
+// whitespace reads back byte for byte.
+func TestWhitespaceRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	values := [][]byte{
+		[]byte("secret \n"),
+		[]byte("\t secret\r\n"),
+		[]byte(" "),
+	}
+
+	files, _ := newTestFileStore(t)
+	authenticated, _ := newIntegrityFileStore(t)
+	encrypted, err := NewEncryptedFileBackend(t.TempDir(), []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileBackend failed: %v", err)
+	}
+	backends := map[string]Backend{
+		"memory":        NewMemoryBackend(),
+		"file":          filesBackend{files},
+		"authenticated": filesBackend{authenticated},
+		"encrypted":     encrypted,
+	}
+	useIntegrityKey(t, []byte("0123456789abcdef0123456789abcdef"))
+
+	for name, b := range backends {
+		v, err := New(WithBackend(b))
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		for _, value := range values {
+			if err := v.SetContext(ctx, testService, "key", value); err != nil {
+				t.Fatalf("%s: Set(%q) failed: %v", name, value, err)
+			}
+			if got, err := v.GetContext(ctx, testService, "key"); err != nil || !bytes.Equal(got, value) {
+				t.Errorf("%s: Get = %q, %v, want %q", name, got, err, value)
+			}
+		}
+	}
+}
@@ -4,130 +4,282 @@ package vault
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
+	"encoding/binary"
 	"fmt"
-	"os/exec"
-	"strings"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
 )
 
-// Windows implementation using PowerShell with DPAPI (Data Protection API)
-// through the Windows Credential Manager. No CGO required.
-
-func set(service, key string, value []byte) error {
-	// Use PowerShell to store credential in Windows Credential Manager
-	// The credential is stored as a Generic credential
-	credName := service + "/" + key
-	encodedValue := base64.StdEncoding.EncodeToString(value)
-
-	// PowerShell script to add credential
-	script := fmt.Sprintf(`
-$credName = '%s'
-$credValue = '%s'
-$securePassword = ConvertTo-SecureString -String $credValue -AsPlainText -Force
-$credential = New-Object System.Management.Automation.PSCredential($credName, $securePassword)
-
-# Remove existing credential if it exists
-try {
-    cmdkey /delete:$credName 2>$null
-} catch {}
-
-# Add new credential using cmdkey
-$bytes = [System.Text.Encoding]::UTF8.GetBytes($credValue)
-cmdkey /generic:$credName /user:$credName /pass:$credValue
-if ($LASTEXITCODE -ne 0) {
-    exit 1
-}
-`, credName, encodedValue)
+// Windows implementation calling the Credential Manager API in advapi32.dll
+// (CredWriteW, CredReadW, CredDeleteW, CredEnumerateW) directly, without
+// CGO, PowerShell or cmdkey. Each secret is a generic credential whose
+// target and user name are "service/key", or service and key joined by the
+// separator set with WithSeparator and encoded with WithEncodedNames.
 
-	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+const (
+	credTypeGeneric         = 1 // CRED_TYPE_GENERIC
+	credPersistSession      = 1 // CRED_PERSIST_SESSION
+	credPersistLocalMachine = 2 // CRED_PERSIST_LOCAL_MACHINE
+	credPersistEnterprise   = 3 // CRED_PERSIST_ENTERPRISE
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("vault: failed to set key: %s", stderr.String())
-	}
+	credMaxBlobSize = 5 * 512 // CRED_MAX_CREDENTIAL_BLOB_SIZE
 
-	return nil
-}
+	// maxNativeValueSize is the largest value whose base64 encoding fits
+	// in a credential blob as UTF-16.
+	maxNativeValueSize = credMaxBlobSize / 2 / 4 * 3
+)
 
-func get(service, key string) ([]byte, error) {
-	credName := service + "/" + key
+var (
+	advapi32           = windows.NewLazySystemDLL("advapi32.dll")
+	procCredWriteW     = advapi32.NewProc("CredWriteW")
+	procCredReadW      = advapi32.NewProc("CredReadW")
+	procCredDeleteW    = advapi32.NewProc("CredDeleteW")
+	procCredEnumerateW = advapi32.NewProc("CredEnumerateW")
+	procCredFree       = advapi32.NewProc("CredFree")
+)
 
-	// PowerShell script to retrieve credential
-	script := fmt.Sprintf(`
-$output = cmdkey /list:"%s" 2>&1
-if ($output -match "NONE") {
-    exit 1
+// credential mirrors the CREDENTIALW structure.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
 }
 
-# Use .NET to read the credential
-Add-Type -AssemblyName System.Runtime.InteropServices
+func set(ctx context.Context, service, key string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-$sig = @"
-[DllImport("advapi32.dll", SetLastError = true, CharSet = CharSet.Unicode)]
-public static extern bool CredRead(string target, int type, int reservedFlag, out IntPtr credentialPtr);
+	target, err := windows.UTF16PtrFromString(itemName(ctx, service, key))
+	if err != nil {
+		return fmt.Errorf("vault: failed to set key: %w", err)
+	}
 
-[DllImport("advapi32.dll", SetLastError = true)]
-public static extern bool CredFree(IntPtr cred);
-"@
+	blob, err := encodeCredential(value)
+	if err != nil {
+		return fmt.Errorf("vault: failed to encode value: %w", err)
+	}
+	if len(blob) > credMaxBlobSize {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrValueTooLarge, len(value), maxNativeValueSize)
+	}
 
-$advapi32 = Add-Type -MemberDefinition $sig -Namespace "ADVAPI32" -Name "Util" -PassThru
+	var comment *uint16
+	if app := appIdentity(ctx); app != "" {
+		if comment, err = windows.UTF16PtrFromString(app); err != nil {
+			return fmt.Errorf("vault: invalid app identity: %w", err)
+		}
+	}
 
-$credPtr = [IntPtr]::Zero
-$result = $advapi32::CredRead("%s", 1, 0, [ref]$credPtr)
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		Comment:            comment,
+		CredentialBlobSize: uint32(len(blob)),
+		CredentialBlob:     &blob[0],
+		Persist:            credPersist(nativeConfigFrom(ctx).windowsPersistence),
+		UserName:           target,
+	}
 
-if (-not $result) {
-    exit 1
+	// CredWrite replaces an existing credential with the same target
+	if r, _, errno := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); r == 0 {
+		return fmt.Errorf("vault: failed to set key: %w", errno)
+	}
+	return nil
 }
 
-$cred = [System.Runtime.InteropServices.Marshal]::PtrToStructure($credPtr, [Type][System.Runtime.InteropServices.ComTypes.CREDENTIAL])
-
-# Read credential blob
-$blob = New-Object byte[] $cred.CredentialBlobSize
-[System.Runtime.InteropServices.Marshal]::Copy($cred.CredentialBlob, $blob, 0, $cred.CredentialBlobSize)
-$password = [System.Text.Encoding]::Unicode.GetString($blob)
+// credPersist returns the CredWrite persist flag for p.
+func credPersist(p WindowsPersistence) uint32 {
+	switch p {
+	case PersistSession:
+		return credPersistSession
+	case PersistEnterprise:
+		return credPersistEnterprise
+	default:
+		return credPersistLocalMachine
+	}
+}
 
-$advapi32::CredFree($credPtr)
-Write-Output $password
-`, credName, credName)
+func get(ctx context.Context, service, key string) ([]byte, error) {
+	blob, err := getRaw(ctx, service, key)
+	if err != nil {
+		return nil, err
+	}
 
-	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	decoded, err := decodeCredential(blob)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode value: %w", ErrCorrupt, err)
+	}
+	return decoded, nil
+}
 
-	if err := cmd.Run(); err != nil {
+// getRaw returns a copy of the credential blob, which is the encoded value
+// as UTF-16LE text.
+func getRaw(ctx context.Context, service, key string) ([]byte, error) {
+	var blob []byte
+	err := readCredential(ctx, service, key, func(cred *credential) {
+		// The blob is freed with the credential
+		blob = bytes.Clone(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) == 0 {
 		return nil, ErrNotFound
 	}
+	return blob, nil
+}
 
-	result := strings.TrimSpace(stdout.String())
-	if result == "" {
-		return nil, ErrNotFound
+func metadata(ctx context.Context, service, key string) (Metadata, error) {
+	var md Metadata
+	err := readCredential(ctx, service, key, func(cred *credential) {
+		md.App = windows.UTF16PtrToString(cred.Comment)
+	})
+	return md, err
+}
+
+// readCredential reads the credential for service and key and passes it to
+// fn, which must not retain it: it is freed when fn returns.
+func readCredential(ctx context.Context, service, key string, fn func(*credential)) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	decoded, err := base64.StdEncoding.DecodeString(result)
+	target, err := windows.UTF16PtrFromString(itemName(ctx, service, key))
 	if err != nil {
-		return nil, fmt.Errorf("vault: failed to decode value: %w", err)
+		return fmt.Errorf("vault: failed to get key: %w", err)
 	}
 
-	return decoded, nil
+	var cred *credential
+	r, _, errno := procCredReadW.Call(
+		uintptr(unsafe.Pointer(target)),
+		credTypeGeneric,
+		0,
+		uintptr(unsafe.Pointer(&cred)),
+	)
+	if r == 0 {
+		if errno == windows.ERROR_NOT_FOUND {
+			return ErrNotFound
+		}
+		return fmt.Errorf("vault: failed to get key: %w", errno)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	fn(cred)
+	return nil
 }
 
-func del(service, key string) error {
-	credName := service + "/" + key
+func del(ctx context.Context, service, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	cmd := exec.Command("cmdkey", "/delete:"+credName)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	target, err := windows.UTF16PtrFromString(itemName(ctx, service, key))
+	if err != nil {
+		return fmt.Errorf("vault: failed to delete key: %w", err)
+	}
 
-	if err := cmd.Run(); err != nil {
-		errStr := stderr.String()
-		if strings.Contains(strings.ToLower(errStr), "not found") ||
-			strings.Contains(strings.ToLower(errStr), "none") {
+	if r, _, errno := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0); r == 0 {
+		if errno == windows.ERROR_NOT_FOUND {
 			return ErrNotFound
 		}
-		return fmt.Errorf("vault: failed to delete key: %s", errStr)
+		return fmt.Errorf("vault: failed to delete key: %w", errno)
 	}
 
 	return nil
 }
+
+func list(ctx context.Context, service string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	prefix := itemPrefix(ctx, service)
+	filter, err := windows.UTF16PtrFromString(prefix + "*")
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to list keys: %w", err)
+	}
+
+	var (
+		count uint32
+		creds **credential
+	)
+	r, _, errno := procCredEnumerateW.Call(
+		uintptr(unsafe.Pointer(filter)),
+		0,
+		uintptr(unsafe.Pointer(&count)),
+		uintptr(unsafe.Pointer(&creds)),
+	)
+	if r == 0 {
+		if errno == windows.ERROR_NOT_FOUND {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("vault: failed to list keys: %w", errno)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(creds)))
+
+	var keys []string
+	for _, cred := range unsafe.Slice(creds, count) {
+		if cred.Type != credTypeGeneric {
+			continue
+		}
+		if key, ok := itemKey(ctx, windows.UTF16PtrToString(cred.TargetName), prefix); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// namedItems reports whether the operation under ctx identifies items by
+// the name itemName returns.
+func namedItems(context.Context) bool {
+	return true
+}
+
+func syncStorage() error {
+	// Credential Manager persists credentials as soon as they are written.
+	return nil
+}
+
+// encodeCredential and decodeCredential are the only place values are
+// converted to and from credential blobs. A value is encoded once, with the
+// default codec (base64), and that ASCII text is stored as UTF-16LE, the
+// form Credential Manager tools such as cmdkey use for passwords. This keeps
+// credentials written by earlier versions, which went through cmdkey,
+// readable.
+func encodeCredential(value []byte) ([]byte, error) {
+	text, err := defaultCodec.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	units := utf16.Encode([]rune(string(text)))
+	blob := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(blob[2*i:], u)
+	}
+	return blob, nil
+}
+
+func decodeCredential(blob []byte) ([]byte, error) {
+	if len(blob)%2 != 0 {
+		return nil, fmt.Errorf("credential blob has odd length %d, want UTF-16", len(blob))
+	}
+
+	units := make([]uint16, len(blob)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(blob[2*i:])
+	}
+	return defaultCodec.Decode([]byte(string(utf16.Decode(units))))
+}
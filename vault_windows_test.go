@@ -0,0 +1,90 @@
+//go:build windows
+
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCredentialBlobRoundTrip(t *testing.T) {
+	values := [][]byte{
+		[]byte("test-secret-value"),
+		{0x00, 0x01, 0x02, 0xFF, 0xFE, 0x80, 0x7F},
+		[]byte("hello 世界 🌍 \t\n\r special!@#$%^&*()"),
+		[]byte("trailing whitespace \n"),
+	}
+
+	for _, value := range values {
+		blob, err := encodeCredential(value)
+		if err != nil {
+			t.Fatalf("encodeCredential(%q) failed: %v", value, err)
+		}
+		got, err := decodeCredential(blob)
+		if err != nil {
+			t.Fatalf("decodeCredential failed: %v", err)
+		}
+		if !bytes.Equal(got, value) {
+			t.Errorf("round trip returned %q, want %q", got, value)
+		}
+	}
+}
+
+func TestCredentialBlobCmdkeyFormat(t *testing.T) {
+	// cmdkey /pass:dGVzdA== stores the password as UTF-16LE
+	blob := []byte{'d', 0, 'G', 0, 'V', 0, 'z', 0, 'd', 0, 'A', 0, '=', 0, '=', 0}
+
+	encoded, err := encodeCredential([]byte("test"))
+	if err != nil {
+		t.Fatalf("encodeCredential failed: %v", err)
+	}
+	if !bytes.Equal(encoded, blob) {
+		t.Errorf("encodeCredential returned %v, want %v", encoded, blob)
+	}
+
+	got, err := decodeCredential(blob)
+	if err != nil {
+		t.Fatalf("decodeCredential failed: %v", err)
+	}
+	if string(got) != "test" {
+		t.Errorf("decodeCredential returned %q, want %q", got, "test")
+	}
+
+	if _, err := decodeCredential(blob[:3]); err == nil {
+		t.Error("decodeCredential of odd-length blob succeeded, want error")
+	}
+}
+
+func TestCredPersist(t *testing.T) {
+	tests := []struct {
+		option WindowsPersistence
+		want   uint32
+	}{
+		{PersistLocalMachine, credPersistLocalMachine},
+		{PersistSession, credPersistSession},
+		{PersistEnterprise, credPersistEnterprise},
+	}
+	for _, tt := range tests {
+		if got := credPersist(tt.option); got != tt.want {
+			t.Errorf("credPersist(%d) = %d, want %d", tt.option, got, tt.want)
+		}
+	}
+
+	b := NativeBackend(WithWindowsPersistence(PersistSession)).(nativeBackend)
+	if got := nativeConfigFrom(b.context(context.Background())).windowsPersistence; got != PersistSession {
+		t.Errorf("backend context carries persistence %d, want PersistSession", got)
+	}
+}
+
+func TestSetValueTooLarge(t *testing.T) {
+	value := make([]byte, maxNativeValueSize+1)
+	if err := set(context.Background(), testService, "key", value); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("set of %d bytes error = %v, want ErrValueTooLarge", len(value), err)
+	}
+	blob, err := encodeCredential(make([]byte, maxNativeValueSize))
+	if err != nil || len(blob) > credMaxBlobSize {
+		t.Errorf("encoding %d bytes gives a %d-byte blob, over %d", maxNativeValueSize, len(blob), credMaxBlobSize)
+	}
+}
@@ -0,0 +1,311 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// quarantineDir is the subdirectory of a storage directory Repair moves
+// corrupt entries to. Its name is not valid base64url, so it is never
+// mistaken for a shard.
+const quarantineDir = ".vault-quarantine"
+
+// staleTempAge is how old a temporary file must be before Verify reports
+// it, so that writes in progress are left alone.
+const staleTempAge = time.Minute
+
+// ProblemKind classifies a Problem.
+type ProblemKind int
+
+const (
+	// ProblemBadName is a file whose name does not encode a service and
+	// key, for example after a manual edit. Repair leaves it in place.
+	ProblemBadName ProblemKind = iota + 1
+
+	// ProblemCorrupt is an entry whose value cannot be decoded or
+	// decrypted. Repair moves it to the quarantine directory.
+	ProblemCorrupt
+
+	// ProblemStrayTemp is a temporary file left by an interrupted write.
+	// Repair removes it.
+	ProblemStrayTemp
+
+	// ProblemStaleIndex is an index file, kept with SetFileIndex or
+	// FileIndex, that doesn't match the secret files. Repair rebuilds it.
+	ProblemStaleIndex
+
+	// ProblemUnauthenticated is an entry of an encrypted backend in the
+	// plain base64 format, which is neither encrypted nor authenticated,
+	// so a modified value would go unnoticed. RequireIntegrity refuses to
+	// read it. Repair leaves it in place; setting it again encrypts it.
+	ProblemUnauthenticated
+)
+
+func (k ProblemKind) String() string {
+	switch k {
+	case ProblemBadName:
+		return "bad name"
+	case ProblemCorrupt:
+		return "corrupt entry"
+	case ProblemStrayTemp:
+		return "stray temporary file"
+	case ProblemStaleIndex:
+		return "stale index"
+	case ProblemUnauthenticated:
+		return "unauthenticated entry"
+	default:
+		return fmt.Sprintf("ProblemKind(%d)", int(k))
+	}
+}
+
+// Problem is an inconsistency found in a storage directory.
+type Problem struct {
+	Kind ProblemKind
+	Path string
+
+	// Service and Key identify a corrupt entry, unless its name has
+	// several slashes and nothing tells where the service ends.
+	Service, Key string
+
+	// Err is why a corrupt entry could not be read.
+	Err error
+
+	// Repaired is set by Repair when it fixed the problem.
+	Repaired bool
+}
+
+func (p Problem) String() string {
+	s := p.Kind.String() + ": " + p.Path
+	if p.Err != nil {
+		s += ": " + p.Err.Error()
+	}
+	if p.Repaired {
+		s += " (repaired)"
+	}
+	return s
+}
+
+// verifier is implemented by backends that can check their storage.
+type verifier interface {
+	verify(ctx context.Context, repair bool) ([]Problem, error)
+}
+
+// Verify scans the storage of the file-based backends (the Linux fallback,
+// iOS, Android and NewEncryptedFileBackend, when set as the default
+// backend) and reports every file with an undecodable name, every entry
+// whose value cannot be decoded or decrypted, every temporary file left
+// by an interrupted write, and the entries of an encrypted backend that
+// are not authenticated. It changes nothing. Other backends return
+// an error wrapping errors.ErrUnsupported.
+func Verify() ([]Problem, error) {
+	return verifyDefault(false)
+}
+
+// Repair is like Verify but also removes stray temporary files and moves
+// corrupt entries into a .vault-quarantine subdirectory of the storage
+// directory, where they can be inspected. Files with bad names are only
+// reported. Problems that were fixed have Repaired set.
+func Repair() ([]Problem, error) {
+	// Repair moves entries away behind the package's back
+	defer invalidateGetCache()
+	return verifyDefault(true)
+}
+
+func verifyDefault(repair bool) ([]Problem, error) {
+	v, ok := currentBackend().(verifier)
+	if !ok {
+		return nil, errNoFileStorage
+	}
+	return v.verify(context.Background(), repair)
+}
+
+func (s *fileStore) verify(ctx context.Context, repair bool) ([]Problem, error) {
+	dir, sharded, err := s.layout()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to read storage directory: %w", err)
+	}
+	var names map[string]namedFile
+	if s.names != nil {
+		if names, err = s.names.names(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []Problem
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return problems, err
+		}
+		path := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.Name() == keyHeaderName || entry.Name() == quarantineDir || entry.Name() == lockName || entry.Name() == indexName ||
+			entry.Name() == namesIndexName || entry.Name() == namesLockName:
+		case sharded && entry.IsDir():
+			service, err := base64.URLEncoding.DecodeString(entry.Name())
+			if err != nil || len(service) == 0 {
+				problems = append(problems, Problem{Kind: ProblemBadName, Path: path})
+				continue
+			}
+			shard, err := s.verifyShard(ctx, dir, path, string(service), repair)
+			problems = append(problems, shard...)
+			if err != nil {
+				return problems, err
+			}
+		case entry.Type().IsRegular():
+			problems = append(problems, s.verifyFile(ctx, dir, dir, entry, sharded, "", names, repair)...)
+		}
+	}
+	// Last, so that the index reflects the entries Repair quarantined
+	p, err := s.verifyIndex(dir, sharded, repair)
+	if p != nil {
+		problems = append(problems, *p)
+	}
+	return problems, err
+}
+
+// verifyShard checks the files of the shard of service, dir, in the storage
+// directory root.
+func (s *fileStore) verifyShard(ctx context.Context, root, dir, service string, repair bool) ([]Problem, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("vault: failed to read storage directory: %w", err)
+	}
+	var problems []Problem
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			problems = append(problems, s.verifyFile(ctx, root, dir, entry, false, service, nil, repair)...)
+		}
+	}
+	return problems, nil
+}
+
+// verifyFile checks one file of dir, which is the storage directory root or
+// one of its shards. Files of a shard have service set and are named after
+// their key; files at the top of a flat directory are named after
+// "service/key", or with HashNames after its hash, which names maps to the
+// service and key. In a sharded directory, secret files only live in
+// shards.
+func (s *fileStore) verifyFile(ctx context.Context, root, dir string, entry os.DirEntry, sharded bool, service string, names map[string]namedFile, repair bool) []Problem {
+	path := filepath.Join(dir, entry.Name())
+
+	if strings.HasPrefix(entry.Name(), ".vault-tmp-") {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < staleTempAge {
+			return nil
+		}
+		p := Problem{Kind: ProblemStrayTemp, Path: path}
+		if repair {
+			p.Repaired = os.Remove(path) == nil
+		}
+		return []Problem{p}
+	}
+
+	var key string
+	ambiguous := false
+	name, err := base64.URLEncoding.DecodeString(entry.Name())
+	switch {
+	case s.names != nil:
+		// Names are only in the names index
+		named, ok := names[entry.Name()]
+		service, key, err = named.Service, named.Key, nil
+		if !ok {
+			err = errors.New("not a recorded file")
+		}
+	case service != "":
+		key = string(name)
+	default:
+		var ok bool
+		service, key, ok = s.splitName(ctx, path, string(name))
+		ambiguous = !ok
+		if sharded {
+			err = errors.New("not a secret file")
+		}
+	}
+	if err != nil || service == "" || key == "" {
+		return []Problem{{Kind: ProblemBadName, Path: path}}
+	}
+
+	// splitName found the reading of an ambiguous name under which the
+	// entry opens; if there is none, it fails under all, as under the first
+	err = s.readFile(ctx, path, service, key)
+	var p Problem
+	switch {
+	case errors.Is(err, errUnauthenticated) || err == nil && s.unauthenticated(path):
+		p = Problem{Kind: ProblemUnauthenticated, Path: path, Service: service, Key: key}
+	case err != nil:
+		p = Problem{Kind: ProblemCorrupt, Path: path, Service: service, Key: key, Err: err}
+		if repair {
+			p.Repaired = s.quarantine(root, path, service, key) == nil
+		}
+	default:
+		return nil
+	}
+	if ambiguous {
+		p.Service, p.Key = "", ""
+	}
+	return []Problem{p}
+}
+
+// unauthenticated reports whether the entry at path is a plain base64 entry
+// in the storage of an encrypted backend.
+func (s *fileStore) unauthenticated(path string) bool {
+	if _, ok := s.codec.(*encryptedCodec); !ok {
+		return false
+	}
+	data, err := readSecretFile(path)
+	if err != nil {
+		return false
+	}
+	data = bytes.TrimSpace(data)
+	return !isEncrypted(data) && !bytes.HasPrefix(data, []byte(integrityPrefix))
+}
+
+// quarantine moves the entry at path, for service and key, into the
+// quarantine directory of root, named as in the flat layout, or keeping
+// its hashed name with HashNames.
+func (s *fileStore) quarantine(root, path, service, key string) error {
+	qdir := filepath.Join(root, quarantineDir)
+	if err := os.MkdirAll(qdir, 0o700); err != nil {
+		return err
+	}
+	name := fileName(service + "/" + key)
+	if s.names != nil {
+		name = filepath.Base(path)
+	}
+	return os.Rename(path, filepath.Join(qdir, name))
+}
+
+// readFile decodes the value of service and key stored at path, discarding
+// it.
+func (s *fileStore) readFile(ctx context.Context, path, service, key string) error {
+	f, err := openSecretFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	codec := s.codecFor(service, key)
+	if sc, ok := asStreamCodec(codec); ok {
+		_, err = io.Copy(io.Discard, &ctxReader{ctx: ctx, r: sc.NewDecoder(f)})
+		return err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	_, err = codec.Decode(data)
+	return err
+}
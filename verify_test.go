@@ -0,0 +1,97 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestVerifyRepair(t *testing.T) {
+	for _, sharded := range []bool{false, true} {
+		ctx := context.Background()
+		s, dir := newTestFileStore(t)
+		s.setSharded(sharded)
+
+		if err := s.set(ctx, "svc", "good", []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.set(ctx, "svc", "bad", []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+		corrupt := secretFile(dir, "svc", "bad")
+		if sharded {
+			corrupt = shardFile(dir, "svc", "bad")
+		}
+		if err := os.WriteFile(corrupt, []byte("not base64!"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		badName := filepath.Join(dir, "notes.txt")
+		if err := os.WriteFile(badName, []byte("hello"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		staleTemp := filepath.Join(filepath.Dir(corrupt), ".vault-tmp-1")
+		freshTemp := filepath.Join(filepath.Dir(corrupt), ".vault-tmp-2")
+		for _, path := range []string{staleTemp, freshTemp} {
+			if err := os.WriteFile(path, []byte("partial"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		old := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(staleTemp, old, old); err != nil {
+			t.Fatal(err)
+		}
+
+		problems, err := s.verify(ctx, false)
+		if err != nil {
+			t.Fatalf("sharded=%v: verify failed: %v", sharded, err)
+		}
+		want := map[ProblemKind]string{
+			ProblemBadName:   badName,
+			ProblemCorrupt:   corrupt,
+			ProblemStrayTemp: staleTemp,
+		}
+		if len(problems) != len(want) {
+			t.Fatalf("sharded=%v: verify found %v, want %d problems", sharded, problems, len(want))
+		}
+		for _, p := range problems {
+			if want[p.Kind] != p.Path || p.Repaired {
+				t.Errorf("sharded=%v: unexpected problem %v", sharded, p)
+			}
+		}
+
+		problems, err = s.verify(ctx, true)
+		if err != nil {
+			t.Fatalf("sharded=%v: repair failed: %v", sharded, err)
+		}
+		for _, p := range problems {
+			if p.Repaired != (p.Kind != ProblemBadName) {
+				t.Errorf("sharded=%v: problem %v has Repaired = %v", sharded, p, p.Repaired)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, quarantineDir, fileName("svc/bad"))); err != nil {
+			t.Errorf("sharded=%v: corrupt entry not quarantined: %v", sharded, err)
+		}
+		if _, err := os.Stat(freshTemp); err != nil {
+			t.Errorf("sharded=%v: fresh temporary file was removed: %v", sharded, err)
+		}
+		if keys, err := s.list(ctx, "svc"); err != nil || !slices.Equal(keys, []string{"good"}) {
+			t.Errorf("sharded=%v: list after repair = %q, %v, want [good]", sharded, keys, err)
+		}
+
+		problems, err = s.verify(ctx, false)
+		if err != nil || len(problems) != 1 || problems[0].Kind != ProblemBadName {
+			t.Errorf("sharded=%v: verify after repair = %v, %v, want only the bad name", sharded, problems, err)
+		}
+	}
+}
+
+func TestVerifyUnsupported(t *testing.T) {
+	useMemory(t)
+	if _, err := Verify(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Verify with memory backend: expected ErrUnsupported, got %v", err)
+	}
+}